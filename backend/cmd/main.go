@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,9 +16,20 @@ import (
 	"github.com/joho/godotenv"
 	"gorm.io/gorm"
 
+	"paytm/internal/analytics"
+	"paytm/internal/card"
 	"paytm/internal/db"
+	"paytm/internal/ledger"
 	"paytm/internal/models"
+	"paytm/internal/notification"
+	"paytm/internal/outbox"
 	"paytm/internal/routes"
+	"paytm/internal/scheduler"
+	"paytm/internal/stream"
+	"paytm/internal/transaction"
+	"paytm/internal/vault"
+	"paytm/internal/webhook"
+	"paytm/internal/worker"
 )
 
 func main() {
@@ -39,9 +51,51 @@ func main() {
 		log.Println("Database migrations completed successfully")
 	}
 
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	transferScheduler := worker.NewWorker("Scheduled transfers", getSchedulerInterval(),
+		scheduler.NewScheduler(database).RunDue)
+	transferScheduler.Start(workerCtx)
+
+	broker := stream.NewBrokerFromEnv(database)
+	go func() {
+		if err := broker.Run(workerCtx); err != nil {
+			log.Printf("❌ Stream broker stopped: %v", err)
+		}
+	}()
+
+	publishers := outbox.MultiPublisher{webhook.NewPublisher(database), notification.NewPublisher(database), broker}
+	if os.Getenv("OUTBOX_LOG_EVENTS") == "true" {
+		publishers = append(publishers, outbox.NewLogPublisher())
+	}
+	outboxRelay := worker.NewWorker("Outbox relay", getOutboxInterval(),
+		outbox.NewRelay(database, publishers).RunDue)
+	outboxRelay.Start(workerCtx)
+
+	webhookDeliverer := worker.NewWorker("Webhook deliveries", getWebhookInterval(),
+		webhook.NewDeliverer(database, nil).RunDue)
+	webhookDeliverer.Start(workerCtx)
+
+	analyticsSummarizer := worker.NewWorker("Analytics summaries", getAnalyticsInterval(),
+		analytics.NewSummarizer(database).RunDue)
+	analyticsSummarizer.Start(workerCtx)
+
+	cardExpiry := worker.NewWorker("Card expiry", getCardExpiryInterval(),
+		card.NewExpiryMonitor(database).RunDue)
+	cardExpiry.Start(workerCtx)
+
+	keyRotator := worker.NewWorker("Card vault re-encryption", getKeyRotationInterval(),
+		vault.NewRotator(database).RunDue)
+	keyRotator.Start(workerCtx)
+
+	topUpReconciler := worker.NewWorker("Card top-up reconciliation", getTopUpReconcileInterval(),
+		transaction.NewTopUpReconciler(database).RunDue)
+	topUpReconciler.Start(workerCtx)
+
 	r := chi.NewRouter()
 
-	if err := routes.RegisterEnhancedRoutes(r, database); err != nil {
+	if err := routes.RegisterEnhancedRoutes(r, database, broker); err != nil {
 		log.Fatalf("failed to register enhanced routes: %v", err)
 	}
 
@@ -54,6 +108,8 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	server.RegisterOnShutdown(broker.Shutdown)
+
 	go func() {
 		fmt.Printf("Server listening on http://localhost:%s\n", port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -70,10 +126,20 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// The workers are stopped even if requests outlast the timeout, so
+	// none is cut off mid-run.
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("❌ Server forced to shutdown: %v", err)
 	}
 
+	transferScheduler.Stop()
+	outboxRelay.Stop()
+	webhookDeliverer.Stop()
+	analyticsSummarizer.Stop()
+	cardExpiry.Stop()
+	keyRotator.Stop()
+	topUpReconciler.Stop()
+
 	log.Println("Server gracefully stopped")
 }
 
@@ -103,11 +169,46 @@ func shouldRunMigrations() bool {
 }
 
 func runMigrations(database *gorm.DB) error {
-	return database.AutoMigrate(
+	if err := database.AutoMigrate(
 		&models.User{},
 		&models.Card{},
 		&models.Transaction{},
-	)
+		&models.TransactionStatusChange{},
+		&models.LedgerAccount{},
+		&models.JournalEntry{},
+		&models.Posting{},
+		&models.IdempotencyKey{},
+		&models.PaymentRequest{},
+		&models.ScheduledTransfer{},
+		&models.ScheduledTransferRun{},
+		&models.ExpenseGroup{},
+		&models.ExpenseGroupMember{},
+		&models.Expense{},
+		&models.ExpenseShare{},
+		&models.GroupSettlement{},
+		&models.RiskAssessment{},
+		&models.RiskRuleHit{},
+		&models.OutboxEvent{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
+		&models.Notification{},
+		&models.AccountStatement{},
+		&models.AnalyticsBucket{},
+		&models.AnalyticsCheckpoint{},
+		&models.Category{},
+		&models.TransactionAnnotation{},
+		&models.TransactionTag{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.VaultEntry{},
+	); err != nil {
+		return err
+	}
+	if err := ledger.MigrateCurrencies(database); err != nil {
+		return err
+	}
+	return vault.MigrateCardTokens(database)
 }
 
 func getPort() string {
@@ -117,3 +218,52 @@ func getPort() string {
 	}
 	return port
 }
+
+func getSchedulerInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("SCHEDULER_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 30 * time.Second
+}
+
+func getOutboxInterval() time.Duration {
+	if millis, err := strconv.Atoi(os.Getenv("OUTBOX_INTERVAL_MS")); err == nil && millis > 0 {
+		return time.Duration(millis) * time.Millisecond
+	}
+	return time.Second
+}
+
+func getWebhookInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("WEBHOOK_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 10 * time.Second
+}
+
+func getAnalyticsInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("ANALYTICS_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Minute
+}
+
+func getCardExpiryInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("CARD_EXPIRY_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Hour
+}
+
+func getKeyRotationInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("KEY_ROTATION_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Hour
+}
+
+func getTopUpReconcileInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("TOPUP_RECONCILE_INTERVAL")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Minute
+}
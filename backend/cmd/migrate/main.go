@@ -6,7 +6,9 @@ import (
 	"path/filepath"
 
 	"paytm/internal/db"
+	"paytm/internal/ledger"
 	"paytm/internal/models"
+	"paytm/internal/vault"
 
 	"github.com/joho/godotenv"
 )
@@ -28,10 +30,47 @@ func main() {
 		&models.User{},
 		&models.Card{},
 		&models.Transaction{},
+		&models.TransactionStatusChange{},
+		&models.LedgerAccount{},
+		&models.JournalEntry{},
+		&models.Posting{},
+		&models.IdempotencyKey{},
+		&models.PaymentRequest{},
+		&models.ScheduledTransfer{},
+		&models.ScheduledTransferRun{},
+		&models.ExpenseGroup{},
+		&models.ExpenseGroupMember{},
+		&models.Expense{},
+		&models.ExpenseShare{},
+		&models.GroupSettlement{},
+		&models.RiskAssessment{},
+		&models.RiskRuleHit{},
+		&models.OutboxEvent{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
+		&models.Notification{},
+		&models.AccountStatement{},
+		&models.AnalyticsBucket{},
+		&models.AnalyticsCheckpoint{},
+		&models.Category{},
+		&models.TransactionAnnotation{},
+		&models.TransactionTag{},
+		&models.Budget{},
+		&models.BudgetAlert{},
+		&models.VaultEntry{},
 	)
 	if err != nil {
 		log.Fatalf("failed to run migrations: %v", err)
 	}
 
+	if err := ledger.MigrateCurrencies(database); err != nil {
+		log.Fatalf("failed to migrate ledger currencies: %v", err)
+	}
+
+	if err := vault.MigrateCardTokens(database); err != nil {
+		log.Fatalf("failed to move card numbers into the card vault: %v", err)
+	}
+
 	log.Println("Database migrations completed successfully!")
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"paytm/internal/db"
+	"paytm/internal/statement"
+
+	"github.com/joho/godotenv"
+)
+
+// Generates the monthly statements of every user, for example from a cron
+// job on the first of the month:
+//
+//	go run ./cmd/statements -month 2025-01
+func main() {
+	month := flag.String("month", statement.PreviousPeriod(time.Now()), "month to issue statements for, as YYYY-MM")
+	regenerate := flag.Bool("regenerate", false, "replace statements that were already issued")
+	flag.Parse()
+
+	err := godotenv.Load(filepath.Join("..", "..", ".env"))
+	if err != nil {
+		log.Printf("Warning: Error loading .env file: %v", err)
+	}
+
+	database, err := db.InitDB(os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer db.CloseDB(database)
+
+	log.Printf("Generating statements for %s...", *month)
+	result, err := statement.GenerateAll(database, *month, *regenerate)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	log.Printf("Statements for %s: %d generated, %d already issued, %d failed",
+		*month, result.Generated, result.Existing, result.Failed)
+	if result.Failed > 0 {
+		os.Exit(1)
+	}
+}
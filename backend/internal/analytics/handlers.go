@@ -0,0 +1,451 @@
+package analytics
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/export"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+// Query is the window and scope of an analytics request. Dates given as
+// YYYY-MM-DD are midnights in the requested time zone; buckets are 15
+// minutes wide, so other times are effectively rounded down to a bucket.
+type Query struct {
+	UserID   uint
+	Location *time.Location
+	From     time.Time
+	To       time.Time
+	Currency string
+}
+
+type PeriodTotals struct {
+	Period      string `json:"period"`
+	Currency    string `json:"currency"`
+	In          int64  `json:"in"`
+	Out         int64  `json:"out"`
+	TopUps      int64  `json:"top_ups"`
+	Fees        int64  `json:"fees"`
+	CountIn     int64  `json:"count_in"`
+	CountOut    int64  `json:"count_out"`
+	CountTopUps int64  `json:"count_top_ups"`
+}
+
+type SummaryResponse struct {
+	Interval string         `json:"interval"`
+	TimeZone string         `json:"time_zone"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	AsOf     *time.Time     `json:"as_of"`
+	Periods  []PeriodTotals `json:"periods"`
+	Totals   []PeriodTotals `json:"totals"`
+}
+
+type CounterpartyTotals struct {
+	UserID   uint   `json:"user_id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+	Count    int64  `json:"count"`
+}
+
+type FeeTotals struct {
+	PaymentMethod string `json:"payment_method"`
+	Currency      string `json:"currency"`
+	Fees          int64  `json:"fees"`
+	Amount        int64  `json:"amount"`
+	Count         int64  `json:"count"`
+}
+
+type CardTotals struct {
+	CardID       uint   `json:"card_id"`
+	MaskedNumber string `json:"masked_number"`
+	CardType     string `json:"card_type"`
+	Currency     string `json:"currency"`
+	Amount       int64  `json:"amount"`
+	Fees         int64  `json:"fees"`
+	Count        int64  `json:"count"`
+}
+
+// parseQuery reads tz, from, to and currency. Without from and to the
+// window is the last defaultDays days, ending at the start of tomorrow in
+// the requested time zone.
+func parseQuery(w http.ResponseWriter, r *http.Request, defaultDays int) (*Query, bool) {
+	currentUser, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	q := r.URL.Query()
+
+	location := time.UTC
+	if tz := q.Get("tz"); tz != "" {
+		loaded, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			http.Error(w, "tz must be an IANA time zone such as Europe/Berlin", http.StatusBadRequest)
+			return nil, false
+		}
+		location = loaded
+	}
+
+	parse := func(name string) (time.Time, bool, error) {
+		value := q.Get(name)
+		if value == "" {
+			return time.Time{}, false, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, true, nil
+		}
+		t, err := time.ParseInLocation("2006-01-02", value, location)
+		return t, true, err
+	}
+
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+	if t, set, err := parse("to"); err != nil {
+		http.Error(w, "to must be an RFC 3339 timestamp or YYYY-MM-DD date", http.StatusBadRequest)
+		return nil, false
+	} else if set {
+		to = t
+	}
+	from := to.AddDate(0, 0, -defaultDays)
+	if t, set, err := parse("from"); err != nil {
+		http.Error(w, "from must be an RFC 3339 timestamp or YYYY-MM-DD date", http.StatusBadRequest)
+		return nil, false
+	} else if set {
+		from = t
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return nil, false
+	}
+	if to.Sub(from) > 3*366*24*time.Hour {
+		http.Error(w, "The range can span at most three years", http.StatusBadRequest)
+		return nil, false
+	}
+
+	query := &Query{UserID: currentUser.ID, Location: location, From: from, To: to}
+	if raw := q.Get("currency"); raw != "" {
+		code, err := currency.Normalize(raw)
+		if err != nil {
+			http.Error(w, "currency must be an ISO 4217 code", http.StatusBadRequest)
+			return nil, false
+		}
+		query.Currency = code
+	}
+	return query, true
+}
+
+// buckets scopes a query to the user's buckets in the window.
+func (q *Query) buckets(db *gorm.DB) *gorm.DB {
+	scope := db.Table("analytics_buckets").
+		Where("analytics_buckets.user_id = ? AND analytics_buckets.bucket_start >= ? AND analytics_buckets.bucket_start < ?",
+			q.UserID, q.From, q.To)
+	if q.Currency != "" {
+		scope = scope.Where("analytics_buckets.currency = ?", q.Currency)
+	}
+	return scope
+}
+
+func limitParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limit := 10
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 100 {
+			http.Error(w, "Limit must be between 1 and 100", http.StatusBadRequest)
+			return 0, false
+		}
+		limit = parsed
+	}
+	return limit, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// GetSummaryHandler returns money in, out, top-ups and fees per day, week
+// (starting Monday) or month of the requested time zone, per currency.
+func GetSummaryHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		interval := r.URL.Query().Get("interval")
+		if interval == "" {
+			interval = "day"
+		}
+		defaultDays := map[string]int{"day": 30, "week": 84, "month": 365}[interval]
+		if defaultDays == 0 {
+			http.Error(w, "interval must be day, week or month", http.StatusBadRequest)
+			return
+		}
+		query, ok := parseQuery(w, r, defaultDays)
+		if !ok {
+			return
+		}
+
+		var rows []struct {
+			Period    time.Time
+			Currency  string
+			Direction models.AnalyticsDirection
+			Count     int64
+			Amount    int64
+			Fee       int64
+		}
+		if err := query.buckets(db).
+			Select("date_trunc(?, bucket_start AT TIME ZONE ?) AS period, currency, direction, "+
+				"SUM(count) AS count, SUM(amount) AS amount, SUM(fee) AS fee", interval, query.Location.String()).
+			Group("period, currency, direction").
+			Order("period, currency").
+			Scan(&rows).Error; err != nil {
+			log.Printf("Error fetching analytics summary for user %d: %v", query.UserID, err)
+			http.Error(w, "Error fetching analytics", http.StatusInternalServerError)
+			return
+		}
+
+		response := SummaryResponse{
+			Interval: interval,
+			TimeZone: query.Location.String(),
+			From:     query.From,
+			To:       query.To,
+			Periods:  []PeriodTotals{},
+			Totals:   []PeriodTotals{},
+		}
+		if asOf, err := Watermark(db); err == nil && !asOf.IsZero() {
+			response.AsOf = &asOf
+		}
+
+		periods := map[string]int{}
+		totals := map[string]int{}
+		for _, row := range rows {
+			label := row.Period.Format("2006-01-02")
+			if interval == "month" {
+				label = row.Period.Format("2006-01")
+			}
+			key := label + "/" + row.Currency
+			if _, ok := periods[key]; !ok {
+				periods[key] = len(response.Periods)
+				response.Periods = append(response.Periods, PeriodTotals{Period: label, Currency: row.Currency})
+			}
+			if _, ok := totals[row.Currency]; !ok {
+				totals[row.Currency] = len(response.Totals)
+				response.Totals = append(response.Totals, PeriodTotals{Period: "total", Currency: row.Currency})
+			}
+			for _, t := range []*PeriodTotals{&response.Periods[periods[key]], &response.Totals[totals[row.Currency]]} {
+				switch row.Direction {
+				case models.AnalyticsIn:
+					t.In += row.Amount
+					t.CountIn += row.Count
+				case models.AnalyticsOut:
+					t.Out += row.Amount
+					t.CountOut += row.Count
+				case models.AnalyticsTopUp:
+					t.TopUps += row.Amount
+					t.CountTopUps += row.Count
+				}
+				t.Fees += row.Fee
+			}
+		}
+
+		writeJSON(w, response)
+	}
+}
+
+// GetCounterpartiesHandler ranks the users the user sent the most money to,
+// or with direction=in, received the most from.
+func GetCounterpartiesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := parseQuery(w, r, 30)
+		if !ok {
+			return
+		}
+		limit, ok := limitParam(w, r)
+		if !ok {
+			return
+		}
+		direction := models.AnalyticsOut
+		switch r.URL.Query().Get("direction") {
+		case "", "out":
+		case "in":
+			direction = models.AnalyticsIn
+		default:
+			http.Error(w, "direction must be in or out", http.StatusBadRequest)
+			return
+		}
+
+		var rows []CounterpartyTotals
+		if err := query.buckets(db).
+			Select("counterparty_id AS user_id, currency, SUM(amount) AS amount, SUM(count) AS count").
+			Where("direction = ?", direction).
+			Group("counterparty_id, currency").
+			Order("amount DESC, count DESC").
+			Limit(limit).
+			Scan(&rows).Error; err != nil {
+			log.Printf("Error fetching counterparties for user %d: %v", query.UserID, err)
+			http.Error(w, "Error fetching analytics", http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]uint, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.UserID)
+		}
+		var users []models.User
+		if len(ids) > 0 {
+			if err := db.Unscoped().Select("id", "name").Where("id IN ?", ids).Find(&users).Error; err != nil {
+				http.Error(w, "Error fetching analytics", http.StatusInternalServerError)
+				return
+			}
+		}
+		names := map[uint]string{}
+		for _, user := range users {
+			names[user.ID] = user.Name
+		}
+		for i := range rows {
+			rows[i].Name = names[rows[i].UserID]
+		}
+		if rows == nil {
+			rows = []CounterpartyTotals{}
+		}
+
+		writeJSON(w, map[string]interface{}{"direction": direction, "counterparties": rows})
+	}
+}
+
+// GetFeesHandler returns the fees the user paid, per payment method.
+func GetFeesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := parseQuery(w, r, 30)
+		if !ok {
+			return
+		}
+
+		rows := []FeeTotals{}
+		if err := query.buckets(db).
+			Select("payment_method, currency, SUM(fee) AS fees, SUM(amount) AS amount, SUM(count) AS count").
+			Where("direction IN ?", []models.AnalyticsDirection{models.AnalyticsOut, models.AnalyticsTopUp}).
+			Group("payment_method, currency").
+			Order("fees DESC, payment_method").
+			Scan(&rows).Error; err != nil {
+			log.Printf("Error fetching fees for user %d: %v", query.UserID, err)
+			http.Error(w, "Error fetching analytics", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string][]FeeTotals{"fees": rows})
+	}
+}
+
+// GetCardsHandler returns how much the user topped up from each card.
+func GetCardsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := parseQuery(w, r, 30)
+		if !ok {
+			return
+		}
+
+		rows := []CardTotals{}
+		if err := query.buckets(db).
+			Select("analytics_buckets.card_id, cards.masked_number, cards.card_type, analytics_buckets.currency, "+
+				"SUM(analytics_buckets.amount) AS amount, SUM(analytics_buckets.fee) AS fees, SUM(analytics_buckets.count) AS count").
+			Joins("LEFT JOIN cards ON cards.id = analytics_buckets.card_id").
+			Where("analytics_buckets.direction = ? AND analytics_buckets.card_id <> 0", models.AnalyticsTopUp).
+			Group("analytics_buckets.card_id, cards.masked_number, cards.card_type, analytics_buckets.currency").
+			Order("amount DESC").
+			Scan(&rows).Error; err != nil {
+			log.Printf("Error fetching card analytics for user %d: %v", query.UserID, err)
+			http.Error(w, "Error fetching analytics", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string][]CardTotals{"cards": rows})
+	}
+}
+
+type CategoryTotals struct {
+	CategoryID uint   `json:"category_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Color      string `json:"color,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Currency   string `json:"currency"`
+	Amount     int64  `json:"amount"`
+	Count      int64  `json:"count"`
+}
+
+// GetCategoriesHandler returns the money the user sent, or with
+// direction=in received, per category they chose or, with group=tag, per
+// tag. Annotations change at any time, so this reads transactions directly
+// rather than the buckets. A transaction with several tags counts towards
+// each of them; uncategorized transactions are reported with category_id 0.
+func GetCategoriesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, ok := parseQuery(w, r, 30)
+		if !ok {
+			return
+		}
+		group := r.URL.Query().Get("group")
+		if group == "" {
+			group = "category"
+		}
+		if group != "category" && group != "tag" {
+			http.Error(w, "group must be category or tag", http.StatusBadRequest)
+			return
+		}
+
+		direction := models.AnalyticsOut
+		side, amount, currencyColumn := "transactions.sender_id = ? AND transactions.receiver_id <> ?",
+			"transactions.amount", "transactions.currency"
+		switch r.URL.Query().Get("direction") {
+		case "", "out":
+		case "in":
+			direction = models.AnalyticsIn
+			side, amount, currencyColumn = "transactions.receiver_id = ? AND transactions.sender_id <> ?",
+				"transactions.received_amount", "transactions.received_currency"
+		default:
+			http.Error(w, "direction must be in or out", http.StatusBadRequest)
+			return
+		}
+
+		scope := db.Table("transactions").
+			Where("transactions.deleted_at IS NULL AND transactions.status IN ?", export.PostedStatuses).
+			Where(side, query.UserID, query.UserID).
+			Where("transactions.timestamp >= ? AND transactions.timestamp < ?", query.From, query.To)
+		if query.Currency != "" {
+			scope = scope.Where(currencyColumn+" = ?", query.Currency)
+		}
+
+		rows := []CategoryTotals{}
+		if group == "tag" {
+			scope = scope.
+				Select("transaction_tags.tag, "+currencyColumn+" AS currency, SUM("+amount+") AS amount, COUNT(*) AS count").
+				Joins("JOIN transaction_tags ON transaction_tags.transaction_id = transactions.id AND transaction_tags.user_id = ?", query.UserID).
+				Group("transaction_tags.tag, " + currencyColumn)
+		} else {
+			scope = scope.
+				Select("COALESCE(categories.id, 0) AS category_id, COALESCE(categories.name, '') AS name, "+
+					"COALESCE(categories.color, '') AS color, "+
+					currencyColumn+" AS currency, SUM("+amount+") AS amount, COUNT(*) AS count").
+				Joins("LEFT JOIN transaction_annotations ON transaction_annotations.transaction_id = transactions.id AND transaction_annotations.user_id = ?", query.UserID).
+				Joins("LEFT JOIN categories ON categories.id = transaction_annotations.category_id").
+				Group("categories.id, categories.name, categories.color, " + currencyColumn)
+		}
+		if err := scope.Order("amount DESC, count DESC").Scan(&rows).Error; err != nil {
+			log.Printf("Error fetching category analytics for user %d: %v", query.UserID, err)
+			http.Error(w, "Error fetching analytics", http.StatusInternalServerError)
+			return
+		}
+		for i := range rows {
+			if group == "category" && rows[i].CategoryID == 0 {
+				rows[i].Name = "Uncategorized"
+			}
+		}
+
+		writeJSON(w, map[string]interface{}{"group": group, "direction": direction, "totals": rows})
+	}
+}
@@ -0,0 +1,163 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/export"
+	"paytm/internal/models"
+)
+
+const (
+	checkpointName = "transactions"
+
+	// overlap is how far before the watermark each run looks again, so a
+	// transaction whose status change committed late is still picked up.
+	// Buckets are recomputed from scratch, so seeing a change twice is
+	// harmless.
+	overlap = 5 * time.Minute
+
+	summarizerLockKey = 0x616e616c79
+)
+
+// factsQuery lists every posted transaction once per user it concerns,
+// from that user's point of view. partyFilter, when set, further restricts
+// each side; %[1]s in it stands for the column of the user on that side.
+func factsQuery(partyFilter string) string {
+	side := func(column string) string {
+		if partyFilter == "" {
+			return ""
+		}
+		return " AND " + fmt.Sprintf(partyFilter, column)
+	}
+	return `
+		SELECT sender_id AS user_id, timestamp, currency,
+			CASE WHEN sender_id = receiver_id THEN 'top_up' ELSE 'out' END AS direction,
+			CASE WHEN sender_id = receiver_id THEN 0 ELSE receiver_id END AS counterparty_id,
+			COALESCE(payment_method, '') AS payment_method, COALESCE(card_id, 0) AS card_id,
+			amount, COALESCE(fee, 0) AS fee
+		FROM transactions
+		WHERE deleted_at IS NULL AND status IN @posted` + side("transactions.sender_id") + `
+		UNION ALL
+		SELECT receiver_id, timestamp, received_currency, 'in', sender_id,
+			COALESCE(payment_method, ''), COALESCE(card_id, 0), received_amount, 0
+		FROM transactions
+		WHERE deleted_at IS NULL AND status IN @posted AND sender_id <> receiver_id` + side("transactions.receiver_id")
+}
+
+// bucketExpr is the start of the 15-minute bucket a transaction falls in.
+const bucketExpr = "to_timestamp(floor(extract(epoch from timestamp) / 900) * 900)"
+
+// insertBuckets sums the facts selected by partyFilter into buckets.
+func insertBuckets(partyFilter string) string {
+	return `
+		INSERT INTO analytics_buckets (user_id, bucket_start, currency, direction, counterparty_id,
+			payment_method, card_id, count, amount, fee)
+		SELECT user_id, ` + bucketExpr + `, currency, direction, counterparty_id, payment_method, card_id,
+			COUNT(*), SUM(amount), SUM(fee)
+		FROM (` + factsQuery(partyFilter) + `) AS facts
+		GROUP BY user_id, ` + bucketExpr + `, currency, direction, counterparty_id, payment_method, card_id`
+}
+
+// Summarizer keeps the analytics buckets in step with transactions. The
+// first run builds them from every transaction; after that each run
+// recomputes only the buckets touched by status changes since the last.
+type Summarizer struct {
+	db *gorm.DB
+}
+
+func NewSummarizer(db *gorm.DB) *Summarizer {
+	return &Summarizer{db: db}
+}
+
+func (s *Summarizer) RunDue(ctx context.Context) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", summarizerLockKey).Scan(&locked).Error; err != nil {
+			return fmt.Errorf("failed to take summarizer lock: %w", err)
+		}
+		if !locked {
+			return nil
+		}
+
+		now := time.Now()
+		var checkpoint models.AnalyticsCheckpoint
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("name = ?", checkpointName).Limit(1).Find(&checkpoint).Error
+		if err != nil {
+			return fmt.Errorf("failed to load analytics checkpoint: %w", err)
+		}
+
+		if checkpoint.Name == "" {
+			if err := rebuild(tx); err != nil {
+				return err
+			}
+		} else if err := refresh(tx, checkpoint.Watermark.Add(-overlap)); err != nil {
+			return err
+		}
+
+		return tx.Save(&models.AnalyticsCheckpoint{Name: checkpointName, Watermark: now}).Error
+	})
+}
+
+// Watermark returns when the buckets were last brought up to date, or the
+// zero time if they have not been built yet.
+func Watermark(db *gorm.DB) (time.Time, error) {
+	var checkpoint models.AnalyticsCheckpoint
+	if err := db.Where("name = ?", checkpointName).Limit(1).Find(&checkpoint).Error; err != nil {
+		return time.Time{}, err
+	}
+	return checkpoint.Watermark, nil
+}
+
+func rebuild(tx *gorm.DB) error {
+	if err := tx.Exec("DELETE FROM analytics_buckets").Error; err != nil {
+		return fmt.Errorf("failed to clear analytics buckets: %w", err)
+	}
+	if err := tx.Exec(insertBuckets(""), map[string]interface{}{
+		"posted": export.PostedStatuses,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to build analytics buckets: %w", err)
+	}
+	return nil
+}
+
+// refresh recomputes the buckets of both parties of every transaction whose
+// status changed since the given time.
+func refresh(tx *gorm.DB, since time.Time) error {
+	// The affected (user, bucket) pairs are kept in a temporary table for
+	// the delete and the insert to join against.
+	if err := tx.Exec(`
+		CREATE TEMPORARY TABLE analytics_dirty ON COMMIT DROP AS
+		SELECT DISTINCT user_id, `+bucketExpr+` AS bucket_start
+		FROM (
+			SELECT sender_id AS user_id, timestamp FROM transactions WHERE status_changed_at >= @since
+			UNION ALL
+			SELECT receiver_id, timestamp FROM transactions WHERE status_changed_at >= @since
+		) AS changed`, map[string]interface{}{"since": since}).Error; err != nil {
+		return fmt.Errorf("failed to find changed analytics buckets: %w", err)
+	}
+
+	if err := tx.Exec(`
+		DELETE FROM analytics_buckets USING analytics_dirty
+		WHERE analytics_buckets.user_id = analytics_dirty.user_id
+			AND analytics_buckets.bucket_start = analytics_dirty.bucket_start`).Error; err != nil {
+		return fmt.Errorf("failed to clear changed analytics buckets: %w", err)
+	}
+
+	if err := tx.Exec(insertBuckets(`EXISTS (
+		SELECT 1 FROM analytics_dirty
+		WHERE analytics_dirty.user_id = %[1]s
+			AND transactions.timestamp >= analytics_dirty.bucket_start
+			AND transactions.timestamp < analytics_dirty.bucket_start + interval '15 minutes'
+	)`), map[string]interface{}{
+		"posted": export.PostedStatuses,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to recompute analytics buckets: %w", err)
+	}
+	return nil
+}
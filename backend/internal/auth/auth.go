@@ -137,6 +137,9 @@ func LoginWithEmail(db *gorm.DB) http.HandlerFunc {
 
 		user, ok := ValidateEmailPassword(db, req.User, req.Passwd)
 		if !ok {
+			if user != nil {
+				recordSignIn(db, r, user.ID, false)
+			}
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -149,6 +152,7 @@ func LoginWithEmail(db *gorm.DB) http.HandlerFunc {
 		}
 
 		SetTokenCookies(w, tokens)
+		recordSignIn(db, r, user.ID, true)
 
 		log.Printf("✅ Email login successful for user: %s (ID: %d)", user.Email, user.ID)
 
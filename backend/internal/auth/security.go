@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/events"
+	"paytm/internal/outbox"
+)
+
+// recordSignIn records a successful or failed sign-in to the user's account
+// so the user can be told about it. It never fails the request.
+func recordSignIn(db *gorm.DB, r *http.Request, userID uint, succeeded bool) {
+	t := events.SecurityLogin
+	if !succeeded {
+		t = events.SecurityLoginFailed
+	}
+
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	if err := outbox.Record(db, events.ForSecurity(t, userID, ip, r.UserAgent())); err != nil {
+		log.Printf("Error recording %s for user %d: %v", t, userID, err)
+	}
+}
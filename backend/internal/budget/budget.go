@@ -0,0 +1,180 @@
+package budget
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/events"
+	"paytm/internal/models"
+	"paytm/internal/outbox"
+)
+
+const periodLayout = "2006-01"
+
+// Thresholds are the shares of a budget, in percent, that trigger an alert.
+var Thresholds = []int{50, 80, 100}
+
+// spentStatuses are the states of a transfer whose money has left the
+// sender. Refunded amounts are subtracted, so reversals count as nothing.
+var spentStatuses = []models.TransactionStatus{
+	models.TransactionStatusCompleted,
+	models.TransactionStatusPartiallyRefunded,
+	models.TransactionStatusReversed,
+}
+
+// ParsePeriod returns the first instant of a YYYY-MM month in UTC and the
+// first instant of the next.
+func ParsePeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(periodLayout, period, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("period must be a YYYY-MM month: %w", err)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// PeriodOf is the month t falls in. Budgets roll over to a new period at
+// midnight UTC on the first of every month.
+func PeriodOf(t time.Time) string {
+	return t.UTC().Format(periodLayout)
+}
+
+// Spent is how much a budget's owner sent in its currency during the
+// period, net of refunds, to its counterparty or under its category.
+func Spent(db *gorm.DB, budget *models.Budget, period string) (int64, error) {
+	start, end, err := ParsePeriod(period)
+	if err != nil {
+		return 0, err
+	}
+
+	query := db.Model(&models.Transaction{}).
+		Select("COALESCE(SUM(transactions.amount - transactions.refunded_amount), 0)").
+		Where("transactions.sender_id = ? AND transactions.receiver_id <> ? AND transactions.type <> ?",
+			budget.UserID, budget.UserID, models.TransactionRefund).
+		Where("transactions.status IN ? AND transactions.currency = ?", spentStatuses, budget.Currency).
+		Where("transactions.timestamp >= ? AND transactions.timestamp < ?", start, end)
+	if budget.CounterpartyID != nil {
+		query = query.Where("transactions.receiver_id = ?", *budget.CounterpartyID)
+	}
+	if budget.CategoryID != nil {
+		query = query.Where("EXISTS (SELECT 1 FROM transaction_annotations WHERE transaction_annotations.transaction_id = transactions.id "+
+			"AND transaction_annotations.user_id = ? AND transaction_annotations.category_id = ?)", budget.UserID, *budget.CategoryID)
+	}
+
+	var spent int64
+	if err := query.Scan(&spent).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum spending of budget %d: %w", budget.ID, err)
+	}
+	return spent, nil
+}
+
+// Reached lists the thresholds spending has reached.
+func Reached(spent, amount int64) []int {
+	var reached []int
+	for _, threshold := range Thresholds {
+		if amount > 0 && spent*100 >= amount*int64(threshold) {
+			reached = append(reached, threshold)
+		}
+	}
+	return reached
+}
+
+// Evaluate checks the budgets a posted transfer counts towards and
+// records an alert for every threshold it pushed one of them past. It runs
+// inside the caller's transaction, so the alerts and their events only
+// exist if the transfer commits. Transfers outside the current period are
+// ignored: nobody needs to hear about last month's budget.
+func Evaluate(tx *gorm.DB, txn *models.Transaction) error {
+	if txn.SenderID == txn.ReceiverID || txn.Type == models.TransactionRefund ||
+		(txn.Status != models.TransactionStatusCompleted && txn.Status != models.TransactionStatusPartiallyRefunded) {
+		return nil
+	}
+	period := PeriodOf(txn.Timestamp)
+	if period != PeriodOf(time.Now()) {
+		return nil
+	}
+
+	// Locking the budgets makes concurrent transfers evaluate them one at a
+	// time, so the one that crosses a threshold always sees the other.
+	var budgets []models.Budget
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND currency = ?", txn.SenderID, txn.Currency).
+		Where("(counterparty_id = ? OR category_id IN (?))", txn.ReceiverID,
+			tx.Model(&models.TransactionAnnotation{}).Select("category_id").
+				Where("user_id = ? AND transaction_id = ? AND category_id IS NOT NULL", txn.SenderID, txn.ID)).
+		Order("id").
+		Find(&budgets).Error; err != nil {
+		return fmt.Errorf("failed to load budgets of user %d: %w", txn.SenderID, err)
+	}
+
+	for i := range budgets {
+		if err := evaluateBudget(tx, &budgets[i], period, &txn.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluateBudget stores the thresholds the budget has reached in the
+// period and announces the highest one that is new.
+func evaluateBudget(tx *gorm.DB, budget *models.Budget, period string, transactionID *uint) error {
+	spent, err := Spent(tx, budget, period)
+	if err != nil {
+		return err
+	}
+
+	var newest *models.BudgetAlert
+	for _, threshold := range Reached(spent, budget.Amount) {
+		alert := models.BudgetAlert{
+			BudgetID:      budget.ID,
+			Period:        period,
+			Threshold:     threshold,
+			Spent:         spent,
+			TransactionID: transactionID,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&alert)
+		if result.Error != nil {
+			return fmt.Errorf("failed to record alert for budget %d: %w", budget.ID, result.Error)
+		}
+		if result.RowsAffected == 1 {
+			newest = &alert
+		}
+	}
+
+	if newest == nil {
+		return nil
+	}
+	return outbox.Record(tx, events.ForBudget(budget, newest))
+}
+
+// Reset forgets the current period's alerts for thresholds the budget no
+// longer reaches, after its amount was raised, and alerts for those it now
+// reaches, after it was lowered.
+func Reset(tx *gorm.DB, budget *models.Budget) error {
+	period := PeriodOf(time.Now())
+	spent, err := Spent(tx, budget, period)
+	if err != nil {
+		return err
+	}
+
+	reached := Reached(spent, budget.Amount)
+	query := tx.Where("budget_id = ? AND period = ?", budget.ID, period)
+	if len(reached) > 0 {
+		query = query.Where("threshold NOT IN ?", reached)
+	}
+	if err := query.Delete(&models.BudgetAlert{}).Error; err != nil {
+		return fmt.Errorf("failed to reset alerts of budget %d: %w", budget.ID, err)
+	}
+	return evaluateBudget(tx, budget, period, nil)
+}
+
+// Recategorized re-evaluates a user's category budgets after they filed one
+// of their transfers under a category.
+func Recategorized(tx *gorm.DB, userID uint, txn *models.Transaction) error {
+	if txn.SenderID != userID {
+		return nil
+	}
+	return Evaluate(tx, txn)
+}
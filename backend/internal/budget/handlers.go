@@ -0,0 +1,394 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+type BudgetRequest struct {
+	Name           *string `json:"name"`
+	CategoryID     *uint   `json:"category_id"`
+	CounterpartyID *uint   `json:"counterparty_id"`
+	Currency       *string `json:"currency"`
+	Amount         *int64  `json:"amount"`
+}
+
+type BudgetResponse struct {
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	CategoryID     *uint     `json:"category_id,omitempty"`
+	CounterpartyID *uint     `json:"counterparty_id,omitempty"`
+	Currency       string    `json:"currency"`
+	Amount         int64     `json:"amount"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type ProgressResponse struct {
+	Budget      BudgetResponse  `json:"budget"`
+	Period      string          `json:"period"`
+	PeriodStart time.Time       `json:"period_start"`
+	PeriodEnd   time.Time       `json:"period_end"`
+	Spent       int64           `json:"spent"`
+	Remaining   int64           `json:"remaining"`
+	Percent     float64         `json:"percent"`
+	Alerts      []AlertResponse `json:"alerts"`
+}
+
+type AlertResponse struct {
+	Threshold     int       `json:"threshold"`
+	Spent         int64     `json:"spent"`
+	TransactionID *uint     `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func newBudgetResponse(b *models.Budget) BudgetResponse {
+	return BudgetResponse{
+		ID:             b.ID,
+		Name:           b.Name,
+		CategoryID:     b.CategoryID,
+		CounterpartyID: b.CounterpartyID,
+		Currency:       b.Currency,
+		Amount:         b.Amount,
+		CreatedAt:      b.CreatedAt,
+	}
+}
+
+// progress works out how far into a budget the user is in a period,
+// together with the alerts it has raised in it.
+func progress(db *gorm.DB, b *models.Budget, period string) (*ProgressResponse, error) {
+	start, end, err := ParsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	spent, err := Spent(db, b, period)
+	if err != nil {
+		return nil, err
+	}
+
+	var alerts []models.BudgetAlert
+	if err := db.Where("budget_id = ? AND period = ?", b.ID, period).Order("threshold").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+
+	response := &ProgressResponse{
+		Budget:      newBudgetResponse(b),
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Spent:       spent,
+		Remaining:   b.Amount - spent,
+		Alerts:      []AlertResponse{},
+	}
+	if response.Remaining < 0 {
+		response.Remaining = 0
+	}
+	if b.Amount > 0 {
+		response.Percent = float64(spent*10000/b.Amount) / 100
+	}
+	for _, alert := range alerts {
+		response.Alerts = append(response.Alerts, AlertResponse{
+			Threshold:     alert.Threshold,
+			Spent:         alert.Spent,
+			TransactionID: alert.TransactionID,
+			CreatedAt:     alert.CreatedAt,
+		})
+	}
+	return response, nil
+}
+
+// periodParam reads the period query parameter, defaulting to the current
+// month.
+func periodParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		return PeriodOf(time.Now()), true
+	}
+	if _, _, err := ParsePeriod(period); err != nil {
+		http.Error(w, "period must be a YYYY-MM month", http.StatusBadRequest)
+		return "", false
+	}
+	return period, true
+}
+
+func findBudget(db *gorm.DB, w http.ResponseWriter, r *http.Request, userID uint) (*models.Budget, bool) {
+	budgetID, err := strconv.ParseUint(chi.URLParam(r, "budgetID"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid budget ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var b models.Budget
+	if err := db.Where("user_id = ?", userID).First(&b, uint(budgetID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Budget not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error fetching budget", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &b, true
+}
+
+// validate checks the fields of a request that are set, and that the
+// category or counterparty they name belong to or exist for the user.
+func validate(db *gorm.DB, w http.ResponseWriter, req *BudgetRequest, userID uint) bool {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 50 {
+			http.Error(w, "Name must be 1 to 50 characters", http.StatusBadRequest)
+			return false
+		}
+		req.Name = &name
+	}
+	if req.Amount != nil && *req.Amount <= 0 {
+		http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
+		return false
+	}
+	if req.Currency != nil {
+		code, err := currency.Normalize(*req.Currency)
+		if err != nil {
+			http.Error(w, "Currency must be an ISO 4217 code", http.StatusBadRequest)
+			return false
+		}
+		req.Currency = &code
+	}
+	if req.CategoryID != nil {
+		var count int64
+		if err := db.Model(&models.Category{}).Where("id = ? AND user_id = ?", *req.CategoryID, userID).
+			Count(&count).Error; err != nil {
+			http.Error(w, "Error validating budget", http.StatusInternalServerError)
+			return false
+		}
+		if count == 0 {
+			http.Error(w, "Category not found", http.StatusBadRequest)
+			return false
+		}
+	}
+	if req.CounterpartyID != nil {
+		if *req.CounterpartyID == userID {
+			http.Error(w, "A budget cannot be for yourself", http.StatusBadRequest)
+			return false
+		}
+		var count int64
+		if err := db.Model(&models.User{}).Where("id = ?", *req.CounterpartyID).Count(&count).Error; err != nil {
+			http.Error(w, "Error validating budget", http.StatusInternalServerError)
+			return false
+		}
+		if count == 0 {
+			http.Error(w, "Counterparty not found", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// GetBudgetsHandler lists the user's budgets with their progress in the
+// current period, or in the one given as period=YYYY-MM.
+func GetBudgetsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		period, ok := periodParam(w, r)
+		if !ok {
+			return
+		}
+
+		var budgets []models.Budget
+		if err := db.Where("user_id = ?", currentUser.ID).Order("name, id").Find(&budgets).Error; err != nil {
+			http.Error(w, "Error fetching budgets", http.StatusInternalServerError)
+			return
+		}
+
+		response := []ProgressResponse{}
+		for i := range budgets {
+			p, err := progress(db, &budgets[i], period)
+			if err != nil {
+				log.Printf("Error computing progress of budget %d: %v", budgets[i].ID, err)
+				http.Error(w, "Error fetching budgets", http.StatusInternalServerError)
+				return
+			}
+			response = append(response, *p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"period": period, "budgets": response})
+	}
+}
+
+// GetBudgetProgressHandler returns one budget's progress in the current
+// period, or in the one given as period=YYYY-MM.
+func GetBudgetProgressHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		b, ok := findBudget(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+		period, ok := periodParam(w, r)
+		if !ok {
+			return
+		}
+
+		p, err := progress(db, b, period)
+		if err != nil {
+			log.Printf("Error computing progress of budget %d: %v", b.ID, err)
+			http.Error(w, "Error fetching budget", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+	}
+}
+
+// CreateBudgetHandler adds a monthly budget for either a category or a
+// counterparty. Spending already made this month counts towards it, so a
+// new budget can alert straight away.
+func CreateBudgetHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req BudgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Name == nil || req.Amount == nil {
+			http.Error(w, "Name and amount are required", http.StatusBadRequest)
+			return
+		}
+		if (req.CategoryID == nil) == (req.CounterpartyID == nil) {
+			http.Error(w, "A budget needs either a category_id or a counterparty_id", http.StatusBadRequest)
+			return
+		}
+		if !validate(db, w, &req, currentUser.ID) {
+			return
+		}
+
+		b := models.Budget{
+			UserID:         currentUser.ID,
+			Name:           *req.Name,
+			CategoryID:     req.CategoryID,
+			CounterpartyID: req.CounterpartyID,
+			Currency:       currentUser.Currency,
+			Amount:         *req.Amount,
+		}
+		if req.Currency != nil {
+			b.Currency = *req.Currency
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&b).Error; err != nil {
+				return err
+			}
+			return Reset(tx, &b)
+		}); err != nil {
+			log.Printf("Error creating budget for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating budget", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newBudgetResponse(&b))
+	}
+}
+
+// UpdateBudgetHandler renames a budget or changes its amount. What it is
+// for and its currency are fixed; create another budget to change them.
+func UpdateBudgetHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		b, ok := findBudget(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		var req BudgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.CategoryID != nil || req.CounterpartyID != nil || req.Currency != nil {
+			http.Error(w, "Only the name and amount of a budget can be changed", http.StatusBadRequest)
+			return
+		}
+		if !validate(db, w, &req, currentUser.ID) {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Amount != nil {
+			updates["amount"] = *req.Amount
+		}
+		if len(updates) > 0 {
+			if err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(b).Updates(updates).Error; err != nil {
+					return err
+				}
+				if req.Amount != nil {
+					return Reset(tx, b)
+				}
+				return nil
+			}); err != nil {
+				log.Printf("Error updating budget %d: %v", b.ID, err)
+				http.Error(w, "Error updating budget", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newBudgetResponse(b))
+	}
+}
+
+func DeleteBudgetHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		b, ok := findBudget(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(b).Error; err != nil {
+			http.Error(w, "Error deleting budget", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Budget deleted"})
+	}
+}
@@ -2,6 +2,7 @@ package card
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,14 +12,21 @@ import (
 
 	"gorm.io/gorm"
 
-	"paytm/internal/encryption"
+	"paytm/internal/currency"
+	"paytm/internal/events"
+	"paytm/internal/limits"
 	"paytm/internal/middleware"
 	"paytm/internal/models"
+	"paytm/internal/outbox"
+	"paytm/internal/processor"
+	"paytm/internal/risk"
+	"paytm/internal/transaction"
+	"paytm/internal/vault"
 )
 
 type CardService struct {
-	db         *gorm.DB
-	encryption *encryption.EncryptionService
+	db    *gorm.DB
+	vault *vault.Vault
 }
 
 type CardRequest struct {
@@ -34,9 +42,12 @@ type CardResponse struct {
 	MaskedNumber string `json:"masked_number"`
 	CardType     string `json:"card_type"`
 	HolderName   string `json:"holder_name"`
+	Nickname     string `json:"nickname,omitempty"`
 	ExpiryMonth  string `json:"expiry_month"`
 	ExpiryYear   string `json:"expiry_year"`
 	IsActive     bool   `json:"is_active"`
+	IsDefault    bool   `json:"is_default"`
+	IsExpired    bool   `json:"is_expired"`
 	CreatedAt    string `json:"created_at"`
 	LastUsedAt   string `json:"last_used_at,omitempty"`
 }
@@ -52,39 +63,37 @@ type AddMoneyResponse struct {
 	Message       string `json:"message"`
 	Amount        int64  `json:"amount"`
 	Fee           int64  `json:"fee"`
+	Currency      string `json:"currency"`
 	NewBalance    int64  `json:"new_balance"`
 	TransactionID uint   `json:"transaction_id"`
+	Status        string `json:"status"`
+
+	ProcessorReference string `json:"processor_reference,omitempty"`
 }
 
 func NewCardService(db *gorm.DB) (*CardService, error) {
-	encService, err := encryption.NewEncryptionService()
+	v, err := vault.New()
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize encryption service: %w", err)
+		return nil, err
 	}
-	return &CardService{db: db, encryption: encService}, nil
+	return &CardService{db: db, vault: v}, nil
 }
 
-func (cs *CardService) detectCardType(number string) models.CardType {
-	cleaned := regexp.MustCompile(`\D`).ReplaceAllString(number, "")
+var nonDigits = regexp.MustCompile(`\D`)
 
-	if regexp.MustCompile(`^4`).MatchString(cleaned) {
-		return models.CardTypeVISA
-	}
-	if regexp.MustCompile(`^5[1-5]|^2[2-7]`).MatchString(cleaned) {
-		return models.CardTypeMasterCard
-	}
-	if regexp.MustCompile(`^3[47]`).MatchString(cleaned) {
-		return models.CardTypeAmex
+// detectCardType looks the card number up in the BIN table. Numbers no
+// known network issues are rejected rather than guessed.
+func (cs *CardService) detectCardType(number string) (Network, error) {
+	cleaned := nonDigits.ReplaceAllString(number, "")
+	network, ok := lookupNetwork(cleaned)
+	if !ok {
+		return Network{}, fmt.Errorf("card network not supported")
 	}
-	if regexp.MustCompile(`^6011|^622(12[6-9]|1[3-9][0-9]|[2-8][0-9]{2}|9[01][0-9]|92[0-5])|^64[4-9]|^65`).MatchString(cleaned) {
-		return models.CardTypeDiscover
-	}
-
-	return models.CardTypeVISA
+	return network, nil
 }
 
 func (cs *CardService) generateMaskedNumber(cardNumber string, cardType models.CardType) string {
-	cleaned := regexp.MustCompile(`\D`).ReplaceAllString(cardNumber, "")
+	cleaned := nonDigits.ReplaceAllString(cardNumber, "")
 	if len(cleaned) < 7 {
 		return ""
 	}
@@ -95,64 +104,86 @@ func (cs *CardService) generateMaskedNumber(cardNumber string, cardType models.C
 	return fmt.Sprintf("%s%sxxxx%s", cardType, first4, last3)
 }
 
-func (cs *CardService) validateCardData(req CardRequest) error {
-	cleaned := regexp.MustCompile(`\D`).ReplaceAllString(req.CardNumber, "")
+func (cs *CardService) validateCardData(req CardRequest) (Network, error) {
+	cleaned := nonDigits.ReplaceAllString(req.CardNumber, "")
+
+	if len(cleaned) < 12 || len(cleaned) > 19 {
+		return Network{}, fmt.Errorf("card number must be between 12 and 19 digits")
+	}
 
-	if len(cleaned) < 13 || len(cleaned) > 19 {
-		return fmt.Errorf("card number must be between 13 and 19 digits")
+	if !luhnValid(cleaned) {
+		return Network{}, fmt.Errorf("card number is invalid")
+	}
+
+	network, err := cs.detectCardType(cleaned)
+	if err != nil {
+		return Network{}, err
+	}
+
+	if !network.validLength(cleaned) {
+		return Network{}, fmt.Errorf("%s card numbers cannot be %d digits long", network.Type, len(cleaned))
 	}
 
 	month, err := strconv.Atoi(req.ExpiryMonth)
 	if err != nil || month < 1 || month > 12 {
-		return fmt.Errorf("expiry month must be between 1 and 12")
+		return Network{}, fmt.Errorf("expiry month must be between 1 and 12")
 	}
 
 	year, err := strconv.Atoi(req.ExpiryYear)
 	if err != nil || year < 0 || year > 99 {
-		return fmt.Errorf("expiry year must be between 00 and 99")
+		return Network{}, fmt.Errorf("expiry year must be between 00 and 99")
+	}
+
+	if !time.Now().Before(expiryEnd(month, year)) {
+		return Network{}, fmt.Errorf("card has expired")
 	}
 
-	if len(req.CVV) < 3 || len(req.CVV) > 4 {
-		return fmt.Errorf("CVV must be 3 or 4 digits")
+	if len(req.CVV) != network.CVVLength {
+		return Network{}, fmt.Errorf("CVV must be %d digits for %s cards", network.CVVLength, network.Type)
 	}
 
 	if _, err := strconv.Atoi(req.CVV); err != nil {
-		return fmt.Errorf("CVV must contain only digits")
+		return Network{}, fmt.Errorf("CVV must contain only digits")
 	}
 
-	if len(req.HolderName) < 2 || len(req.HolderName) > 50 {
-		return fmt.Errorf("cardholder name must be between 2 and 50 characters")
+	if err := validateHolderName(req.HolderName); err != nil {
+		return Network{}, err
 	}
 
+	return network, nil
+}
+
+// validateHolderName checks a cardholder name, both when a card is added and
+// when its holder name is corrected later.
+func validateHolderName(name string) error {
+	if len(name) < 2 || len(name) > 50 {
+		return fmt.Errorf("cardholder name must be between 2 and 50 characters")
+	}
 	return nil
 }
 
 func (cs *CardService) AddCard(userID uint, req CardRequest) (*models.Card, error) {
 
-	if err := cs.validateCardData(req); err != nil {
+	network, err := cs.validateCardData(req)
+	if err != nil {
 		log.Printf("❌ Card validation failed for user %d: %v", userID, err)
 		return nil, err
 	}
 
-	cardType := cs.detectCardType(req.CardNumber)
+	cardType := network.Type
 	maskedNumber := cs.generateMaskedNumber(req.CardNumber, cardType)
 
 	var existingCard models.Card
-	err := cs.db.Where("user_id = ? AND masked_number = ? AND is_active = ?",
+	err = cs.db.Where("user_id = ? AND masked_number = ? AND is_active = ?",
 		userID, maskedNumber, true).First(&existingCard).Error
 	if err == nil {
 		return nil, fmt.Errorf("this card is already added to your account")
 	}
 
-	cardDataJSON, _ := json.Marshal(req)
-	encryptedData, err := cs.encryption.Encrypt(string(cardDataJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt card data: %w", err)
-	}
-
+	// Only the number goes into the vault. The CVV is used for the charge
+	// it came with and then forgotten.
 	card := &models.Card{
 		UserID:       userID,
-		CardToken:    encryptedData,
 		MaskedNumber: maskedNumber,
 		CardType:     cardType,
 		HolderName:   req.HolderName,
@@ -161,8 +192,25 @@ func (cs *CardService) AddCard(userID uint, req CardRequest) (*models.Card, erro
 		IsActive:     true,
 	}
 
-	if err := cs.db.Create(card).Error; err != nil {
-		return nil, fmt.Errorf("failed to save card: %w", err)
+	if err := cs.db.Transaction(func(tx *gorm.DB) error {
+		// A user's first usable card becomes their default.
+		var defaults int64
+		if err := tx.Model(&models.Card{}).Where("user_id = ? AND is_default = ?", userID, true).
+			Count(&defaults).Error; err != nil {
+			return fmt.Errorf("failed to look up default card: %w", err)
+		}
+		card.IsDefault = defaults == 0
+		token, err := cs.vault.Tokenize(tx, nonDigits.ReplaceAllString(req.CardNumber, ""))
+		if err != nil {
+			return err
+		}
+		card.CardToken = token
+		if err := tx.Create(card).Error; err != nil {
+			return fmt.Errorf("failed to save card: %w", err)
+		}
+		return outbox.Record(tx, events.ForCard(events.CardAdded, card))
+	}); err != nil {
+		return nil, err
 	}
 
 	log.Printf("✅ Card added for user %d: %s", userID, maskedNumber)
@@ -173,6 +221,28 @@ func (cs *CardService) calculateFee(amount int64) int64 {
 	return int64(float64(amount) * 0.014)
 }
 
+func newCardResponse(card *models.Card) CardResponse {
+	response := CardResponse{
+		ID:           card.ID,
+		MaskedNumber: card.MaskedNumber,
+		CardType:     string(card.CardType),
+		HolderName:   card.HolderName,
+		Nickname:     card.Nickname,
+		ExpiryMonth:  card.ExpiryMonth,
+		ExpiryYear:   card.ExpiryYear,
+		IsActive:     card.IsActive,
+		IsDefault:    card.IsDefault,
+		IsExpired:    card.ExpiredAt != nil,
+		CreatedAt:    card.CreatedAt.Format(time.RFC3339),
+	}
+	if card.LastUsedAt != nil {
+		response.LastUsedAt = card.LastUsedAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// GetCardsHandler lists the user's active cards, or with
+// include_inactive=true also the deactivated and expired ones.
 func GetCardsHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		currentUser, ok := middleware.GetUserFromContext(r)
@@ -181,32 +251,21 @@ func GetCardsHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		query := db.Where("user_id = ?", currentUser.ID)
+		if r.URL.Query().Get("include_inactive") != "true" {
+			query = query.Where("is_active = ?", true)
+		}
+
 		var cards []models.Card
-		if err := db.Where("user_id = ? AND is_active = ?", currentUser.ID, true).
-			Order("created_at DESC").Find(&cards).Error; err != nil {
+		if err := query.Order("created_at DESC").Find(&cards).Error; err != nil {
 			log.Printf("Error fetching cards for user %d: %v", currentUser.ID, err)
 			http.Error(w, "Error fetching cards", http.StatusInternalServerError)
 			return
 		}
 
-		var cardResponses []CardResponse
+		cardResponses := []CardResponse{}
 		for _, card := range cards {
-			response := CardResponse{
-				ID:           card.ID,
-				MaskedNumber: card.MaskedNumber,
-				CardType:     string(card.CardType),
-				HolderName:   card.HolderName,
-				ExpiryMonth:  card.ExpiryMonth,
-				ExpiryYear:   card.ExpiryYear,
-				IsActive:     card.IsActive,
-				CreatedAt:    card.CreatedAt.Format(time.RFC3339),
-			}
-
-			if card.LastUsedAt != nil {
-				response.LastUsedAt = card.LastUsedAt.Format(time.RFC3339)
-			}
-
-			cardResponses = append(cardResponses, response)
+			cardResponses = append(cardResponses, newCardResponse(&card))
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -242,20 +301,9 @@ func AddCardHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		response := CardResponse{
-			ID:           card.ID,
-			MaskedNumber: card.MaskedNumber,
-			CardType:     string(card.CardType),
-			HolderName:   card.HolderName,
-			ExpiryMonth:  card.ExpiryMonth,
-			ExpiryYear:   card.ExpiryYear,
-			IsActive:     card.IsActive,
-			CreatedAt:    card.CreatedAt.Format(time.RFC3339),
-		}
-
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(response)
+		json.NewEncoder(w).Encode(newCardResponse(card))
 	}
 }
 
@@ -278,16 +326,6 @@ func AddMoneyWithCardHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		if req.Amount > 100000 {
-			http.Error(w, "Amount cannot exceed 1000 per transaction", http.StatusBadRequest)
-			return
-		}
-
-		if req.CardID == nil && req.CardData == nil {
-			http.Error(w, "Either card_id or card_data must be provided", http.StatusBadRequest)
-			return
-		}
-
 		cardService, err := NewCardService(db)
 		if err != nil {
 			log.Printf("Failed to initialize card service: %v", err)
@@ -302,78 +340,214 @@ func AddMoneyWithCardHandler(db *gorm.DB) http.HandlerFunc {
 			}
 		}()
 
-		var cardID uint
+		if err := limits.CheckTopUp(tx, currentUser.ID, req.Amount, currentUser.Currency); err != nil {
+			tx.Rollback()
+			var limitErr *limits.Error
+			if errors.As(err, &limitErr) {
+				limits.WriteError(w, limitErr)
+				return
+			}
+			if errors.Is(err, currency.ErrRateUnavailable) {
+				http.Error(w, fmt.Sprintf("No exchange rate available to check limits for %s", currentUser.Currency), http.StatusUnprocessableEntity)
+				return
+			}
+			log.Printf("Error checking top-up limits for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error checking limits", http.StatusInternalServerError)
+			return
+		}
 
+		var card models.Card
+		var charge processor.Card
 		if req.CardData != nil {
-			card, err := cardService.AddCard(currentUser.ID, *req.CardData)
+			added, err := cardService.AddCard(currentUser.ID, *req.CardData)
 			if err != nil {
 				tx.Rollback()
 				log.Printf("Error adding new card for user %d: %v", currentUser.ID, err)
 				http.Error(w, fmt.Sprintf("Error adding card: %v", err), http.StatusBadRequest)
 				return
 			}
-			cardID = card.ID
+			card = *added
+			charge = newProcessorCard(*req.CardData)
 		} else {
-			var card models.Card
-			if err := tx.Where("id = ? AND user_id = ? AND is_active = ?",
-				*req.CardID, currentUser.ID, true).First(&card).Error; err != nil {
+			// Without a card_id the user's default card is charged.
+			query := tx.Where("user_id = ? AND is_active = ?", currentUser.ID, true)
+			if req.CardID != nil {
+				query = query.Where("id = ?", *req.CardID)
+			} else {
+				query = query.Where("is_default = ?", true)
+			}
+			if err := query.First(&card).Error; err != nil {
 				tx.Rollback()
-				if err == gorm.ErrRecordNotFound {
-					http.Error(w, "Card not found or inactive", http.StatusNotFound)
-				} else {
-					log.Printf("Error fetching card %d for user %d: %v", *req.CardID, currentUser.ID, err)
+				switch {
+				case err != gorm.ErrRecordNotFound:
+					log.Printf("Error fetching card for user %d: %v", currentUser.ID, err)
 					http.Error(w, "Error fetching card", http.StatusInternalServerError)
+				case req.CardID == nil:
+					http.Error(w, "Provide card_id or card_data, or set a default card", http.StatusBadRequest)
+				default:
+					http.Error(w, "Card not found or inactive", http.StatusNotFound)
 				}
 				return
 			}
-			cardID = card.ID
+			if cardExpired(&card, time.Now()) {
+				tx.Rollback()
+				http.Error(w, "Card has expired", http.StatusUnprocessableEntity)
+				return
+			}
+			if charge, err = cardService.processorCard(&card); err != nil {
+				tx.Rollback()
+				log.Printf("Error reading card %d for user %d: %v", card.ID, currentUser.ID, err)
+				http.Error(w, "Error reading card", http.StatusInternalServerError)
+				return
+			}
 		}
 
 		fee := cardService.calculateFee(req.Amount)
 
-		var user models.User
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, currentUser.ID).Error; err != nil {
+		topUp := models.Transaction{
+			SenderID:         currentUser.ID,
+			ReceiverID:       currentUser.ID,
+			Amount:           req.Amount,
+			Fee:              fee,
+			Currency:         currentUser.Currency,
+			ReceivedAmount:   req.Amount,
+			ReceivedCurrency: currentUser.Currency,
+			Type:             models.TransactionSelf,
+			PaymentMethod:    models.PaymentMethodCard,
+			CardID:           &card.ID,
+			Description:      fmt.Sprintf("Added money via card: %s", req.Description),
+			Timestamp:        time.Now(),
+		}
+
+		if err := transaction.CreatePending(tx, &topUp); err != nil {
 			tx.Rollback()
-			log.Printf("Error fetching user %d for balance update: %v", currentUser.ID, err)
-			http.Error(w, "User not found", http.StatusNotFound)
+			log.Printf("Error creating transaction for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating transaction record", http.StatusInternalServerError)
 			return
 		}
-
-		user.Balance += req.Amount
-
-		if err := tx.Save(&user).Error; err != nil {
+		assessment, err := risk.DefaultEngine().Assess(tx, risk.EventFor(&topUp))
+		if err != nil {
 			tx.Rollback()
-			log.Printf("Error updating balance for user %d: %v", currentUser.ID, err)
+			log.Printf("Error screening card top-up %d: %v", topUp.ID, err)
 			http.Error(w, "Error updating balance", http.StatusInternalServerError)
 			return
 		}
 
-		transaction := models.Transaction{
-			SenderID:      user.ID,
-			ReceiverID:    user.ID,
-			Amount:        req.Amount,
-			Fee:           fee,
-			Type:          models.TransactionSelf,
-			PaymentMethod: models.PaymentMethodCard,
-			CardID:        &cardID,
-			Status:        "completed",
-			Description:   fmt.Sprintf("Added money via card: %s", req.Description),
-			Timestamp:     time.Now(),
+		if assessment.Decision == models.RiskDecisionBlock {
+			if err := transaction.Transition(tx, &topUp, models.TransactionStatusFailed, transaction.ErrBlockedByRisk.Error()); err != nil {
+				tx.Rollback()
+				log.Printf("Error declining card top-up %d: %v", topUp.ID, err)
+				http.Error(w, "Error updating balance", http.StatusInternalServerError)
+				return
+			}
+			if err := tx.Commit().Error; err != nil {
+				log.Printf("Error recording declined card top-up: %v", err)
+			}
+			http.Error(w, "Top-up declined by risk checks", http.StatusForbidden)
+			return
+		}
+
+		// The card is charged outside the database transaction so a slow
+		// processor never holds locks; the pending top-up is on record
+		// first.
+		if err := tx.Commit().Error; err != nil {
+			log.Printf("Error committing pending card top-up for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error completing transaction", http.StatusInternalServerError)
+			return
+		}
+
+		auth, err := processor.Default().Authorize(r.Context(), processor.AuthorizeRequest{
+			Reference: fmt.Sprintf("topup_%d", topUp.ID),
+			Amount:    transaction.ChargeAmount(&topUp),
+			Currency:  topUp.Currency,
+			Card:      charge,
+		})
+		if err != nil {
+			failTopUp(db, &topUp, err)
+			writeChargeError(w, err)
+			return
+		}
+		topUp.ProcessorReference = auth.Reference
+		if err := db.Model(&topUp).Update("processor_reference", auth.Reference).Error; err != nil {
+			log.Printf("Error storing authorization of card top-up %d: %v", topUp.ID, err)
+			transaction.VoidTopUp(r.Context(), &topUp)
+			failTopUp(db, &topUp, err)
+			http.Error(w, "Error completing transaction", http.StatusInternalServerError)
+			return
+		}
+
+		if assessment.Decision == models.RiskDecisionHold {
+			// Held top-ups stay pending with the money reserved on the card;
+			// it is captured if the review approves them.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(AddMoneyResponse{
+				Message:            "Top-up is under review",
+				Amount:             req.Amount,
+				Fee:                fee,
+				Currency:           currentUser.Currency,
+				NewBalance:         currentUser.Balance,
+				TransactionID:      topUp.ID,
+				Status:             string(topUp.Status),
+				ProcessorReference: topUp.ProcessorReference,
+			})
+			return
 		}
 
-		if err := tx.Create(&transaction).Error; err != nil {
+		tx = db.Begin()
+		if err := transaction.CaptureTopUp(r.Context(), tx, &topUp); err != nil {
+			switch {
+			case errors.Is(err, transaction.ErrCardCharge):
+				if err := tx.Commit().Error; err != nil {
+					log.Printf("Error recording failed card top-up %d: %v", topUp.ID, err)
+				}
+				writeChargeError(w, err)
+			case errors.Is(err, transaction.ErrCaptureUnknown):
+				// Not a 5xx: the idempotency key must keep this answer, or a
+				// retry would start a second top-up and charge the card
+				// again. The reconciler settles this one.
+				tx.Rollback()
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(AddMoneyResponse{
+					Message:            "The card processor did not confirm the charge in time; the top-up stays pending until it is confirmed",
+					Amount:             req.Amount,
+					Fee:                fee,
+					Currency:           currentUser.Currency,
+					NewBalance:         currentUser.Balance,
+					TransactionID:      topUp.ID,
+					Status:             string(topUp.Status),
+					ProcessorReference: topUp.ProcessorReference,
+				})
+			default:
+				// The charge was refunded when the wallet could not be
+				// credited.
+				tx.Rollback()
+				transaction.FailTopUp(db, &topUp, transaction.CreditFailedReason)
+				log.Printf("Error executing card top-up %d: %v", topUp.ID, err)
+				http.Error(w, "Error updating balance", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		var user models.User
+		if err := tx.First(&user, currentUser.ID).Error; err != nil {
 			tx.Rollback()
-			log.Printf("Error creating transaction for user %d: %v", currentUser.ID, err)
-			http.Error(w, "Error creating transaction record", http.StatusInternalServerError)
+			transaction.RefundCapture(r.Context(), &topUp)
+			transaction.FailTopUp(db, &topUp, transaction.CreditFailedReason)
+			log.Printf("Error fetching user %d after balance update: %v", currentUser.ID, err)
+			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
 
-		if err := tx.Model(&models.Card{}).Where("id = ?", cardID).
+		if err := tx.Model(&models.Card{}).Where("id = ?", card.ID).
 			Update("last_used_at", time.Now()).Error; err != nil {
 			log.Printf("Warning: Failed to update card last used time: %v", err)
 		}
 
 		if err := tx.Commit().Error; err != nil {
+			transaction.RefundCapture(r.Context(), &topUp)
+			transaction.FailTopUp(db, &topUp, transaction.CreditFailedReason)
 			log.Printf("Error committing transaction for user %d: %v", currentUser.ID, err)
 			http.Error(w, "Error completing transaction", http.StatusInternalServerError)
 			return
@@ -383,11 +557,14 @@ func AddMoneyWithCardHandler(db *gorm.DB) http.HandlerFunc {
 			currentUser.ID, req.Amount, fee)
 
 		response := AddMoneyResponse{
-			Message:       "Money added successfully",
-			Amount:        req.Amount,
-			Fee:           fee,
-			NewBalance:    user.Balance,
-			TransactionID: transaction.ID,
+			Message:            "Money added successfully",
+			Amount:             req.Amount,
+			Fee:                fee,
+			Currency:           currentUser.Currency,
+			NewBalance:         user.Balance,
+			TransactionID:      topUp.ID,
+			Status:             string(topUp.Status),
+			ProcessorReference: topUp.ProcessorReference,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -395,3 +572,46 @@ func AddMoneyWithCardHandler(db *gorm.DB) http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+func newProcessorCard(req CardRequest) processor.Card {
+	return processor.Card{
+		Number:      req.CardNumber,
+		ExpiryMonth: req.ExpiryMonth,
+		ExpiryYear:  req.ExpiryYear,
+		CVV:         req.CVV,
+		HolderName:  req.HolderName,
+	}
+}
+
+// processorCard recovers what the processor needs to charge a stored card.
+// Cards on file are charged without a CVV, which is never stored.
+func (cs *CardService) processorCard(card *models.Card) (processor.Card, error) {
+	number, err := cs.vault.Detokenize(cs.db, card.CardToken)
+	if err != nil {
+		return processor.Card{}, fmt.Errorf("failed to read number of card %d: %w", card.ID, err)
+	}
+	return processor.Card{
+		Number:      number,
+		ExpiryMonth: card.ExpiryMonth,
+		ExpiryYear:  card.ExpiryYear,
+		HolderName:  card.HolderName,
+	}, nil
+}
+
+// failTopUp records that a card top-up could not be charged.
+func failTopUp(db *gorm.DB, topUp *models.Transaction, cause error) {
+	transaction.FailTopUp(db, topUp, transaction.ChargeFailureReason(cause))
+}
+
+func writeChargeError(w http.ResponseWriter, err error) {
+	var decline *processor.DeclineError
+	switch {
+	case errors.As(err, &decline):
+		http.Error(w, "Card declined: "+decline.Message, http.StatusPaymentRequired)
+	case errors.Is(err, processor.ErrTimeout):
+		http.Error(w, "The card processor did not respond in time", http.StatusGatewayTimeout)
+	default:
+		log.Printf("Card processor error: %v", err)
+		http.Error(w, "The card could not be charged", http.StatusBadGateway)
+	}
+}
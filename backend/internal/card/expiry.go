@@ -0,0 +1,104 @@
+package card
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/events"
+	"paytm/internal/models"
+	"paytm/internal/outbox"
+)
+
+const expiryBatchSize = 200
+
+// ExpiryMonitor deactivates cards once their expiry month has passed and
+// warns their owners shortly before. Every card is expired and warned about
+// at most once: the conditional updates below only match a card that has
+// not been, and only while it still has the expiry date that was checked,
+// so overlapping runs and renewed cards do not get stray events.
+type ExpiryMonitor struct {
+	db *gorm.DB
+	// Warning is how long before a card expires its owner is told.
+	Warning time.Duration
+}
+
+// NewExpiryMonitor warns CARD_EXPIRY_WARNING_DAYS (default 30) days before
+// a card expires.
+func NewExpiryMonitor(db *gorm.DB) *ExpiryMonitor {
+	days := 30
+	if n, err := strconv.Atoi(os.Getenv("CARD_EXPIRY_WARNING_DAYS")); err == nil && n >= 0 {
+		days = n
+	}
+	return &ExpiryMonitor{db: db, Warning: time.Duration(days) * 24 * time.Hour}
+}
+
+func (m *ExpiryMonitor) RunDue(ctx context.Context) error {
+	now := time.Now()
+	var lastID uint
+	for {
+		var cards []models.Card
+		if err := m.db.WithContext(ctx).Where("expired_at IS NULL AND id > ?", lastID).
+			Order("id").Limit(expiryBatchSize).Find(&cards).Error; err != nil {
+			return fmt.Errorf("failed to load cards: %w", err)
+		}
+
+		for i := range cards {
+			card := &cards[i]
+			end := cardExpiryEnd(card)
+			var err error
+			switch {
+			case !now.Before(end):
+				err = m.expire(ctx, card, now)
+			case card.ExpiryWarningSentAt == nil && !now.Before(end.Add(-m.Warning)):
+				err = m.warn(ctx, card, now)
+			}
+			if err != nil {
+				log.Printf("Error checking expiry of card %d: %v", card.ID, err)
+			}
+		}
+
+		if len(cards) < expiryBatchSize {
+			return nil
+		}
+		lastID = cards[len(cards)-1].ID
+	}
+}
+
+func (m *ExpiryMonitor) expire(ctx context.Context, card *models.Card, now time.Time) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Card{}).
+			Where("id = ? AND expiry_month = ? AND expiry_year = ? AND expired_at IS NULL",
+				card.ID, card.ExpiryMonth, card.ExpiryYear).
+			Updates(map[string]interface{}{"expired_at": now, "is_active": false, "is_default": false})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		log.Printf("Card %d of user %d has expired", card.ID, card.UserID)
+		return outbox.Record(tx, events.ForCard(events.CardExpired, card))
+	})
+}
+
+func (m *ExpiryMonitor) warn(ctx context.Context, card *models.Card, now time.Time) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Card{}).
+			Where("id = ? AND expiry_month = ? AND expiry_year = ? AND expired_at IS NULL AND expiry_warning_sent_at IS NULL",
+				card.ID, card.ExpiryMonth, card.ExpiryYear).
+			Update("expiry_warning_sent_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return outbox.Record(tx, events.ForCard(events.CardExpiring, card))
+	})
+}
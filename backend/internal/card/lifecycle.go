@@ -0,0 +1,284 @@
+package card
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"paytm/internal/events"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/outbox"
+	"paytm/internal/vault"
+)
+
+// UpdateCardRequest changes only the fields it sets. An empty nickname
+// removes it; the expiry month and year are given together.
+type UpdateCardRequest struct {
+	Nickname    *string `json:"nickname"`
+	HolderName  *string `json:"holder_name"`
+	ExpiryMonth *string `json:"expiry_month"`
+	ExpiryYear  *string `json:"expiry_year"`
+}
+
+// expiryEnd is the moment a card expiring in month/year stops being valid:
+// the start of the following month, UTC. year is the two-digit year.
+func expiryEnd(month, year int) time.Time {
+	return time.Date(2000+year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// cardExpiryEnd is expiryEnd for a stored card. Cards whose expiry cannot
+// be parsed are treated as already expired.
+func cardExpiryEnd(card *models.Card) time.Time {
+	month, err := strconv.Atoi(card.ExpiryMonth)
+	if err != nil {
+		return time.Time{}
+	}
+	year, err := strconv.Atoi(card.ExpiryYear)
+	if err != nil {
+		return time.Time{}
+	}
+	return expiryEnd(month, year)
+}
+
+func cardExpired(card *models.Card, now time.Time) bool {
+	return card.ExpiredAt != nil || !now.Before(cardExpiryEnd(card))
+}
+
+// findCard loads one of the user's cards, active or not.
+func findCard(db *gorm.DB, w http.ResponseWriter, r *http.Request, userID uint) (*models.Card, bool) {
+	cardID, err := strconv.ParseUint(chi.URLParam(r, "cardID"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid card ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var card models.Card
+	if err := db.Where("user_id = ?", userID).First(&card, uint(cardID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Card not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Error fetching card %d for user %d: %v", cardID, userID, err)
+		http.Error(w, "Error fetching card", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &card, true
+}
+
+func writeCard(w http.ResponseWriter, card *models.Card) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newCardResponse(card))
+}
+
+// UpdateCardHandler renames a card or corrects its holder name and expiry,
+// as after the bank sends a renewed card with the same number. A new,
+// unexpired expiry date brings back a card the expiry job deactivated.
+func UpdateCardHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var req UpdateCardRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if (req.ExpiryMonth == nil) != (req.ExpiryYear == nil) {
+			http.Error(w, "expiry_month and expiry_year must be given together", http.StatusBadRequest)
+			return
+		}
+
+		card, ok := findCard(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Nickname != nil {
+			nickname := strings.TrimSpace(*req.Nickname)
+			if utf8.RuneCountInString(nickname) > 50 {
+				http.Error(w, "Nickname must be at most 50 characters", http.StatusBadRequest)
+				return
+			}
+			updates["nickname"] = nickname
+		}
+		if req.HolderName != nil {
+			holderName := strings.TrimSpace(*req.HolderName)
+			if err := validateHolderName(holderName); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			updates["holder_name"] = holderName
+		}
+		if req.ExpiryMonth != nil {
+			month, err := strconv.Atoi(*req.ExpiryMonth)
+			if err != nil || month < 1 || month > 12 {
+				http.Error(w, "expiry month must be between 1 and 12", http.StatusBadRequest)
+				return
+			}
+			year, err := strconv.Atoi(*req.ExpiryYear)
+			if err != nil || year < 0 || year > 99 {
+				http.Error(w, "expiry year must be between 00 and 99", http.StatusBadRequest)
+				return
+			}
+			if !time.Now().Before(expiryEnd(month, year)) {
+				http.Error(w, "card has expired", http.StatusBadRequest)
+				return
+			}
+			updates["expiry_month"] = fmt.Sprintf("%02d", month)
+			updates["expiry_year"] = fmt.Sprintf("%02d", year)
+			updates["expiry_warning_sent_at"] = nil
+			if card.ExpiredAt != nil {
+				updates["expired_at"] = nil
+				updates["is_active"] = true
+			}
+		}
+		if len(updates) == 0 {
+			writeCard(w, card)
+			return
+		}
+
+		if err := db.Model(card).Updates(updates).Error; err != nil {
+			log.Printf("Error updating card %d for user %d: %v", card.ID, currentUser.ID, err)
+			http.Error(w, "Error updating card", http.StatusInternalServerError)
+			return
+		}
+		writeCard(w, card)
+	}
+}
+
+// SetDefaultCardHandler makes an active card the one top-ups charge when
+// no card is given.
+func SetDefaultCardHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		card, ok := findCard(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+		if !card.IsActive {
+			http.Error(w, "Only an active card can be the default", http.StatusConflict)
+			return
+		}
+
+		// The old default is cleared first so the unique index on the
+		// user's default card never sees two.
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Card{}).
+				Where("user_id = ? AND is_default = ? AND id <> ?", currentUser.ID, true, card.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+			return tx.Model(card).Update("is_default", true).Error
+		}); err != nil {
+			log.Printf("Error setting default card %d for user %d: %v", card.ID, currentUser.ID, err)
+			http.Error(w, "Error setting default card", http.StatusInternalServerError)
+			return
+		}
+		writeCard(w, card)
+	}
+}
+
+// DeactivateCardHandler stops a card from being charged while keeping it on
+// file. A deactivated card is no longer the default.
+func DeactivateCardHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		card, ok := findCard(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+		if err := db.Model(card).Updates(map[string]interface{}{"is_active": false, "is_default": false}).Error; err != nil {
+			log.Printf("Error deactivating card %d for user %d: %v", card.ID, currentUser.ID, err)
+			http.Error(w, "Error deactivating card", http.StatusInternalServerError)
+			return
+		}
+		writeCard(w, card)
+	}
+}
+
+// ActivateCardHandler lets a deactivated card be charged again. Expired
+// cards need a new expiry date instead.
+func ActivateCardHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		card, ok := findCard(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+		if cardExpired(card, time.Now()) {
+			http.Error(w, "Card has expired; update its expiry date to use it again", http.StatusConflict)
+			return
+		}
+		if err := db.Model(card).Update("is_active", true).Error; err != nil {
+			log.Printf("Error activating card %d for user %d: %v", card.ID, currentUser.ID, err)
+			http.Error(w, "Error activating card", http.StatusInternalServerError)
+			return
+		}
+		writeCard(w, card)
+	}
+}
+
+// RemoveCardHandler deletes a card from the user's account. The row is
+// soft-deleted so past top-ups keep pointing at it, but its number is
+// dropped from the vault.
+func RemoveCardHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		card, ok := findCard(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(card).Updates(map[string]interface{}{"is_active": false, "is_default": false}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(card).Error; err != nil {
+				return err
+			}
+			if err := vault.Delete(tx, card.CardToken); err != nil {
+				return err
+			}
+			return outbox.Record(tx, events.ForCard(events.CardRemoved, card))
+		}); err != nil {
+			log.Printf("Error removing card %d for user %d: %v", card.ID, currentUser.ID, err)
+			http.Error(w, "Error removing card", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Card removed for user %d: %s", currentUser.ID, card.MaskedNumber)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
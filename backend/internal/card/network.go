@@ -0,0 +1,127 @@
+package card
+
+import (
+	"strconv"
+
+	"paytm/internal/models"
+)
+
+// Network is a card scheme together with the card numbers and CVVs it
+// issues.
+type Network struct {
+	Type       models.CardType
+	PANLengths []int
+	CVVLength  int
+}
+
+var networks = map[models.CardType]Network{
+	models.CardTypeVISA:       {models.CardTypeVISA, []int{13, 16, 19}, 3},
+	models.CardTypeMasterCard: {models.CardTypeMasterCard, []int{16}, 3},
+	models.CardTypeAmex:       {models.CardTypeAmex, []int{15}, 4},
+	models.CardTypeDiscover:   {models.CardTypeDiscover, []int{16, 17, 18, 19}, 3},
+	models.CardTypeRuPay:      {models.CardTypeRuPay, []int{16}, 3},
+	models.CardTypeJCB:        {models.CardTypeJCB, []int{16, 17, 18, 19}, 3},
+	models.CardTypeDiners:     {models.CardTypeDiners, []int{14, 15, 16, 17, 18, 19}, 3},
+	models.CardTypeUnionPay:   {models.CardTypeUnionPay, []int{16, 17, 18, 19}, 3},
+	models.CardTypeMaestro:    {models.CardTypeMaestro, []int{12, 13, 14, 15, 16, 17, 18, 19}, 3},
+}
+
+// binRange assigns the card numbers whose leading digits fall between From
+// and To, inclusive, to a network. Both bounds have the same number of
+// digits.
+type binRange struct {
+	From, To string
+	Network  models.CardType
+}
+
+// binRanges is the IIN table card numbers are matched against. Ranges
+// overlap on purpose: the one with the longest prefix wins, so RuPay's
+// 652150-653149 takes precedence over Discover's 65.
+var binRanges = []binRange{
+	{"4", "4", models.CardTypeVISA},
+
+	{"51", "55", models.CardTypeMasterCard},
+	{"2221", "2720", models.CardTypeMasterCard},
+
+	{"34", "34", models.CardTypeAmex},
+	{"37", "37", models.CardTypeAmex},
+
+	{"6011", "6011", models.CardTypeDiscover},
+	{"644", "649", models.CardTypeDiscover},
+	{"65", "65", models.CardTypeDiscover},
+
+	{"60", "60", models.CardTypeRuPay},
+	{"81", "82", models.CardTypeRuPay},
+	{"508", "508", models.CardTypeRuPay},
+	{"652150", "653149", models.CardTypeRuPay},
+
+	{"3528", "3589", models.CardTypeJCB},
+
+	{"300", "305", models.CardTypeDiners},
+	{"3095", "3095", models.CardTypeDiners},
+	{"36", "36", models.CardTypeDiners},
+	{"38", "39", models.CardTypeDiners},
+
+	{"62", "62", models.CardTypeUnionPay},
+
+	{"5018", "5018", models.CardTypeMaestro},
+	{"5020", "5020", models.CardTypeMaestro},
+	{"5038", "5038", models.CardTypeMaestro},
+	{"5893", "5893", models.CardTypeMaestro},
+	{"6304", "6304", models.CardTypeMaestro},
+	{"6759", "6759", models.CardTypeMaestro},
+	{"6761", "6763", models.CardTypeMaestro},
+}
+
+// lookupNetwork finds the network that issued a card number, which must be
+// digits only. It reports false for numbers no known network issues.
+func lookupNetwork(number string) (Network, bool) {
+	var best *binRange
+	for i := range binRanges {
+		r := &binRanges[i]
+		if len(number) < len(r.From) {
+			continue
+		}
+		prefix, err := strconv.Atoi(number[:len(r.From)])
+		if err != nil {
+			continue
+		}
+		from, _ := strconv.Atoi(r.From)
+		to, _ := strconv.Atoi(r.To)
+		if prefix < from || prefix > to {
+			continue
+		}
+		if best == nil || len(r.From) > len(best.From) {
+			best = r
+		}
+	}
+	if best == nil {
+		return Network{}, false
+	}
+	return networks[best.Network], true
+}
+
+func (n Network) validLength(number string) bool {
+	for _, length := range n.PANLengths {
+		if len(number) == length {
+			return true
+		}
+	}
+	return false
+}
+
+// luhnValid checks the Luhn check digit of a number made of digits only.
+func luhnValid(number string) bool {
+	sum := 0
+	for i := 0; i < len(number); i++ {
+		digit := int(number[len(number)-1-i] - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return len(number) > 0 && sum%10 == 0
+}
@@ -0,0 +1,159 @@
+package card
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"paytm/internal/models"
+)
+
+// testPAN pads prefix with zeros to length digits and appends the Luhn
+// check digit.
+func testPAN(prefix string, length int) string {
+	body := prefix + strings.Repeat("0", length-1-len(prefix))
+	for digit := '0'; digit <= '9'; digit++ {
+		if number := body + string(digit); luhnValid(number) {
+			return number
+		}
+	}
+	panic("no check digit for " + body)
+}
+
+func testCardRequest(number, cvv string) CardRequest {
+	return CardRequest{
+		CardNumber:  number,
+		ExpiryMonth: "12",
+		ExpiryYear:  fmt.Sprintf("%02d", (time.Now().Year()+2)%100),
+		CVV:         cvv,
+		HolderName:  "Test Holder",
+	}
+}
+
+// networkPrefixes are BINs each network issues, used to build numbers of
+// any length for it.
+var networkPrefixes = map[models.CardType]string{
+	models.CardTypeVISA:       "4",
+	models.CardTypeMasterCard: "55",
+	models.CardTypeAmex:       "37",
+	models.CardTypeDiscover:   "6011",
+	models.CardTypeRuPay:      "60",
+	models.CardTypeJCB:        "3530",
+	models.CardTypeDiners:     "36",
+	models.CardTypeUnionPay:   "62",
+	models.CardTypeMaestro:    "6759",
+}
+
+func TestValidateCardDataAcceptsEachNetwork(t *testing.T) {
+	tests := []struct {
+		number string
+		cvv    string
+		want   models.CardType
+	}{
+		{"4111111111111111", "123", models.CardTypeVISA},
+		{"4222222222222", "123", models.CardTypeVISA},
+		{"5555555555554444", "123", models.CardTypeMasterCard},
+		{"2223003122003222", "123", models.CardTypeMasterCard},
+		{"378282246310005", "1234", models.CardTypeAmex},
+		{"6011111111111117", "123", models.CardTypeDiscover},
+		{"6080000000000000", "123", models.CardTypeRuPay},
+		{"3530111333300000", "123", models.CardTypeJCB},
+		{"36227206271667", "123", models.CardTypeDiners},
+		{"6200000000000005", "123", models.CardTypeUnionPay},
+		{"6759649826438453", "123", models.CardTypeMaestro},
+		{"4111 1111 1111 1111", "123", models.CardTypeVISA},
+	}
+	cs := &CardService{}
+	for _, tt := range tests {
+		network, err := cs.validateCardData(testCardRequest(tt.number, tt.cvv))
+		if err != nil {
+			t.Errorf("validateCardData(%s) = %v, want %s", tt.number, err, tt.want)
+			continue
+		}
+		if network.Type != tt.want {
+			t.Errorf("validateCardData(%s) network = %s, want %s", tt.number, network.Type, tt.want)
+		}
+	}
+}
+
+func TestValidateCardDataRejectsLuhnFailure(t *testing.T) {
+	cs := &CardService{}
+	_, err := cs.validateCardData(testCardRequest("4111111111111112", "123"))
+	if err == nil || err.Error() != "card number is invalid" {
+		t.Errorf("validateCardData() = %v, want a Luhn failure", err)
+	}
+}
+
+func TestValidateCardDataRejectsUnknownBIN(t *testing.T) {
+	cs := &CardService{}
+	for _, prefix := range []string{"1", "7", "9", "50"} {
+		number := testPAN(prefix, 16)
+		if network, ok := lookupNetwork(number); ok {
+			t.Errorf("lookupNetwork(%s) = %s, want no network", number, network.Type)
+		}
+		if _, err := cs.validateCardData(testCardRequest(number, "123")); err == nil || err.Error() != "card network not supported" {
+			t.Errorf("validateCardData(%s) = %v, want an unsupported network", number, err)
+		}
+	}
+}
+
+func TestValidateCardDataRejectsWrongLength(t *testing.T) {
+	cs := &CardService{}
+	for cardType, network := range networks {
+		prefix := networkPrefixes[cardType]
+		for length := 12; length <= 19; length++ {
+			if network.validLength(strings.Repeat("0", length)) {
+				continue
+			}
+			number := testPAN(prefix, length)
+			_, err := cs.validateCardData(testCardRequest(number, strings.Repeat("1", network.CVVLength)))
+			want := fmt.Sprintf("%s card numbers cannot be %d digits long", cardType, length)
+			if err == nil || err.Error() != want {
+				t.Errorf("validateCardData(%s) = %v, want %q", number, err, want)
+			}
+		}
+	}
+}
+
+func TestValidateCardDataRejectsWrongCVVLength(t *testing.T) {
+	cs := &CardService{}
+	for cardType, network := range networks {
+		number := testPAN(networkPrefixes[cardType], network.PANLengths[0])
+		if _, err := cs.validateCardData(testCardRequest(number, strings.Repeat("1", network.CVVLength))); err != nil {
+			t.Errorf("validateCardData(%s) with a %d digit CVV = %v, want nil", number, network.CVVLength, err)
+		}
+		want := fmt.Sprintf("CVV must be %d digits for %s cards", network.CVVLength, cardType)
+		for _, length := range []int{network.CVVLength - 1, network.CVVLength + 1} {
+			_, err := cs.validateCardData(testCardRequest(number, strings.Repeat("1", length)))
+			if err == nil || err.Error() != want {
+				t.Errorf("validateCardData(%s) with a %d digit CVV = %v, want %q", number, length, err, want)
+			}
+		}
+	}
+}
+
+func TestLookupNetworkPrefersLongestPrefix(t *testing.T) {
+	tests := []struct {
+		number string
+		want   models.CardType
+	}{
+		{"6521500000000006", models.CardTypeRuPay},
+		{"6531490000000008", models.CardTypeRuPay},
+		{testPAN("652149", 16), models.CardTypeDiscover},
+		{testPAN("653150", 16), models.CardTypeDiscover},
+		{"6500000000000002", models.CardTypeDiscover},
+		// Maestro's 5018 and RuPay's 508 sit side by side under 50.
+		{"5018000000000009", models.CardTypeMaestro},
+		{"5081000000000001", models.CardTypeRuPay},
+		{testPAN("5089", 16), models.CardTypeRuPay},
+		{"6011111111111117", models.CardTypeDiscover},
+		{testPAN("6012", 16), models.CardTypeRuPay},
+	}
+	for _, tt := range tests {
+		network, ok := lookupNetwork(tt.number)
+		if !ok || network.Type != tt.want {
+			t.Errorf("lookupNetwork(%s) = %s (%v), want %s", tt.number, network.Type, ok, tt.want)
+		}
+	}
+}
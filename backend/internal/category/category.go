@@ -0,0 +1,274 @@
+package category
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/models"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 50
+	maxNoteChars = 2000
+)
+
+var (
+	ErrInvalidTag  = errors.New("tags must be 1 to 50 letters, digits, '-' or '_'")
+	ErrTooManyTags = fmt.Errorf("a transaction can have at most %d tags", maxTags)
+	ErrNoteTooLong = fmt.Errorf("notes can be at most %d characters", maxNoteChars)
+)
+
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+
+// defaultCategory is a category every user starts with, together with the
+// words in a description that suggest it.
+type defaultCategory struct {
+	Name     string
+	Color    string
+	Keywords []string
+}
+
+var defaultCategories = []defaultCategory{
+	{"Food & Drink", "#f97316", []string{"food", "lunch", "dinner", "breakfast", "coffee", "restaurant", "pizza", "drinks", "bar"}},
+	{"Groceries", "#22c55e", []string{"grocery", "groceries", "supermarket", "market"}},
+	{"Housing", "#8b5cf6", []string{"rent", "mortgage", "deposit", "landlord"}},
+	{"Utilities", "#0ea5e9", []string{"electricity", "electric", "water", "gas", "internet", "wifi", "phone", "mobile", "bill"}},
+	{"Transport", "#eab308", []string{"uber", "taxi", "cab", "fuel", "petrol", "parking", "train", "bus", "metro"}},
+	{"Shopping", "#ec4899", []string{"shopping", "clothes", "amazon", "gift"}},
+	{"Entertainment", "#a855f7", []string{"movie", "movies", "cinema", "concert", "netflix", "spotify", "game", "tickets"}},
+	{"Travel", "#14b8a6", []string{"flight", "hotel", "trip", "travel", "vacation", "holiday"}},
+	{"Health", "#ef4444", []string{"doctor", "pharmacy", "medicine", "hospital", "gym", "dentist"}},
+	{"Friends & Family", "#f43f5e", []string{"split", "share", "birthday", "loan", "payback"}},
+	{"Income", "#10b981", []string{"salary", "payment", "invoice", "refund"}},
+	{"Top-ups", "#64748b", []string{"top-up", "topup"}},
+	{"Other", "#94a3b8", nil},
+}
+
+// EnsureDefaults gives a user without any categories the default set.
+func EnsureDefaults(db *gorm.DB, userID uint) error {
+	var count int64
+	if err := db.Model(&models.Category{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to count categories for user %d: %w", userID, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	categories := make([]models.Category, 0, len(defaultCategories))
+	for _, d := range defaultCategories {
+		categories = append(categories, models.Category{UserID: userID, Name: d.Name, Color: d.Color, IsDefault: true})
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&categories).Error; err != nil {
+		return fmt.Errorf("failed to create default categories for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// NormalizeTags trims, lower-cases and de-duplicates tags, keeping their
+// order, and checks they are well formed.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+		if tag == "" || len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, ErrTooManyTags
+	}
+	return normalized, nil
+}
+
+// Suggestion is a category the user is likely to pick for a transaction.
+// Confidence is the share of the evidence behind it, from 0 to 1.
+type Suggestion struct {
+	Category   models.Category
+	Reason     string
+	Confidence float64
+}
+
+// Suggest proposes categories for a transaction from the user's point of
+// view, best first. It looks at what the user chose before for the same
+// counterparty (or card, for top-ups), then for the same description, and
+// finally at keywords in the description and the direction of the money.
+func Suggest(db *gorm.DB, userID uint, txn *models.Transaction) ([]Suggestion, error) {
+	var categories []models.Category
+	if err := db.Where("user_id = ?", userID).Find(&categories).Error; err != nil {
+		return nil, fmt.Errorf("failed to load categories: %w", err)
+	}
+	byID := map[uint]models.Category{}
+	byName := map[string]models.Category{}
+	for _, c := range categories {
+		byID[c.ID] = c
+		byName[strings.ToLower(c.Name)] = c
+	}
+
+	var suggestions []Suggestion
+	seen := map[uint]bool{}
+	add := func(c models.Category, reason string, confidence float64) {
+		if seen[c.ID] || len(suggestions) >= 3 {
+			return
+		}
+		seen[c.ID] = true
+		suggestions = append(suggestions, Suggestion{Category: c, Reason: reason, Confidence: confidence})
+	}
+
+	// Past choices for the same counterparty, in the same direction.
+	history := db.Table("transaction_annotations").
+		Select("transaction_annotations.category_id, COUNT(*) AS uses").
+		Joins("JOIN transactions ON transactions.id = transaction_annotations.transaction_id").
+		Where("transaction_annotations.user_id = ? AND transaction_annotations.category_id IS NOT NULL", userID).
+		Where("transactions.id <> ?", txn.ID)
+	switch {
+	case txn.SenderID == txn.ReceiverID && txn.CardID != nil:
+		history = history.Where("transactions.sender_id = ? AND transactions.receiver_id = ? AND transactions.card_id = ?",
+			userID, userID, *txn.CardID)
+	case txn.SenderID == txn.ReceiverID:
+		history = history.Where("transactions.sender_id = ? AND transactions.receiver_id = ? AND transactions.payment_method = ?",
+			userID, userID, txn.PaymentMethod)
+	case txn.SenderID == userID:
+		history = history.Where("transactions.sender_id = ? AND transactions.receiver_id = ?", userID, txn.ReceiverID)
+	default:
+		history = history.Where("transactions.receiver_id = ? AND transactions.sender_id = ?", userID, txn.SenderID)
+	}
+	if err := addFromHistory(history, byID, "counterparty", add); err != nil {
+		return nil, err
+	}
+
+	// Past choices for transactions described the same way.
+	if description := strings.TrimSpace(txn.Description); description != "" {
+		sameDescription := db.Table("transaction_annotations").
+			Select("transaction_annotations.category_id, COUNT(*) AS uses").
+			Joins("JOIN transactions ON transactions.id = transaction_annotations.transaction_id").
+			Where("transaction_annotations.user_id = ? AND transaction_annotations.category_id IS NOT NULL", userID).
+			Where("transactions.id <> ? AND LOWER(TRIM(transactions.description)) = ?", txn.ID, strings.ToLower(description))
+		if err := addFromHistory(sameDescription, byID, "description", add); err != nil {
+			return nil, err
+		}
+
+		words := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+			return !(r == '-' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+		})
+		for _, d := range defaultCategories {
+			if c, ok := byName[strings.ToLower(d.Name)]; ok && matchesAny(words, d.Keywords) {
+				add(c, "keyword", 0.5)
+			}
+		}
+	}
+
+	// Finally the direction of the money.
+	fallback := ""
+	switch {
+	case txn.SenderID == txn.ReceiverID:
+		fallback = "top-ups"
+	case txn.ReceiverID == userID:
+		fallback = "income"
+	}
+	if c, ok := byName[fallback]; ok {
+		add(c, "direction", 0.3)
+	}
+	return suggestions, nil
+}
+
+func addFromHistory(query *gorm.DB, byID map[uint]models.Category, reason string, add func(models.Category, string, float64)) error {
+	var rows []struct {
+		CategoryID uint
+		Uses       int64
+	}
+	if err := query.Group("transaction_annotations.category_id").Order("uses DESC").Limit(3).
+		Scan(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load past categories: %w", err)
+	}
+	var total int64
+	for _, row := range rows {
+		total += row.Uses
+	}
+	for _, row := range rows {
+		if c, ok := byID[row.CategoryID]; ok {
+			add(c, reason, float64(row.Uses)/float64(total))
+		}
+	}
+	return nil
+}
+
+func matchesAny(words, keywords []string) bool {
+	for _, word := range words {
+		for _, keyword := range keywords {
+			if word == keyword {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type CategoryResponse struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Color     string `json:"color,omitempty"`
+	IsDefault bool   `json:"is_default"`
+}
+
+func NewCategoryResponse(c models.Category) CategoryResponse {
+	return CategoryResponse{ID: c.ID, Name: c.Name, Color: c.Color, IsDefault: c.IsDefault}
+}
+
+// Annotation is what a user recorded about one transaction.
+type Annotation struct {
+	Category *CategoryResponse `json:"category,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Note     string            `json:"note,omitempty"`
+}
+
+// LoadAnnotations returns the user's annotations of the given transactions,
+// keyed by transaction ID. Transactions the user never annotated are left
+// out.
+func LoadAnnotations(db *gorm.DB, userID uint, transactionIDs []uint) (map[uint]*Annotation, error) {
+	annotations := map[uint]*Annotation{}
+	if len(transactionIDs) == 0 {
+		return annotations, nil
+	}
+
+	var rows []models.TransactionAnnotation
+	if err := db.Preload("Category").
+		Where("user_id = ? AND transaction_id IN ?", userID, transactionIDs).
+		Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load annotations: %w", err)
+	}
+	for _, row := range rows {
+		annotation := &Annotation{Note: row.Note}
+		if row.Category != nil {
+			response := NewCategoryResponse(*row.Category)
+			annotation.Category = &response
+		}
+		annotations[row.TransactionID] = annotation
+	}
+
+	var tags []models.TransactionTag
+	if err := db.Where("user_id = ? AND transaction_id IN ?", userID, transactionIDs).
+		Order("id").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to load tags: %w", err)
+	}
+	for _, tag := range tags {
+		annotation, ok := annotations[tag.TransactionID]
+		if !ok {
+			annotation = &Annotation{}
+			annotations[tag.TransactionID] = annotation
+		}
+		annotation.Tags = append(annotation.Tags, tag.Tag)
+	}
+	return annotations, nil
+}
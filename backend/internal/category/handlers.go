@@ -0,0 +1,474 @@
+package category
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/budget"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type CategoryRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+// AnnotationRequest updates only the fields it sets. A category_id of 0
+// clears the category and tags replace the existing ones.
+type AnnotationRequest struct {
+	CategoryID *uint     `json:"category_id"`
+	Tags       *[]string `json:"tags"`
+	Note       *string   `json:"note"`
+}
+
+type SuggestionResponse struct {
+	Category   CategoryResponse `json:"category"`
+	Reason     string           `json:"reason"`
+	Confidence float64          `json:"confidence"`
+}
+
+type AnnotationResponse struct {
+	TransactionID uint                 `json:"transaction_id"`
+	Category      *CategoryResponse    `json:"category"`
+	Tags          []string             `json:"tags"`
+	Note          string               `json:"note"`
+	Suggestions   []SuggestionResponse `json:"suggestions,omitempty"`
+}
+
+type TagResponse struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+func validateCategory(w http.ResponseWriter, req *CategoryRequest) bool {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || utf8.RuneCountInString(name) > 50 {
+			http.Error(w, "Name must be 1 to 50 characters", http.StatusBadRequest)
+			return false
+		}
+		req.Name = &name
+	}
+	if req.Color != nil && *req.Color != "" && !colorPattern.MatchString(*req.Color) {
+		http.Error(w, "Color must be a hex color such as #22c55e", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func nameTaken(db *gorm.DB, userID uint, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Category{}).
+		Where("user_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", userID, name, exceptID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func findCategory(db *gorm.DB, w http.ResponseWriter, r *http.Request, userID uint) (*models.Category, bool) {
+	categoryID, err := strconv.ParseUint(chi.URLParam(r, "categoryID"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var c models.Category
+	if err := db.Where("user_id = ?", userID).First(&c, uint(categoryID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error fetching category", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &c, true
+}
+
+// findTransaction loads a transaction the user is a party to.
+func findTransaction(db *gorm.DB, w http.ResponseWriter, r *http.Request, userID uint) (*models.Transaction, bool) {
+	transactionID, err := strconv.ParseUint(chi.URLParam(r, "transactionID"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var txn models.Transaction
+	if err := db.Where("id = ? AND (sender_id = ? OR receiver_id = ?)", uint(transactionID), userID, userID).
+		First(&txn).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &txn, true
+}
+
+func GetCategoriesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err := EnsureDefaults(db, currentUser.ID); err != nil {
+			log.Printf("Error creating default categories: %v", err)
+			http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+			return
+		}
+
+		var categories []models.Category
+		if err := db.Where("user_id = ?", currentUser.ID).Order("name").Find(&categories).Error; err != nil {
+			http.Error(w, "Error fetching categories", http.StatusInternalServerError)
+			return
+		}
+
+		response := []CategoryResponse{}
+		for _, c := range categories {
+			response = append(response, NewCategoryResponse(c))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]CategoryResponse{"categories": response})
+	}
+}
+
+func CreateCategoryHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req CategoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Name == nil {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+		if !validateCategory(w, &req) {
+			return
+		}
+
+		// Creating the first category must not stop the defaults from
+		// being added later.
+		if err := EnsureDefaults(db, currentUser.ID); err != nil {
+			log.Printf("Error creating default categories: %v", err)
+			http.Error(w, "Error creating category", http.StatusInternalServerError)
+			return
+		}
+		if taken, err := nameTaken(db, currentUser.ID, *req.Name, 0); err != nil {
+			http.Error(w, "Error creating category", http.StatusInternalServerError)
+			return
+		} else if taken {
+			http.Error(w, "A category with this name already exists", http.StatusConflict)
+			return
+		}
+
+		c := models.Category{UserID: currentUser.ID, Name: *req.Name}
+		if req.Color != nil {
+			c.Color = *req.Color
+		}
+		if err := db.Create(&c).Error; err != nil {
+			http.Error(w, "Error creating category", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(NewCategoryResponse(c))
+	}
+}
+
+func UpdateCategoryHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		c, ok := findCategory(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		var req CategoryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if !validateCategory(w, &req) {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Name != nil {
+			if taken, err := nameTaken(db, currentUser.ID, *req.Name, c.ID); err != nil {
+				http.Error(w, "Error updating category", http.StatusInternalServerError)
+				return
+			} else if taken {
+				http.Error(w, "A category with this name already exists", http.StatusConflict)
+				return
+			}
+			updates["name"] = *req.Name
+		}
+		if req.Color != nil {
+			updates["color"] = *req.Color
+		}
+		if len(updates) > 0 {
+			if err := db.Model(c).Updates(updates).Error; err != nil {
+				http.Error(w, "Error updating category", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(NewCategoryResponse(*c))
+	}
+}
+
+// DeleteCategoryHandler deletes a category, and with it any budget for it;
+// transactions filed under it are left uncategorized.
+func DeleteCategoryHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		c, ok := findCategory(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.TransactionAnnotation{}).
+				Where("user_id = ? AND category_id = ?", currentUser.ID, c.ID).
+				Update("category_id", nil).Error; err != nil {
+				return err
+			}
+			return tx.Unscoped().Delete(c).Error
+		}); err != nil {
+			log.Printf("Error deleting category %d: %v", c.ID, err)
+			http.Error(w, "Error deleting category", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted"})
+	}
+}
+
+// GetTagsHandler lists the tags the user has used, most used first.
+func GetTagsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tags := []TagResponse{}
+		if err := db.Model(&models.TransactionTag{}).
+			Select("tag, COUNT(*) AS count").
+			Where("user_id = ?", currentUser.ID).
+			Group("tag").
+			Order("count DESC, tag").
+			Scan(&tags).Error; err != nil {
+			http.Error(w, "Error fetching tags", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]TagResponse{"tags": tags})
+	}
+}
+
+func newAnnotationResponse(transactionID uint, annotation *Annotation) AnnotationResponse {
+	response := AnnotationResponse{TransactionID: transactionID, Tags: []string{}}
+	if annotation != nil {
+		response.Category = annotation.Category
+		response.Note = annotation.Note
+		if annotation.Tags != nil {
+			response.Tags = annotation.Tags
+		}
+	}
+	return response
+}
+
+// suggest fills in category suggestions when the transaction has no
+// category yet.
+func suggest(db *gorm.DB, userID uint, txn *models.Transaction, response *AnnotationResponse) error {
+	if response.Category != nil {
+		return nil
+	}
+	if err := EnsureDefaults(db, userID); err != nil {
+		return err
+	}
+	suggestions, err := Suggest(db, userID, txn)
+	if err != nil {
+		return err
+	}
+	for _, s := range suggestions {
+		response.Suggestions = append(response.Suggestions, SuggestionResponse{
+			Category:   NewCategoryResponse(s.Category),
+			Reason:     s.Reason,
+			Confidence: s.Confidence,
+		})
+	}
+	return nil
+}
+
+// GetAnnotationHandler returns the user's category, tags and note for a
+// transaction, with suggested categories while it has none.
+func GetAnnotationHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		txn, ok := findTransaction(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		annotations, err := LoadAnnotations(db, currentUser.ID, []uint{txn.ID})
+		if err != nil {
+			log.Printf("Error loading annotation of transaction %d: %v", txn.ID, err)
+			http.Error(w, "Error fetching annotation", http.StatusInternalServerError)
+			return
+		}
+		response := newAnnotationResponse(txn.ID, annotations[txn.ID])
+		if err := suggest(db, currentUser.ID, txn, &response); err != nil {
+			log.Printf("Error suggesting categories for transaction %d: %v", txn.ID, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func UpdateAnnotationHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		txn, ok := findTransaction(db, w, r, currentUser.ID)
+		if !ok {
+			return
+		}
+
+		var req AnnotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		var tags []string
+		if req.Tags != nil {
+			normalized, err := NormalizeTags(*req.Tags)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			tags = normalized
+		}
+		if req.Note != nil && utf8.RuneCountInString(*req.Note) > maxNoteChars {
+			http.Error(w, ErrNoteTooLong.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.CategoryID != nil && *req.CategoryID != 0 {
+			var count int64
+			if err := db.Model(&models.Category{}).
+				Where("id = ? AND user_id = ?", *req.CategoryID, currentUser.ID).
+				Count(&count).Error; err != nil {
+				http.Error(w, "Error updating annotation", http.StatusInternalServerError)
+				return
+			}
+			if count == 0 {
+				http.Error(w, "Category not found", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			annotation := models.TransactionAnnotation{UserID: currentUser.ID, TransactionID: txn.ID}
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("user_id = ? AND transaction_id = ?", currentUser.ID, txn.ID).
+				FirstOrCreate(&annotation).Error; err != nil {
+				return err
+			}
+
+			updates := map[string]interface{}{"updated_at": time.Now()}
+			if req.CategoryID != nil {
+				if *req.CategoryID == 0 {
+					updates["category_id"] = nil
+				} else {
+					updates["category_id"] = *req.CategoryID
+				}
+			}
+			if req.Note != nil {
+				updates["note"] = strings.TrimSpace(*req.Note)
+			}
+			if err := tx.Model(&annotation).Updates(updates).Error; err != nil {
+				return err
+			}
+
+			if req.Tags != nil {
+				if err := tx.Where("user_id = ? AND transaction_id = ?", currentUser.ID, txn.ID).
+					Delete(&models.TransactionTag{}).Error; err != nil {
+					return err
+				}
+				for _, tag := range tags {
+					if err := tx.Create(&models.TransactionTag{
+						UserID:        currentUser.ID,
+						TransactionID: txn.ID,
+						Tag:           tag,
+					}).Error; err != nil {
+						return err
+					}
+				}
+			}
+
+			// Filing a transfer under a category can take that category's
+			// budget past a threshold.
+			if req.CategoryID != nil && *req.CategoryID != 0 {
+				return budget.Recategorized(tx, currentUser.ID, txn)
+			}
+			return nil
+		}); err != nil {
+			log.Printf("Error updating annotation of transaction %d: %v", txn.ID, err)
+			http.Error(w, "Error updating annotation", http.StatusInternalServerError)
+			return
+		}
+
+		annotations, err := LoadAnnotations(db, currentUser.ID, []uint{txn.ID})
+		if err != nil {
+			http.Error(w, "Error fetching annotation", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newAnnotationResponse(txn.ID, annotations[txn.ID]))
+	}
+}
@@ -0,0 +1,107 @@
+package currency
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// RatePrecision is the number of decimal places rates are stored with. The
+// rounded rate is also the one used for the conversion, so a stored
+// transaction can always be recomputed from its own fields.
+const RatePrecision = 8
+
+type Conversion struct {
+	From      string
+	To        string
+	Amount    int64
+	Converted int64
+	Rate      string
+	Source    string
+}
+
+func Convert(provider RateProvider, amount int64, from, to string) (*Conversion, error) {
+	if from == to {
+		return &Conversion{From: from, To: to, Amount: amount, Converted: amount}, nil
+	}
+
+	rate, err := provider.Rate(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rateText := rate.Value.FloatString(RatePrecision)
+	converted, err := ConvertAtRate(amount, from, to, rateText)
+	if err != nil {
+		return nil, err
+	}
+	return &Conversion{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Converted: converted,
+		Rate:      rateText,
+		Source:    rate.Source,
+	}, nil
+}
+
+// ConvertAtRate converts an amount in minor units of from into minor units
+// of to, rounding half away from zero. The rate is quoted in major units.
+func ConvertAtRate(amount int64, from, to, rate string) (int64, error) {
+	fromCurrency, ok := Lookup(from)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, from)
+	}
+	toCurrency, ok := Lookup(to)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, to)
+	}
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid exchange rate %q", rate)
+	}
+
+	result := new(big.Rat).Mul(big.NewRat(amount, 1), value)
+	shift := toCurrency.MinorUnits - fromCurrency.MinorUnits
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil)
+	if shift > 0 {
+		result.Mul(result, new(big.Rat).SetInt(scale))
+	} else if shift < 0 {
+		result.Quo(result, new(big.Rat).SetInt(scale))
+	}
+
+	rounded := roundHalfAwayFromZero(result)
+	if !rounded.IsInt64() {
+		return 0, fmt.Errorf("converted amount overflows")
+	}
+	return rounded.Int64(), nil
+}
+
+// InverseRate returns the rate for the opposite direction at the same
+// precision, used when money goes back the way it came.
+func InverseRate(rate string) (string, error) {
+	value, ok := new(big.Rat).SetString(rate)
+	if !ok || value.Sign() <= 0 {
+		return "", fmt.Errorf("invalid exchange rate %q", rate)
+	}
+	return new(big.Rat).Inv(value).FloatString(RatePrecision), nil
+}
+
+func roundHalfAwayFromZero(r *big.Rat) *big.Int {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return quo
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
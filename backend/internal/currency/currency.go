@@ -0,0 +1,87 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const Default = "USD"
+
+var ErrUnknownCurrency = errors.New("unknown ISO 4217 currency code")
+
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+// Active ISO 4217 codes grouped by the number of minor units. Fund codes are
+// included where they are in active use; precious metals and testing codes
+// are not, since wallets can never hold them.
+var (
+	twoDecimalCodes = `AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV
+		BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CNY COP COU CRC CUP CVE CZK DKK DOP DZD
+		EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL HTG HUF IDR ILS INR IRR
+		JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR
+		MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD
+		RUB SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY
+		TTD TWD TZS UAH USD USN UYU UZS VED VES WST XCD XCG YER ZAR ZMW ZWG`
+
+	otherMinorUnits = map[string]int{
+		"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+		"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+		"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+		"CLF": 4, "UYW": 4,
+	}
+
+	currencies = buildTable()
+)
+
+func buildTable() map[string]Currency {
+	table := make(map[string]Currency, len(otherMinorUnits)+160)
+	for _, code := range strings.Fields(twoDecimalCodes) {
+		table[code] = Currency{Code: code, MinorUnits: 2}
+	}
+	for code, units := range otherMinorUnits {
+		table[code] = Currency{Code: code, MinorUnits: units}
+	}
+	return table
+}
+
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[code]
+	return c, ok
+}
+
+// Normalize upper-cases a currency code and checks it against ISO 4217.
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := currencies[code]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return code, nil
+}
+
+// FormatAmount renders an amount held in minor units as a plain decimal
+// string, e.g. 12345 USD as "123.45" and 12345 JPY as "12345".
+func FormatAmount(minor int64, code string) string {
+	units := 2
+	if c, ok := currencies[code]; ok {
+		units = c.MinorUnits
+	}
+
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	if units == 0 {
+		return fmt.Sprintf("%s%d", sign, minor)
+	}
+
+	scale := int64(1)
+	for i := 0; i < units; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, minor/scale, units, minor%scale)
+}
@@ -0,0 +1,194 @@
+package currency
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+// Rate is the number of units of To that one unit of From buys.
+type Rate struct {
+	From   string
+	To     string
+	Value  *big.Rat
+	Source string
+}
+
+type RateProvider interface {
+	Rate(from, to string) (*Rate, error)
+}
+
+// defaultRates are indicative mid-market rates quoted against USD, used when
+// no rates file is configured.
+var defaultRates = map[string]string{
+	"AED": "3.6725",
+	"AUD": "1.52",
+	"CAD": "1.37",
+	"CHF": "0.88",
+	"CNY": "7.24",
+	"EUR": "0.92",
+	"GBP": "0.79",
+	"HKD": "7.81",
+	"INR": "83.50",
+	"JPY": "151.20",
+	"SGD": "1.35",
+}
+
+// StaticProvider quotes every currency against a single base and derives
+// cross rates from it, so EUR->GBP is rates[GBP] / rates[EUR].
+type StaticProvider struct {
+	base   string
+	rates  map[string]*big.Rat
+	source string
+}
+
+type rateTable struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+func NewStaticProvider(base string, rates map[string]string) (*StaticProvider, error) {
+	return newStaticProvider(base, rates, "static")
+}
+
+func newStaticProvider(base string, rates map[string]string, source string) (*StaticProvider, error) {
+	base, err := Normalize(base)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &StaticProvider{
+		base:   base,
+		rates:  map[string]*big.Rat{base: big.NewRat(1, 1)},
+		source: source,
+	}
+	for code, value := range rates {
+		normalized, err := Normalize(code)
+		if err != nil {
+			return nil, err
+		}
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s", value, normalized)
+		}
+		p.rates[normalized] = rate
+	}
+	return p, nil
+}
+
+func (p *StaticProvider) Rate(from, to string) (*Rate, error) {
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s rate for %s", ErrRateUnavailable, p.base, from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s rate for %s", ErrRateUnavailable, p.base, to)
+	}
+	return &Rate{
+		From:   from,
+		To:     to,
+		Value:  new(big.Rat).Quo(toRate, fromRate),
+		Source: p.source,
+	}, nil
+}
+
+// FileProvider reads a JSON rate table of the form
+// {"base": "USD", "rates": {"EUR": "0.92"}} and picks up edits to the file
+// without a restart. If a reload fails the previous table stays in use.
+type FileProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	table   *StaticProvider
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	p := &FileProvider{path: path}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FileProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat rates file: %w", err)
+	}
+	if p.table != nil && info.ModTime().Equal(p.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("failed to read rates file: %w", err)
+	}
+	var parsed rateTable
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return fmt.Errorf("failed to parse rates file: %w", err)
+	}
+	table, err := newStaticProvider(parsed.Base, parsed.Rates, "file:"+p.path)
+	if err != nil {
+		return fmt.Errorf("invalid rates file: %w", err)
+	}
+
+	p.table = table
+	p.modTime = info.ModTime()
+	return nil
+}
+
+func (p *FileProvider) Rate(from, to string) (*Rate, error) {
+	p.mu.Lock()
+	if err := p.reload(); err != nil {
+		log.Printf("Warning: keeping previous exchange rates: %v", err)
+	}
+	table := p.table
+	p.mu.Unlock()
+
+	return table.Rate(from, to)
+}
+
+var (
+	providerOnce    sync.Once
+	defaultProvider RateProvider
+)
+
+// NewRateProviderFromEnv uses the file named by FX_RATES_FILE when set and
+// falls back to the built-in static table otherwise.
+func NewRateProviderFromEnv() (RateProvider, error) {
+	if path := os.Getenv("FX_RATES_FILE"); path != "" {
+		return NewFileProvider(path)
+	}
+	return NewStaticProvider(Default, defaultRates)
+}
+
+func DefaultProvider() RateProvider {
+	providerOnce.Do(func() {
+		if defaultProvider != nil {
+			return
+		}
+		provider, err := NewRateProviderFromEnv()
+		if err != nil {
+			log.Printf("Warning: %v, falling back to built-in exchange rates", err)
+			provider, _ = NewStaticProvider(Default, defaultRates)
+		}
+		defaultProvider = provider
+	})
+	return defaultProvider
+}
+
+// SetDefaultProvider replaces the provider used for transfers. It must be
+// called before the server starts handling requests.
+func SetDefaultProvider(p RateProvider) {
+	providerOnce.Do(func() {})
+	defaultProvider = p
+}
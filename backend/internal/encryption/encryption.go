@@ -1,54 +1,58 @@
 package encryption
 
 import (
-	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// version starts every ciphertext written with a per-record data key:
+//
+//	v1:<master key ID>:<wrapped data key>:<nonce and sealed data>
+//
+// with both binary parts in base64. Ciphertexts from before it are plain
+// base64 of the nonce and the data sealed with CARD_ENCRYPTION_KEY; base64
+// never contains a colon, so the two cannot be confused.
+const version = "v1"
+
+// EncryptionService encrypts each record with its own random data key and
+// stores that key wrapped by a master key from a KeyProvider. Rotating the
+// master key therefore only needs the small wrapped keys rewritten, which
+// Reencrypt does.
 type EncryptionService struct {
-	gcm cipher.AEAD
+	keys   KeyProvider
+	legacy cipher.AEAD
 }
 
 func NewEncryptionService() (*EncryptionService, error) {
-	keyString := os.Getenv("CARD_ENCRYPTION_KEY")
-	if keyString == "" {
-		return nil, fmt.Errorf("CARD_ENCRYPTION_KEY environment variable is not set")
-	}
-
-	var key []byte
-	var err error
-
-	if len(keyString)%2 == 0 && len(keyString) >= 32 {
-		key, err = hex.DecodeString(keyString)
-		if err != nil {
-			key = []byte(keyString)
-		}
-	} else {
-		key = []byte(keyString)
-	}
-
-	if len(key) != 32 {
-		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d bytes. "+
-			"Provide either a 32-byte string or a 64-character hex string", len(key))
-	}
-
-	block, err := aes.NewCipher(key)
+	keys, err := DefaultProvider()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+		return nil, err
 	}
+	return &EncryptionService{keys: keys, legacy: legacyAEAD()}, nil
+}
 
-	gcm, err := cipher.NewGCM(block)
+// CurrentKeyID is the master key new ciphertexts are written under.
+func (e *EncryptionService) CurrentKeyID() string {
+	return e.keys.CurrentKeyID()
+}
+
+// KeyID returns the master key a ciphertext was written under, or "" for
+// ciphertexts from before key rotation.
+func (e *EncryptionService) KeyID(ciphertext string) string {
+	keyID, _, _, err := split(ciphertext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return ""
 	}
-
-	return &EncryptionService{gcm: gcm}, nil
+	return keyID
 }
 
 func (e *EncryptionService) Encrypt(plaintext string) (string, error) {
@@ -56,35 +60,226 @@ func (e *EncryptionService) Encrypt(plaintext string) (string, error) {
 		return "", fmt.Errorf("plaintext cannot be empty")
 	}
 
-	nonce := make([]byte, e.gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
 	}
-
-	ciphertext := e.gcm.Seal(nonce, nonce, []byte(plaintext), nil)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	sealed, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	keyID := e.keys.CurrentKeyID()
+	wrapped, err := e.keys.WrapKey(keyID, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return join(keyID, wrapped, sealed), nil
 }
 
 func (e *EncryptionService) Decrypt(ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", fmt.Errorf("ciphertext cannot be empty")
 	}
+	if !strings.HasPrefix(ciphertext, version+":") {
+		return e.decryptLegacy(ciphertext)
+	}
+
+	keyID, wrapped, sealed, err := split(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := e.keys.UnwrapKey(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Reencrypt moves a ciphertext to the current master key. Ciphertexts
+// with a data key only have it rewrapped; older ones are encrypted afresh.
+// Ciphertexts already under the current key are returned unchanged.
+func (e *EncryptionService) Reencrypt(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, version+":") {
+		plaintext, err := e.decryptLegacy(ciphertext)
+		if err != nil {
+			return "", err
+		}
+		return e.Encrypt(plaintext)
+	}
+
+	keyID, wrapped, sealed, err := split(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	current := e.keys.CurrentKeyID()
+	if keyID == current {
+		return ciphertext, nil
+	}
+	dataKey, err := e.keys.UnwrapKey(keyID, wrapped)
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := e.keys.WrapKey(current, dataKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	return join(current, rewrapped, sealed), nil
+}
 
+func (e *EncryptionService) decryptLegacy(ciphertext string) (string, error) {
+	if e.legacy == nil {
+		return "", fmt.Errorf("ciphertext predates key rotation and CARD_ENCRYPTION_KEY is not set")
+	}
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode base64: %w", err)
 	}
+	plaintext, err := openWith(e.legacy, data)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func join(keyID string, wrapped, sealed []byte) string {
+	return strings.Join([]string{version, keyID,
+		base64.StdEncoding.EncodeToString(wrapped), base64.StdEncoding.EncodeToString(sealed)}, ":")
+}
+
+func split(ciphertext string) (keyID string, wrapped, sealed []byte, err error) {
+	parts := strings.Split(ciphertext, ":")
+	if len(parts) != 4 || parts[0] != version {
+		return "", nil, nil, fmt.Errorf("unrecognized ciphertext format")
+	}
+	if wrapped, err = base64.StdEncoding.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to decode wrapped key: %w", err)
+	}
+	if sealed, err = base64.StdEncoding.DecodeString(parts[3]); err != nil {
+		return "", nil, nil, fmt.Errorf("failed to decode base64: %w", err)
+	}
+	return parts[1], wrapped, sealed, nil
+}
+
+func seal(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return openWith(aead, data)
+}
 
-	nonceSize := e.gcm.NonceSize()
+func openWith(aead cipher.AEAD, data []byte) ([]byte, error) {
+	nonceSize := aead.NonceSize()
 	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+		return nil, fmt.Errorf("ciphertext too short")
 	}
 
 	nonce, encryptedData := data[:nonceSize], data[nonceSize:]
-	plaintext, err := e.gcm.Open(nil, nonce, encryptedData, nil)
+	plaintext, err := aead.Open(nil, nonce, encryptedData, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
 	}
+	return plaintext, nil
+}
 
-	return string(plaintext), nil
+// legacyAEAD is the cipher for ciphertexts from before key rotation, or
+// nil when CARD_ENCRYPTION_KEY is not set.
+func legacyAEAD() cipher.AEAD {
+	key, err := parseKey(os.Getenv("CARD_ENCRYPTION_KEY"))
+	if err != nil {
+		return nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil
+	}
+	return aead
+}
+
+// NewProviderFromEnv builds the key provider named by
+// ENCRYPTION_KEY_PROVIDER:
+//
+//   - env (the default): master keys from ENCRYPTION_MASTER_KEYS, or
+//     CARD_ENCRYPTION_KEY alone; see KeyringFromEnv
+//   - file: master keys from the JSON file at ENCRYPTION_KEYRING_FILE
+//   - local-kms: a LocalKMS keeping its keys in LOCAL_KMS_FILE (default
+//     local-kms.json), which creates a new master key on start once the
+//     current one is LOCAL_KMS_ROTATION_DAYS old, if set
+func NewProviderFromEnv() (KeyProvider, error) {
+	switch name := os.Getenv("ENCRYPTION_KEY_PROVIDER"); name {
+	case "", "env":
+		return KeyringFromEnv()
+	case "file":
+		path := os.Getenv("ENCRYPTION_KEYRING_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("ENCRYPTION_KEYRING_FILE environment variable is not set")
+		}
+		return KeyringFromFile(path)
+	case "local-kms":
+		path := os.Getenv("LOCAL_KMS_FILE")
+		if path == "" {
+			path = "local-kms.json"
+		}
+		kms, err := OpenLocalKMS(path)
+		if err != nil {
+			return nil, err
+		}
+		if raw := os.Getenv("LOCAL_KMS_ROTATION_DAYS"); raw != "" {
+			days, err := strconv.Atoi(raw)
+			if err != nil || days <= 0 {
+				return nil, fmt.Errorf("invalid LOCAL_KMS_ROTATION_DAYS %q", raw)
+			}
+			if kms.CurrentKeyAge() >= time.Duration(days)*24*time.Hour {
+				id, err := kms.Rotate()
+				if err != nil {
+					return nil, err
+				}
+				log.Printf("Local KMS rotated to master key %s", id)
+			}
+		}
+		return kms, nil
+	default:
+		return nil, fmt.Errorf("unknown ENCRYPTION_KEY_PROVIDER %q", name)
+	}
+}
+
+var (
+	providerOnce    sync.Once
+	defaultProvider KeyProvider
+	providerErr     error
+)
+
+// DefaultProvider returns the key provider built from the environment on
+// first use.
+func DefaultProvider() (KeyProvider, error) {
+	providerOnce.Do(func() {
+		if defaultProvider != nil {
+			return
+		}
+		defaultProvider, providerErr = NewProviderFromEnv()
+	})
+	return defaultProvider, providerErr
+}
+
+// SetDefaultProvider replaces the key provider. It must be called before
+// anything is encrypted.
+func SetDefaultProvider(p KeyProvider) {
+	providerOnce.Do(func() {})
+	defaultProvider, providerErr = p, nil
 }
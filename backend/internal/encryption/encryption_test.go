@@ -0,0 +1,211 @@
+package encryption
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = b + byte(i)
+	}
+	return key
+}
+
+func testKeyring(t *testing.T, current string) *Keyring {
+	t.Helper()
+	ring, err := NewKeyring("test", current, map[string][]byte{"old": testKey(1), "new": testKey(2)})
+	if err != nil {
+		t.Fatalf("NewKeyring() = %v", err)
+	}
+	return ring
+}
+
+// legacyCiphertext encrypts plaintext the way ciphertexts were written
+// before key rotation: base64 of the nonce and the data sealed with key.
+func legacyCiphertext(t *testing.T, key []byte, plaintext string) string {
+	t.Helper()
+	sealed, err := seal(key, []byte(plaintext))
+	if err != nil {
+		t.Fatalf("seal() = %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	e := &EncryptionService{keys: testKeyring(t, "new")}
+	for _, plaintext := range []string{"4111111111111111", "x", "card number with spaces and ünïcode", strings.Repeat("9", 4096)} {
+		ciphertext, err := e.Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q) = %v", plaintext, err)
+		}
+
+		parts := strings.Split(ciphertext, ":")
+		if len(parts) != 4 || parts[0] != version || parts[1] != "new" {
+			t.Errorf("Encrypt(%q) = %q, want v1:new:<wrapped>:<sealed>", plaintext, ciphertext)
+		}
+		if len(plaintext) >= 16 && strings.Contains(ciphertext, plaintext) {
+			t.Errorf("Encrypt(%q) contains the plaintext", plaintext)
+		}
+		if got := e.KeyID(ciphertext); got != "new" {
+			t.Errorf("KeyID() = %q, want new", got)
+		}
+
+		got, err := e.Decrypt(ciphertext)
+		if err != nil || got != plaintext {
+			t.Errorf("Decrypt(Encrypt(%q)) = %q, %v", plaintext, got, err)
+		}
+	}
+}
+
+func TestEncryptUsesFreshDataKeys(t *testing.T) {
+	e := &EncryptionService{keys: testKeyring(t, "new")}
+	first, _ := e.Encrypt("4111111111111111")
+	second, _ := e.Encrypt("4111111111111111")
+	if first == second {
+		t.Fatal("encrypting the same plaintext twice gave the same ciphertext")
+	}
+	if strings.Split(first, ":")[2] == strings.Split(second, ":")[2] {
+		t.Error("encrypting the same plaintext twice wrapped the same data key")
+	}
+}
+
+func TestEncryptRejectsEmpty(t *testing.T) {
+	e := &EncryptionService{keys: testKeyring(t, "new")}
+	if _, err := e.Encrypt(""); err == nil {
+		t.Error("Encrypt(\"\") = nil, want an error")
+	}
+	if _, err := e.Decrypt(""); err == nil {
+		t.Error("Decrypt(\"\") = nil, want an error")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	legacyKey := testKey(9)
+	ciphertext := legacyCiphertext(t, legacyKey, "4111111111111111")
+
+	t.Setenv("CARD_ENCRYPTION_KEY", hex.EncodeToString(legacyKey))
+	e := &EncryptionService{keys: testKeyring(t, "new"), legacy: legacyAEAD()}
+	if e.legacy == nil {
+		t.Fatal("legacyAEAD() = nil with CARD_ENCRYPTION_KEY set")
+	}
+	if got := e.KeyID(ciphertext); got != "" {
+		t.Errorf("KeyID(legacy) = %q, want empty", got)
+	}
+	got, err := e.Decrypt(ciphertext)
+	if err != nil || got != "4111111111111111" {
+		t.Errorf("Decrypt(legacy) = %q, %v", got, err)
+	}
+
+	t.Setenv("CARD_ENCRYPTION_KEY", hex.EncodeToString(testKey(10)))
+	wrongKey := &EncryptionService{keys: testKeyring(t, "new"), legacy: legacyAEAD()}
+	if _, err := wrongKey.Decrypt(ciphertext); err == nil {
+		t.Error("Decrypt(legacy) with another CARD_ENCRYPTION_KEY = nil, want an error")
+	}
+
+	t.Setenv("CARD_ENCRYPTION_KEY", "")
+	withoutKey := &EncryptionService{keys: testKeyring(t, "new"), legacy: legacyAEAD()}
+	if _, err := withoutKey.Decrypt(ciphertext); err == nil || !strings.Contains(err.Error(), "CARD_ENCRYPTION_KEY") {
+		t.Errorf("Decrypt(legacy) without CARD_ENCRYPTION_KEY = %v, want an error naming it", err)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	e := &EncryptionService{keys: testKeyring(t, "new")}
+	ciphertext, err := e.Encrypt("4111111111111111")
+	if err != nil {
+		t.Fatalf("Encrypt() = %v", err)
+	}
+	parts := strings.Split(ciphertext, ":")
+
+	flip := func(part string) string {
+		raw, _ := base64.StdEncoding.DecodeString(part)
+		raw[len(raw)-1] ^= 1
+		return base64.StdEncoding.EncodeToString(raw)
+	}
+	other, _ := e.Encrypt("5555555555554444")
+	otherParts := strings.Split(other, ":")
+
+	tests := []struct {
+		name       string
+		ciphertext string
+	}{
+		{"sealed data changed", strings.Join([]string{parts[0], parts[1], parts[2], flip(parts[3])}, ":")},
+		{"wrapped key changed", strings.Join([]string{parts[0], parts[1], flip(parts[2]), parts[3]}, ":")},
+		{"key ID swapped", strings.Join([]string{parts[0], "old", parts[2], parts[3]}, ":")},
+		{"unknown key ID", strings.Join([]string{parts[0], "gone", parts[2], parts[3]}, ":")},
+		{"data key of another record", strings.Join([]string{parts[0], parts[1], otherParts[2], parts[3]}, ":")},
+		{"sealed data truncated", strings.Join([]string{parts[0], parts[1], parts[2], base64.StdEncoding.EncodeToString([]byte("short"))}, ":")},
+		{"not base64", strings.Join([]string{parts[0], parts[1], parts[2], "%%%"}, ":")},
+		{"missing part", strings.Join(parts[:3], ":")},
+		{"extra part", ciphertext + ":extra"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := e.Decrypt(tt.ciphertext); err == nil {
+				t.Errorf("Decrypt() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	legacyKey := testKey(9)
+	old := &EncryptionService{keys: testKeyring(t, "old")}
+	current := &EncryptionService{keys: testKeyring(t, "new"), legacy: mustAEAD(t, legacyKey)}
+
+	underOld, err := old.Encrypt("4111111111111111")
+	if err != nil {
+		t.Fatalf("Encrypt() = %v", err)
+	}
+	underNew, err := current.Encrypt("4111111111111111")
+	if err != nil {
+		t.Fatalf("Encrypt() = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext string
+		// sameData is whether the sealed data is kept and only the data
+		// key rewrapped.
+		sameData  bool
+		unchanged bool
+	}{
+		{"older master key", underOld, true, false},
+		{"current master key", underNew, true, true},
+		{"before key rotation", legacyCiphertext(t, legacyKey, "4111111111111111"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := current.Reencrypt(tt.ciphertext)
+			if err != nil {
+				t.Fatalf("Reencrypt() = %v", err)
+			}
+			if current.KeyID(got) != "new" {
+				t.Errorf("KeyID(Reencrypt()) = %q, want new", current.KeyID(got))
+			}
+			if (got == tt.ciphertext) != tt.unchanged {
+				t.Errorf("Reencrypt() changed the ciphertext = %v, want %v", got != tt.ciphertext, !tt.unchanged)
+			}
+			if tt.sameData && strings.Split(got, ":")[3] != strings.Split(tt.ciphertext, ":")[3] {
+				t.Error("Reencrypt() re-sealed the data instead of rewrapping its key")
+			}
+			if plaintext, err := current.Decrypt(got); err != nil || plaintext != "4111111111111111" {
+				t.Errorf("Decrypt(Reencrypt()) = %q, %v", plaintext, err)
+			}
+		})
+	}
+}
+
+func mustAEAD(t *testing.T, key []byte) cipher.AEAD {
+	t.Helper()
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatalf("newAEAD() = %v", err)
+	}
+	return aead
+}
@@ -0,0 +1,204 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// KeyProvider holds the master keys that per-record data keys are wrapped
+// with. Master keys are named by an ID that is stored with every
+// ciphertext, so retired keys keep decrypting old data while new data is
+// wrapped with CurrentKeyID.
+type KeyProvider interface {
+	Name() string
+	CurrentKeyID() string
+	WrapKey(keyID string, dataKey []byte) ([]byte, error)
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Keyring is a KeyProvider whose master keys are held in memory.
+type Keyring struct {
+	name    string
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from 32-byte master keys. current must be
+// one of them.
+func NewKeyring(name, current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{name: name, current: current, keys: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key ID %q: use up to 64 letters, digits, '.', '_' or '-'", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the keyring", current)
+	}
+	return k, nil
+}
+
+func (k *Keyring) Name() string         { return k.name }
+func (k *Keyring) CurrentKeyID() string { return k.current }
+
+// KeyIDs lists the keyring's master keys in order.
+func (k *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WrapKey encrypts a data key with a master key. The key ID is bound to the
+// result, so a wrapped key cannot be passed off as wrapped by another key.
+func (k *Keyring) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func (k *Keyring) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// KeyringFromEnv reads master keys from ENCRYPTION_MASTER_KEYS as
+// comma-separated id=key pairs. ENCRYPTION_CURRENT_KEY picks the one new
+// data is wrapped with and defaults to the last listed. Without
+// ENCRYPTION_MASTER_KEYS, CARD_ENCRYPTION_KEY is the only master key, with
+// the ID "default".
+func KeyringFromEnv() (*Keyring, error) {
+	raw := strings.TrimSpace(os.Getenv("ENCRYPTION_MASTER_KEYS"))
+	if raw == "" {
+		key, err := parseKey(os.Getenv("CARD_ENCRYPTION_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("CARD_ENCRYPTION_KEY: %w", err)
+		}
+		return NewKeyring("env", "default", map[string][]byte{"default": key})
+	}
+
+	keys := map[string][]byte{}
+	current := ""
+	for _, pair := range strings.Split(raw, ",") {
+		id, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("ENCRYPTION_MASTER_KEYS: expected id=key, got %q", pair)
+		}
+		key, err := parseKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_MASTER_KEYS: key %s: %w", id, err)
+		}
+		keys[id] = key
+		current = id
+	}
+	if id := os.Getenv("ENCRYPTION_CURRENT_KEY"); id != "" {
+		current = id
+	}
+	return NewKeyring("env", current, keys)
+}
+
+// keyringFile is the layout of ENCRYPTION_KEYRING_FILE: hex-encoded master
+// keys by ID and the ID of the current one.
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// KeyringFromFile reads master keys from a JSON file such as
+//
+//	{"current": "2026-10", "keys": {"2026-04": "<64 hex chars>", "2026-10": "<64 hex chars>"}}
+func KeyringFromFile(path string) (*Keyring, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring file: %w", err)
+	}
+	var file keyringFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid keyring file %s: %w", path, err)
+	}
+	keys := map[string][]byte{}
+	for id, value := range file.Keys {
+		key, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("keyring file %s: key %s is not hex", path, id)
+		}
+		keys[id] = key
+	}
+	return NewKeyring("file", file.Current, keys)
+}
+
+// parseKey accepts either a 64-character hex string or a raw 32-byte
+// string.
+func parseKey(keyString string) ([]byte, error) {
+	if keyString == "" {
+		return nil, fmt.Errorf("key is not set")
+	}
+
+	var key []byte
+	var err error
+
+	if len(keyString)%2 == 0 && len(keyString) >= 32 {
+		key, err = hex.DecodeString(keyString)
+		if err != nil {
+			key = []byte(keyString)
+		}
+	} else {
+		key = []byte(keyString)
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d bytes. "+
+			"Provide either a 32-byte string or a 64-character hex string", len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d bytes", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
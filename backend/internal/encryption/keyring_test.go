@@ -0,0 +1,125 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewKeyringRejectsBadKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		keys    map[string][]byte
+		want    string
+	}{
+		{"current key missing", "b", map[string][]byte{"a": testKey(1)}, `current key "b" is not in the keyring`},
+		{"short key", "a", map[string][]byte{"a": testKey(1)[:16]}, "key a: encryption key must be 32 bytes"},
+		{"key ID with a colon", "a:1", map[string][]byte{"a:1": testKey(1)}, `invalid key ID "a:1"`},
+		{"empty key ID", "", map[string][]byte{"": testKey(1)}, `invalid key ID ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring("test", tt.current, tt.keys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewKeyring() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringWrapBindsKeyID(t *testing.T) {
+	ring := testKeyring(t, "new")
+	dataKey := testKey(7)
+
+	wrapped, err := ring.WrapKey("new", dataKey)
+	if err != nil {
+		t.Fatalf("WrapKey() = %v", err)
+	}
+	if got, err := ring.UnwrapKey("new", wrapped); err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("UnwrapKey(WrapKey()) = %x, %v", got, err)
+	}
+	if _, err := ring.UnwrapKey("old", wrapped); err == nil {
+		t.Error("UnwrapKey() under another master key = nil, want an error")
+	}
+	if _, err := ring.WrapKey("gone", dataKey); err == nil {
+		t.Error("WrapKey() with an unknown master key = nil, want an error")
+	}
+	if got := ring.KeyIDs(); !reflect.DeepEqual(got, []string{"new", "old"}) {
+		t.Errorf("KeyIDs() = %v, want [new old]", got)
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	a, b := hex.EncodeToString(testKey(1)), hex.EncodeToString(testKey(2))
+	tests := []struct {
+		name        string
+		masterKeys  string
+		currentKey  string
+		cardKey     string
+		wantCurrent string
+		wantIDs     []string
+		wantErr     bool
+	}{
+		{"CARD_ENCRYPTION_KEY alone", "", "", a, "default", []string{"default"}, false},
+		{"raw 32-byte CARD_ENCRYPTION_KEY", "", "", strings.Repeat("k", 32), "default", []string{"default"}, false},
+		{"last listed key is current", "2026-04=" + a + ", 2026-10=" + b, "", a, "2026-10", []string{"2026-04", "2026-10"}, false},
+		{"ENCRYPTION_CURRENT_KEY picks the key", "2026-04=" + a + ",2026-10=" + b, "2026-04", "", "2026-04", []string{"2026-04", "2026-10"}, false},
+		{"ENCRYPTION_CURRENT_KEY not listed", "2026-04=" + a, "2026-10", "", "", nil, true},
+		{"pair without a key", "2026-04", "", "", "", nil, true},
+		{"key of the wrong length", "2026-04=" + a[:40], "", "", "", nil, true},
+		{"no keys at all", "", "", "", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENCRYPTION_MASTER_KEYS", tt.masterKeys)
+			t.Setenv("ENCRYPTION_CURRENT_KEY", tt.currentKey)
+			t.Setenv("CARD_ENCRYPTION_KEY", tt.cardKey)
+
+			ring, err := KeyringFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("KeyringFromEnv() = %s, want an error", ring.CurrentKeyID())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("KeyringFromEnv() = %v", err)
+			}
+			if ring.CurrentKeyID() != tt.wantCurrent {
+				t.Errorf("CurrentKeyID() = %q, want %q", ring.CurrentKeyID(), tt.wantCurrent)
+			}
+			if got := ring.KeyIDs(); !reflect.DeepEqual(got, tt.wantIDs) {
+				t.Errorf("KeyIDs() = %v, want %v", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestKeyringFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	raw := `{"current": "2026-10", "keys": {"2026-04": "` + hex.EncodeToString(testKey(1)) +
+		`", "2026-10": "` + hex.EncodeToString(testKey(2)) + `"}}`
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ring, err := KeyringFromFile(path)
+	if err != nil {
+		t.Fatalf("KeyringFromFile() = %v", err)
+	}
+	if ring.CurrentKeyID() != "2026-10" || ring.Name() != "file" {
+		t.Errorf("KeyringFromFile() = %s keyring with current key %q", ring.Name(), ring.CurrentKeyID())
+	}
+
+	if err := os.WriteFile(path, []byte(`{"current": "a", "keys": {"a": "not hex"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := KeyringFromFile(path); err == nil {
+		t.Error("KeyringFromFile() with a key that is not hex = nil, want an error")
+	}
+}
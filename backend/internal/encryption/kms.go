@@ -0,0 +1,152 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// LocalKMS stands in for a hosted key management service in development
+// and tests. Like one, it creates its own master keys and never hands them
+// out; callers only get data keys wrapped and unwrapped. The keys live in a
+// file only it reads and writes.
+type LocalKMS struct {
+	mu    sync.Mutex
+	path  string
+	state localKMSState
+	ring  *Keyring
+}
+
+type localKMSKey struct {
+	Key       string    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type localKMSState struct {
+	Current string                 `json:"current"`
+	Keys    map[string]localKMSKey `json:"keys"`
+}
+
+// OpenLocalKMS loads the key file at path, creating it with a first master
+// key if it does not exist.
+func OpenLocalKMS(path string) (*LocalKMS, error) {
+	k := &LocalKMS{path: path}
+	raw, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		k.state.Keys = map[string]localKMSKey{}
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read local KMS keys: %w", err)
+	}
+
+	if err := json.Unmarshal(raw, &k.state); err != nil {
+		return nil, fmt.Errorf("invalid local KMS key file %s: %w", path, err)
+	}
+	if k.ring, err = k.keyring(k.state); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *LocalKMS) Name() string { return "local-kms" }
+
+func (k *LocalKMS) CurrentKeyID() string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.ring.CurrentKeyID()
+}
+
+func (k *LocalKMS) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	k.mu.Lock()
+	ring := k.ring
+	k.mu.Unlock()
+	return ring.WrapKey(keyID, dataKey)
+}
+
+func (k *LocalKMS) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.Lock()
+	ring := k.ring
+	k.mu.Unlock()
+	return ring.UnwrapKey(keyID, wrapped)
+}
+
+// CurrentKeyAge is how long ago the current master key was created.
+func (k *LocalKMS) CurrentKeyAge() time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return time.Since(k.state.Keys[k.state.Current].CreatedAt)
+}
+
+// Rotate creates a master key and makes it current. Older keys are kept so
+// existing data keys can still be unwrapped.
+func (k *LocalKMS) Rotate() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate master key: %w", err)
+	}
+	now := time.Now().UTC()
+	id := "local-" + now.Format("20060102T150405.000")
+	if _, exists := k.state.Keys[id]; exists {
+		return "", fmt.Errorf("master key %s already exists", id)
+	}
+
+	next := localKMSState{Current: id, Keys: map[string]localKMSKey{}}
+	for existing, entry := range k.state.Keys {
+		next.Keys[existing] = entry
+	}
+	next.Keys[id] = localKMSKey{Key: hex.EncodeToString(key), CreatedAt: now}
+
+	ring, err := k.keyring(next)
+	if err != nil {
+		return "", err
+	}
+	if err := k.save(next); err != nil {
+		return "", err
+	}
+	k.state, k.ring = next, ring
+	return id, nil
+}
+
+func (k *LocalKMS) keyring(state localKMSState) (*Keyring, error) {
+	keys := map[string][]byte{}
+	for id, entry := range state.Keys {
+		key, err := hex.DecodeString(entry.Key)
+		if err != nil {
+			return nil, fmt.Errorf("local KMS key %s is not hex", id)
+		}
+		keys[id] = key
+	}
+	ring, err := NewKeyring(k.Name(), state.Current, keys)
+	if err != nil {
+		return nil, fmt.Errorf("local KMS key file %s: %w", k.path, err)
+	}
+	return ring, nil
+}
+
+func (k *LocalKMS) save(state localKMSState) error {
+	raw, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("failed to write local KMS keys: %w", err)
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return fmt.Errorf("failed to write local KMS keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package encryption
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLocalKMS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "local-kms.json")
+	kms, err := OpenLocalKMS(path)
+	if err != nil {
+		t.Fatalf("OpenLocalKMS() = %v", err)
+	}
+	first := kms.CurrentKeyID()
+
+	e := &EncryptionService{keys: kms}
+	ciphertext, err := e.Encrypt("4111111111111111")
+	if err != nil {
+		t.Fatalf("Encrypt() = %v", err)
+	}
+
+	// Key IDs are creation times to the millisecond.
+	time.Sleep(2 * time.Millisecond)
+	second, err := kms.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate() = %v", err)
+	}
+	if second == first || kms.CurrentKeyID() != second {
+		t.Errorf("CurrentKeyID() = %s after rotating to %s", kms.CurrentKeyID(), second)
+	}
+
+	reopened, err := OpenLocalKMS(path)
+	if err != nil {
+		t.Fatalf("reopening the local KMS = %v", err)
+	}
+	if reopened.CurrentKeyID() != second {
+		t.Errorf("reopened CurrentKeyID() = %s, want %s", reopened.CurrentKeyID(), second)
+	}
+	e = &EncryptionService{keys: reopened}
+	if e.KeyID(ciphertext) != first {
+		t.Errorf("KeyID() = %s, want %s", e.KeyID(ciphertext), first)
+	}
+	if plaintext, err := e.Decrypt(ciphertext); err != nil || plaintext != "4111111111111111" {
+		t.Errorf("Decrypt() under a retired local KMS key = %q, %v", plaintext, err)
+	}
+	rotated, err := e.Reencrypt(ciphertext)
+	if err != nil || e.KeyID(rotated) != second {
+		t.Errorf("Reencrypt() = %q, %v, want a ciphertext under %s", rotated, err, second)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("local KMS key file mode = %o, want 600", perm)
+	}
+}
@@ -0,0 +1,245 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"paytm/internal/models"
+)
+
+type Type string
+
+const (
+	TransactionCompleted Type = "transaction.completed"
+	TransactionFailed    Type = "transaction.failed"
+	TransactionCancelled Type = "transaction.cancelled"
+	TransactionRefunded  Type = "transaction.refunded"
+	CardAdded            Type = "card.added"
+	CardRemoved          Type = "card.removed"
+	CardExpiring         Type = "card.expiring"
+	CardExpired          Type = "card.expired"
+	FriendAdded          Type = "friend.added"
+	FriendRemoved        Type = "friend.removed"
+	SecurityLogin        Type = "security.login"
+	SecurityLoginFailed  Type = "security.login_failed"
+	BudgetThreshold      Type = "budget.threshold_reached"
+)
+
+// Types lists every event type that can be subscribed to.
+var Types = []Type{
+	TransactionCompleted,
+	TransactionFailed,
+	TransactionCancelled,
+	TransactionRefunded,
+	CardAdded,
+	CardRemoved,
+	CardExpiring,
+	CardExpired,
+	FriendAdded,
+	FriendRemoved,
+	SecurityLogin,
+	SecurityLoginFailed,
+	BudgetThreshold,
+}
+
+func IsValidType(t string) bool {
+	for _, known := range Types {
+		if string(known) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something that happened to one or more users. UserIDs are the
+// users it concerns and decide who gets to see it; they are not part of the
+// payload. Sequence is the event's position in the outbox, set once it has
+// been recorded.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      Type        `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+	UserIDs   []uint      `json:"-"`
+	Sequence  uint        `json:"-"`
+}
+
+// Concerns reports whether the event is addressed to the user.
+func (e *Event) Concerns(userID uint) bool {
+	for _, id := range e.UserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func New(t Type, data interface{}, userIDs ...uint) *Event {
+	return &Event{
+		ID:        newID(),
+		Type:      t,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+		UserIDs:   userIDs,
+	}
+}
+
+// Payload is the JSON envelope sent to subscribers.
+func (e *Event) Payload() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("events: failed to read random bytes: " + err.Error())
+	}
+	return "evt_" + hex.EncodeToString(b)
+}
+
+type TransactionData struct {
+	ID                    uint       `json:"id"`
+	SenderID              uint       `json:"sender_id"`
+	ReceiverID            uint       `json:"receiver_id"`
+	Amount                int64      `json:"amount"`
+	Fee                   int64      `json:"fee"`
+	Currency              string     `json:"currency"`
+	ReceivedAmount        int64      `json:"received_amount"`
+	ReceivedCurrency      string     `json:"received_currency"`
+	Type                  string     `json:"type"`
+	PaymentMethod         string     `json:"payment_method,omitempty"`
+	Status                string     `json:"status"`
+	FailureReason         string     `json:"failure_reason,omitempty"`
+	Description           string     `json:"description"`
+	OriginalTransactionID *uint      `json:"original_transaction_id,omitempty"`
+	RefundedAmount        int64      `json:"refunded_amount"`
+	Timestamp             time.Time  `json:"timestamp"`
+	StatusChangedAt       *time.Time `json:"status_changed_at,omitempty"`
+}
+
+type CardData struct {
+	ID           uint   `json:"id"`
+	UserID       uint   `json:"user_id"`
+	MaskedNumber string `json:"masked_number"`
+	CardType     string `json:"card_type"`
+	Nickname     string `json:"nickname,omitempty"`
+	ExpiryMonth  string `json:"expiry_month"`
+	ExpiryYear   string `json:"expiry_year"`
+}
+
+type FriendData struct {
+	UserID   uint `json:"user_id"`
+	FriendID uint `json:"friend_id"`
+}
+
+type SecurityData struct {
+	UserID    uint   `json:"user_id"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// BudgetData reports how much of a budget was spent when it reached
+// Threshold percent. TransactionID is the transfer that crossed it, when
+// there was one.
+type BudgetData struct {
+	BudgetID       uint   `json:"budget_id"`
+	UserID         uint   `json:"user_id"`
+	Name           string `json:"name"`
+	CategoryID     *uint  `json:"category_id,omitempty"`
+	CounterpartyID *uint  `json:"counterparty_id,omitempty"`
+	Period         string `json:"period"`
+	Threshold      int    `json:"threshold"`
+	Amount         int64  `json:"amount"`
+	Spent          int64  `json:"spent"`
+	Currency       string `json:"currency"`
+	TransactionID  *uint  `json:"transaction_id,omitempty"`
+}
+
+// ForTransaction builds an event about a transaction, addressed to both of
+// its parties. Failed and cancelled transactions only concern the sender:
+// the receiver never expected the money, and the failure reason is about
+// the sender's wallet or risk checks.
+func ForTransaction(t Type, txn *models.Transaction) *Event {
+	data := TransactionData{
+		ID:                    txn.ID,
+		SenderID:              txn.SenderID,
+		ReceiverID:            txn.ReceiverID,
+		Amount:                txn.Amount,
+		Fee:                   txn.Fee,
+		Currency:              txn.Currency,
+		ReceivedAmount:        txn.ReceivedAmount,
+		ReceivedCurrency:      txn.ReceivedCurrency,
+		Type:                  string(txn.Type),
+		PaymentMethod:         string(txn.PaymentMethod),
+		Status:                string(txn.Status),
+		FailureReason:         txn.FailureReason,
+		Description:           txn.Description,
+		OriginalTransactionID: txn.OriginalTransactionID,
+		RefundedAmount:        txn.RefundedAmount,
+		Timestamp:             txn.Timestamp,
+		StatusChangedAt:       txn.StatusChangedAt,
+	}
+	if txn.SenderID == txn.ReceiverID || t == TransactionFailed || t == TransactionCancelled {
+		return New(t, data, txn.SenderID)
+	}
+	return New(t, data, txn.SenderID, txn.ReceiverID)
+}
+
+// ForTransition returns the event announcing that a transaction reached a
+// status, or nil for statuses nobody outside needs to hear about.
+func ForTransition(txn *models.Transaction) *Event {
+	switch txn.Status {
+	case models.TransactionStatusCompleted:
+		return ForTransaction(TransactionCompleted, txn)
+	case models.TransactionStatusFailed:
+		return ForTransaction(TransactionFailed, txn)
+	case models.TransactionStatusCancelled:
+		return ForTransaction(TransactionCancelled, txn)
+	case models.TransactionStatusPartiallyRefunded, models.TransactionStatusReversed:
+		return ForTransaction(TransactionRefunded, txn)
+	}
+	return nil
+}
+
+func ForCard(t Type, card *models.Card) *Event {
+	return New(t, CardData{
+		ID:           card.ID,
+		UserID:       card.UserID,
+		MaskedNumber: card.MaskedNumber,
+		CardType:     string(card.CardType),
+		Nickname:     card.Nickname,
+		ExpiryMonth:  card.ExpiryMonth,
+		ExpiryYear:   card.ExpiryYear,
+	}, card.UserID)
+}
+
+// ForFriendship builds an event about a friendship, addressed to both users.
+func ForFriendship(t Type, userID, friendID uint) *Event {
+	return New(t, FriendData{UserID: userID, FriendID: friendID}, userID, friendID)
+}
+
+// ForSecurity builds an event about the security of a user's account, such
+// as a sign-in, addressed to that user only.
+func ForSecurity(t Type, userID uint, ipAddress, userAgent string) *Event {
+	return New(t, SecurityData{UserID: userID, IPAddress: ipAddress, UserAgent: userAgent}, userID)
+}
+
+// ForBudget builds the alert for a budget reaching a threshold, addressed
+// to its owner only.
+func ForBudget(budget *models.Budget, alert *models.BudgetAlert) *Event {
+	return New(BudgetThreshold, BudgetData{
+		BudgetID:       budget.ID,
+		UserID:         budget.UserID,
+		Name:           budget.Name,
+		CategoryID:     budget.CategoryID,
+		CounterpartyID: budget.CounterpartyID,
+		Period:         alert.Period,
+		Threshold:      alert.Threshold,
+		Amount:         budget.Amount,
+		Spent:          alert.Spent,
+		Currency:       budget.Currency,
+		TransactionID:  alert.TransactionID,
+	}, budget.UserID)
+}
@@ -0,0 +1,638 @@
+package expense
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/currency"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/transaction"
+)
+
+type CreateGroupRequest struct {
+	Name      string `json:"name"`
+	Currency  string `json:"currency,omitempty"`
+	MemberIDs []uint `json:"member_ids"`
+}
+
+type AddMemberRequest struct {
+	UserID uint `json:"user_id"`
+}
+
+type CreateExpenseRequest struct {
+	Description string       `json:"description"`
+	Amount      int64        `json:"amount"`
+	Currency    string       `json:"currency,omitempty"`
+	PaidByID    uint         `json:"paid_by_id,omitempty"`
+	SplitMethod string       `json:"split_method"`
+	Splits      []SplitInput `json:"splits,omitempty"`
+}
+
+type MemberResponse struct {
+	UserID  uint   `json:"user_id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Balance int64  `json:"balance"`
+}
+
+type ShareResponse struct {
+	UserID uint  `json:"user_id"`
+	Shares int64 `json:"shares,omitempty"`
+	Amount int64 `json:"amount"`
+}
+
+type ExpenseResponse struct {
+	ID          uint            `json:"id"`
+	Description string          `json:"description"`
+	Amount      int64           `json:"amount"`
+	Currency    string          `json:"currency"`
+	PaidByID    uint            `json:"paid_by_id"`
+	SplitMethod string          `json:"split_method"`
+	Shares      []ShareResponse `json:"shares"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type GroupResponse struct {
+	ID        uint              `json:"id"`
+	Name      string            `json:"name"`
+	Currency  string            `json:"currency"`
+	CreatedBy uint              `json:"created_by"`
+	Members   []MemberResponse  `json:"members"`
+	Expenses  []ExpenseResponse `json:"expenses,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type SettlementResponse struct {
+	Currency  string    `json:"currency"`
+	Plan      []Payment `json:"plan"`
+	Settled   []Payment `json:"settled,omitempty"`
+	Held      []Payment `json:"held,omitempty"`
+	Declined  []Payment `json:"declined,omitempty"`
+	MyBalance int64     `json:"my_balance"`
+}
+
+func newGroupResponse(group models.ExpenseGroup) GroupResponse {
+	response := GroupResponse{
+		ID:        group.ID,
+		Name:      group.Name,
+		Currency:  group.Currency,
+		CreatedBy: group.CreatedByID,
+		Members:   []MemberResponse{},
+		CreatedAt: group.CreatedAt,
+	}
+	for _, member := range group.Members {
+		response.Members = append(response.Members, MemberResponse{
+			UserID:  member.UserID,
+			Name:    member.User.Name,
+			Email:   member.User.Email,
+			Balance: member.Balance,
+		})
+	}
+	for _, expense := range group.Expenses {
+		response.Expenses = append(response.Expenses, newExpenseResponse(expense))
+	}
+	return response
+}
+
+func newExpenseResponse(expense models.Expense) ExpenseResponse {
+	response := ExpenseResponse{
+		ID:          expense.ID,
+		Description: expense.Description,
+		Amount:      expense.Amount,
+		Currency:    expense.Currency,
+		PaidByID:    expense.PaidByID,
+		SplitMethod: string(expense.SplitMethod),
+		CreatedAt:   expense.CreatedAt,
+	}
+	for _, share := range expense.Shares {
+		response.Shares = append(response.Shares, ShareResponse{
+			UserID: share.UserID,
+			Shares: share.Shares,
+			Amount: share.Amount,
+		})
+	}
+	return response
+}
+
+func areFriends(db *gorm.DB, userID, friendID uint) (bool, error) {
+	var count int64
+	err := db.Table("user_friends").
+		Where("user_id = ? AND friend_id = ?", userID, friendID).Count(&count).Error
+	return count > 0, err
+}
+
+// loadGroupForMember returns the group only if the user belongs to it, so
+// non-members get the same 404 as for a group that does not exist.
+func loadGroupForMember(db *gorm.DB, groupID, userID uint) (*models.ExpenseGroup, int, string) {
+	var group models.ExpenseGroup
+	if err := db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("user_id")
+	}).Preload("Members.User").First(&group, groupID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, http.StatusNotFound, "Group not found"
+		}
+		return nil, http.StatusInternalServerError, "Error fetching group"
+	}
+
+	for _, member := range group.Members {
+		if member.UserID == userID {
+			return &group, 0, ""
+		}
+	}
+	return nil, http.StatusNotFound, "Group not found"
+}
+
+func CreateGroupHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if req.Name == "" {
+			http.Error(w, "Group name is required", http.StatusBadRequest)
+			return
+		}
+
+		// Members settle from their wallets in the group's currency, by
+		// default the creator's primary one.
+		code, err := transaction.TransferCurrency(req.Currency, currentUser.Currency)
+		if err != nil {
+			transaction.WriteTransferError(w, err)
+			return
+		}
+
+		group := models.ExpenseGroup{
+			Name:        req.Name,
+			CreatedByID: currentUser.ID,
+			Currency:    code,
+			Members:     []models.ExpenseGroupMember{{UserID: currentUser.ID}},
+		}
+
+		seen := map[uint]bool{currentUser.ID: true}
+		for _, memberID := range req.MemberIDs {
+			if seen[memberID] {
+				continue
+			}
+			seen[memberID] = true
+
+			friends, err := areFriends(db, currentUser.ID, memberID)
+			if err != nil {
+				http.Error(w, "Error checking friends", http.StatusInternalServerError)
+				return
+			}
+			if !friends {
+				http.Error(w, fmt.Sprintf("User %d is not in your friends list", memberID), http.StatusBadRequest)
+				return
+			}
+			group.Members = append(group.Members, models.ExpenseGroupMember{UserID: memberID})
+		}
+		if len(group.Members) > maxGroupMembers {
+			http.Error(w, fmt.Sprintf("A group can have at most %d members", maxGroupMembers), http.StatusBadRequest)
+			return
+		}
+
+		if err := db.Create(&group).Error; err != nil {
+			log.Printf("Error creating expense group for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating group", http.StatusInternalServerError)
+			return
+		}
+
+		created, status, message := loadGroupForMember(db, group.ID, currentUser.ID)
+		if created == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newGroupResponse(*created))
+	}
+}
+
+func groupFromRequest(db *gorm.DB, r *http.Request, userID uint) (*models.ExpenseGroup, int, string) {
+	groupID, err := strconv.ParseUint(chi.URLParam(r, "groupID"), 10, 32)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid group ID"
+	}
+	return loadGroupForMember(db, uint(groupID), userID)
+}
+
+func GetGroupsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var groups []models.ExpenseGroup
+		if err := db.Preload("Members", func(db *gorm.DB) *gorm.DB {
+			return db.Order("user_id")
+		}).Preload("Members.User").
+			Where("id IN (?)", db.Model(&models.ExpenseGroupMember{}).
+				Select("group_id").Where("user_id = ?", currentUser.ID)).
+			Order("created_at DESC").Find(&groups).Error; err != nil {
+			http.Error(w, "Error fetching groups", http.StatusInternalServerError)
+			return
+		}
+
+		responses := []GroupResponse{}
+		for _, group := range groups {
+			responses = append(responses, newGroupResponse(group))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]GroupResponse{"groups": responses})
+	}
+}
+
+func GetGroupHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, status, message := groupFromRequest(db, r, currentUser.ID)
+		if group == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		if err := db.Preload("Shares").Where("group_id = ?", group.ID).
+			Order("created_at DESC").Limit(50).Find(&group.Expenses).Error; err != nil {
+			http.Error(w, "Error fetching expenses", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newGroupResponse(*group))
+	}
+}
+
+func AddMemberHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AddMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, status, message := groupFromRequest(db, r, currentUser.ID)
+		if group == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		friends, err := areFriends(db, currentUser.ID, req.UserID)
+		if err != nil {
+			http.Error(w, "Error checking friends", http.StatusInternalServerError)
+			return
+		}
+		if !friends {
+			http.Error(w, "You can only add friends to a group", http.StatusBadRequest)
+			return
+		}
+
+		for _, member := range group.Members {
+			if member.UserID == req.UserID {
+				http.Error(w, "User is already a member of this group", http.StatusConflict)
+				return
+			}
+		}
+		if len(group.Members) >= maxGroupMembers {
+			http.Error(w, fmt.Sprintf("A group can have at most %d members", maxGroupMembers), http.StatusConflict)
+			return
+		}
+
+		if err := db.Create(&models.ExpenseGroupMember{GroupID: group.ID, UserID: req.UserID}).Error; err != nil {
+			http.Error(w, "Error adding member", http.StatusInternalServerError)
+			return
+		}
+
+		updated, status, message := groupFromRequest(db, r, currentUser.ID)
+		if updated == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newGroupResponse(*updated))
+	}
+}
+
+func CreateExpenseHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateExpenseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if req.Amount <= 0 {
+			http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		group, status, message := groupFromRequest(db, r, currentUser.ID)
+		if group == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		// Balances are kept in the group's currency, so every expense is
+		// recorded in it.
+		if req.Currency != "" {
+			code, err := currency.Normalize(req.Currency)
+			if err != nil {
+				http.Error(w, "Currency must be an ISO 4217 code", http.StatusBadRequest)
+				return
+			}
+			if code != group.Currency {
+				http.Error(w, fmt.Sprintf("Expenses in this group must be in %s", group.Currency), http.StatusBadRequest)
+				return
+			}
+		}
+
+		isMember := make(map[uint]bool, len(group.Members))
+		for _, member := range group.Members {
+			isMember[member.UserID] = true
+		}
+
+		paidBy := req.PaidByID
+		if paidBy == 0 {
+			paidBy = currentUser.ID
+		}
+		if !isMember[paidBy] {
+			http.Error(w, "The payer must be a member of the group", http.StatusBadRequest)
+			return
+		}
+
+		splits := req.Splits
+		if len(splits) == 0 {
+			for _, member := range group.Members {
+				splits = append(splits, SplitInput{UserID: member.UserID})
+			}
+		}
+		for _, split := range splits {
+			if !isMember[split.UserID] {
+				http.Error(w, fmt.Sprintf("User %d is not a member of the group", split.UserID), http.StatusBadRequest)
+				return
+			}
+		}
+
+		method := models.SplitMethod(req.SplitMethod)
+		if method == "" {
+			method = models.SplitEqual
+		}
+
+		shares, err := computeShares(req.Amount, method, splits)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		expense := models.Expense{
+			GroupID:     group.ID,
+			PaidByID:    paidBy,
+			CreatedByID: currentUser.ID,
+			Amount:      req.Amount,
+			Currency:    group.Currency,
+			Description: req.Description,
+			SplitMethod: method,
+			Shares:      shares,
+		}
+
+		deltas := map[uint]int64{paidBy: req.Amount}
+		for _, share := range shares {
+			deltas[share.UserID] -= share.Amount
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&expense).Error; err != nil {
+				return err
+			}
+			for userID, delta := range deltas {
+				if delta == 0 {
+					continue
+				}
+				if err := tx.Model(&models.ExpenseGroupMember{}).
+					Where("group_id = ? AND user_id = ?", group.ID, userID).
+					UpdateColumn("balance", gorm.Expr("balance + ?", delta)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error recording expense in group %d: %v", group.ID, err)
+			http.Error(w, "Error recording expense", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("✅ Expense %d recorded in group %d: Amount=%d %s, PaidBy=%d, Split=%s",
+			expense.ID, group.ID, expense.Amount, expense.Currency, paidBy, method)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newExpenseResponse(expense))
+	}
+}
+
+func GetSettlementPlanHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, status, message := groupFromRequest(db, r, currentUser.ID)
+		if group == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		response := SettlementResponse{Currency: group.Currency, Plan: settlementPlan(group.Members)}
+		for _, member := range group.Members {
+			if member.UserID == currentUser.ID {
+				response.MyBalance = member.Balance
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// SettleUpHandler pays the current user's part of the settlement plan from
+// their wallet. Other members settle their own debts the same way; nobody's
+// wallet is charged without them calling this endpoint. Payments the risk
+// checks hold only count towards the balances once approved, and declined
+// ones leave the debt in place.
+func SettleUpHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		group, status, message := groupFromRequest(db, r, currentUser.ID)
+		if group == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		var members []models.ExpenseGroupMember
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("group_id = ?", group.ID).Order("user_id").Find(&members).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error fetching group balances", http.StatusInternalServerError)
+			return
+		}
+
+		// Balances only change once a held settlement is approved, so until
+		// then the plan would ask for the same payment again.
+		var awaitingReview int64
+		if err := tx.Model(&models.GroupSettlement{}).
+			Joins("JOIN transactions ON transactions.id = group_settlements.transaction_id").
+			Where("group_settlements.group_id = ? AND group_settlements.from_user_id = ? AND transactions.status = ?",
+				group.ID, currentUser.ID, models.TransactionStatusPending).
+			Count(&awaitingReview).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error fetching group settlements", http.StatusInternalServerError)
+			return
+		}
+		if awaitingReview > 0 {
+			tx.Rollback()
+			http.Error(w, "A settlement in this group is awaiting risk review", http.StatusConflict)
+			return
+		}
+
+		plan := settlementPlan(members)
+		var settled, held, declined []Payment
+		for _, payment := range plan {
+			if payment.FromUserID != currentUser.ID {
+				continue
+			}
+
+			result, err := transaction.Transfer(tx, payment.FromUserID, payment.ToUserID, payment.Amount, group.Currency,
+				fmt.Sprintf("Settle up: %s", group.Name))
+			switch {
+			case errors.Is(err, transaction.ErrBlockedByRisk):
+				// The declined transfer is kept on record and the debt stays.
+				declined = append(declined, payment)
+				continue
+			case errors.Is(err, transaction.ErrHeldForReview):
+			case err != nil:
+				tx.Rollback()
+				transaction.WriteTransferError(w, err)
+				return
+			}
+
+			if err := tx.Create(&models.GroupSettlement{
+				GroupID:       group.ID,
+				FromUserID:    payment.FromUserID,
+				ToUserID:      payment.ToUserID,
+				Amount:        payment.Amount,
+				TransactionID: result.Transaction.ID,
+			}).Error; err != nil {
+				tx.Rollback()
+				http.Error(w, "Error recording settlement", http.StatusInternalServerError)
+				return
+			}
+			if err != nil {
+				// The balances are updated when the review approves it.
+				held = append(held, payment)
+				continue
+			}
+
+			for userID, delta := range map[uint]int64{payment.FromUserID: payment.Amount, payment.ToUserID: -payment.Amount} {
+				if err := tx.Model(&models.ExpenseGroupMember{}).
+					Where("group_id = ? AND user_id = ?", group.ID, userID).
+					UpdateColumn("balance", gorm.Expr("balance + ?", delta)).Error; err != nil {
+					tx.Rollback()
+					http.Error(w, "Error updating group balances", http.StatusInternalServerError)
+					return
+				}
+			}
+			settled = append(settled, payment)
+		}
+
+		if len(settled)+len(held)+len(declined) == 0 {
+			tx.Rollback()
+			http.Error(w, "You have nothing to settle in this group", http.StatusBadRequest)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			http.Error(w, "Error completing settlement", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("✅ User %d settled %d debts in group %d (%d held, %d declined)",
+			currentUser.ID, len(settled), group.ID, len(held), len(declined))
+		if len(settled)+len(held) == 0 {
+			transaction.WriteTransferError(w, transaction.ErrBlockedByRisk)
+			return
+		}
+
+		updated, status, message := groupFromRequest(db, r, currentUser.ID)
+		if updated == nil {
+			http.Error(w, message, status)
+			return
+		}
+
+		response := SettlementResponse{Currency: updated.Currency, Plan: settlementPlan(updated.Members), Settled: settled, Held: held, Declined: declined}
+		for _, member := range updated.Members {
+			if member.UserID == currentUser.ID {
+				response.MyBalance = member.Balance
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(held) > 0 {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
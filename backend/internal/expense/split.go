@@ -0,0 +1,244 @@
+package expense
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"sort"
+
+	"paytm/internal/models"
+)
+
+type SplitInput struct {
+	UserID uint  `json:"user_id"`
+	Shares int64 `json:"shares,omitempty"`
+	Amount int64 `json:"amount,omitempty"`
+}
+
+type Payment struct {
+	FromUserID uint  `json:"from_user_id"`
+	ToUserID   uint  `json:"to_user_id"`
+	Amount     int64 `json:"amount"`
+}
+
+// distribute splits amount in proportion to weights using the largest
+// remainder method, so the parts always add up to amount exactly and any
+// leftover minor units go to the largest fractional parts first. The
+// arithmetic is done in big integers because amount * weight can overflow
+// an int64; every part is at most amount, so the results fit again.
+func distribute(amount int64, weights []int64) []int64 {
+	total := new(big.Int)
+	for _, w := range weights {
+		total.Add(total, big.NewInt(w))
+	}
+
+	parts := make([]int64, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	var allocated int64
+	for i, w := range weights {
+		part, remainder := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(amount), big.NewInt(w)), total, new(big.Int))
+		parts[i] = part.Int64()
+		remainders[i] = remainder
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]].Cmp(remainders[order[b]]) > 0 })
+
+	for i := 0; allocated < amount; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+	return parts
+}
+
+func computeShares(amount int64, method models.SplitMethod, splits []SplitInput) ([]models.ExpenseShare, error) {
+	if len(splits) == 0 {
+		return nil, fmt.Errorf("an expense needs at least one participant")
+	}
+
+	seen := make(map[uint]bool, len(splits))
+	for _, split := range splits {
+		if seen[split.UserID] {
+			return nil, fmt.Errorf("user %d appears more than once in the split", split.UserID)
+		}
+		seen[split.UserID] = true
+	}
+
+	shares := make([]models.ExpenseShare, len(splits))
+	switch method {
+	case models.SplitEqual:
+		weights := make([]int64, len(splits))
+		for i := range weights {
+			weights[i] = 1
+		}
+		for i, part := range distribute(amount, weights) {
+			shares[i] = models.ExpenseShare{UserID: splits[i].UserID, Shares: 1, Amount: part}
+		}
+	case models.SplitShares:
+		weights := make([]int64, len(splits))
+		for i, split := range splits {
+			if split.Shares <= 0 {
+				return nil, fmt.Errorf("shares for user %d must be greater than 0", split.UserID)
+			}
+			weights[i] = split.Shares
+		}
+		for i, part := range distribute(amount, weights) {
+			shares[i] = models.ExpenseShare{UserID: splits[i].UserID, Shares: splits[i].Shares, Amount: part}
+		}
+	case models.SplitExact:
+		var total int64
+		for i, split := range splits {
+			if split.Amount < 0 {
+				return nil, fmt.Errorf("amount for user %d cannot be negative", split.UserID)
+			}
+			total += split.Amount
+			shares[i] = models.ExpenseShare{UserID: split.UserID, Amount: split.Amount}
+		}
+		if total != amount {
+			return nil, fmt.Errorf("exact amounts add up to %d but the expense is %d", total, amount)
+		}
+	default:
+		return nil, fmt.Errorf("split_method must be one of equal, shares or exact")
+	}
+	return shares, nil
+}
+
+// maxGroupMembers caps the size of expense groups so that their settlement
+// plan can be the exact minimum: finding it is exponential in the number of
+// members with a balance.
+const maxGroupMembers = 16
+
+// position is a member's balance: negative when they owe the group.
+type position struct {
+	userID uint
+	amount int64
+}
+
+// settlementPlan pays off member balances in as few transfers as possible.
+// Members whose balances cancel out can settle among themselves in one
+// transfer fewer than there are of them, so the fewest transfers come from
+// splitting the members with a balance into as many such sets as possible,
+// which zeroSumSets finds. Groups from before maxGroupMembers that are
+// larger than it fall back to settling everyone as one set, which takes at
+// most n-1 transfers but not always the fewest.
+func settlementPlan(members []models.ExpenseGroupMember) []Payment {
+	var open []position
+	for _, member := range members {
+		if member.Balance != 0 {
+			open = append(open, position{member.UserID, member.Balance})
+		}
+	}
+	if len(open) > maxGroupMembers {
+		return settle(open)
+	}
+
+	var payments []Payment
+	for _, set := range zeroSumSets(open) {
+		payments = append(payments, settle(set)...)
+	}
+	return payments
+}
+
+// zeroSumSets splits positions, whose balances add up to zero, into the
+// largest number of sets that each add up to zero, by dynamic programming
+// over subsets: best[mask] is the most zero-sum sets the positions in mask
+// can be split into, not counting a remainder that does not add up to zero.
+func zeroSumSets(positions []position) [][]position {
+	n := len(positions)
+	full := 1<<n - 1
+	sums := make([]int64, full+1)
+	best := make([]uint8, full+1)
+	for mask := 1; mask <= full; mask++ {
+		sums[mask] = sums[mask&(mask-1)] + positions[bits.TrailingZeros(uint(mask))].amount
+		for i := 0; i < n; i++ {
+			if bit := 1 << i; mask&bit != 0 && best[mask^bit] > best[mask] {
+				best[mask] = best[mask^bit]
+			}
+		}
+		if sums[mask] == 0 {
+			best[mask]++
+		}
+	}
+
+	// Take positions out one at a time without losing a set, highest
+	// first; each time the rest adds up to zero, what was taken out since
+	// the last time is a set.
+	var sets [][]position
+	mask, rest := full, full
+	for mask != 0 {
+		keep := best[mask]
+		if sums[mask] == 0 {
+			keep--
+		}
+		for i := n - 1; i >= 0; i-- {
+			if bit := 1 << i; mask&bit != 0 && best[mask^bit] == keep {
+				mask ^= bit
+				break
+			}
+		}
+		if sums[mask] == 0 {
+			var set []position
+			for i := 0; i < n; i++ {
+				if (rest^mask)&(1<<i) != 0 {
+					set = append(set, positions[i])
+				}
+			}
+			sets = append([][]position{set}, sets...)
+			rest = mask
+		}
+	}
+	return sets
+}
+
+// settle pays off a set of balances by repeatedly matching the largest
+// debtor with the largest creditor. Each step clears at least one member,
+// so n members settle in at most n-1 transfers.
+func settle(positions []position) []Payment {
+	var debtors, creditors []position
+	for _, p := range positions {
+		switch {
+		case p.amount < 0:
+			debtors = append(debtors, position{p.userID, -p.amount})
+		case p.amount > 0:
+			creditors = append(creditors, p)
+		}
+	}
+	byAmount := func(list []position) func(i, j int) bool {
+		return func(i, j int) bool {
+			if list[i].amount != list[j].amount {
+				return list[i].amount > list[j].amount
+			}
+			return list[i].userID < list[j].userID
+		}
+	}
+
+	var payments []Payment
+	for len(debtors) > 0 && len(creditors) > 0 {
+		sort.Slice(debtors, byAmount(debtors))
+		sort.Slice(creditors, byAmount(creditors))
+
+		amount := debtors[0].amount
+		if creditors[0].amount < amount {
+			amount = creditors[0].amount
+		}
+		payments = append(payments, Payment{
+			FromUserID: debtors[0].userID,
+			ToUserID:   creditors[0].userID,
+			Amount:     amount,
+		})
+
+		debtors[0].amount -= amount
+		creditors[0].amount -= amount
+		if debtors[0].amount == 0 {
+			debtors = debtors[1:]
+		}
+		if creditors[0].amount == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return payments
+}
@@ -0,0 +1,138 @@
+package expense
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"paytm/internal/models"
+)
+
+func TestDistribute(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even split", 90, []int64{1, 1, 1}, []int64{30, 30, 30}},
+		{"one unit left over goes to the first tie", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"two units left over", 10, []int64{1, 1, 1, 1}, []int64{3, 3, 2, 2}},
+		{"leftover goes to the largest remainder", 100, []int64{1, 2}, []int64{33, 67}},
+		{"largest remainder is not the largest weight", 10, []int64{5, 1, 1}, []int64{7, 2, 1}},
+		{"less than one unit each", 2, []int64{1, 1, 1}, []int64{1, 1, 0}},
+		{"zero amount", 0, []int64{1, 3}, []int64{0, 0}},
+		{"single participant", 1234, []int64{7}, []int64{1234}},
+		{"product overflows int64", 9_000_000_000_000_000_000, []int64{1, 2}, []int64{3_000_000_000_000_000_000, 6_000_000_000_000_000_000}},
+		{"total weight overflows int64", 101, []int64{math.MaxInt64, math.MaxInt64}, []int64{51, 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := distribute(tt.amount, tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("distribute(%d, %v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+			}
+			var sum int64
+			for _, part := range got {
+				sum += part
+			}
+			if sum != tt.amount {
+				t.Errorf("parts add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func members(balances ...int64) []models.ExpenseGroupMember {
+	list := make([]models.ExpenseGroupMember, len(balances))
+	for i, balance := range balances {
+		list[i] = models.ExpenseGroupMember{UserID: uint(i + 1), Balance: balance}
+	}
+	return list
+}
+
+func TestSettlementPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		members []models.ExpenseGroupMember
+		want    []Payment
+	}{
+		{"nothing owed", members(0, 0, 0), nil},
+		{"one debt", members(-500, 500), []Payment{{1, 2, 500}}},
+		{
+			"one debtor, two creditors",
+			members(-300, 100, 200),
+			[]Payment{{1, 3, 200}, {1, 2, 100}},
+		},
+		{
+			"largest debtor pays largest creditor first",
+			members(-100, -400, 250, 250),
+			[]Payment{{2, 3, 250}, {2, 4, 150}, {1, 4, 100}},
+		},
+		{
+			"ties go to the lower user ID",
+			members(-50, -50, 100),
+			[]Payment{{1, 3, 50}, {2, 3, 50}},
+		},
+		{
+			// Matching the largest debtor with the largest creditor would
+			// take four transfers.
+			"balances that cancel out settle among themselves",
+			members(-6, -5, 2, 4, 5),
+			[]Payment{{1, 4, 4}, {1, 3, 2}, {2, 5, 5}},
+		},
+		{
+			"three sets",
+			members(-3, 1, -2, 3, 2, -1),
+			[]Payment{{1, 4, 3}, {3, 5, 2}, {6, 2, 1}},
+		},
+		{
+			"cancelling pair among larger balances",
+			members(-7, -3, 2, 3, 5),
+			[]Payment{{2, 4, 3}, {1, 5, 5}, {1, 3, 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := settlementPlan(tt.members)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("settlementPlan() = %v, want %v", got, tt.want)
+			}
+
+			balances := map[uint]int64{}
+			for _, member := range tt.members {
+				balances[member.UserID] = member.Balance
+			}
+			for _, payment := range got {
+				balances[payment.FromUserID] += payment.Amount
+				balances[payment.ToUserID] -= payment.Amount
+			}
+			for userID, balance := range balances {
+				if balance != 0 {
+					t.Errorf("user %d is left with balance %d", userID, balance)
+				}
+			}
+			if len(tt.members) > 0 && len(got) > len(tt.members)-1 {
+				t.Errorf("%d transfers for %d members, want at most %d", len(got), len(tt.members), len(tt.members)-1)
+			}
+		})
+	}
+}
+
+func TestSettlementPlanOverCap(t *testing.T) {
+	balances := make([]int64, maxGroupMembers+1)
+	for i := range balances[1:] {
+		balances[i+1] = 1
+	}
+	balances[0] = -maxGroupMembers
+
+	got := settlementPlan(members(balances...))
+	if len(got) != maxGroupMembers {
+		t.Fatalf("%d transfers for %d members, want %d", len(got), len(balances), maxGroupMembers)
+	}
+	for _, payment := range got {
+		if payment.FromUserID != 1 || payment.Amount != 1 {
+			t.Errorf("unexpected transfer %v", payment)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"paytm/internal/currency"
+)
+
+type csvWriter struct {
+	w        *csv.Writer
+	currency string
+}
+
+func newCSVWriter(w *bufio.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) ContentType() string { return "text/csv; charset=utf-8" }
+func (c *csvWriter) Extension() string   { return "csv" }
+
+func (c *csvWriter) Begin(s *Statement) error {
+	c.currency = s.Currency
+	return c.w.Write([]string{"date", "transaction_id", "type", "description", "counterparty", "amount", "balance", "currency"})
+}
+
+func (c *csvWriter) Line(l *Line) error {
+	return c.w.Write([]string{
+		l.Date.UTC().Format(time.RFC3339),
+		strconv.FormatUint(uint64(l.TransactionID), 10),
+		string(l.Kind),
+		l.Description,
+		l.Counterparty,
+		currency.FormatAmount(l.Amount, c.currency),
+		currency.FormatAmount(l.Balance, c.currency),
+		c.currency,
+	})
+}
+
+func (c *csvWriter) End(s *Statement) error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,299 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/ledger"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/transaction"
+)
+
+const flushEvery = 500
+
+type LineKind string
+
+const (
+	LineTransferOut LineKind = "transfer_out"
+	LineTransferIn  LineKind = "transfer_in"
+	LineTopUp       LineKind = "top_up"
+	LineRefundOut   LineKind = "refund_out"
+	LineRefundIn    LineKind = "refund_in"
+	LineFee         LineKind = "fee"
+)
+
+// Line is one statement row from the user's point of view: Amount is
+// signed (money in is positive) and Balance is the running balance after it.
+type Line struct {
+	FITID         string
+	TransactionID uint
+	Date          time.Time
+	Kind          LineKind
+	Description   string
+	Counterparty  string
+	Amount        int64
+	Balance       int64
+}
+
+type Statement struct {
+	UserID         uint
+	AccountName    string
+	Currency       string
+	From           time.Time
+	To             time.Time
+	OpeningBalance int64
+	ClosingBalance int64
+	GeneratedAt    time.Time
+}
+
+type Writer interface {
+	ContentType() string
+	Extension() string
+	Begin(s *Statement) error
+	Line(l *Line) error
+	End(s *Statement) error
+}
+
+type row struct {
+	ID               uint
+	Timestamp        time.Time
+	SenderID         uint
+	ReceiverID       uint
+	Amount           int64
+	Fee              int64
+	Currency         string
+	ReceivedAmount   int64
+	ReceivedCurrency string
+	Description      string
+	Type             string
+	PaymentMethod    string
+	SenderName       string
+	ReceiverName     string
+}
+
+// PostedStatuses are the transaction states whose money movement is on the
+// ledger and therefore belongs on a statement.
+var PostedStatuses = []models.TransactionStatus{
+	models.TransactionStatusCompleted,
+	models.TransactionStatusPartiallyRefunded,
+	models.TransactionStatusReversed,
+}
+
+func newWriter(format string, w *bufio.Writer) Writer {
+	switch format {
+	case "csv":
+		return newCSVWriter(w)
+	case "ofx":
+		return &ofxWriter{w: w}
+	case "qif":
+		return &qifWriter{w: w}
+	}
+	return nil
+}
+
+// linesFor turns a transaction into statement lines. Card top-ups charge the
+// fee on top of the amount, so they are shown as the gross card charge
+// followed by a separate fee line; the running balance lands on the net
+// amount that actually reached the wallet.
+func linesFor(userID uint, r *row) []Line {
+	base := Line{
+		FITID:         strconv.FormatUint(uint64(r.ID), 10),
+		TransactionID: r.ID,
+		Date:          r.Timestamp,
+		Description:   r.Description,
+	}
+
+	switch {
+	case r.SenderID == userID && r.ReceiverID == userID:
+		base.Kind = LineTopUp
+		base.Amount = r.Amount + r.Fee
+		if r.PaymentMethod != "" {
+			base.Counterparty = r.PaymentMethod
+		}
+		if r.Fee == 0 {
+			return []Line{base}
+		}
+		fee := Line{
+			FITID:         base.FITID + "-fee",
+			TransactionID: r.ID,
+			Date:          r.Timestamp,
+			Kind:          LineFee,
+			Description:   "Processing fee",
+			Counterparty:  base.Counterparty,
+			Amount:        -r.Fee,
+		}
+		return []Line{base, fee}
+	case r.SenderID == userID:
+		base.Kind = LineTransferOut
+		if r.Type == string(models.TransactionRefund) {
+			base.Kind = LineRefundOut
+		}
+		base.Amount = -r.Amount
+		base.Counterparty = r.ReceiverName
+	default:
+		base.Kind = LineTransferIn
+		if r.Type == string(models.TransactionRefund) {
+			base.Kind = LineRefundIn
+		}
+		base.Amount = r.ReceivedAmount
+		base.Counterparty = r.SenderName
+	}
+	return []Line{base}
+}
+
+// Stream writes every posted transaction that moved money in or out of the
+// user's wallet in currencyCode during [from, to) through w, reading rows one
+// at a time so that large ranges never sit in memory.
+func Stream(db *gorm.DB, user *models.User, currencyCode string, from, to time.Time, w Writer, flush func()) (*Statement, error) {
+	opening, err := ledger.BalanceAt(db, user.ID, currencyCode, from)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &Statement{
+		UserID:         user.ID,
+		AccountName:    user.Name,
+		Currency:       currencyCode,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		ClosingBalance: opening,
+		GeneratedAt:    time.Now(),
+	}
+
+	rows, err := db.Table("transactions").
+		Select(`transactions.id, transactions.timestamp, transactions.sender_id, transactions.receiver_id,
+			transactions.amount, transactions.fee, transactions.currency, transactions.received_amount,
+			transactions.received_currency, transactions.description, transactions.type,
+			transactions.payment_method, senders.name AS sender_name, receivers.name AS receiver_name`).
+		Joins("LEFT JOIN users senders ON senders.id = transactions.sender_id").
+		Joins("LEFT JOIN users receivers ON receivers.id = transactions.receiver_id").
+		Where("transactions.deleted_at IS NULL").
+		Where("((transactions.sender_id = ? AND transactions.currency = ?) OR (transactions.receiver_id = ? AND transactions.received_currency = ?))",
+			user.ID, currencyCode, user.ID, currencyCode).
+		Where("transactions.timestamp >= ? AND transactions.timestamp < ?", from, to).
+		Where("transactions.status IN ?", PostedStatuses).
+		Order("transactions.timestamp ASC, transactions.id ASC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	if err := w.Begin(statement); err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for rows.Next() {
+		var r row
+		if err := db.ScanRows(rows, &r); err != nil {
+			return nil, fmt.Errorf("failed to read transaction: %w", err)
+		}
+		for _, line := range linesFor(user.ID, &r) {
+			statement.ClosingBalance += line.Amount
+			line.Balance = statement.ClosingBalance
+			if err := w.Line(&line); err != nil {
+				return nil, err
+			}
+		}
+		if count++; count%flushEvery == 0 && flush != nil {
+			flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+
+	if err := w.End(statement); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+func ExportTransactionsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		q := r.URL.Query()
+
+		format := q.Get("format")
+		if format == "" {
+			format = "csv"
+		}
+
+		to := time.Now()
+		if toStr := q.Get("to"); toStr != "" {
+			t, err := transaction.ParseTime(toStr)
+			if err != nil {
+				http.Error(w, "to must be an RFC 3339 timestamp or YYYY-MM-DD date", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+
+		from := to.AddDate(0, 0, -30)
+		if fromStr := q.Get("from"); fromStr != "" {
+			t, err := transaction.ParseTime(fromStr)
+			if err != nil {
+				http.Error(w, "from must be an RFC 3339 timestamp or YYYY-MM-DD date", http.StatusBadRequest)
+				return
+			}
+			from = t
+		}
+
+		if !to.After(from) {
+			http.Error(w, "to must be after from", http.StatusBadRequest)
+			return
+		}
+
+		walletCurrency := currentUser.Currency
+		if c := q.Get("currency"); c != "" {
+			normalized, err := currency.Normalize(c)
+			if err != nil {
+				http.Error(w, "currency must be an ISO 4217 code", http.StatusBadRequest)
+				return
+			}
+			walletCurrency = normalized
+		}
+
+		buffered := bufio.NewWriterSize(w, 32*1024)
+		writer := newWriter(format, buffered)
+		if writer == nil {
+			http.Error(w, "format must be one of csv, ofx or qif", http.StatusBadRequest)
+			return
+		}
+
+		filename := fmt.Sprintf("dinero-statement-%s-%s-%s.%s", walletCurrency,
+			from.Format("2006-01-02"), to.Format("2006-01-02"), writer.Extension())
+		w.Header().Set("Content-Type", writer.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		flush := func() {
+			buffered.Flush()
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+
+		if _, err := Stream(db, currentUser, walletCurrency, from, to, writer, flush); err != nil {
+			// Headers may already be on the wire, so the best we can do is
+			// log and cut the stream short.
+			log.Printf("Error exporting transactions for user %d: %v", currentUser.ID, err)
+			return
+		}
+		flush()
+	}
+}
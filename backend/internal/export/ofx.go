@@ -0,0 +1,115 @@
+package export
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"paytm/internal/currency"
+)
+
+// ofxWriter produces an OFX 2.2 bank statement. The document is written by
+// hand rather than marshalled so that transactions can be streamed between
+// the header and the closing balance.
+type ofxWriter struct {
+	w        *bufio.Writer
+	currency string
+}
+
+func (o *ofxWriter) ContentType() string { return "application/x-ofx" }
+func (o *ofxWriter) Extension() string   { return "ofx" }
+
+func ofxTime(t time.Time) string {
+	return t.UTC().Format("20060102150405.000") + "[0:GMT]"
+}
+
+func ofxEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func (o *ofxWriter) Begin(s *Statement) error {
+	o.currency = s.Currency
+	_, err := fmt.Fprintf(o.w, `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+<SIGNONMSGSRSV1>
+<SONRS>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<DTSERVER>%s</DTSERVER>
+<LANGUAGE>ENG</LANGUAGE>
+</SONRS>
+</SIGNONMSGSRSV1>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<TRNUID>0</TRNUID>
+<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>
+<STMTRS>
+<CURDEF>%s</CURDEF>
+<BANKACCTFROM>
+<BANKID>DINERO</BANKID>
+<ACCTID>%d</ACCTID>
+<ACCTTYPE>CHECKING</ACCTTYPE>
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>%s</DTSTART>
+<DTEND>%s</DTEND>
+`, ofxTime(s.GeneratedAt), ofxEscape(s.Currency), s.UserID, ofxTime(s.From), ofxTime(s.To))
+	return err
+}
+
+func ofxTransactionType(l *Line) string {
+	switch l.Kind {
+	case LineFee:
+		return "FEE"
+	case LineTopUp:
+		return "DEP"
+	}
+	if l.Amount < 0 {
+		return "DEBIT"
+	}
+	return "CREDIT"
+}
+
+func (o *ofxWriter) Line(l *Line) error {
+	name := l.Counterparty
+	if name == "" {
+		name = string(l.Kind)
+	}
+	_, err := fmt.Fprintf(o.w, `<STMTTRN>
+<TRNTYPE>%s</TRNTYPE>
+<DTPOSTED>%s</DTPOSTED>
+<TRNAMT>%s</TRNAMT>
+<FITID>%s</FITID>
+<NAME>%s</NAME>
+<MEMO>%s</MEMO>
+</STMTTRN>
+`, ofxTransactionType(l), ofxTime(l.Date), currency.FormatAmount(l.Amount, o.currency), l.FITID,
+		ofxEscape(truncate(name, 32)), ofxEscape(truncate(l.Description, 255)))
+	return err
+}
+
+func (o *ofxWriter) End(s *Statement) error {
+	_, err := fmt.Fprintf(o.w, `</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>%s</BALAMT>
+<DTASOF>%s</DTASOF>
+</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`, currency.FormatAmount(s.ClosingBalance, s.Currency), ofxTime(s.To))
+	return err
+}
@@ -0,0 +1,44 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"paytm/internal/currency"
+)
+
+// qifWriter produces a Quicken Interchange Format bank register. QIF has no
+// balance field, so the opening balance is recorded as the first entry.
+type qifWriter struct {
+	w        *bufio.Writer
+	currency string
+}
+
+func (q *qifWriter) ContentType() string { return "application/qif" }
+func (q *qifWriter) Extension() string   { return "qif" }
+
+func qifText(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func (q *qifWriter) Begin(s *Statement) error {
+	q.currency = s.Currency
+	_, err := fmt.Fprintf(q.w, "!Type:Bank\nD%s\nT%s\nPOpening Balance\n^\n",
+		s.From.UTC().Format("01/02/2006"), currency.FormatAmount(s.OpeningBalance, s.Currency))
+	return err
+}
+
+func (q *qifWriter) Line(l *Line) error {
+	payee := l.Counterparty
+	if payee == "" {
+		payee = string(l.Kind)
+	}
+	_, err := fmt.Fprintf(q.w, "D%s\nT%s\nN%s\nP%s\nM%s\n^\n",
+		l.Date.UTC().Format("01/02/2006"), currency.FormatAmount(l.Amount, q.currency), l.FITID, qifText(payee), qifText(l.Description))
+	return err
+}
+
+func (q *qifWriter) End(s *Statement) error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	keyTTL       = 24 * time.Hour
+	maxKeyLength = 255
+	maxBodyBytes = 1 << 20
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claim inserts the key for the user. It returns the already stored record
+// when the key has been seen before and is not yet expired.
+func claim(db *gorm.DB, record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "key"}},
+			DoNothing: true,
+		}).Create(record)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var existing models.IdempotencyKey
+		if err := db.Where("user_id = ? AND key = ?", record.UserID, record.Key).
+			First(&existing).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				continue
+			}
+			return nil, err
+		}
+		if existing.ExpiresAt.After(time.Now()) {
+			return &existing, nil
+		}
+
+		if err := db.Where("id = ? AND expires_at <= ?", existing.ID, time.Now()).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return nil, err
+		}
+		record.ID = 0
+	}
+	return nil, gorm.ErrDuplicatedKey
+}
+
+// Middleware makes a money-moving endpoint safe to retry. Requests carrying
+// an Idempotency-Key header are fingerprinted; a replay with the same body
+// gets the original response back, a reused key with a different body is
+// rejected, and 5xx outcomes release the key so the client may try again.
+func Middleware(db *gorm.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderKey)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxKeyLength {
+				http.Error(w, "Idempotency-Key must be at most 255 characters", http.StatusBadRequest)
+				return
+			}
+
+			currentUser, ok := middleware.GetUserFromContext(r)
+			if !ok {
+				http.Error(w, "User not found in context", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			if err != nil {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			record := models.IdempotencyKey{
+				UserID:      currentUser.ID,
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				RequestHash: fingerprint(r, body),
+				ExpiresAt:   time.Now().Add(keyTTL),
+			}
+
+			existing, err := claim(db, &record)
+			if err != nil {
+				log.Printf("Error claiming idempotency key for user %d: %v", currentUser.ID, err)
+				http.Error(w, "Error processing idempotency key", http.StatusInternalServerError)
+				return
+			}
+
+			if existing != nil {
+				if existing.RequestHash != record.RequestHash {
+					http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+					return
+				}
+				if existing.CompletedAt == nil {
+					http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+					return
+				}
+
+				log.Printf("↩️ Replaying idempotent response for user %d, key %s", currentUser.ID, key)
+				if existing.ContentType != "" {
+					w.Header().Set("Content-Type", existing.ContentType)
+				}
+				w.Header().Set(HeaderReplayed, "true")
+				w.WriteHeader(existing.StatusCode)
+				w.Write(existing.ResponseBody)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				if rec := recover(); rec != nil {
+					db.Delete(&models.IdempotencyKey{}, record.ID)
+					panic(rec)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= http.StatusInternalServerError {
+				if err := db.Delete(&models.IdempotencyKey{}, record.ID).Error; err != nil {
+					log.Printf("Error releasing idempotency key %d: %v", record.ID, err)
+				}
+				return
+			}
+
+			now := time.Now()
+			if err := db.Model(&models.IdempotencyKey{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+				"status_code":   recorder.status,
+				"content_type":  recorder.Header().Get("Content-Type"),
+				"response_body": recorder.body.Bytes(),
+				"completed_at":  &now,
+			}).Error; err != nil {
+				log.Printf("Error storing idempotent response %d: %v", record.ID, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+type Reconciliation struct {
+	UserID         uint                   `json:"user_id"`
+	Currency       string                 `json:"currency"`
+	AccountID      uint                   `json:"account_id"`
+	UserBalance    int64                  `json:"user_balance"`
+	AccountBalance int64                  `json:"account_balance"`
+	PostedBalance  int64                  `json:"posted_balance"`
+	Balanced       bool                   `json:"balanced"`
+	Wallets        []WalletReconciliation `json:"wallets"`
+}
+
+type WalletReconciliation struct {
+	AccountID      uint   `json:"account_id"`
+	Currency       string `json:"currency"`
+	AccountBalance int64  `json:"account_balance"`
+	PostedBalance  int64  `json:"posted_balance"`
+	Balanced       bool   `json:"balanced"`
+}
+
+type PostingResponse struct {
+	AccountID    uint   `json:"account_id"`
+	AccountCode  string `json:"account_code"`
+	Amount       int64  `json:"amount"`
+	BalanceAfter *int64 `json:"balance_after,omitempty"`
+}
+
+type JournalEntryResponse struct {
+	ID            uint              `json:"id"`
+	Kind          string            `json:"kind"`
+	TransactionID *uint             `json:"transaction_id,omitempty"`
+	Description   string            `json:"description"`
+	PostedAt      time.Time         `json:"posted_at"`
+	Postings      []PostingResponse `json:"postings"`
+}
+
+type LedgerHistoryResponse struct {
+	AccountID uint                   `json:"account_id"`
+	Currency  string                 `json:"currency"`
+	Balance   int64                  `json:"balance"`
+	Entries   []JournalEntryResponse `json:"entries"`
+	Total     int64                  `json:"total"`
+	Page      int                    `json:"page"`
+	Limit     int                    `json:"limit"`
+}
+
+// ReconcileUser checks every wallet's cached balance against the sum of the
+// postings ever made to it, and the user's balance against the wallet of
+// their primary currency.
+func ReconcileUser(db *gorm.DB, userID uint) (*Reconciliation, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user %d: %w", userID, err)
+	}
+
+	wallets, err := Wallets(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	posted := make(map[uint]int64, len(wallets))
+	for _, account := range wallets {
+		var sum int64
+		if err := db.Model(&models.Posting{}).Where("account_id = ?", account.ID).
+			Select("COALESCE(SUM(amount), 0)").Scan(&sum).Error; err != nil {
+			return nil, fmt.Errorf("failed to sum postings for account %d: %w", account.ID, err)
+		}
+		posted[account.ID] = sum
+	}
+	return reconcile(user, wallets, posted), nil
+}
+
+// reconcile compares the user's wallets with the sums of their postings,
+// given by account ID.
+func reconcile(user models.User, wallets []models.LedgerAccount, posted map[uint]int64) *Reconciliation {
+	result := &Reconciliation{
+		UserID:      user.ID,
+		Currency:    user.Currency,
+		UserBalance: user.Balance,
+		Balanced:    true,
+		Wallets:     []WalletReconciliation{},
+	}
+
+	hasPrimary := false
+	for _, account := range wallets {
+		wallet := WalletReconciliation{
+			AccountID:      account.ID,
+			Currency:       account.Currency,
+			AccountBalance: account.Balance,
+			PostedBalance:  posted[account.ID],
+		}
+		wallet.Balanced = wallet.PostedBalance == wallet.AccountBalance
+		result.Balanced = result.Balanced && wallet.Balanced
+		result.Wallets = append(result.Wallets, wallet)
+
+		if account.Currency == user.Currency {
+			hasPrimary = true
+			result.AccountID = account.ID
+			result.AccountBalance = wallet.AccountBalance
+			result.PostedBalance = wallet.PostedBalance
+		}
+	}
+
+	if hasPrimary {
+		result.Balanced = result.Balanced && result.AccountBalance == result.UserBalance
+	} else {
+		result.Balanced = result.Balanced && user.Balance == 0
+	}
+	return result
+}
+
+func ReconcileHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		result, err := ReconcileUser(db, currentUser.ID)
+		if err != nil {
+			log.Printf("Error reconciling ledger for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error reconciling balance", http.StatusInternalServerError)
+			return
+		}
+
+		if !result.Balanced {
+			log.Printf("⚠️ Ledger mismatch for user %d: user=%d account=%d postings=%d",
+				currentUser.ID, result.UserBalance, result.AccountBalance, result.PostedBalance)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func GetLedgerEntriesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		page := 1
+		if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				page = p
+			}
+		}
+
+		limit := 20
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+				limit = l
+			}
+		}
+
+		walletCurrency := currentUser.Currency
+		if c := r.URL.Query().Get("currency"); c != "" {
+			normalized, err := currency.Normalize(c)
+			if err != nil {
+				http.Error(w, "currency must be an ISO 4217 code", http.StatusBadRequest)
+				return
+			}
+			walletCurrency = normalized
+		}
+
+		response := LedgerHistoryResponse{Currency: walletCurrency, Page: page, Limit: limit, Entries: []JournalEntryResponse{}}
+
+		var account models.LedgerAccount
+		err := db.Where("code = ?", UserAccountCode(currentUser.ID, walletCurrency)).First(&account).Error
+		if err == gorm.ErrRecordNotFound {
+			if walletCurrency == currentUser.Currency {
+				response.Balance = currentUser.Balance
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching ledger account for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error fetching ledger", http.StatusInternalServerError)
+			return
+		}
+
+		response.AccountID = account.ID
+		response.Balance = account.Balance
+
+		entryIDs := db.Model(&models.Posting{}).Select("journal_entry_id").Where("account_id = ?", account.ID)
+
+		db.Model(&models.JournalEntry{}).Where("id IN (?)", entryIDs).Count(&response.Total)
+
+		var entries []models.JournalEntry
+		if err := db.Preload("Postings.Account").
+			Where("id IN (?)", entryIDs).
+			Order("posted_at DESC, id DESC").
+			Limit(limit).
+			Offset((page - 1) * limit).
+			Find(&entries).Error; err != nil {
+			log.Printf("Error fetching journal entries for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error fetching ledger", http.StatusInternalServerError)
+			return
+		}
+
+		for _, entry := range entries {
+			entryResponse := JournalEntryResponse{
+				ID:            entry.ID,
+				Kind:          string(entry.Kind),
+				TransactionID: entry.TransactionID,
+				Description:   entry.Description,
+				PostedAt:      entry.PostedAt,
+			}
+			for _, posting := range entry.Postings {
+				postingResponse := PostingResponse{
+					AccountID:   posting.AccountID,
+					AccountCode: posting.Account.Code,
+					Amount:      posting.Amount,
+				}
+				if posting.AccountID == account.ID {
+					balanceAfter := posting.BalanceAfter
+					postingResponse.BalanceAfter = &balanceAfter
+				}
+				entryResponse.Postings = append(entryResponse.Postings, postingResponse)
+			}
+			response.Entries = append(response.Entries, entryResponse)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// BalanceAt returns the balance of the user's wallet in a currency just
+// before the given time.
+// Postings are dated by their transaction's timestamp so that the result
+// lines up with transaction history, falling back to the posting time for
+// entries without a transaction such as opening balances.
+func BalanceAt(db *gorm.DB, userID uint, currencyCode string, at time.Time) (int64, error) {
+	var balance int64
+	err := db.Table("postings").
+		Select("COALESCE(SUM(postings.amount), 0)").
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+		Joins("JOIN journal_entries ON journal_entries.id = postings.journal_entry_id").
+		Joins("LEFT JOIN transactions ON transactions.id = journal_entries.transaction_id").
+		Where("ledger_accounts.code = ? AND postings.deleted_at IS NULL", UserAccountCode(userID, currencyCode)).
+		Where("COALESCE(transactions.timestamp, journal_entries.posted_at) < ?", at).
+		Scan(&balance).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute %s balance for user %d at %s: %w", currencyCode, userID, at.Format(time.RFC3339), err)
+	}
+	return balance, nil
+}
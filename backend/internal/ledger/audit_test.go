@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"reflect"
+	"testing"
+
+	"paytm/internal/models"
+)
+
+func TestReconcileUser(t *testing.T) {
+	user := models.User{Currency: "USD", Balance: 5000}
+	user.ID = 1
+	usd, inr := wallet(1, "USD", 5000), wallet(2, "INR", 83000)
+
+	tests := []struct {
+		name         string
+		user         models.User
+		wallets      []models.LedgerAccount
+		posted       map[uint]int64
+		want         bool
+		wantBalanced []bool
+	}{
+		{
+			"in balance",
+			user, []models.LedgerAccount{usd, inr},
+			map[uint]int64{1: 5000, 2: 83000},
+			true, []bool{true, true},
+		},
+		{
+			"primary wallet drifted from its postings",
+			user, []models.LedgerAccount{usd, inr},
+			map[uint]int64{1: 4900, 2: 83000},
+			false, []bool{false, true},
+		},
+		{
+			"other wallet drifted from its postings",
+			user, []models.LedgerAccount{usd, inr},
+			map[uint]int64{1: 5000, 2: 83100},
+			false, []bool{true, false},
+		},
+		{
+			"user balance drifted from the primary wallet",
+			models.User{Currency: "USD", Balance: 5100}, []models.LedgerAccount{usd, inr},
+			map[uint]int64{1: 5000, 2: 83000},
+			false, []bool{true, true},
+		},
+		{
+			"user balance without a primary wallet",
+			models.User{Currency: "EUR", Balance: 100}, []models.LedgerAccount{usd},
+			map[uint]int64{1: 5000},
+			false, []bool{true},
+		},
+		{
+			"no wallets yet",
+			models.User{Currency: "USD"}, nil,
+			map[uint]int64{},
+			true, []bool{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := reconcile(tt.user, tt.wallets, tt.posted)
+			if result.Balanced != tt.want {
+				t.Errorf("Balanced = %v, want %v", result.Balanced, tt.want)
+			}
+			balanced := []bool{}
+			for _, wallet := range result.Wallets {
+				balanced = append(balanced, wallet.Balanced)
+				if wallet.PostedBalance != tt.posted[wallet.AccountID] {
+					t.Errorf("wallet %d PostedBalance = %d, want %d", wallet.AccountID, wallet.PostedBalance, tt.posted[wallet.AccountID])
+				}
+			}
+			if !reflect.DeepEqual(balanced, tt.wantBalanced) {
+				t.Errorf("wallets balanced = %v, want %v", balanced, tt.wantBalanced)
+			}
+		})
+	}
+}
+
+func TestReconcileUserReportsPrimaryWallet(t *testing.T) {
+	user := models.User{Currency: "INR", Balance: 83000}
+	user.ID = 7
+	result := reconcile(user, []models.LedgerAccount{wallet(1, "USD", 5000), wallet(2, "INR", 83000)},
+		map[uint]int64{1: 5000, 2: 82000})
+
+	if result.UserID != 7 || result.Currency != "INR" || result.AccountID != 2 {
+		t.Errorf("reconcile() = user %d, %s wallet %d, want user 7, INR wallet 2", result.UserID, result.Currency, result.AccountID)
+	}
+	if result.UserBalance != 83000 || result.AccountBalance != 83000 || result.PostedBalance != 82000 {
+		t.Errorf("reconcile() balances = user %d, account %d, posted %d, want 83000, 83000, 82000",
+			result.UserBalance, result.AccountBalance, result.PostedBalance)
+	}
+	if result.Balanced {
+		t.Error("reconcile() = balanced, want the drifted INR wallet flagged")
+	}
+}
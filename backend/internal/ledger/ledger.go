@@ -0,0 +1,376 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/models"
+)
+
+const (
+	AccountCardFunding     = "system:card_funding"
+	AccountManualTopUp     = "system:manual_top_up"
+	AccountFeeRevenue      = "system:fee_revenue"
+	AccountOpeningBalances = "system:opening_balances"
+	AccountFXClearing      = "system:fx_clearing"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrUnbalancedEntry   = errors.New("journal entry postings do not sum to zero")
+	ErrEmptyEntry        = errors.New("journal entry needs at least two postings")
+)
+
+type Line struct {
+	AccountID uint
+	Amount    int64
+}
+
+// Leg is one side of a transfer: the wallet it touches and the amount in
+// that wallet's currency.
+type Leg struct {
+	UserID   uint
+	Currency string
+	Amount   int64
+}
+
+type Entry struct {
+	Kind          models.JournalEntryKind
+	TransactionID *uint
+	Description   string
+	Lines         []Line
+}
+
+func UserAccountCode(userID uint, currency string) string {
+	return fmt.Sprintf("user:%d:%s", userID, currency)
+}
+
+// SystemAccount returns the system account for code in the given currency.
+// Every currency has its own set so that each one balances on its own.
+func SystemAccount(tx *gorm.DB, code, currency string) (*models.LedgerAccount, error) {
+	account, _, err := getOrCreateAccount(tx, models.LedgerAccount{
+		Code:          code + ":" + currency,
+		Type:          models.LedgerAccountSystem,
+		Currency:      currency,
+		AllowNegative: true,
+	})
+	return account, err
+}
+
+// UserAccount returns the user's wallet in a currency, opening it on first
+// use. Balances that existed before the ledger are carried over into the
+// wallet of the user's primary currency with an opening_balance entry so the
+// account always reconciles with its postings.
+func UserAccount(tx *gorm.DB, userID uint, currency string) (*models.LedgerAccount, error) {
+	var user models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load user %d: %w", userID, err)
+	}
+
+	account, created, err := getOrCreateAccount(tx, models.LedgerAccount{
+		Code:     UserAccountCode(userID, currency),
+		Type:     models.LedgerAccountUserWallet,
+		UserID:   &user.ID,
+		Currency: currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if created && user.Balance != 0 && currency == user.Currency {
+		equity, err := SystemAccount(tx, AccountOpeningBalances, currency)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := Post(tx, Entry{
+			Kind:        models.JournalEntryOpeningBalance,
+			Description: "Opening balance carried over from wallet",
+			Lines: []Line{
+				{AccountID: account.ID, Amount: user.Balance},
+				{AccountID: equity.ID, Amount: -user.Balance},
+			},
+		}); err != nil {
+			return nil, fmt.Errorf("failed to post opening balance for user %d: %w", userID, err)
+		}
+		account.Balance = user.Balance
+	}
+
+	return account, nil
+}
+
+func getOrCreateAccount(tx *gorm.DB, account models.LedgerAccount) (*models.LedgerAccount, bool, error) {
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "code"}},
+		DoNothing: true,
+	}).Create(&account).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to create ledger account %s: %w", account.Code, err)
+	}
+	if account.ID != 0 {
+		return &account, true, nil
+	}
+
+	var existing models.LedgerAccount
+	if err := tx.Where("code = ?", account.Code).First(&existing).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to load ledger account %s: %w", account.Code, err)
+	}
+	return &existing, false, nil
+}
+
+// Wallets lists the user's wallet accounts, one per currency held.
+func Wallets(db *gorm.DB, userID uint) ([]models.LedgerAccount, error) {
+	var accounts []models.LedgerAccount
+	if err := db.Where("user_id = ? AND type = ?", userID, models.LedgerAccountUserWallet).
+		Order("currency").Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load wallets for user %d: %w", userID, err)
+	}
+	return accounts, nil
+}
+
+// Post writes a balanced journal entry and applies it to the account
+// balances. Postings must sum to zero within each currency. The wallet of
+// the user's primary currency mirrors its balance onto models.User.Balance,
+// which is therefore always derived from the ledger.
+func Post(tx *gorm.DB, entry Entry) (*models.JournalEntry, error) {
+	deltas, err := totals(entry.Lines)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var accounts []models.LedgerAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Order("id").Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to lock ledger accounts: %w", err)
+	}
+	if len(accounts) != len(ids) {
+		return nil, fmt.Errorf("journal entry references unknown ledger accounts")
+	}
+
+	balances, err := apply(accounts, deltas)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := models.JournalEntry{
+		Kind:          entry.Kind,
+		TransactionID: entry.TransactionID,
+		Description:   entry.Description,
+		PostedAt:      time.Now(),
+	}
+	running := make(map[uint]int64, len(accounts))
+	for _, account := range accounts {
+		running[account.ID] = account.Balance
+	}
+	for _, line := range entry.Lines {
+		running[line.AccountID] += line.Amount
+		journal.Postings = append(journal.Postings, models.Posting{
+			AccountID:    line.AccountID,
+			Amount:       line.Amount,
+			BalanceAfter: running[line.AccountID],
+		})
+	}
+
+	if err := tx.Create(&journal).Error; err != nil {
+		return nil, fmt.Errorf("failed to write journal entry: %w", err)
+	}
+
+	for _, account := range accounts {
+		if err := tx.Model(&models.LedgerAccount{}).Where("id = ?", account.ID).
+			UpdateColumn("balance", balances[account.ID]).Error; err != nil {
+			return nil, fmt.Errorf("failed to update ledger account %d: %w", account.ID, err)
+		}
+		if account.Type == models.LedgerAccountUserWallet && account.UserID != nil {
+			if err := tx.Model(&models.User{}).Where("id = ? AND currency = ?", *account.UserID, account.Currency).
+				UpdateColumn("balance", balances[account.ID]).Error; err != nil {
+				return nil, fmt.Errorf("failed to sync balance for user %d: %w", *account.UserID, err)
+			}
+		}
+	}
+
+	return &journal, nil
+}
+
+// totals checks the lines of an entry and sums them per account.
+func totals(lines []Line) (map[uint]int64, error) {
+	if len(lines) < 2 {
+		return nil, ErrEmptyEntry
+	}
+
+	deltas := make(map[uint]int64)
+	for _, line := range lines {
+		if line.Amount == 0 {
+			return nil, fmt.Errorf("posting to account %d has zero amount", line.AccountID)
+		}
+		deltas[line.AccountID] += line.Amount
+	}
+	return deltas, nil
+}
+
+// apply returns the balances of accounts after the per-account deltas of
+// an entry, which must sum to zero within each currency and leave no
+// account that cannot go negative below zero.
+func apply(accounts []models.LedgerAccount, deltas map[uint]int64) (map[uint]int64, error) {
+	sums := make(map[string]int64)
+	for _, account := range accounts {
+		sums[account.Currency] += deltas[account.ID]
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return nil, ErrUnbalancedEntry
+		}
+	}
+
+	balances := make(map[uint]int64, len(accounts))
+	for _, account := range accounts {
+		newBalance := account.Balance + deltas[account.ID]
+		if newBalance < 0 && !account.AllowNegative {
+			return nil, ErrInsufficientFunds
+		}
+		balances[account.ID] = newBalance
+	}
+	return balances, nil
+}
+
+// systemAccounts finds the ID of a system account in a currency.
+type systemAccounts func(code, currency string) (uint, error)
+
+func systemAccountsIn(tx *gorm.DB) systemAccounts {
+	return func(code, currency string) (uint, error) {
+		account, err := SystemAccount(tx, code, currency)
+		if err != nil {
+			return 0, err
+		}
+		return account.ID, nil
+	}
+}
+
+func Transfer(tx *gorm.DB, from, to Leg, transactionID uint, description string) (*models.JournalEntry, error) {
+	return transfer(tx, models.JournalEntryTransfer, from, to, transactionID, description)
+}
+
+func Refund(tx *gorm.DB, from, to Leg, transactionID uint, description string) (*models.JournalEntry, error) {
+	return transfer(tx, models.JournalEntryRefund, from, to, transactionID, description)
+}
+
+// transfer debits one wallet and credits another. When the legs are in
+// different currencies the money passes through the FX clearing account of
+// each currency, keeping both currencies balanced on their own.
+func transfer(tx *gorm.DB, kind models.JournalEntryKind, from, to Leg, transactionID uint, description string) (*models.JournalEntry, error) {
+	if err := checkLegs(from, to); err != nil {
+		return nil, err
+	}
+
+	// Open both wallets in user ID order so concurrent opposite transfers
+	// cannot deadlock on the user row locks.
+	first, second := from, to
+	if first.UserID > second.UserID {
+		first, second = second, first
+	}
+	accounts := make(map[uint]*models.LedgerAccount, 2)
+	for _, leg := range []Leg{first, second} {
+		account, err := UserAccount(tx, leg.UserID, leg.Currency)
+		if err != nil {
+			return nil, err
+		}
+		accounts[leg.UserID] = account
+	}
+
+	lines, err := transferLines(from, to, accounts[from.UserID].ID, accounts[to.UserID].ID, systemAccountsIn(tx))
+	if err != nil {
+		return nil, err
+	}
+
+	return Post(tx, Entry{
+		Kind:          kind,
+		TransactionID: &transactionID,
+		Description:   description,
+		Lines:         lines,
+	})
+}
+
+// checkLegs rejects a same-currency transfer whose legs differ, which would
+// create or destroy money.
+func checkLegs(from, to Leg) error {
+	if from.Currency == to.Currency && from.Amount != to.Amount {
+		return fmt.Errorf("same-currency transfer legs differ: %d != %d", from.Amount, to.Amount)
+	}
+	return nil
+}
+
+// transferLines moves money from the source wallet to the destination
+// wallet, through the FX clearing accounts when the legs' currencies
+// differ.
+func transferLines(from, to Leg, source, destination uint, system systemAccounts) ([]Line, error) {
+	lines := []Line{
+		{AccountID: source, Amount: -from.Amount},
+		{AccountID: destination, Amount: to.Amount},
+	}
+	if from.Currency != to.Currency {
+		fromClearing, err := system(AccountFXClearing, from.Currency)
+		if err != nil {
+			return nil, err
+		}
+		toClearing, err := system(AccountFXClearing, to.Currency)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines,
+			Line{AccountID: fromClearing, Amount: from.Amount},
+			Line{AccountID: toClearing, Amount: -to.Amount},
+		)
+	}
+	return lines, nil
+}
+
+// TopUp credits a wallet from an external funding account. The fee is
+// charged on top of the amount, so the funding account is debited for
+// both and the fee lands in fee revenue.
+func TopUp(tx *gorm.DB, kind models.JournalEntryKind, userID uint, currency, source string, amount, fee int64, transactionID uint, description string) (*models.JournalEntry, error) {
+	wallet, err := UserAccount(tx, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := topUpLines(wallet.ID, currency, source, amount, fee, systemAccountsIn(tx))
+	if err != nil {
+		return nil, err
+	}
+
+	return Post(tx, Entry{
+		Kind:          kind,
+		TransactionID: &transactionID,
+		Description:   description,
+		Lines:         lines,
+	})
+}
+
+// topUpLines credits the wallet with amount and debits the funding account
+// for amount and fee, crediting the fee to fee revenue.
+func topUpLines(wallet uint, currency, source string, amount, fee int64, system systemAccounts) ([]Line, error) {
+	funding, err := system(source, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []Line{
+		{AccountID: wallet, Amount: amount},
+		{AccountID: funding, Amount: -(amount + fee)},
+	}
+	if fee > 0 {
+		revenue, err := system(AccountFeeRevenue, currency)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, Line{AccountID: revenue, Amount: fee})
+	}
+	return lines, nil
+}
@@ -0,0 +1,252 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"paytm/internal/models"
+)
+
+func wallet(id uint, currency string, balance int64) models.LedgerAccount {
+	userID := id
+	account := models.LedgerAccount{
+		Code:     UserAccountCode(userID, currency),
+		Type:     models.LedgerAccountUserWallet,
+		UserID:   &userID,
+		Currency: currency,
+		Balance:  balance,
+	}
+	account.ID = id
+	return account
+}
+
+// systemIDs numbers the system accounts from 100 in order of first use and
+// keeps them, so a test can look them up again.
+type systemIDs map[string]models.LedgerAccount
+
+func (s systemIDs) lookup(code, currency string) (uint, error) {
+	key := code + ":" + currency
+	if account, ok := s[key]; ok {
+		return account.ID, nil
+	}
+	account := models.LedgerAccount{
+		Code:          key,
+		Type:          models.LedgerAccountSystem,
+		Currency:      currency,
+		AllowNegative: true,
+	}
+	account.ID = uint(100 + len(s))
+	s[key] = account
+	return account.ID, nil
+}
+
+func (s systemIDs) id(code, currency string) uint {
+	return s[code+":"+currency].ID
+}
+
+// post runs the checks Post makes on lines against accounts, without the
+// database, and returns the balances they would leave.
+func post(accounts []models.LedgerAccount, lines []Line) (map[uint]int64, error) {
+	deltas, err := totals(lines)
+	if err != nil {
+		return nil, err
+	}
+	touched := make([]models.LedgerAccount, 0, len(deltas))
+	for _, account := range accounts {
+		if _, ok := deltas[account.ID]; ok {
+			touched = append(touched, account)
+		}
+	}
+	if len(touched) != len(deltas) {
+		return nil, fmt.Errorf("journal entry references unknown ledger accounts")
+	}
+	return apply(touched, deltas)
+}
+
+func accountsOf(system systemIDs, wallets ...models.LedgerAccount) []models.LedgerAccount {
+	accounts := append([]models.LedgerAccount(nil), wallets...)
+	for _, account := range system {
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+func TestPostChecksEntries(t *testing.T) {
+	system := systemIDs{}
+	funding, _ := system.lookup(AccountCardFunding, "USD")
+	accounts := accountsOf(system, wallet(1, "USD", 500), wallet(2, "USD", 0), wallet(3, "INR", 0))
+
+	tests := []struct {
+		name  string
+		lines []Line
+		want  error
+	}{
+		{"balanced", []Line{{1, -200}, {2, 200}}, nil},
+		{"one posting", []Line{{1, -200}}, ErrEmptyEntry},
+		{"no postings", nil, ErrEmptyEntry},
+		{"more debited than credited", []Line{{1, -200}, {2, 150}}, ErrUnbalancedEntry},
+		{"more credited than debited", []Line{{1, -200}, {2, 250}}, ErrUnbalancedEntry},
+		{"balanced only across currencies", []Line{{1, -200}, {3, 200}}, ErrUnbalancedEntry},
+		{"wallet overdrawn", []Line{{1, -501}, {2, 501}}, ErrInsufficientFunds},
+		{"wallet emptied", []Line{{1, -500}, {2, 500}}, nil},
+		{"system account goes negative", []Line{{funding, -900}, {2, 900}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := post(accounts, tt.lines); !errors.Is(err, tt.want) {
+				t.Errorf("post() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := post(accounts, []Line{{1, -200}, {2, 0}, {2, 200}}); err == nil {
+		t.Error("post() with a zero posting = nil, want an error")
+	}
+	if _, err := post(accounts, []Line{{1, -200}, {99, 200}}); err == nil {
+		t.Error("post() to an unknown account = nil, want an error")
+	}
+}
+
+func TestTransferLines(t *testing.T) {
+	tests := []struct {
+		name         string
+		from, to     Leg
+		wantBalances map[string]int64
+	}{
+		{
+			"same currency",
+			Leg{UserID: 1, Currency: "USD", Amount: 250},
+			Leg{UserID: 2, Currency: "USD", Amount: 250},
+			map[string]int64{"user:1:USD": 750, "user:2:USD": 250},
+		},
+		{
+			"across currencies",
+			Leg{UserID: 1, Currency: "USD", Amount: 250},
+			Leg{UserID: 2, Currency: "INR", Amount: 20750},
+			map[string]int64{
+				"user:1:USD":               750,
+				"user:2:INR":               20750,
+				AccountFXClearing + ":USD": 250,
+				AccountFXClearing + ":INR": -20750,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkLegs(tt.from, tt.to); err != nil {
+				t.Fatalf("checkLegs() = %v", err)
+			}
+			system := systemIDs{}
+			lines, err := transferLines(tt.from, tt.to, 1, 2, system.lookup)
+			if err != nil {
+				t.Fatalf("transferLines() = %v", err)
+			}
+			accounts := accountsOf(system, wallet(1, tt.from.Currency, 1000), wallet(2, tt.to.Currency, 0))
+
+			// Every currency nets to zero on its own.
+			sums := map[string]int64{}
+			currencyOf := map[uint]string{}
+			for _, account := range accounts {
+				currencyOf[account.ID] = account.Currency
+			}
+			for _, line := range lines {
+				sums[currencyOf[line.AccountID]] += line.Amount
+			}
+			for currency, sum := range sums {
+				if sum != 0 {
+					t.Errorf("%s postings sum to %d, want 0", currency, sum)
+				}
+			}
+
+			balances, err := post(accounts, lines)
+			if err != nil {
+				t.Fatalf("post() = %v", err)
+			}
+			got := map[string]int64{}
+			for _, account := range accounts {
+				if balance, ok := balances[account.ID]; ok {
+					got[account.Code] = balance
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantBalances) {
+				t.Errorf("balances = %v, want %v", got, tt.wantBalances)
+			}
+		})
+	}
+}
+
+func TestTransferLinesNeedClearingAcrossCurrencies(t *testing.T) {
+	from := Leg{UserID: 1, Currency: "USD", Amount: 250}
+	to := Leg{UserID: 2, Currency: "INR", Amount: 20750}
+	accounts := []models.LedgerAccount{wallet(1, "USD", 1000), wallet(2, "INR", 0)}
+	direct := []Line{{1, -from.Amount}, {2, to.Amount}}
+	if _, err := post(accounts, direct); !errors.Is(err, ErrUnbalancedEntry) {
+		t.Errorf("post() of a cross-currency transfer without clearing = %v, want %v", err, ErrUnbalancedEntry)
+	}
+}
+
+func TestCheckLegsRejectsUnequalSameCurrencyLegs(t *testing.T) {
+	err := checkLegs(Leg{UserID: 1, Currency: "USD", Amount: 250}, Leg{UserID: 2, Currency: "USD", Amount: 249})
+	if err == nil {
+		t.Error("checkLegs() = nil, want an error")
+	}
+}
+
+func TestTopUpLines(t *testing.T) {
+	tests := []struct {
+		name         string
+		amount, fee  int64
+		wantBalances map[string]int64
+	}{
+		{
+			"fee on top of the amount",
+			10000, 250,
+			map[string]int64{
+				"user:1:USD":                10000,
+				AccountCardFunding + ":USD": -10250,
+				AccountFeeRevenue + ":USD":  250,
+			},
+		},
+		{
+			"no fee",
+			10000, 0,
+			map[string]int64{
+				"user:1:USD":                10000,
+				AccountCardFunding + ":USD": -10000,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system := systemIDs{}
+			lines, err := topUpLines(1, "USD", AccountCardFunding, tt.amount, tt.fee, system.lookup)
+			if err != nil {
+				t.Fatalf("topUpLines() = %v", err)
+			}
+			if _, ok := system[AccountFeeRevenue+":USD"]; ok != (tt.fee > 0) {
+				t.Errorf("fee revenue account used = %v, want %v", ok, tt.fee > 0)
+			}
+
+			accounts := accountsOf(system, wallet(1, "USD", 0))
+			balances, err := post(accounts, lines)
+			if err != nil {
+				t.Fatalf("post() = %v", err)
+			}
+			got := map[string]int64{}
+			for _, account := range accounts {
+				got[account.Code] = balances[account.ID]
+			}
+			if !reflect.DeepEqual(got, tt.wantBalances) {
+				t.Errorf("balances = %v, want %v", got, tt.wantBalances)
+			}
+			if credited := balances[1]; credited != tt.amount {
+				t.Errorf("wallet credited %d, want the full amount %d", credited, tt.amount)
+			}
+			if charged := -balances[system.id(AccountCardFunding, "USD")]; charged != tt.amount+tt.fee {
+				t.Errorf("funding charged %d, want amount plus fee %d", charged, tt.amount+tt.fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package ledger
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/models"
+)
+
+// MigrateCurrencies moves ledgers created before multi-currency wallets onto
+// per-currency accounts. Legacy wallets keep their balance in the currency
+// their owner had at the time, legacy system accounts become the default
+// currency's, and old transactions are stamped with the sender's currency.
+// Payment requests, schedules and expense groups get their payer's currency
+// and expenses their group's. Every step only touches rows still in the old
+// shape, so it is safe to run on each start.
+func MigrateCurrencies(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			UPDATE ledger_accounts
+			SET currency = COALESCE(NULLIF(users.currency, ''), ?),
+				code = ledger_accounts.code || ':' || COALESCE(NULLIF(users.currency, ''), ?)
+			FROM users
+			WHERE users.id = ledger_accounts.user_id
+				AND ledger_accounts.type = ?
+				AND ledger_accounts.code ~ '^user:[0-9]+$'`,
+			currency.Default, currency.Default, models.LedgerAccountUserWallet).Error; err != nil {
+			return fmt.Errorf("failed to migrate wallet accounts: %w", err)
+		}
+
+		if err := tx.Exec(`
+			UPDATE ledger_accounts
+			SET currency = ?, code = code || ':' || ?
+			WHERE type = ? AND code ~ '^system:[a-z_]+$'`,
+			currency.Default, currency.Default, models.LedgerAccountSystem).Error; err != nil {
+			return fmt.Errorf("failed to migrate system accounts: %w", err)
+		}
+
+		if err := tx.Exec(`
+			UPDATE transactions
+			SET currency = COALESCE(NULLIF(users.currency, ''), ?)
+			FROM users
+			WHERE users.id = transactions.sender_id
+				AND COALESCE(transactions.received_currency, '') = ''`,
+			currency.Default).Error; err != nil {
+			return fmt.Errorf("failed to migrate transaction currencies: %w", err)
+		}
+
+		if err := tx.Exec(`
+			UPDATE transactions
+			SET received_amount = amount, received_currency = currency
+			WHERE COALESCE(received_currency, '') = ''`).Error; err != nil {
+			return fmt.Errorf("failed to migrate transaction amounts: %w", err)
+		}
+
+		// Payment requests, schedules and groups made before they stored a
+		// currency were paid in the payer's primary one.
+		for _, backfill := range []struct{ table, payer string }{
+			{"payment_requests", "payer_id"},
+			{"scheduled_transfers", "user_id"},
+			{"expense_groups", "created_by_id"},
+		} {
+			if err := tx.Exec(fmt.Sprintf(`
+				UPDATE %[1]s
+				SET currency = COALESCE(NULLIF(users.currency, ''), ?)
+				FROM users
+				WHERE users.id = %[1]s.%[2]s
+					AND COALESCE(%[1]s.currency, '') = ''`, backfill.table, backfill.payer),
+				currency.Default).Error; err != nil {
+				return fmt.Errorf("failed to migrate %s currencies: %w", backfill.table, err)
+			}
+		}
+
+		if err := tx.Exec(`
+			UPDATE expenses
+			SET currency = expense_groups.currency
+			FROM expense_groups
+			WHERE expense_groups.id = expenses.group_id
+				AND COALESCE(expenses.currency, '') = ''`).Error; err != nil {
+			return fmt.Errorf("failed to migrate expense currencies: %w", err)
+		}
+		return nil
+	})
+}
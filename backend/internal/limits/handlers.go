@@ -0,0 +1,134 @@
+package limits
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/middleware"
+)
+
+type PeriodUsage struct {
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+type VelocityUsage struct {
+	MaxCount      int64      `json:"max_count"`
+	WindowSeconds int64      `json:"window_seconds"`
+	Used          int64      `json:"used"`
+	Remaining     int64      `json:"remaining"`
+	ResetsAt      *time.Time `json:"resets_at,omitempty"`
+}
+
+type KindUsage struct {
+	PerTransaction int64           `json:"per_transaction,omitempty"`
+	Daily          *PeriodUsage    `json:"daily,omitempty"`
+	Monthly        *PeriodUsage    `json:"monthly,omitempty"`
+	Velocity       []VelocityUsage `json:"velocity,omitempty"`
+}
+
+type LimitsResponse struct {
+	Tier     string    `json:"tier"`
+	Currency string    `json:"currency"`
+	Send     KindUsage `json:"send"`
+	Receive  KindUsage `json:"receive"`
+	TopUp    KindUsage `json:"top_up"`
+}
+
+func periodUsage(db *gorm.DB, policy *Policy, userID uint, kind Kind, limit int64, start, reset time.Time) (*PeriodUsage, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	used, err := usedSince(db, policy, userID, kind, start)
+	if err != nil {
+		return nil, err
+	}
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &PeriodUsage{Limit: limit, Used: used, Remaining: remaining, ResetsAt: reset}, nil
+}
+
+func kindUsage(db *gorm.DB, policy *Policy, userID uint, kind Kind, limit Limit, now time.Time) (KindUsage, error) {
+	usage := KindUsage{PerTransaction: limit.PerTransaction}
+
+	var err error
+	if usage.Daily, err = periodUsage(db, policy, userID, kind, limit.Daily,
+		startOfDay(now), startOfDay(now).AddDate(0, 0, 1)); err != nil {
+		return usage, err
+	}
+	if usage.Monthly, err = periodUsage(db, policy, userID, kind, limit.Monthly,
+		startOfMonth(now), startOfMonth(now).AddDate(0, 1, 0)); err != nil {
+		return usage, err
+	}
+
+	for _, velocity := range limit.Velocity {
+		count, earliest, err := countSince(db, userID, kind, now.Add(-velocity.Window()))
+		if err != nil {
+			return usage, err
+		}
+		v := VelocityUsage{
+			MaxCount:      velocity.MaxCount,
+			WindowSeconds: velocity.WindowSeconds,
+			Used:          count,
+			Remaining:     velocity.MaxCount - count,
+		}
+		if v.Remaining < 0 {
+			v.Remaining = 0
+		}
+		if earliest != nil {
+			resetsAt := earliest.Add(velocity.Window())
+			v.ResetsAt = &resetsAt
+		}
+		usage.Velocity = append(usage.Velocity, v)
+	}
+	return usage, nil
+}
+
+// GetLimitsHandler shows the user's tier limits and how much of each is
+// already used.
+func GetLimitsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		policy := DefaultPolicy()
+		tier := currentUser.Tier
+		if _, ok := policy.Tiers[tier]; !ok {
+			tier = TierStandard
+		}
+		tierLimits := policy.ForTier(tier)
+		now := time.Now()
+
+		response := LimitsResponse{Tier: tier, Currency: policy.Currency}
+		for _, item := range []struct {
+			kind   Kind
+			target *KindUsage
+		}{
+			{KindSend, &response.Send},
+			{KindReceive, &response.Receive},
+			{KindTopUp, &response.TopUp},
+		} {
+			usage, err := kindUsage(db, policy, currentUser.ID, item.kind, tierLimits.For(item.kind), now)
+			if err != nil {
+				log.Printf("Error computing %s limits for user %d: %v", item.kind, currentUser.ID, err)
+				http.Error(w, "Error fetching limits", http.StatusInternalServerError)
+				return
+			}
+			*item.target = usage
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
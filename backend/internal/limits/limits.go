@@ -0,0 +1,268 @@
+package limits
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/currency"
+	"paytm/internal/models"
+)
+
+type Scope string
+
+const (
+	ScopePerTransaction Scope = "per_transaction"
+	ScopeDaily          Scope = "daily"
+	ScopeMonthly        Scope = "monthly"
+	ScopeVelocity       Scope = "velocity"
+)
+
+// Error is returned when a movement would break a limit. Amounts are in
+// minor units of Currency; for velocity limits they count transactions.
+type Error struct {
+	Kind      Kind       `json:"kind"`
+	Scope     Scope      `json:"scope"`
+	Currency  string     `json:"currency,omitempty"`
+	Limit     int64      `json:"limit"`
+	Used      int64      `json:"used"`
+	Remaining int64      `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Scope == ScopeVelocity {
+		return fmt.Sprintf("%s velocity limit of %d transactions reached", e.Kind, e.Limit)
+	}
+	return fmt.Sprintf("%s %s limit of %d %s exceeded, %d remaining", e.Kind, e.Scope, e.Limit, e.Currency, e.Remaining)
+}
+
+// WriteError reports a limit rejection as JSON. Velocity limits answer 429
+// with Retry-After; amount limits answer 422.
+func WriteError(w http.ResponseWriter, e *Error) {
+	status := http.StatusUnprocessableEntity
+	if e.Scope == ScopeVelocity {
+		status = http.StatusTooManyRequests
+		if e.ResetsAt != nil {
+			seconds := int64(time.Until(*e.ResetsAt).Seconds()) + 1
+			if seconds < 1 {
+				seconds = 1
+			}
+			w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": e.Error(),
+		"limit": e,
+	})
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// scope narrows a transaction query to the movements of one kind that
+// count towards a user's limits. Failed and cancelled transactions never
+// moved money, so they are left out.
+func scope(query *gorm.DB, userID uint, kind Kind) (*gorm.DB, string, string) {
+	query = query.Model(&models.Transaction{}).
+		Where("status NOT IN ?", []models.TransactionStatus{models.TransactionStatusFailed, models.TransactionStatusCancelled})
+	switch kind {
+	case KindSend:
+		return query.Where("sender_id = ? AND receiver_id <> ? AND type = ?", userID, userID, models.TransactionSent), "amount", "currency"
+	case KindReceive:
+		return query.Where("receiver_id = ? AND sender_id <> ? AND type = ?", userID, userID, models.TransactionSent), "received_amount", "received_currency"
+	default:
+		return query.Where("sender_id = ? AND receiver_id = ? AND type = ?", userID, userID, models.TransactionSelf), "amount", "currency"
+	}
+}
+
+// usedSince sums a user's movements of one kind since a point in time,
+// converted into the policy currency.
+func usedSince(tx *gorm.DB, policy *Policy, userID uint, kind Kind, since time.Time) (int64, error) {
+	query, amountColumn, currencyColumn := scope(tx, userID, kind)
+
+	var sums []struct {
+		Currency string
+		Total    int64
+	}
+	if err := query.Where("timestamp >= ?", since).
+		Select(fmt.Sprintf("%s AS currency, COALESCE(SUM(%s), 0) AS total", currencyColumn, amountColumn)).
+		Group(currencyColumn).Scan(&sums).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum %s usage for user %d: %w", kind, userID, err)
+	}
+
+	var used int64
+	for _, sum := range sums {
+		converted, err := toPolicyCurrency(policy, sum.Total, sum.Currency)
+		if err != nil {
+			return 0, err
+		}
+		used += converted
+	}
+	return used, nil
+}
+
+// countSince counts a user's movements of one kind since a point in time and
+// returns the earliest of them, which is the first to leave the window.
+func countSince(tx *gorm.DB, userID uint, kind Kind, since time.Time) (int64, *time.Time, error) {
+	query, _, _ := scope(tx, userID, kind)
+
+	var result struct {
+		Count    int64
+		Earliest *time.Time
+	}
+	if err := query.Where("timestamp >= ?", since).
+		Select("COUNT(*) AS count, MIN(timestamp) AS earliest").
+		Scan(&result).Error; err != nil {
+		return 0, nil, fmt.Errorf("failed to count %s usage for user %d: %w", kind, userID, err)
+	}
+	return result.Count, result.Earliest, nil
+}
+
+func toPolicyCurrency(policy *Policy, amount int64, code string) (int64, error) {
+	if code == "" {
+		code = policy.Currency
+	}
+	conversion, err := currency.Convert(currency.DefaultProvider(), amount, code, policy.Currency)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert %s to %s for limits: %w", code, policy.Currency, err)
+	}
+	return conversion.Converted, nil
+}
+
+func check(tx *gorm.DB, user *models.User, kind Kind, amount int64, code string, now time.Time) error {
+	policy := DefaultPolicy()
+	limit := policy.ForTier(user.Tier).For(kind)
+
+	converted, err := toPolicyCurrency(policy, amount, code)
+	if err != nil {
+		return err
+	}
+
+	if limit.PerTransaction > 0 && converted > limit.PerTransaction {
+		return &Error{
+			Kind:      kind,
+			Scope:     ScopePerTransaction,
+			Currency:  policy.Currency,
+			Limit:     limit.PerTransaction,
+			Remaining: limit.PerTransaction,
+		}
+	}
+
+	periods := []struct {
+		scope Scope
+		limit int64
+		start time.Time
+		reset time.Time
+	}{
+		{ScopeDaily, limit.Daily, startOfDay(now), startOfDay(now).AddDate(0, 0, 1)},
+		{ScopeMonthly, limit.Monthly, startOfMonth(now), startOfMonth(now).AddDate(0, 1, 0)},
+	}
+	for _, period := range periods {
+		if period.limit <= 0 {
+			continue
+		}
+		used, err := usedSince(tx, policy, user.ID, kind, period.start)
+		if err != nil {
+			return err
+		}
+		if used+converted > period.limit {
+			resetsAt := period.reset
+			remaining := period.limit - used
+			if remaining < 0 {
+				remaining = 0
+			}
+			return &Error{
+				Kind:      kind,
+				Scope:     period.scope,
+				Currency:  policy.Currency,
+				Limit:     period.limit,
+				Used:      used,
+				Remaining: remaining,
+				ResetsAt:  &resetsAt,
+			}
+		}
+	}
+
+	for _, velocity := range limit.Velocity {
+		if velocity.MaxCount <= 0 || velocity.WindowSeconds <= 0 {
+			continue
+		}
+		count, earliest, err := countSince(tx, user.ID, kind, now.Add(-velocity.Window()))
+		if err != nil {
+			return err
+		}
+		if count >= velocity.MaxCount {
+			limitErr := &Error{
+				Kind:  kind,
+				Scope: ScopeVelocity,
+				Limit: velocity.MaxCount,
+				Used:  count,
+			}
+			if earliest != nil {
+				resetsAt := earliest.Add(velocity.Window())
+				limitErr.ResetsAt = &resetsAt
+			}
+			return limitErr
+		}
+	}
+	return nil
+}
+
+// lockUsers locks the given users in ID order, the same order the ledger
+// uses, so that concurrent checks for one user run one after another
+// without risking deadlocks.
+func lockUsers(tx *gorm.DB, ids ...uint) (map[uint]*models.User, error) {
+	var users []models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to lock users for limit check: %w", err)
+	}
+	byID := make(map[uint]*models.User, len(users))
+	for i := range users {
+		byID[users[i].ID] = &users[i]
+	}
+	for _, id := range ids {
+		if byID[id] == nil {
+			return nil, fmt.Errorf("user %d not found for limit check", id)
+		}
+	}
+	return byID, nil
+}
+
+// CheckTransfer checks the sender's send limits and the receiver's receive
+// limits. It must run inside the transaction that records the transfer.
+func CheckTransfer(tx *gorm.DB, senderID, receiverID uint, amount int64, code string, received int64, receivedCode string) error {
+	users, err := lockUsers(tx, senderID, receiverID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := check(tx, users[senderID], KindSend, amount, code, now); err != nil {
+		return err
+	}
+	return check(tx, users[receiverID], KindReceive, received, receivedCode, now)
+}
+
+// CheckTopUp checks a user's top-up limits inside the top-up's transaction.
+func CheckTopUp(tx *gorm.DB, userID uint, amount int64, code string) error {
+	users, err := lockUsers(tx, userID)
+	if err != nil {
+		return err
+	}
+	return check(tx, users[userID], KindTopUp, amount, code, time.Now())
+}
@@ -0,0 +1,139 @@
+package limits
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"paytm/internal/currency"
+)
+
+type Kind string
+
+const (
+	KindSend    Kind = "send"
+	KindReceive Kind = "receive"
+	KindTopUp   Kind = "top_up"
+)
+
+const (
+	TierBasic    = "basic"
+	TierStandard = "standard"
+	TierPremium  = "premium"
+)
+
+// Velocity caps how many transactions may start within a rolling window.
+type Velocity struct {
+	MaxCount      int64 `json:"max_count"`
+	WindowSeconds int64 `json:"window_seconds"`
+}
+
+func (v Velocity) Window() time.Duration {
+	return time.Duration(v.WindowSeconds) * time.Second
+}
+
+// Limit holds the caps for one kind of money movement, in minor units of the
+// policy currency. Zero means no cap. Daily and monthly limits run on UTC
+// calendar days and months.
+type Limit struct {
+	PerTransaction int64      `json:"per_transaction"`
+	Daily          int64      `json:"daily"`
+	Monthly        int64      `json:"monthly"`
+	Velocity       []Velocity `json:"velocity,omitempty"`
+}
+
+type TierLimits struct {
+	Send    Limit `json:"send"`
+	Receive Limit `json:"receive"`
+	TopUp   Limit `json:"top_up"`
+}
+
+func (t TierLimits) For(kind Kind) Limit {
+	switch kind {
+	case KindSend:
+		return t.Send
+	case KindReceive:
+		return t.Receive
+	default:
+		return t.TopUp
+	}
+}
+
+type Policy struct {
+	Currency string                `json:"currency"`
+	Tiers    map[string]TierLimits `json:"tiers"`
+}
+
+// ForTier returns the limits of a tier, treating unknown tiers as standard.
+func (p *Policy) ForTier(tier string) TierLimits {
+	if limits, ok := p.Tiers[tier]; ok {
+		return limits
+	}
+	return p.Tiers[TierStandard]
+}
+
+var defaultPolicy = Policy{
+	Currency: currency.Default,
+	Tiers: map[string]TierLimits{
+		TierBasic: {
+			Send:    Limit{PerTransaction: 50000, Daily: 100000, Monthly: 500000, Velocity: []Velocity{{MaxCount: 5, WindowSeconds: 3600}, {MaxCount: 20, WindowSeconds: 86400}}},
+			Receive: Limit{Daily: 200000, Monthly: 1000000},
+			TopUp:   Limit{PerTransaction: 50000, Daily: 100000, Monthly: 500000, Velocity: []Velocity{{MaxCount: 5, WindowSeconds: 3600}}},
+		},
+		TierStandard: {
+			Send:    Limit{PerTransaction: 200000, Daily: 500000, Monthly: 2000000, Velocity: []Velocity{{MaxCount: 10, WindowSeconds: 3600}, {MaxCount: 50, WindowSeconds: 86400}}},
+			Receive: Limit{Daily: 1000000, Monthly: 5000000},
+			TopUp:   Limit{PerTransaction: 100000, Daily: 300000, Monthly: 2000000, Velocity: []Velocity{{MaxCount: 10, WindowSeconds: 3600}}},
+		},
+		TierPremium: {
+			Send:    Limit{PerTransaction: 1000000, Daily: 2500000, Monthly: 10000000, Velocity: []Velocity{{MaxCount: 30, WindowSeconds: 3600}}},
+			Receive: Limit{},
+			TopUp:   Limit{PerTransaction: 500000, Daily: 1000000, Monthly: 5000000, Velocity: []Velocity{{MaxCount: 20, WindowSeconds: 3600}}},
+		},
+	},
+}
+
+func loadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read limits file: %w", err)
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse limits file: %w", err)
+	}
+	if policy.Currency, err = currency.Normalize(policy.Currency); err != nil {
+		return nil, fmt.Errorf("invalid limits file: %w", err)
+	}
+	if _, ok := policy.Tiers[TierStandard]; !ok {
+		return nil, fmt.Errorf("invalid limits file: the %q tier is required", TierStandard)
+	}
+	return &policy, nil
+}
+
+var (
+	policyOnce    sync.Once
+	currentPolicy *Policy
+)
+
+// DefaultPolicy loads the policy from the JSON file named by LIMITS_FILE,
+// falling back to the built-in tiers when it is unset or invalid.
+func DefaultPolicy() *Policy {
+	policyOnce.Do(func() {
+		currentPolicy = &defaultPolicy
+		path := os.Getenv("LIMITS_FILE")
+		if path == "" {
+			return
+		}
+		policy, err := loadPolicy(path)
+		if err != nil {
+			log.Printf("Warning: %v, falling back to built-in limits", err)
+			return
+		}
+		currentPolicy = policy
+	})
+	return currentPolicy
+}
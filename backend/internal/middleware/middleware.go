@@ -61,3 +61,16 @@ func GetUserFromContext(r *http.Request) (*models.User, bool) {
 	user, ok := r.Context().Value(UserContextKey).(*models.User)
 	return user, ok
 }
+
+// RequireAdmin lets only admin users through. It must run after
+// JWTAuthMiddleware, which puts the user in the context.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := GetUserFromContext(r)
+		if !ok || !user.IsAdmin {
+			http.Error(w, "Forbidden: admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
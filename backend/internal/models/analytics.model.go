@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type AnalyticsDirection string
+
+const (
+	AnalyticsIn    AnalyticsDirection = "in"
+	AnalyticsOut   AnalyticsDirection = "out"
+	AnalyticsTopUp AnalyticsDirection = "top_up"
+)
+
+// AnalyticsBucket sums one user's posted transactions over a 15-minute
+// window of UTC time, split by everything the analytics API groups on.
+// Every time zone offset in use is a multiple of 15 minutes, so buckets
+// roll up into local days, weeks and months exactly. CounterpartyID and
+// CardID are 0 when they do not apply.
+type AnalyticsBucket struct {
+	ID             uint               `gorm:"primaryKey"`
+	UserID         uint               `gorm:"not null;uniqueIndex:idx_analytics_bucket,priority:1"`
+	BucketStart    time.Time          `gorm:"not null;uniqueIndex:idx_analytics_bucket,priority:2"`
+	Currency       string             `gorm:"type:varchar(3);not null;uniqueIndex:idx_analytics_bucket,priority:3"`
+	Direction      AnalyticsDirection `gorm:"type:varchar(10);not null;uniqueIndex:idx_analytics_bucket,priority:4"`
+	CounterpartyID uint               `gorm:"not null;default:0;uniqueIndex:idx_analytics_bucket,priority:5"`
+	PaymentMethod  string             `gorm:"type:varchar(20);not null;default:'';uniqueIndex:idx_analytics_bucket,priority:6"`
+	CardID         uint               `gorm:"not null;default:0;uniqueIndex:idx_analytics_bucket,priority:7"`
+	Count          int64              `gorm:"not null;default:0"`
+	Amount         int64              `gorm:"not null;default:0"`
+	Fee            int64              `gorm:"not null;default:0"`
+}
+
+// AnalyticsCheckpoint remembers how far the summarizer has folded
+// transaction status changes into the buckets.
+type AnalyticsCheckpoint struct {
+	Name      string    `gorm:"primaryKey;type:varchar(50)"`
+	Watermark time.Time `gorm:"not null"`
+	UpdatedAt time.Time
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Budget caps what a user means to send in a calendar month (UTC), either
+// to one counterparty or under one of their categories. Each month starts
+// from zero; nothing carries over.
+type Budget struct {
+	gorm.Model
+	UserID         uint   `gorm:"not null;index"`
+	Name           string `gorm:"type:varchar(50);not null"`
+	CategoryID     *uint  `gorm:"index"`
+	CounterpartyID *uint  `gorm:"index"`
+	Currency       string `gorm:"type:varchar(3);not null"`
+	Amount         int64  `gorm:"not null"`
+
+	User         User      `gorm:"foreignKey:UserID"`
+	Category     *Category `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE"`
+	Counterparty *User     `gorm:"foreignKey:CounterpartyID"`
+}
+
+// BudgetAlert records that a budget's spending reached a threshold, in
+// percent, during a period (YYYY-MM). It is stored once per budget, period
+// and threshold, so each alert goes out at most once a month.
+type BudgetAlert struct {
+	ID            uint   `gorm:"primaryKey"`
+	BudgetID      uint   `gorm:"not null;uniqueIndex:idx_budget_alert_period_threshold"`
+	Period        string `gorm:"type:varchar(7);not null;uniqueIndex:idx_budget_alert_period_threshold"`
+	Threshold     int    `gorm:"not null;uniqueIndex:idx_budget_alert_period_threshold"`
+	Spent         int64  `gorm:"not null"`
+	TransactionID *uint
+	CreatedAt     time.Time
+
+	Budget Budget `gorm:"foreignKey:BudgetID;constraint:OnDelete:CASCADE"`
+}
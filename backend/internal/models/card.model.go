@@ -13,20 +13,34 @@ const (
 	CardTypeMasterCard CardType = "MC"
 	CardTypeAmex       CardType = "AMEX"
 	CardTypeDiscover   CardType = "DISC"
+	CardTypeRuPay      CardType = "RUPAY"
+	CardTypeJCB        CardType = "JCB"
+	CardTypeDiners     CardType = "DINERS"
+	CardTypeUnionPay   CardType = "UNIONPAY"
+	CardTypeMaestro    CardType = "MAESTRO"
 )
 
+// Card is a payment card on file. Deactivated cards stay listed but cannot
+// be charged; ExpiredAt is set, and the card deactivated, once its expiry
+// month has passed. At most one live card per user is the default for
+// top-ups. CardToken is the card vault token of the card number.
 type Card struct {
 	gorm.Model
-	UserID       uint     `gorm:"not null;index"`
+	UserID       uint     `gorm:"not null;index;uniqueIndex:idx_cards_user_default,where:is_default AND deleted_at IS NULL"`
 	CardToken    string   `gorm:"not null"`
 	MaskedNumber string   `gorm:"not null"`
 	CardType     CardType `gorm:"type:varchar(10);not null"`
 	HolderName   string   `gorm:"not null"`
+	Nickname     string   `gorm:"type:varchar(50)"`
 	ExpiryMonth  string   `gorm:"not null"`
 	ExpiryYear   string   `gorm:"not null"`
 	IsActive     bool     `gorm:"default:true"`
+	IsDefault    bool     `gorm:"not null;default:false"`
 	LastUsedAt   *time.Time
 
+	ExpiredAt           *time.Time
+	ExpiryWarningSentAt *time.Time
+
 	User         User          `gorm:"foreignKey:UserID"`
 	Transactions []Transaction `gorm:"foreignKey:CardID"`
 }
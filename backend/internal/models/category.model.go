@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Category is a user's own label for what a transaction was for. Each user
+// starts with a set of defaults they are free to rename or delete.
+type Category struct {
+	gorm.Model
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_category_user_name"`
+	Name      string `gorm:"type:varchar(50);not null;uniqueIndex:idx_category_user_name"`
+	Color     string `gorm:"type:varchar(7)"`
+	IsDefault bool   `gorm:"not null;default:false"`
+}
+
+// TransactionAnnotation is what one party to a transaction has recorded
+// about it. The other party never sees it.
+type TransactionAnnotation struct {
+	ID            uint   `gorm:"primaryKey"`
+	UserID        uint   `gorm:"not null;uniqueIndex:idx_annotation_user_transaction"`
+	TransactionID uint   `gorm:"not null;uniqueIndex:idx_annotation_user_transaction;index"`
+	CategoryID    *uint  `gorm:"index"`
+	Note          string `gorm:"type:text"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	Category *Category `gorm:"foreignKey:CategoryID;constraint:OnDelete:SET NULL"`
+}
+
+// TransactionTag is a free-form tag a user put on a transaction.
+type TransactionTag struct {
+	ID            uint   `gorm:"primaryKey"`
+	UserID        uint   `gorm:"not null;uniqueIndex:idx_tag_user_transaction_tag,priority:1;index:idx_tag_user_tag,priority:1"`
+	TransactionID uint   `gorm:"not null;uniqueIndex:idx_tag_user_transaction_tag,priority:2"`
+	Tag           string `gorm:"type:varchar(50);not null;uniqueIndex:idx_tag_user_transaction_tag,priority:3;index:idx_tag_user_tag,priority:2"`
+	CreatedAt     time.Time
+}
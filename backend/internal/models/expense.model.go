@@ -0,0 +1,66 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+type SplitMethod string
+
+const (
+	SplitEqual  SplitMethod = "equal"
+	SplitShares SplitMethod = "shares"
+	SplitExact  SplitMethod = "exact"
+)
+
+// ExpenseGroup.Currency is the currency of every expense, balance and
+// settlement in the group.
+type ExpenseGroup struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	CreatedByID uint   `gorm:"not null;index"`
+	Currency    string `gorm:"type:varchar(3)"`
+
+	Members  []ExpenseGroupMember `gorm:"foreignKey:GroupID"`
+	Expenses []Expense            `gorm:"foreignKey:GroupID"`
+}
+
+// ExpenseGroupMember.Balance is positive when the group owes the member
+// and negative when the member owes the group.
+type ExpenseGroupMember struct {
+	gorm.Model
+	GroupID uint  `gorm:"not null;uniqueIndex:idx_group_member"`
+	UserID  uint  `gorm:"not null;uniqueIndex:idx_group_member;index"`
+	Balance int64 `gorm:"not null;default:0"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+type Expense struct {
+	gorm.Model
+	GroupID     uint   `gorm:"not null;index"`
+	PaidByID    uint   `gorm:"not null"`
+	CreatedByID uint   `gorm:"not null"`
+	Amount      int64  `gorm:"not null"`
+	Currency    string `gorm:"type:varchar(3)"`
+	Description string
+	SplitMethod SplitMethod `gorm:"type:varchar(10);not null"`
+
+	Shares []ExpenseShare `gorm:"foreignKey:ExpenseID"`
+}
+
+type ExpenseShare struct {
+	gorm.Model
+	ExpenseID uint  `gorm:"not null;index"`
+	UserID    uint  `gorm:"not null"`
+	Shares    int64 `gorm:"not null;default:0"`
+	Amount    int64 `gorm:"not null"`
+}
+
+type GroupSettlement struct {
+	gorm.Model
+	GroupID       uint  `gorm:"not null;index"`
+	FromUserID    uint  `gorm:"not null"`
+	ToUserID      uint  `gorm:"not null"`
+	Amount        int64 `gorm:"not null"`
+	TransactionID uint  `gorm:"not null"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+type IdempotencyKey struct {
+	ID           uint   `gorm:"primarykey"`
+	UserID       uint   `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key          string `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Method       string `gorm:"type:varchar(10);not null"`
+	Path         string `gorm:"not null"`
+	RequestHash  string `gorm:"type:varchar(64);not null"`
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CompletedAt  *time.Time
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
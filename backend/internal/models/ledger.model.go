@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type LedgerAccountType string
+type JournalEntryKind string
+
+const (
+	LedgerAccountUserWallet LedgerAccountType = "user_wallet"
+	LedgerAccountSystem     LedgerAccountType = "system"
+)
+
+const (
+	JournalEntryOpeningBalance JournalEntryKind = "opening_balance"
+	JournalEntryTransfer       JournalEntryKind = "transfer"
+	JournalEntryTopUp          JournalEntryKind = "top_up"
+	JournalEntryCardTopUp      JournalEntryKind = "card_top_up"
+	JournalEntryRefund         JournalEntryKind = "refund"
+)
+
+type LedgerAccount struct {
+	gorm.Model
+	Code          string            `gorm:"uniqueIndex;not null"`
+	Type          LedgerAccountType `gorm:"type:varchar(20);not null"`
+	UserID        *uint             `gorm:"index"`
+	Currency      string            `gorm:"type:varchar(3)"`
+	Balance       int64             `gorm:"not null;default:0"`
+	AllowNegative bool              `gorm:"default:false"`
+}
+
+type JournalEntry struct {
+	gorm.Model
+	Kind          JournalEntryKind `gorm:"type:varchar(30);not null"`
+	TransactionID *uint            `gorm:"index"`
+	Description   string
+	PostedAt      time.Time `gorm:"not null;index"`
+
+	Postings []Posting `gorm:"foreignKey:JournalEntryID"`
+}
+
+type Posting struct {
+	gorm.Model
+	JournalEntryID uint  `gorm:"not null;index"`
+	AccountID      uint  `gorm:"not null;index"`
+	Amount         int64 `gorm:"not null"`
+	BalanceAfter   int64 `gorm:"not null"`
+
+	Account LedgerAccount `gorm:"foreignKey:AccountID"`
+}
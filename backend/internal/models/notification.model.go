@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification is an entry in a user's in-app inbox. It is produced from
+// the event named by EventID, at most once per user and event.
+type Notification struct {
+	gorm.Model
+	UserID      uint       `gorm:"not null;uniqueIndex:idx_notification_user_event;index:idx_notification_user_read"`
+	EventID     string     `gorm:"type:varchar(40);not null;uniqueIndex:idx_notification_user_event"`
+	EventType   string     `gorm:"type:varchar(50);not null;index"`
+	Title       string     `gorm:"not null"`
+	Body        string     `gorm:"type:text"`
+	Data        string     `gorm:"type:text"`
+	ReadAt      *time.Time `gorm:"index:idx_notification_user_read"`
+	DismissedAt *time.Time
+
+	User User `gorm:"foreignKey:UserID"`
+}
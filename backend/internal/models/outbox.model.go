@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// OutboxEvent is a domain event written in the same database transaction
+// as the change it describes and later published by the relay. ID gives
+// the publishing order.
+type OutboxEvent struct {
+	ID          uint       `gorm:"primaryKey"`
+	EventID     string     `gorm:"type:varchar(40);not null;uniqueIndex"`
+	Type        string     `gorm:"type:varchar(50);not null"`
+	UserIDs     string     `gorm:"type:varchar(255)"`
+	Data        string     `gorm:"type:text;not null"`
+	CreatedAt   time.Time  `gorm:"not null"`
+	PublishedAt *time.Time `gorm:"index"`
+	Attempts    int        `gorm:"not null;default:0"`
+	LastError   string
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PaymentRequestStatus string
+
+const (
+	PaymentRequestPending   PaymentRequestStatus = "pending"
+	PaymentRequestAccepted  PaymentRequestStatus = "accepted"
+	PaymentRequestDeclined  PaymentRequestStatus = "declined"
+	PaymentRequestCancelled PaymentRequestStatus = "cancelled"
+	PaymentRequestExpired   PaymentRequestStatus = "expired"
+)
+
+type PaymentRequest struct {
+	gorm.Model
+	RequesterID   uint   `gorm:"not null;index"`
+	PayerID       uint   `gorm:"not null;index"`
+	Amount        int64  `gorm:"not null"`
+	Currency      string `gorm:"type:varchar(3)"`
+	Note          string
+	Status        PaymentRequestStatus `gorm:"type:varchar(20);not null;default:'pending';index"`
+	ExpiresAt     time.Time            `gorm:"not null;index"`
+	RespondedAt   *time.Time
+	TransactionID *uint
+
+	Requester   User         `gorm:"foreignKey:RequesterID"`
+	Payer       User         `gorm:"foreignKey:PayerID"`
+	Transaction *Transaction `gorm:"foreignKey:TransactionID"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RiskDecision string
+type RiskAction string
+type RiskReviewStatus string
+
+const (
+	RiskDecisionAllow RiskDecision = "allow"
+	RiskDecisionHold  RiskDecision = "hold"
+	RiskDecisionBlock RiskDecision = "block"
+)
+
+const (
+	RiskActionTransfer  RiskAction = "transfer"
+	RiskActionCardTopUp RiskAction = "card_top_up"
+)
+
+const (
+	RiskReviewPending  RiskReviewStatus = "pending"
+	RiskReviewApproved RiskReviewStatus = "approved"
+	RiskReviewRejected RiskReviewStatus = "rejected"
+)
+
+// RiskAssessment records the outcome of screening one transaction. Held
+// transactions wait in pending with ReviewStatus pending until someone from
+// ops approves or rejects them.
+type RiskAssessment struct {
+	gorm.Model
+	Action         RiskAction `gorm:"type:varchar(20);not null"`
+	UserID         uint       `gorm:"not null;index"`
+	TransactionID  uint       `gorm:"not null;index"`
+	CounterpartyID *uint
+	CardID         *uint
+	Amount         int64        `gorm:"not null"`
+	Currency       string       `gorm:"type:varchar(3);not null"`
+	Decision       RiskDecision `gorm:"type:varchar(10);not null;index"`
+
+	ReviewStatus RiskReviewStatus `gorm:"type:varchar(10);index"`
+	ReviewedByID *uint
+	ReviewedAt   *time.Time
+	ReviewNote   string
+
+	Hits        []RiskRuleHit `gorm:"foreignKey:AssessmentID"`
+	Transaction Transaction   `gorm:"foreignKey:TransactionID"`
+}
+
+// RiskRuleHit is one rule that fired during an assessment, kept so rules
+// can be tuned against how often they fire and how reviews turn out.
+type RiskRuleHit struct {
+	ID           uint         `gorm:"primaryKey"`
+	AssessmentID uint         `gorm:"not null;index"`
+	Rule         string       `gorm:"type:varchar(50);not null;index"`
+	Decision     RiskDecision `gorm:"type:varchar(10);not null"`
+	Reason       string       `gorm:"not null"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ScheduleFrequency string
+type ScheduleStatus string
+type ScheduleRunStatus string
+
+const (
+	ScheduleOnce    ScheduleFrequency = "once"
+	ScheduleDaily   ScheduleFrequency = "daily"
+	ScheduleWeekly  ScheduleFrequency = "weekly"
+	ScheduleMonthly ScheduleFrequency = "monthly"
+)
+
+const (
+	ScheduleActive    ScheduleStatus = "active"
+	SchedulePaused    ScheduleStatus = "paused"
+	ScheduleCancelled ScheduleStatus = "cancelled"
+	ScheduleCompleted ScheduleStatus = "completed"
+	ScheduleFailed    ScheduleStatus = "failed"
+)
+
+const (
+	ScheduleRunSucceeded ScheduleRunStatus = "succeeded"
+	ScheduleRunFailed    ScheduleRunStatus = "failed"
+	ScheduleRunRetrying  ScheduleRunStatus = "retrying"
+	ScheduleRunHeld      ScheduleRunStatus = "held"
+)
+
+type ScheduledTransfer struct {
+	gorm.Model
+	UserID       uint   `gorm:"not null;index"`
+	ReceiverID   uint   `gorm:"not null"`
+	Amount       int64  `gorm:"not null"`
+	Currency     string `gorm:"type:varchar(3)"`
+	Description  string
+	Frequency    ScheduleFrequency `gorm:"type:varchar(10);not null"`
+	DayOfMonth   int
+	Timezone     string    `gorm:"default:'UTC'"`
+	StartAt      time.Time `gorm:"not null"`
+	EndAt        *time.Time
+	OccurrenceAt time.Time      `gorm:"not null"`
+	NextRunAt    time.Time      `gorm:"not null;index"`
+	Status       ScheduleStatus `gorm:"type:varchar(20);not null;default:'active';index"`
+	RetryCount   int            `gorm:"not null;default:0"`
+	RunCount     int            `gorm:"not null;default:0"`
+	LastRunAt    *time.Time
+	LastError    string
+
+	User     User                   `gorm:"foreignKey:UserID"`
+	Receiver User                   `gorm:"foreignKey:ReceiverID"`
+	Runs     []ScheduledTransferRun `gorm:"foreignKey:ScheduledTransferID"`
+}
+
+type ScheduledTransferRun struct {
+	gorm.Model
+	ScheduledTransferID uint              `gorm:"not null;index"`
+	OccurrenceAt        time.Time         `gorm:"not null"`
+	Attempt             int               `gorm:"not null"`
+	Status              ScheduleRunStatus `gorm:"type:varchar(20);not null"`
+	TransactionID       *uint
+	Error               string
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AccountStatement is the stored monthly statement of one of a user's
+// wallets. Period is the calendar month in UTC, formatted as YYYY-MM, and
+// the rendered documents are kept so a statement always downloads exactly
+// as it was issued.
+type AccountStatement struct {
+	gorm.Model
+	UserID         uint      `gorm:"not null;uniqueIndex:idx_statement_user_period"`
+	Currency       string    `gorm:"type:varchar(3);not null;uniqueIndex:idx_statement_user_period"`
+	Period         string    `gorm:"type:varchar(7);not null;uniqueIndex:idx_statement_user_period"`
+	PeriodStart    time.Time `gorm:"not null"`
+	PeriodEnd      time.Time `gorm:"not null"`
+	OpeningBalance int64     `gorm:"not null"`
+	ClosingBalance int64     `gorm:"not null"`
+	TotalIn        int64     `gorm:"not null;default:0"`
+	TotalOut       int64     `gorm:"not null;default:0"`
+	TotalFees      int64     `gorm:"not null;default:0"`
+	LineCount      int       `gorm:"not null;default:0"`
+	HTML           string    `gorm:"type:text"`
+	PDF            []byte
+	Checksum       string    `gorm:"type:varchar(64)"`
+	GeneratedAt    time.Time `gorm:"not null"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
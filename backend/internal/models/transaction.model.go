@@ -7,12 +7,24 @@ import (
 )
 
 type TransactionType string
+type TransactionStatus string
 type PaymentMethod string
 
 const (
 	TransactionSent     TransactionType = "sent"
 	TransactionReceived TransactionType = "received"
 	TransactionSelf     TransactionType = "self"
+	TransactionRefund   TransactionType = "refund"
+)
+
+const (
+	TransactionStatusPending           TransactionStatus = "pending"
+	TransactionStatusProcessing        TransactionStatus = "processing"
+	TransactionStatusCompleted         TransactionStatus = "completed"
+	TransactionStatusFailed            TransactionStatus = "failed"
+	TransactionStatusPartiallyRefunded TransactionStatus = "partially_refunded"
+	TransactionStatusReversed          TransactionStatus = "reversed"
+	TransactionStatusCancelled         TransactionStatus = "cancelled"
 )
 
 const (
@@ -21,20 +33,54 @@ const (
 	PaymentMethodUPI     PaymentMethod = "upi"
 )
 
+// Transaction.Amount is debited from the sender in Currency and
+// ReceivedAmount is credited to the receiver in ReceivedCurrency. They only
+// differ for cross-currency transfers, where ExchangeRate holds the units of
+// ReceivedCurrency bought by one unit of Currency.
 type Transaction struct {
 	gorm.Model
-	SenderID      uint
-	ReceiverID    uint
-	Amount        int64 `gorm:"not null"`
-	Fee           int64 `gorm:"default:0"`
+	SenderID      uint   `gorm:"index:idx_transactions_sender_timestamp,priority:1"`
+	ReceiverID    uint   `gorm:"index:idx_transactions_receiver_timestamp,priority:1"`
+	Amount        int64  `gorm:"not null"`
+	Fee           int64  `gorm:"default:0"`
+	Currency      string `gorm:"type:varchar(3);not null;default:'USD'"`
 	Description   string
 	Type          TransactionType `gorm:"type:varchar(20);not null"`
 	PaymentMethod PaymentMethod   `gorm:"type:varchar(20);default:'balance'"`
 	CardID        *uint
-	Status        string    `gorm:"default:'completed'"`
-	Timestamp     time.Time `gorm:"autoCreateTime"`
+	Status        TransactionStatus `gorm:"type:varchar(20);default:'pending'"`
+	Timestamp     time.Time         `gorm:"autoCreateTime;index:idx_transactions_sender_timestamp,priority:2;index:idx_transactions_receiver_timestamp,priority:2"`
+
+	OriginalTransactionID *uint `gorm:"index"`
+	RefundedAmount        int64 `gorm:"not null;default:0"`
+
+	ReceivedAmount   int64  `gorm:"not null;default:0"`
+	ReceivedCurrency string `gorm:"type:varchar(3)"`
+	ExchangeRate     string `gorm:"type:varchar(32)"`
+	RateSource       string
+
+	StatusChangedAt *time.Time `gorm:"index"`
+	FailureReason   string
+
+	// ProcessorReference is the card processor's authorization of a card
+	// top-up, kept to capture, void or refund it.
+	ProcessorReference string `gorm:"type:varchar(64);index"`
+
+	Sender   *User         `gorm:"foreignKey:SenderID"`
+	Receiver User          `gorm:"foreignKey:ReceiverID"`
+	Card     *Card         `gorm:"foreignKey:CardID"`
+	Refunds  []Transaction `gorm:"foreignKey:OriginalTransactionID"`
+
+	StatusChanges []TransactionStatusChange `gorm:"foreignKey:TransactionID"`
+}
 
-	Sender   *User `gorm:"foreignKey:SenderID"`
-	Receiver User  `gorm:"foreignKey:ReceiverID"`
-	Card     *Card `gorm:"foreignKey:CardID"`
+// TransactionStatusChange records one step of a transaction's lifecycle.
+// FromStatus is empty for the row written when the transaction is created.
+type TransactionStatusChange struct {
+	ID            uint              `gorm:"primaryKey"`
+	TransactionID uint              `gorm:"not null;index"`
+	FromStatus    TransactionStatus `gorm:"type:varchar(20)"`
+	ToStatus      TransactionStatus `gorm:"type:varchar(20);not null"`
+	Reason        string
+	ChangedAt     time.Time `gorm:"not null"`
 }
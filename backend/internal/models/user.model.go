@@ -13,6 +13,8 @@ type User struct {
 	ExternalID   string
 	Balance      int64  `gorm:"not null;default:0"`
 	Currency     string `gorm:"default:'USD'"`
+	Tier         string `gorm:"type:varchar(20);default:'standard'"`
+	IsAdmin      bool   `gorm:"not null;default:false"`
 	Avatar       string
 	Friends      []*User       `gorm:"many2many:user_friends;joinForeignKey:UserID;joinReferences:FriendID"`
 	Transactions []Transaction `gorm:"foreignKey:SenderID"`
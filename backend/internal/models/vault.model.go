@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// VaultEntry is a card number, encrypted, kept behind an opaque token.
+// Cards refer to their number only through Token; CVVs are never stored.
+// KeyID is the master key EncryptedPAN is under, empty for entries written
+// before key rotation.
+type VaultEntry struct {
+	ID           uint   `gorm:"primaryKey"`
+	Token        string `gorm:"type:varchar(40);not null;uniqueIndex"`
+	EncryptedPAN string `gorm:"type:text;not null"`
+	KeyID        string `gorm:"type:varchar(64);not null;default:'';index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (VaultEntry) TableName() string {
+	return "card_vault_entries"
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookEndpoint receives the events of its owner, or of every user when
+// Global is set (admins only). Events is a comma-separated list of event
+// types, or "*" for all of them.
+type WebhookEndpoint struct {
+	gorm.Model
+	UserID      uint   `gorm:"not null;index"`
+	Global      bool   `gorm:"not null;default:false"`
+	URL         string `gorm:"not null"`
+	Secret      string `gorm:"not null"`
+	Events      string `gorm:"not null"`
+	Description string
+	IsActive    bool `gorm:"not null;default:true"`
+
+	User User `gorm:"foreignKey:UserID"`
+}
+
+// WebhookDelivery is one event queued for one endpoint. Failed attempts are
+// retried with backoff until MaxAttempts, after which the delivery is failed
+// and can only be redelivered by hand.
+type WebhookDelivery struct {
+	gorm.Model
+	EndpointID     uint                  `gorm:"not null;index"`
+	EventID        string                `gorm:"type:varchar(40);not null;index"`
+	EventType      string                `gorm:"type:varchar(50);not null"`
+	Payload        string                `gorm:"type:text;not null"`
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(20);not null;default:'pending';index:idx_webhook_deliveries_due,priority:1"`
+	Attempts       int                   `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time             `gorm:"not null;index:idx_webhook_deliveries_due,priority:2"`
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	LastError      string
+	DeliveredAt    *time.Time
+	RedeliveryOf   *uint
+
+	Endpoint    WebhookEndpoint  `gorm:"foreignKey:EndpointID"`
+	AttemptLogs []WebhookAttempt `gorm:"foreignKey:DeliveryID"`
+}
+
+type WebhookAttempt struct {
+	ID           uint `gorm:"primaryKey"`
+	DeliveryID   uint `gorm:"not null;index"`
+	Attempt      int  `gorm:"not null"`
+	StatusCode   int
+	Error        string
+	ResponseBody string
+	DurationMs   int64
+	AttemptedAt  time.Time `gorm:"not null"`
+}
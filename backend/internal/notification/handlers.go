@@ -0,0 +1,286 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+type NotificationResponse struct {
+	ID        uint            `json:"id"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Read      bool            `json:"read"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type NotificationListResponse struct {
+	Notifications []NotificationResponse `json:"notifications"`
+	UnreadCount   int64                  `json:"unread_count"`
+	NextBefore    uint                   `json:"next_before,omitempty"`
+	HasMore       bool                   `json:"has_more"`
+}
+
+// BulkRequest selects notifications by ID, or every one in the inbox when
+// All is set.
+type BulkRequest struct {
+	IDs []uint `json:"ids"`
+	All bool   `json:"all"`
+}
+
+type BulkResponse struct {
+	Updated     int64 `json:"updated"`
+	UnreadCount int64 `json:"unread_count"`
+}
+
+func newNotificationResponse(notification models.Notification) NotificationResponse {
+	response := NotificationResponse{
+		ID:        notification.ID,
+		Type:      notification.EventType,
+		Title:     notification.Title,
+		Body:      notification.Body,
+		Read:      notification.ReadAt != nil,
+		ReadAt:    notification.ReadAt,
+		CreatedAt: notification.CreatedAt,
+	}
+	if notification.Data != "" {
+		response.Data = json.RawMessage(notification.Data)
+	}
+	return response
+}
+
+// inbox scopes a query to the notifications the user has not dismissed.
+func inbox(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Model(&models.Notification{}).Where("user_id = ? AND dismissed_at IS NULL", userID)
+}
+
+func unreadCount(db *gorm.DB, userID uint) (int64, error) {
+	var count int64
+	err := inbox(db, userID).Where("read_at IS NULL").Count(&count).Error
+	return count, err
+}
+
+// GetNotificationsHandler lists the user's inbox, newest first. status is
+// unread, read or all (the default); type filters by event type.
+func GetNotificationsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+
+		limit := 50
+		if raw := query.Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 200 {
+				http.Error(w, "Limit must be between 1 and 200", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		dbQuery := inbox(db, currentUser.ID)
+		switch query.Get("status") {
+		case "", "all":
+		case "unread":
+			dbQuery = dbQuery.Where("read_at IS NULL")
+		case "read":
+			dbQuery = dbQuery.Where("read_at IS NOT NULL")
+		default:
+			http.Error(w, "Status must be unread, read or all", http.StatusBadRequest)
+			return
+		}
+		if eventType := query.Get("type"); eventType != "" {
+			dbQuery = dbQuery.Where("event_type = ?", eventType)
+		}
+		if raw := query.Get("before"); raw != "" {
+			before, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+			dbQuery = dbQuery.Where("id < ?", uint(before))
+		}
+
+		var notifications []models.Notification
+		if err := dbQuery.Order("id DESC").Limit(limit + 1).Find(&notifications).Error; err != nil {
+			http.Error(w, "Error fetching notifications", http.StatusInternalServerError)
+			return
+		}
+
+		count, err := unreadCount(db, currentUser.ID)
+		if err != nil {
+			http.Error(w, "Error counting notifications", http.StatusInternalServerError)
+			return
+		}
+
+		response := NotificationListResponse{Notifications: []NotificationResponse{}, UnreadCount: count}
+		if len(notifications) > limit {
+			notifications = notifications[:limit]
+			response.HasMore = true
+			response.NextBefore = notifications[limit-1].ID
+		}
+		for _, notification := range notifications {
+			response.Notifications = append(response.Notifications, newNotificationResponse(notification))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func GetUnreadCountHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		count, err := unreadCount(db, currentUser.ID)
+		if err != nil {
+			http.Error(w, "Error counting notifications", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"unread_count": count})
+	}
+}
+
+// MarkReadHandler marks one notification as read. Marking it again keeps
+// the original read time.
+func MarkReadHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		notificationID, err := strconv.ParseUint(chi.URLParam(r, "notificationID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+
+		var notification models.Notification
+		if err := inbox(db, currentUser.ID).First(&notification, uint(notificationID)).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, "Notification not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching notification", http.StatusInternalServerError)
+			return
+		}
+
+		if notification.ReadAt == nil {
+			now := time.Now()
+			if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+				http.Error(w, "Error updating notification", http.StatusInternalServerError)
+				return
+			}
+			notification.ReadAt = &now
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newNotificationResponse(notification))
+	}
+}
+
+// BulkMarkReadHandler marks the selected notifications as read.
+func BulkMarkReadHandler(db *gorm.DB) http.HandlerFunc {
+	return bulkHandler(db, func(query *gorm.DB) *gorm.DB {
+		return query.Where("read_at IS NULL").Update("read_at", time.Now())
+	})
+}
+
+// BulkDismissHandler removes the selected notifications from the inbox.
+func BulkDismissHandler(db *gorm.DB) http.HandlerFunc {
+	return bulkHandler(db, func(query *gorm.DB) *gorm.DB {
+		return query.Update("dismissed_at", time.Now())
+	})
+}
+
+// DismissNotificationHandler removes one notification from the inbox.
+func DismissNotificationHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		notificationID, err := strconv.ParseUint(chi.URLParam(r, "notificationID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			return
+		}
+
+		result := inbox(db, currentUser.ID).Where("id = ?", uint(notificationID)).Update("dismissed_at", time.Now())
+		if result.Error != nil {
+			http.Error(w, "Error dismissing notification", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Notification dismissed"})
+	}
+}
+
+func bulkHandler(db *gorm.DB, apply func(query *gorm.DB) *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req BulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.All == (len(req.IDs) > 0) {
+			http.Error(w, "Provide either ids or all", http.StatusBadRequest)
+			return
+		}
+		if len(req.IDs) > 500 {
+			http.Error(w, "At most 500 ids at a time", http.StatusBadRequest)
+			return
+		}
+
+		query := inbox(db, currentUser.ID)
+		if !req.All {
+			query = query.Where("id IN ?", req.IDs)
+		}
+		result := apply(query)
+		if result.Error != nil {
+			http.Error(w, "Error updating notifications", http.StatusInternalServerError)
+			return
+		}
+
+		count, err := unreadCount(db, currentUser.ID)
+		if err != nil {
+			http.Error(w, "Error counting notifications", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BulkResponse{Updated: result.RowsAffected, UnreadCount: count})
+	}
+}
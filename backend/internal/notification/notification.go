@@ -0,0 +1,227 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/currency"
+	"paytm/internal/events"
+	"paytm/internal/models"
+)
+
+// Publisher turns published events into inbox notifications for the users
+// they concern. Users are only told about what others did to them, so the
+// user who added a friend, for instance, gets nothing.
+type Publisher struct {
+	db *gorm.DB
+}
+
+func NewPublisher(db *gorm.DB) *Publisher {
+	return &Publisher{db: db}
+}
+
+// Publish stores a notification per concerned user. A unique index on user
+// and event makes publishing the same event again a no-op.
+func (p *Publisher) Publish(ctx context.Context, event *events.Event) error {
+	db := p.db.WithContext(ctx)
+
+	raw, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event data: %w", event.Type, err)
+	}
+
+	c := &composer{db: db, names: map[uint]string{}}
+	var notifications []models.Notification
+	for _, userID := range event.UserIDs {
+		title, body, err := c.compose(event.Type, raw, userID)
+		if err != nil {
+			return err
+		}
+		if title == "" {
+			continue
+		}
+		notifications = append(notifications, models.Notification{
+			UserID:    userID,
+			EventID:   event.ID,
+			EventType: string(event.Type),
+			Title:     title,
+			Body:      body,
+			Data:      string(raw),
+		})
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).
+		Create(&notifications).Error; err != nil {
+		return fmt.Errorf("failed to store notifications for event %s: %w", event.ID, err)
+	}
+	return nil
+}
+
+type composer struct {
+	db    *gorm.DB
+	names map[uint]string
+}
+
+// compose writes the notification a user gets for an event, or an empty
+// title when they get none.
+func (c *composer) compose(t events.Type, raw []byte, userID uint) (string, string, error) {
+	switch {
+	case strings.HasPrefix(string(t), "transaction."):
+		var data events.TransactionData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", "", fmt.Errorf("invalid %s event data: %w", t, err)
+		}
+		return c.transaction(t, &data, userID)
+
+	case t == events.CardAdded:
+		var data events.CardData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", "", fmt.Errorf("invalid %s event data: %w", t, err)
+		}
+		return "Card added", fmt.Sprintf("Your %s card %s was added to your account. If this wasn't you, remove it and change your password.",
+			data.CardType, data.MaskedNumber), nil
+
+	case t == events.CardRemoved || t == events.CardExpiring || t == events.CardExpired:
+		var data events.CardData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", "", fmt.Errorf("invalid %s event data: %w", t, err)
+		}
+		card := data.CardType + " card " + data.MaskedNumber
+		if data.Nickname != "" {
+			card = fmt.Sprintf("%s (%s)", data.Nickname, card)
+		}
+		switch t {
+		case events.CardRemoved:
+			return "Card removed", fmt.Sprintf("Your %s was removed from your account. If this wasn't you, change your password.", card), nil
+		case events.CardExpiring:
+			return "Card expiring soon", fmt.Sprintf("Your %s expires at the end of %s/%s. Update its expiry date once you receive the renewed card.",
+				card, data.ExpiryMonth, data.ExpiryYear), nil
+		}
+		return "Card expired", fmt.Sprintf("Your %s has expired and can no longer be used for top-ups.", card), nil
+
+	case t == events.FriendAdded || t == events.FriendRemoved:
+		var data events.FriendData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", "", fmt.Errorf("invalid %s event data: %w", t, err)
+		}
+		if userID != data.FriendID {
+			return "", "", nil
+		}
+		name, err := c.name(data.UserID)
+		if err != nil {
+			return "", "", err
+		}
+		if t == events.FriendAdded {
+			return "New friend", name + " added you as a friend.", nil
+		}
+		return "Friend removed", name + " removed you from their friends.", nil
+
+	case t == events.SecurityLogin || t == events.SecurityLoginFailed:
+		var data events.SecurityData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", "", fmt.Errorf("invalid %s event data: %w", t, err)
+		}
+		from := ""
+		if data.IPAddress != "" {
+			from = " from " + data.IPAddress
+		}
+		if t == events.SecurityLogin {
+			return "New sign-in", "Your account was signed in to" + from + ". If this wasn't you, change your password.", nil
+		}
+		return "Failed sign-in attempt", "Someone tried to sign in to your account with a wrong password" + from + ".", nil
+
+	case t == events.BudgetThreshold:
+		var data events.BudgetData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return "", "", fmt.Errorf("invalid %s event data: %w", t, err)
+		}
+		body := fmt.Sprintf("You have spent %s of your %s budget \"%s\" this month.",
+			formatMoney(data.Spent, data.Currency), formatMoney(data.Amount, data.Currency), data.Name)
+		if data.Threshold >= 100 {
+			return "Budget exceeded", body, nil
+		}
+		return fmt.Sprintf("Budget %d%% used", data.Threshold), body, nil
+	}
+	return "", "", nil
+}
+
+func (c *composer) transaction(t events.Type, data *events.TransactionData, userID uint) (string, string, error) {
+	amount := formatMoney(data.Amount, data.Currency)
+
+	if data.SenderID == data.ReceiverID {
+		switch t {
+		case events.TransactionCompleted:
+			return "Top-up completed", amount + " was added to your wallet.", nil
+		case events.TransactionFailed:
+			return "Top-up failed", withReason("Your top-up of "+amount+" failed", data.FailureReason), nil
+		case events.TransactionCancelled:
+			return "Top-up cancelled", withReason("Your top-up of "+amount+" was cancelled", data.FailureReason), nil
+		}
+		return "", "", nil
+	}
+
+	// Refund transactions are announced through the refunded event on the
+	// transaction they refund.
+	if data.Type == string(models.TransactionRefund) {
+		return "", "", nil
+	}
+
+	otherID := data.ReceiverID
+	if userID == data.ReceiverID {
+		otherID = data.SenderID
+	}
+	other, err := c.name(otherID)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch t {
+	case events.TransactionCompleted:
+		if userID == data.ReceiverID {
+			return "Money received", fmt.Sprintf("%s sent you %s.", other, formatMoney(data.ReceivedAmount, data.ReceivedCurrency)), nil
+		}
+		return "Money sent", fmt.Sprintf("You sent %s to %s.", amount, other), nil
+	case events.TransactionFailed:
+		return "Transfer failed", withReason(fmt.Sprintf("Your transfer of %s to %s failed", amount, other), data.FailureReason), nil
+	case events.TransactionCancelled:
+		return "Transfer cancelled", withReason(fmt.Sprintf("Your transfer of %s to %s was cancelled", amount, other), data.FailureReason), nil
+	case events.TransactionRefunded:
+		refunded := formatMoney(data.RefundedAmount, data.Currency)
+		if userID == data.SenderID {
+			return "Refund received", fmt.Sprintf("%s refunded %s of your %s payment.", other, refunded, amount), nil
+		}
+		return "Refund issued", fmt.Sprintf("You have refunded %s of %s's %s payment.", refunded, other, amount), nil
+	}
+	return "", "", nil
+}
+
+func (c *composer) name(userID uint) (string, error) {
+	if name, ok := c.names[userID]; ok {
+		return name, nil
+	}
+	var user models.User
+	if err := c.db.Unscoped().Select("id", "name").First(&user, userID).Error; err != nil {
+		return "", fmt.Errorf("failed to load user %d: %w", userID, err)
+	}
+	c.names[userID] = user.Name
+	return user.Name, nil
+}
+
+func formatMoney(minor int64, code string) string {
+	return currency.FormatAmount(minor, code) + " " + code
+}
+
+func withReason(text, reason string) string {
+	if reason == "" {
+		return text + "."
+	}
+	return text + ": " + reason + "."
+}
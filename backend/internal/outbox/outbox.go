@@ -0,0 +1,61 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/events"
+	"paytm/internal/models"
+)
+
+// Record writes an event to the outbox inside the caller's transaction, so
+// it is published if and only if the surrounding work commits.
+func Record(tx *gorm.DB, event *events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+
+	userIDs := make([]string, 0, len(event.UserIDs))
+	for _, id := range event.UserIDs {
+		userIDs = append(userIDs, strconv.FormatUint(uint64(id), 10))
+	}
+
+	row := models.OutboxEvent{
+		EventID:   event.ID,
+		Type:      string(event.Type),
+		UserIDs:   strings.Join(userIDs, ","),
+		Data:      string(data),
+		CreatedAt: event.CreatedAt,
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return fmt.Errorf("failed to record %s event: %w", event.Type, err)
+	}
+	return nil
+}
+
+// Decode rebuilds the event stored in an outbox row. Data stays raw JSON so
+// it is published exactly as recorded.
+func Decode(row *models.OutboxEvent) (*events.Event, error) {
+	event := &events.Event{
+		ID:        row.EventID,
+		Type:      events.Type(row.Type),
+		CreatedAt: row.CreatedAt,
+		Data:      json.RawMessage(row.Data),
+		Sequence:  row.ID,
+	}
+	if row.UserIDs != "" {
+		for _, raw := range strings.Split(row.UserIDs, ",") {
+			id, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid user IDs %q on outbox event %d", row.UserIDs, row.ID)
+			}
+			event.UserIDs = append(event.UserIDs, uint(id))
+		}
+	}
+	return event, nil
+}
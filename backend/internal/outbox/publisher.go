@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"paytm/internal/events"
+)
+
+// Publisher hands events to the outside world. The relay publishes every
+// event at least once and in order, so a publisher may see an event again
+// after a failure and should deduplicate on Event.ID where that matters.
+type Publisher interface {
+	Publish(ctx context.Context, event *events.Event) error
+}
+
+// MultiPublisher publishes each event to every publisher in turn. An
+// error from any of them fails the event, which is then retried against
+// all of them.
+type MultiPublisher []Publisher
+
+func (m MultiPublisher) Publish(ctx context.Context, event *events.Event) error {
+	var errs []error
+	for _, publisher := range m {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogPublisher writes each event to the log.
+type LogPublisher struct{}
+
+func NewLogPublisher() *LogPublisher {
+	return &LogPublisher{}
+}
+
+func (p *LogPublisher) Publish(ctx context.Context, event *events.Event) error {
+	payload, err := event.Payload()
+	if err != nil {
+		return err
+	}
+	log.Printf("📣 Event %s %s users=%v: %s", event.Type, event.ID, event.UserIDs, payload)
+	return nil
+}
+
+// MemoryPublisher keeps published events in memory and passes them on to
+// in-process subscribers. A subscriber that falls a full buffer behind is
+// dropped and its channel closed, so it can catch up from durable storage
+// instead of silently missing events or stalling the relay.
+type MemoryPublisher struct {
+	mu          sync.Mutex
+	events      []*events.Event
+	limit       int
+	subscribers map[chan *events.Event]struct{}
+}
+
+// NewMemoryPublisher keeps at most limit events, or all of them when limit
+// is zero.
+func NewMemoryPublisher(limit int) *MemoryPublisher {
+	return &MemoryPublisher{limit: limit, subscribers: map[chan *events.Event]struct{}{}}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event *events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	if p.limit > 0 && len(p.events) > p.limit {
+		p.events = p.events[len(p.events)-p.limit:]
+	}
+	for ch := range p.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(p.subscribers, ch)
+			close(ch)
+		}
+	}
+	return nil
+}
+
+// Events returns the events kept so far, oldest first.
+func (p *MemoryPublisher) Events() []*events.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*events.Event(nil), p.events...)
+}
+
+// Subscribe returns a channel receiving events published from now on, and
+// a function that unsubscribes and closes it.
+func (p *MemoryPublisher) Subscribe(buffer int) (<-chan *events.Event, func()) {
+	ch := make(chan *events.Event, buffer)
+	p.mu.Lock()
+	p.subscribers[ch] = struct{}{}
+	p.mu.Unlock()
+
+	return ch, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if _, ok := p.subscribers[ch]; ok {
+			delete(p.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/models"
+)
+
+const (
+	batchSize = 100
+
+	// relayLockKey is the advisory lock that keeps a single relay
+	// publishing at a time across server instances, which is what keeps
+	// events in order.
+	relayLockKey = 0x6f7574626f78
+)
+
+// Relay publishes outbox events that have not been published yet, oldest
+// first. An event that fails to publish stops the run so nothing behind it
+// overtakes it; it is retried on the next run.
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+}
+
+func NewRelay(db *gorm.DB, publisher Publisher) *Relay {
+	return &Relay{db: db, publisher: publisher}
+}
+
+func (r *Relay) RunDue(ctx context.Context) error {
+	for {
+		published, err := r.publishBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if published < batchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// publishBatch publishes up to one batch and marks each event published as
+// it goes. Events are marked only after their publish succeeded, so a crash
+// in between means publishing them again rather than losing them.
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	tx := r.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var locked bool
+	if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", relayLockKey).Scan(&locked).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to take relay lock: %w", err)
+	}
+	if !locked {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	var rows []models.OutboxEvent
+	if err := tx.Where("published_at IS NULL").Order("id").Limit(batchSize).Find(&rows).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to fetch outbox events: %w", err)
+	}
+
+	published := 0
+	for i := range rows {
+		row := &rows[i]
+		if publishErr := r.publish(ctx, row); publishErr != nil {
+			log.Printf("❌ Outbox event %d (%s) failed to publish: %v", row.ID, row.Type, publishErr)
+			if err := tx.Model(row).Updates(map[string]interface{}{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": publishErr.Error(),
+			}).Error; err != nil {
+				tx.Rollback()
+				return published, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			break
+		}
+		if err := tx.Model(row).Updates(map[string]interface{}{
+			"published_at": time.Now(),
+			"attempts":     gorm.Expr("attempts + 1"),
+			"last_error":   "",
+		}).Error; err != nil {
+			tx.Rollback()
+			return published, fmt.Errorf("failed to mark outbox event %d published: %w", row.ID, err)
+		}
+		published++
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, fmt.Errorf("failed to commit outbox batch: %w", err)
+	}
+	return published, nil
+}
+
+func (r *Relay) publish(ctx context.Context, row *models.OutboxEvent) error {
+	event, err := Decode(row)
+	if err != nil {
+		return err
+	}
+	return r.publisher.Publish(ctx, event)
+}
@@ -0,0 +1,438 @@
+package paymentrequest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/transaction"
+)
+
+const (
+	defaultExpiryHours = 7 * 24
+	maxExpiryHours     = 30 * 24
+)
+
+type CreatePaymentRequestRequest struct {
+	PayerID        uint   `json:"payer_id"`
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency,omitempty"`
+	Note           string `json:"note"`
+	ExpiresInHours int    `json:"expires_in_hours,omitempty"`
+}
+
+type PaymentRequestResponse struct {
+	ID            uint                        `json:"id"`
+	Requester     transaction.TransactionUser `json:"requester"`
+	Payer         transaction.TransactionUser `json:"payer"`
+	Amount        int64                       `json:"amount"`
+	Currency      string                      `json:"currency"`
+	Note          string                      `json:"note"`
+	Status        string                      `json:"status"`
+	ExpiresAt     time.Time                   `json:"expires_at"`
+	CreatedAt     time.Time                   `json:"created_at"`
+	RespondedAt   *time.Time                  `json:"responded_at,omitempty"`
+	TransactionID *uint                       `json:"transaction_id,omitempty"`
+}
+
+type AcceptPaymentRequestResponse struct {
+	Request     PaymentRequestResponse          `json:"request"`
+	Transaction transaction.TransactionResponse `json:"transaction"`
+}
+
+func newPaymentRequestResponse(req models.PaymentRequest) PaymentRequestResponse {
+	return PaymentRequestResponse{
+		ID: req.ID,
+		Requester: transaction.TransactionUser{
+			ID:    req.Requester.ID,
+			Name:  req.Requester.Name,
+			Email: req.Requester.Email,
+		},
+		Payer: transaction.TransactionUser{
+			ID:    req.Payer.ID,
+			Name:  req.Payer.Name,
+			Email: req.Payer.Email,
+		},
+		Amount:        req.Amount,
+		Currency:      req.Currency,
+		Note:          req.Note,
+		Status:        string(req.Status),
+		ExpiresAt:     req.ExpiresAt,
+		CreatedAt:     req.CreatedAt,
+		RespondedAt:   req.RespondedAt,
+		TransactionID: req.TransactionID,
+	}
+}
+
+// expireStale moves pending requests past their expiry to expired so that
+// lists and responses never show a request that can no longer be paid.
+// Requests whose transfer is held for review stay pending until the review
+// decides whether they were paid.
+func expireStale(db *gorm.DB) error {
+	return db.Model(&models.PaymentRequest{}).
+		Where("status = ? AND expires_at <= ?", models.PaymentRequestPending, time.Now()).
+		Where("transaction_id IS NULL OR transaction_id NOT IN (?)", heldTransfers(db)).
+		Update("status", models.PaymentRequestExpired).Error
+}
+
+// heldTransfers selects the transactions still waiting to move money, which
+// for a payment request means its transfer is held for risk review.
+func heldTransfers(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Transaction{}).Select("id").Where("status = ?", models.TransactionStatusPending)
+}
+
+// awaitingReview reports whether the request was accepted with a transfer
+// that is still held for risk review.
+func awaitingReview(tx *gorm.DB, paymentRequest *models.PaymentRequest) (bool, error) {
+	if paymentRequest.TransactionID == nil {
+		return false, nil
+	}
+	var count int64
+	if err := heldTransfers(tx).Where("id = ?", *paymentRequest.TransactionID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check transfer of payment request %d: %w", paymentRequest.ID, err)
+	}
+	return count > 0, nil
+}
+
+func loadPaymentRequest(db *gorm.DB, id uint) (*models.PaymentRequest, error) {
+	var req models.PaymentRequest
+	if err := db.Preload("Requester").Preload("Payer").First(&req, id).Error; err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func CreatePaymentRequestHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreatePaymentRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if req.Amount <= 0 {
+			http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		if req.PayerID == currentUser.ID {
+			http.Error(w, "Cannot request money from yourself", http.StatusBadRequest)
+			return
+		}
+
+		expiresIn := req.ExpiresInHours
+		if expiresIn == 0 {
+			expiresIn = defaultExpiryHours
+		}
+		if expiresIn < 0 || expiresIn > maxExpiryHours {
+			http.Error(w, fmt.Sprintf("expires_in_hours must be between 1 and %d", maxExpiryHours), http.StatusBadRequest)
+			return
+		}
+
+		var payer models.User
+		if err := db.First(&payer, req.PayerID).Error; err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		// The payer pays from their wallet in this currency, by default
+		// the primary one they hold now.
+		code, err := transaction.TransferCurrency(req.Currency, payer.Currency)
+		if err != nil {
+			transaction.WriteTransferError(w, err)
+			return
+		}
+
+		paymentRequest := models.PaymentRequest{
+			RequesterID: currentUser.ID,
+			PayerID:     payer.ID,
+			Amount:      req.Amount,
+			Currency:    code,
+			Note:        req.Note,
+			Status:      models.PaymentRequestPending,
+			ExpiresAt:   time.Now().Add(time.Duration(expiresIn) * time.Hour),
+		}
+
+		if err := db.Create(&paymentRequest).Error; err != nil {
+			log.Printf("Error creating payment request for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating payment request", http.StatusInternalServerError)
+			return
+		}
+
+		paymentRequest.Requester = *currentUser
+		paymentRequest.Payer = payer
+
+		log.Printf("✅ Payment request %d created: %d asks %d for %d %s",
+			paymentRequest.ID, currentUser.ID, payer.ID, req.Amount, code)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newPaymentRequestResponse(paymentRequest))
+	}
+}
+
+func listPaymentRequests(db *gorm.DB, column string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if err := expireStale(db); err != nil {
+			log.Printf("Error expiring payment requests: %v", err)
+		}
+
+		query := db.Preload("Requester").Preload("Payer").
+			Where(column+" = ?", currentUser.ID)
+		if status := r.URL.Query().Get("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var requests []models.PaymentRequest
+		if err := query.Order("created_at DESC").Find(&requests).Error; err != nil {
+			http.Error(w, "Error fetching payment requests", http.StatusInternalServerError)
+			return
+		}
+
+		responses := []PaymentRequestResponse{}
+		for _, req := range requests {
+			responses = append(responses, newPaymentRequestResponse(req))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]PaymentRequestResponse{"requests": responses})
+	}
+}
+
+func GetIncomingRequestsHandler(db *gorm.DB) http.HandlerFunc {
+	return listPaymentRequests(db, "payer_id")
+}
+
+func GetOutgoingRequestsHandler(db *gorm.DB) http.HandlerFunc {
+	return listPaymentRequests(db, "requester_id")
+}
+
+func AcceptPaymentRequestHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, err := strconv.ParseUint(chi.URLParam(r, "requestID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		var paymentRequest models.PaymentRequest
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&paymentRequest, uint(requestID)).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Payment request not found", http.StatusNotFound)
+			return
+		}
+
+		if paymentRequest.PayerID != currentUser.ID {
+			tx.Rollback()
+			http.Error(w, "Only the payer can accept this request", http.StatusForbidden)
+			return
+		}
+
+		if paymentRequest.Status != models.PaymentRequestPending {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("Payment request is already %s", paymentRequest.Status), http.StatusConflict)
+			return
+		}
+
+		held, err := awaitingReview(tx, &paymentRequest)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error accepting payment request %d: %v", paymentRequest.ID, err)
+			http.Error(w, "Error completing payment request", http.StatusInternalServerError)
+			return
+		}
+		if held {
+			tx.Rollback()
+			http.Error(w, "Payment request is awaiting risk review", http.StatusConflict)
+			return
+		}
+
+		if !paymentRequest.ExpiresAt.After(time.Now()) {
+			tx.Model(&paymentRequest).Update("status", models.PaymentRequestExpired)
+			tx.Commit()
+			http.Error(w, "Payment request has expired", http.StatusGone)
+			return
+		}
+
+		description := fmt.Sprintf("Payment request #%d", paymentRequest.ID)
+		if paymentRequest.Note != "" {
+			description += ": " + paymentRequest.Note
+		}
+
+		result, err := transaction.Transfer(tx, currentUser.ID, paymentRequest.RequesterID, paymentRequest.Amount, paymentRequest.Currency, description)
+		switch {
+		case errors.Is(err, transaction.ErrBlockedByRisk):
+			// The request stays open; the declined attempt is kept.
+			if err := tx.Commit().Error; err != nil {
+				log.Printf("Error recording declined transfer: %v", err)
+			}
+			transaction.WriteTransferError(w, err)
+			return
+		case errors.Is(err, transaction.ErrHeldForReview):
+		case err != nil:
+			tx.Rollback()
+			transaction.WriteTransferError(w, err)
+			return
+		}
+
+		// A held transfer is linked to the request, which stays pending and
+		// is accepted once the transfer is approved.
+		updates := map[string]interface{}{"transaction_id": result.Transaction.ID}
+		if err == nil {
+			updates["status"] = models.PaymentRequestAccepted
+			updates["responded_at"] = time.Now()
+		}
+		if err := tx.Model(&paymentRequest).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error updating payment request", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			http.Error(w, "Error completing payment request", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusAccepted
+			log.Printf("⏸️ Payment request %d accepted by user %d is held for review (transaction %d)",
+				paymentRequest.ID, currentUser.ID, result.Transaction.ID)
+		} else {
+			log.Printf("✅ Payment request %d accepted by user %d (transaction %d)",
+				paymentRequest.ID, currentUser.ID, result.Transaction.ID)
+		}
+
+		loaded, err := loadPaymentRequest(db, paymentRequest.ID)
+		if err != nil {
+			http.Error(w, "Payment request accepted but could not be loaded", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(AcceptPaymentRequestResponse{
+			Request:     newPaymentRequestResponse(*loaded),
+			Transaction: transaction.NewTransferResponse(result),
+		})
+	}
+}
+
+// closePaymentRequest handles the responses that settle a request without
+// moving money: the payer declining it or the requester cancelling it.
+func closePaymentRequest(db *gorm.DB, status models.PaymentRequestStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestID, err := strconv.ParseUint(chi.URLParam(r, "requestID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if err := expireStale(db); err != nil {
+			log.Printf("Error expiring payment requests: %v", err)
+		}
+
+		var paymentRequest models.PaymentRequest
+		if err := db.First(&paymentRequest, uint(requestID)).Error; err != nil {
+			http.Error(w, "Payment request not found", http.StatusNotFound)
+			return
+		}
+
+		if status == models.PaymentRequestDeclined && paymentRequest.PayerID != currentUser.ID {
+			http.Error(w, "Only the payer can decline this request", http.StatusForbidden)
+			return
+		}
+		if status == models.PaymentRequestCancelled && paymentRequest.RequesterID != currentUser.ID {
+			http.Error(w, "Only the requester can cancel this request", http.StatusForbidden)
+			return
+		}
+
+		held, err := awaitingReview(db, &paymentRequest)
+		if err != nil {
+			log.Printf("Error closing payment request %d: %v", paymentRequest.ID, err)
+			http.Error(w, "Error updating payment request", http.StatusInternalServerError)
+			return
+		}
+		if held {
+			http.Error(w, "Payment request is awaiting risk review", http.StatusConflict)
+			return
+		}
+
+		now := time.Now()
+		result := db.Model(&models.PaymentRequest{}).
+			Where("id = ? AND status = ?", paymentRequest.ID, models.PaymentRequestPending).
+			Updates(map[string]interface{}{"status": status, "responded_at": &now})
+		if result.Error != nil {
+			http.Error(w, "Error updating payment request", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			current, err := loadPaymentRequest(db, paymentRequest.ID)
+			if err != nil {
+				http.Error(w, "Error updating payment request", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Payment request is already %s", current.Status), http.StatusConflict)
+			return
+		}
+
+		loaded, err := loadPaymentRequest(db, paymentRequest.ID)
+		if err != nil {
+			http.Error(w, "Error fetching payment request", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newPaymentRequestResponse(*loaded))
+	}
+}
+
+func DeclinePaymentRequestHandler(db *gorm.DB) http.HandlerFunc {
+	return closePaymentRequest(db, models.PaymentRequestDeclined)
+}
+
+func CancelPaymentRequestHandler(db *gorm.DB) http.HandlerFunc {
+	return closePaymentRequest(db, models.PaymentRequestCancelled)
+}
@@ -0,0 +1,197 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDeclined is returned, wrapped in a *DeclineError, when the issuer
+	// or the processor refuses a charge. Retrying will not help.
+	ErrDeclined = errors.New("card declined")
+	// ErrTemporary is a failure worth retrying, such as the processor being
+	// briefly unavailable.
+	ErrTemporary = errors.New("temporary processor failure")
+	// ErrTimeout means the processor did not answer in time. The outcome of
+	// the call is unknown.
+	ErrTimeout = errors.New("card processor timed out")
+	// ErrUnknownAuthorization is returned for references the processor has
+	// no authorization for.
+	ErrUnknownAuthorization = errors.New("unknown authorization")
+	// ErrInvalidState is returned when an authorization cannot take the
+	// requested step, such as capturing one that was voided.
+	ErrInvalidState = errors.New("authorization is not in a state that allows this")
+)
+
+// DeclineError says why a charge was declined. Code is stable and meant for
+// programs; Message is meant for people.
+type DeclineError struct {
+	Code    string
+	Message string
+}
+
+func (e *DeclineError) Error() string { return "card declined: " + e.Message }
+func (e *DeclineError) Unwrap() error { return ErrDeclined }
+
+// Card is what the processor needs to know about the card being charged.
+// CVV may be empty for cards on file.
+type Card struct {
+	Number      string
+	ExpiryMonth string
+	ExpiryYear  string
+	CVV         string
+	HolderName  string
+}
+
+// AuthorizeRequest reserves Amount on a card. Reference is ours and unique
+// per charge; processors use it to make a repeated authorization return the
+// first one instead of reserving the money twice.
+type AuthorizeRequest struct {
+	Reference string
+	Amount    int64
+	Currency  string
+	Card      Card
+}
+
+// Authorization is money reserved on a card. Reference is the processor's
+// and is what capture, void and refund take.
+type Authorization struct {
+	Reference string
+	Amount    int64
+	Currency  string
+}
+
+// CardProcessor charges cards in two steps: Authorize reserves the money
+// and Capture takes it. Void releases an authorization that will not be
+// captured and Refund returns captured money.
+type CardProcessor interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error)
+	Capture(ctx context.Context, reference string, amount int64) error
+	Void(ctx context.Context, reference string) error
+	Refund(ctx context.Context, reference string, amount int64) error
+}
+
+// Retrying gives every call to a processor a deadline and retries
+// temporary failures with a doubling backoff. Declines and timeouts are
+// returned straight away.
+type Retrying struct {
+	Processor CardProcessor
+	Timeout   time.Duration
+	Attempts  int
+	Backoff   time.Duration
+}
+
+func (r *Retrying) Name() string { return r.Processor.Name() }
+
+func (r *Retrying) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	var auth *Authorization
+	err := r.do(ctx, func(ctx context.Context) (err error) {
+		auth, err = r.Processor.Authorize(ctx, req)
+		return err
+	})
+	return auth, err
+}
+
+func (r *Retrying) Capture(ctx context.Context, reference string, amount int64) error {
+	return r.do(ctx, func(ctx context.Context) error { return r.Processor.Capture(ctx, reference, amount) })
+}
+
+func (r *Retrying) Void(ctx context.Context, reference string) error {
+	return r.do(ctx, func(ctx context.Context) error { return r.Processor.Void(ctx, reference) })
+}
+
+func (r *Retrying) Refund(ctx context.Context, reference string, amount int64) error {
+	return r.do(ctx, func(ctx context.Context) error { return r.Processor.Refund(ctx, reference, amount) })
+}
+
+func (r *Retrying) do(ctx context.Context, call func(context.Context) error) error {
+	backoff := r.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, r.Timeout)
+		err = call(callCtx)
+		timedOut := callCtx.Err() == context.DeadlineExceeded
+		cancel()
+		if timedOut && (err == nil || errors.Is(err, context.DeadlineExceeded)) {
+			err = ErrTimeout
+		}
+		if err == nil || !errors.Is(err, ErrTemporary) || attempt >= r.Attempts {
+			return err
+		}
+
+		log.Printf("Card processor %s failed (attempt %d of %d), retrying in %s: %v",
+			r.Processor.Name(), attempt, r.Attempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// NewProcessorFromEnv builds the processor named by CARD_PROCESSOR. Only
+// the simulated processor is built in. PROCESSOR_TIMEOUT (seconds, default
+// 10) bounds each call and PROCESSOR_ATTEMPTS (default 3) is how often a
+// temporary failure is tried.
+func NewProcessorFromEnv() (CardProcessor, error) {
+	var p CardProcessor
+	switch name := os.Getenv("CARD_PROCESSOR"); name {
+	case "", "simulated":
+		p = NewSimulated()
+	default:
+		return nil, fmt.Errorf("unknown CARD_PROCESSOR %q", name)
+	}
+
+	retrying := &Retrying{Processor: p, Timeout: 10 * time.Second, Attempts: 3, Backoff: 200 * time.Millisecond}
+	if raw := os.Getenv("PROCESSOR_TIMEOUT"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid PROCESSOR_TIMEOUT %q", raw)
+		}
+		retrying.Timeout = time.Duration(seconds) * time.Second
+	}
+	if raw := os.Getenv("PROCESSOR_ATTEMPTS"); raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts <= 0 {
+			return nil, fmt.Errorf("invalid PROCESSOR_ATTEMPTS %q", raw)
+		}
+		retrying.Attempts = attempts
+	}
+	return retrying, nil
+}
+
+var (
+	processorOnce    sync.Once
+	defaultProcessor CardProcessor
+)
+
+// Default returns the processor card top-ups are charged through.
+func Default() CardProcessor {
+	processorOnce.Do(func() {
+		if defaultProcessor != nil {
+			return
+		}
+		p, err := NewProcessorFromEnv()
+		if err != nil {
+			log.Printf("Warning: %v, falling back to the simulated card processor", err)
+			p = &Retrying{Processor: NewSimulated(), Timeout: 10 * time.Second, Attempts: 3, Backoff: 200 * time.Millisecond}
+		}
+		defaultProcessor = p
+	})
+	return defaultProcessor
+}
+
+// SetDefault replaces the processor used for card top-ups. It must be
+// called before the server starts handling requests.
+func SetDefault(p CardProcessor) {
+	processorOnce.Do(func() {})
+	defaultProcessor = p
+}
@@ -0,0 +1,176 @@
+package processor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Test card numbers the simulated processor treats specially. Every other
+// card is approved.
+const (
+	CardDeclined          = "4000000000000002"
+	CardInsufficientFunds = "4000000000009995"
+	CardExpired           = "4000000000000069"
+	CardRetry             = "4000000000000119"
+	CardTimeout           = "4000000000000259"
+	CardCaptureDeclined   = "4000000000000341"
+)
+
+var nonDigits = regexp.MustCompile(`\D`)
+
+type authorizationState string
+
+const (
+	stateAuthorized authorizationState = "authorized"
+	stateCaptured   authorizationState = "captured"
+	stateVoided     authorizationState = "voided"
+)
+
+type simulatedAuthorization struct {
+	Authorization
+	card     string
+	state    authorizationState
+	captured int64
+	refunded int64
+}
+
+// Simulated is an in-memory processor for development and testing. It
+// approves every card except the test numbers above: those decline, time
+// out, fail once before succeeding, or authorize but refuse the capture.
+type Simulated struct {
+	// Hang is how long a timing-out card blocks when the caller set no
+	// deadline.
+	Hang time.Duration
+
+	mu             sync.Mutex
+	authorizations map[string]*simulatedAuthorization
+	byRequest      map[string]string
+	attempts       map[string]int
+}
+
+func NewSimulated() *Simulated {
+	return &Simulated{
+		Hang:           time.Minute,
+		authorizations: map[string]*simulatedAuthorization{},
+		byRequest:      map[string]string{},
+		attempts:       map[string]int{},
+	}
+}
+
+func (s *Simulated) Name() string { return "simulated" }
+
+func (s *Simulated) Authorize(ctx context.Context, req AuthorizeRequest) (*Authorization, error) {
+	number := nonDigits.ReplaceAllString(req.Card.Number, "")
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be greater than 0")
+	}
+
+	switch number {
+	case CardDeclined:
+		return nil, &DeclineError{Code: "card_declined", Message: "the card was declined"}
+	case CardInsufficientFunds:
+		return nil, &DeclineError{Code: "insufficient_funds", Message: "the card has insufficient funds"}
+	case CardExpired:
+		return nil, &DeclineError{Code: "expired_card", Message: "the card has expired"}
+	case CardTimeout:
+		select {
+		case <-ctx.Done():
+			return nil, ErrTimeout
+		case <-time.After(s.Hang):
+			return nil, ErrTimeout
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if number == CardRetry {
+		s.attempts[req.Reference]++
+		if s.attempts[req.Reference] == 1 {
+			return nil, fmt.Errorf("%w: issuer unavailable", ErrTemporary)
+		}
+	}
+
+	if reference, ok := s.byRequest[req.Reference]; ok {
+		auth := s.authorizations[reference].Authorization
+		return &auth, nil
+	}
+
+	auth := &simulatedAuthorization{
+		Authorization: Authorization{Reference: newReference(), Amount: req.Amount, Currency: req.Currency},
+		card:          number,
+		state:         stateAuthorized,
+	}
+	s.authorizations[auth.Reference] = auth
+	s.byRequest[req.Reference] = auth.Reference
+	result := auth.Authorization
+	return &result, nil
+}
+
+func (s *Simulated) Capture(ctx context.Context, reference string, amount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.authorizations[reference]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if auth.state == stateCaptured && auth.captured == amount {
+		return nil
+	}
+	if auth.state != stateAuthorized || amount <= 0 || amount > auth.Amount {
+		return ErrInvalidState
+	}
+	if auth.card == CardCaptureDeclined {
+		return &DeclineError{Code: "capture_declined", Message: "the issuer refused the capture"}
+	}
+	auth.state = stateCaptured
+	auth.captured = amount
+	return nil
+}
+
+func (s *Simulated) Void(ctx context.Context, reference string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.authorizations[reference]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	switch auth.state {
+	case stateVoided:
+		return nil
+	case stateCaptured:
+		return ErrInvalidState
+	}
+	auth.state = stateVoided
+	return nil
+}
+
+func (s *Simulated) Refund(ctx context.Context, reference string, amount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.authorizations[reference]
+	if !ok {
+		return ErrUnknownAuthorization
+	}
+	if auth.state != stateCaptured || amount <= 0 || auth.refunded+amount > auth.captured {
+		return ErrInvalidState
+	}
+	auth.refunded += amount
+	return nil
+}
+
+func newReference() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic("processor: failed to read random bytes: " + err.Error())
+	}
+	return "sim_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,250 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/models"
+)
+
+// Event describes a money movement about to happen. Value is Amount in the
+// engine currency so rule thresholds can be compared across wallets; the
+// engine fills it in before any rule runs. Valued is false when no exchange
+// rate was available for Currency; rules with amount thresholds then stay
+// quiet rather than compare against a meaningless zero.
+type Event struct {
+	Action         models.RiskAction
+	UserID         uint
+	CounterpartyID *uint
+	CardID         *uint
+	TransactionID  uint
+	Amount         int64
+	Currency       string
+	At             time.Time
+
+	Value         int64
+	ValueCurrency string
+	Valued        bool
+}
+
+// EventFor builds the event for a pending transaction: card top-ups are
+// screened as such and everything else as a transfer to the receiver.
+func EventFor(txn *models.Transaction) *Event {
+	event := &Event{
+		Action:        models.RiskActionTransfer,
+		UserID:        txn.SenderID,
+		TransactionID: txn.ID,
+		Amount:        txn.Amount,
+		Currency:      txn.Currency,
+		At:            txn.Timestamp,
+	}
+	if txn.Type == models.TransactionSelf && txn.PaymentMethod == models.PaymentMethodCard {
+		event.Action = models.RiskActionCardTopUp
+		event.CardID = txn.CardID
+	} else {
+		receiverID := txn.ReceiverID
+		event.CounterpartyID = &receiverID
+	}
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	return event
+}
+
+// Hit is a rule that fired and the decision it asks for.
+type Hit struct {
+	Rule     string
+	Decision models.RiskDecision
+	Reason   string
+}
+
+// Rule inspects an event and returns a hit when it fires, or nil.
+type Rule interface {
+	Name() string
+	Evaluate(tx *gorm.DB, event *Event) (*Hit, error)
+}
+
+var severity = map[models.RiskDecision]int{
+	models.RiskDecisionAllow: 0,
+	models.RiskDecisionHold:  1,
+	models.RiskDecisionBlock: 2,
+}
+
+func IsValidDecision(decision models.RiskDecision) bool {
+	_, ok := severity[decision]
+	return ok
+}
+
+// Engine runs every rule against an event. The strictest decision among the
+// rules that fired wins, and nothing firing means allow.
+type Engine struct {
+	currency string
+	rules    []Rule
+}
+
+func NewEngine(currencyCode string, rules ...Rule) *Engine {
+	return &Engine{currency: currencyCode, rules: rules}
+}
+
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+func (e *Engine) Evaluate(tx *gorm.DB, event *Event) (models.RiskDecision, []Hit, error) {
+	value, err := valueIn(event.Amount, event.Currency, e.currency)
+	if err != nil {
+		log.Printf("Risk: skipping amount thresholds for user %d: %v", event.UserID, err)
+	}
+	event.Value = value
+	event.ValueCurrency = e.currency
+	event.Valued = err == nil
+
+	decision := models.RiskDecisionAllow
+	var hits []Hit
+	for _, rule := range e.rules {
+		hit, err := rule.Evaluate(tx, event)
+		if err != nil {
+			return "", nil, fmt.Errorf("risk rule %s: %w", rule.Name(), err)
+		}
+		if hit == nil {
+			continue
+		}
+		hits = append(hits, *hit)
+		if severity[hit.Decision] > severity[decision] {
+			decision = hit.Decision
+		}
+	}
+	return decision, hits, nil
+}
+
+// Assess evaluates an event and records the decision together with the
+// rules that fired. Holds are queued for review.
+func (e *Engine) Assess(tx *gorm.DB, event *Event) (*models.RiskAssessment, error) {
+	decision, hits, err := e.Evaluate(tx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	assessment := models.RiskAssessment{
+		Action:         event.Action,
+		UserID:         event.UserID,
+		TransactionID:  event.TransactionID,
+		CounterpartyID: event.CounterpartyID,
+		CardID:         event.CardID,
+		Amount:         event.Amount,
+		Currency:       event.Currency,
+		Decision:       decision,
+	}
+	if decision == models.RiskDecisionHold {
+		assessment.ReviewStatus = models.RiskReviewPending
+	}
+	for _, hit := range hits {
+		assessment.Hits = append(assessment.Hits, models.RiskRuleHit{
+			Rule:     hit.Rule,
+			Decision: hit.Decision,
+			Reason:   hit.Reason,
+		})
+	}
+
+	if err := tx.Omit("Transaction").Create(&assessment).Error; err != nil {
+		return nil, fmt.Errorf("failed to record risk assessment for transaction %d: %w", event.TransactionID, err)
+	}
+	return &assessment, nil
+}
+
+// Config holds the tunable built-in rules. Amount thresholds are in minor
+// units of Currency.
+type Config struct {
+	Currency      string            `json:"currency"`
+	NewRecipient  NewRecipientRule  `json:"new_recipient_large_amount"`
+	TransferBurst TransferBurstRule `json:"transfer_burst"`
+	NewCard       NewCardRule       `json:"new_card_immediate_use"`
+	TopUpThenSend TopUpThenSendRule `json:"top_up_then_send"`
+}
+
+var defaultConfig = Config{
+	Currency:      currency.Default,
+	NewRecipient:  NewRecipientRule{Enabled: true, Decision: models.RiskDecisionHold, MinAmount: 50000},
+	TransferBurst: TransferBurstRule{Enabled: true, Decision: models.RiskDecisionHold, MaxCount: 5, WindowSeconds: 600},
+	NewCard:       NewCardRule{Enabled: true, Decision: models.RiskDecisionHold, MaxAgeSeconds: 900, MinAmount: 20000},
+	TopUpThenSend: TopUpThenSendRule{Enabled: true, Decision: models.RiskDecisionHold, WindowSeconds: 3600, MinPercent: 80},
+}
+
+// Engine builds an engine from the enabled rules.
+func (c *Config) Engine() *Engine {
+	var rules []Rule
+	if c.NewRecipient.Enabled {
+		rules = append(rules, c.NewRecipient)
+	}
+	if c.TransferBurst.Enabled {
+		rules = append(rules, c.TransferBurst)
+	}
+	if c.NewCard.Enabled {
+		rules = append(rules, c.NewCard)
+	}
+	if c.TopUpThenSend.Enabled {
+		rules = append(rules, c.TopUpThenSend)
+	}
+	return NewEngine(c.Currency, rules...)
+}
+
+// loadConfig reads rule overrides on top of the defaults, so a file only
+// needs to name the settings it changes.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read risk rules file: %w", err)
+	}
+	config := defaultConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse risk rules file: %w", err)
+	}
+	if config.Currency, err = currency.Normalize(config.Currency); err != nil {
+		return nil, fmt.Errorf("invalid risk rules file: %w", err)
+	}
+	for _, decision := range []models.RiskDecision{
+		config.NewRecipient.Decision, config.TransferBurst.Decision,
+		config.NewCard.Decision, config.TopUpThenSend.Decision,
+	} {
+		if !IsValidDecision(decision) {
+			return nil, fmt.Errorf("invalid risk rules file: unknown decision %q", decision)
+		}
+	}
+	return &config, nil
+}
+
+var (
+	configOnce    sync.Once
+	currentConfig *Config
+	engine        *Engine
+)
+
+// DefaultConfig loads the rules from the JSON file named by RISK_RULES_FILE,
+// falling back to the built-in rules when it is unset or invalid.
+func DefaultConfig() *Config {
+	configOnce.Do(func() {
+		currentConfig = &defaultConfig
+		if path := os.Getenv("RISK_RULES_FILE"); path != "" {
+			config, err := loadConfig(path)
+			if err != nil {
+				log.Printf("Warning: %v, falling back to built-in risk rules", err)
+			} else {
+				currentConfig = config
+			}
+		}
+		engine = currentConfig.Engine()
+	})
+	return currentConfig
+}
+
+func DefaultEngine() *Engine {
+	DefaultConfig()
+	return engine
+}
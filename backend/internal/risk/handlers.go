@@ -0,0 +1,254 @@
+package risk
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"paytm/internal/models"
+)
+
+type HitResponse struct {
+	Rule     string `json:"rule"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+}
+
+type AssessmentResponse struct {
+	ID             uint          `json:"id"`
+	Action         string        `json:"action"`
+	UserID         uint          `json:"user_id"`
+	TransactionID  uint          `json:"transaction_id"`
+	CounterpartyID *uint         `json:"counterparty_id,omitempty"`
+	CardID         *uint         `json:"card_id,omitempty"`
+	Amount         int64         `json:"amount"`
+	Currency       string        `json:"currency"`
+	Decision       string        `json:"decision"`
+	ReviewStatus   string        `json:"review_status,omitempty"`
+	ReviewedByID   *uint         `json:"reviewed_by_id,omitempty"`
+	ReviewedAt     *time.Time    `json:"reviewed_at,omitempty"`
+	ReviewNote     string        `json:"review_note,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	Hits           []HitResponse `json:"hits"`
+}
+
+type AssessmentListResponse struct {
+	Assessments []AssessmentResponse `json:"assessments"`
+	NextBefore  uint                 `json:"next_before,omitempty"`
+	HasMore     bool                 `json:"has_more"`
+}
+
+type RuleStats struct {
+	Rule     string `json:"rule"`
+	Enabled  bool   `json:"enabled"`
+	Fired    int64  `json:"fired"`
+	Approved int64  `json:"approved"`
+	Rejected int64  `json:"rejected"`
+	Pending  int64  `json:"pending"`
+}
+
+type RulesResponse struct {
+	Config *Config     `json:"config"`
+	Since  time.Time   `json:"since"`
+	Stats  []RuleStats `json:"stats"`
+}
+
+func NewAssessmentResponse(assessment models.RiskAssessment) AssessmentResponse {
+	response := AssessmentResponse{
+		ID:             assessment.ID,
+		Action:         string(assessment.Action),
+		UserID:         assessment.UserID,
+		TransactionID:  assessment.TransactionID,
+		CounterpartyID: assessment.CounterpartyID,
+		CardID:         assessment.CardID,
+		Amount:         assessment.Amount,
+		Currency:       assessment.Currency,
+		Decision:       string(assessment.Decision),
+		ReviewStatus:   string(assessment.ReviewStatus),
+		ReviewedByID:   assessment.ReviewedByID,
+		ReviewedAt:     assessment.ReviewedAt,
+		ReviewNote:     assessment.ReviewNote,
+		CreatedAt:      assessment.CreatedAt,
+		Hits:           []HitResponse{},
+	}
+	for _, hit := range assessment.Hits {
+		response.Hits = append(response.Hits, HitResponse{
+			Rule:     hit.Rule,
+			Decision: string(hit.Decision),
+			Reason:   hit.Reason,
+		})
+	}
+	return response
+}
+
+// ListAssessmentsHandler pages through assessments newest first. Filters are
+// decision, review_status, rule and user_id; pass next_before as before to
+// get the following page. The review queue is review_status=pending.
+func ListAssessmentsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit := 50
+		if raw := query.Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 200 {
+				http.Error(w, "Limit must be between 1 and 200", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		dbQuery := db.Model(&models.RiskAssessment{}).Preload("Hits")
+		if decision := query.Get("decision"); decision != "" {
+			if !IsValidDecision(models.RiskDecision(decision)) {
+				http.Error(w, "Invalid decision", http.StatusBadRequest)
+				return
+			}
+			dbQuery = dbQuery.Where("decision = ?", decision)
+		}
+		if status := query.Get("review_status"); status != "" {
+			dbQuery = dbQuery.Where("review_status = ?", status)
+		}
+		if rule := query.Get("rule"); rule != "" {
+			dbQuery = dbQuery.Where("id IN (?)", db.Model(&models.RiskRuleHit{}).Select("assessment_id").Where("rule = ?", rule))
+		}
+		if raw := query.Get("user_id"); raw != "" {
+			userID, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid user ID", http.StatusBadRequest)
+				return
+			}
+			dbQuery = dbQuery.Where("user_id = ?", uint(userID))
+		}
+		if raw := query.Get("before"); raw != "" {
+			before, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+			dbQuery = dbQuery.Where("id < ?", uint(before))
+		}
+
+		var assessments []models.RiskAssessment
+		if err := dbQuery.Order("id DESC").Limit(limit + 1).Find(&assessments).Error; err != nil {
+			log.Printf("Error listing risk assessments: %v", err)
+			http.Error(w, "Error fetching assessments", http.StatusInternalServerError)
+			return
+		}
+
+		response := AssessmentListResponse{Assessments: []AssessmentResponse{}}
+		if len(assessments) > limit {
+			assessments = assessments[:limit]
+			response.HasMore = true
+			response.NextBefore = assessments[limit-1].ID
+		}
+		for _, assessment := range assessments {
+			response.Assessments = append(response.Assessments, NewAssessmentResponse(assessment))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func GetAssessmentHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assessmentID, err := strconv.ParseUint(chi.URLParam(r, "assessmentID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid assessment ID", http.StatusBadRequest)
+			return
+		}
+
+		var assessment models.RiskAssessment
+		if err := db.Preload("Hits").First(&assessment, uint(assessmentID)).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, "Assessment not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching assessment", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(NewAssessmentResponse(assessment))
+	}
+}
+
+// GetRulesHandler returns the active rule settings together with how often
+// each rule fired over the last days (30 by default) and how the reviews of
+// those hits came out, which is what tuning a threshold is judged on.
+func GetRulesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days := 30
+		if raw := r.URL.Query().Get("days"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 365 {
+				http.Error(w, "Days must be between 1 and 365", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+		since := time.Now().AddDate(0, 0, -days)
+
+		var rows []struct {
+			Rule         string
+			ReviewStatus string
+			Count        int64
+		}
+		if err := db.Table("risk_rule_hits").
+			Select("risk_rule_hits.rule, COALESCE(risk_assessments.review_status, '') AS review_status, COUNT(*) AS count").
+			Joins("JOIN risk_assessments ON risk_assessments.id = risk_rule_hits.assessment_id").
+			Where("risk_rule_hits.created_at >= ?", since).
+			Group("risk_rule_hits.rule, risk_assessments.review_status").
+			Scan(&rows).Error; err != nil {
+			log.Printf("Error counting risk rule hits: %v", err)
+			http.Error(w, "Error fetching rule statistics", http.StatusInternalServerError)
+			return
+		}
+
+		config := DefaultConfig()
+		enabled := map[string]bool{}
+		for _, rule := range DefaultEngine().Rules() {
+			enabled[rule.Name()] = true
+		}
+		stats := map[string]*RuleStats{}
+		var order []string
+		for _, name := range []string{
+			config.NewRecipient.Name(), config.TransferBurst.Name(),
+			config.NewCard.Name(), config.TopUpThenSend.Name(),
+		} {
+			stats[name] = &RuleStats{Rule: name, Enabled: enabled[name]}
+			order = append(order, name)
+		}
+		for _, row := range rows {
+			stat, ok := stats[row.Rule]
+			if !ok {
+				stat = &RuleStats{Rule: row.Rule}
+				stats[row.Rule] = stat
+				order = append(order, row.Rule)
+			}
+			stat.Fired += row.Count
+			switch models.RiskReviewStatus(row.ReviewStatus) {
+			case models.RiskReviewApproved:
+				stat.Approved += row.Count
+			case models.RiskReviewRejected:
+				stat.Rejected += row.Count
+			case models.RiskReviewPending:
+				stat.Pending += row.Count
+			}
+		}
+
+		response := RulesResponse{Config: config, Since: since}
+		for _, name := range order {
+			response.Stats = append(response.Stats, *stats[name])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
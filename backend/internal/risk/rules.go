@@ -0,0 +1,186 @@
+package risk
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/models"
+)
+
+// settledStatuses are the statuses of transfers that actually moved money.
+var settledStatuses = []models.TransactionStatus{
+	models.TransactionStatusCompleted,
+	models.TransactionStatusPartiallyRefunded,
+	models.TransactionStatusReversed,
+}
+
+// NewRecipientRule fires on a large first transfer to someone the user has
+// never paid before.
+type NewRecipientRule struct {
+	Enabled   bool                `json:"enabled"`
+	Decision  models.RiskDecision `json:"decision"`
+	MinAmount int64               `json:"min_amount"`
+}
+
+func (r NewRecipientRule) Name() string { return "new_recipient_large_amount" }
+
+func (r NewRecipientRule) Evaluate(tx *gorm.DB, event *Event) (*Hit, error) {
+	if event.Action != models.RiskActionTransfer || event.CounterpartyID == nil || !event.Valued || event.Value < r.MinAmount {
+		return nil, nil
+	}
+
+	var previous int64
+	if err := tx.Model(&models.Transaction{}).
+		Where("sender_id = ? AND receiver_id = ? AND type = ? AND status IN ? AND id <> ?",
+			event.UserID, *event.CounterpartyID, models.TransactionSent, settledStatuses, event.TransactionID).
+		Count(&previous).Error; err != nil {
+		return nil, fmt.Errorf("failed to count earlier transfers to user %d: %w", *event.CounterpartyID, err)
+	}
+	if previous > 0 {
+		return nil, nil
+	}
+
+	return &Hit{
+		Rule:     r.Name(),
+		Decision: r.Decision,
+		Reason: fmt.Sprintf("first transfer to user %d is %s, at or above %s",
+			*event.CounterpartyID, currency.FormatAmount(event.Amount, event.Currency),
+			currency.FormatAmount(r.MinAmount, event.ValueCurrency)),
+	}, nil
+}
+
+// TransferBurstRule fires when a user starts too many transfers in a short
+// window, which usually means a taken-over account being drained.
+type TransferBurstRule struct {
+	Enabled       bool                `json:"enabled"`
+	Decision      models.RiskDecision `json:"decision"`
+	MaxCount      int64               `json:"max_count"`
+	WindowSeconds int64               `json:"window_seconds"`
+}
+
+func (r TransferBurstRule) Name() string { return "transfer_burst" }
+
+func (r TransferBurstRule) Evaluate(tx *gorm.DB, event *Event) (*Hit, error) {
+	if event.Action != models.RiskActionTransfer || r.MaxCount <= 0 {
+		return nil, nil
+	}
+
+	window := time.Duration(r.WindowSeconds) * time.Second
+	var recent int64
+	if err := tx.Model(&models.Transaction{}).
+		Where("sender_id = ? AND type = ? AND status NOT IN ? AND timestamp >= ? AND id <> ?",
+			event.UserID, models.TransactionSent,
+			[]models.TransactionStatus{models.TransactionStatusFailed, models.TransactionStatusCancelled},
+			event.At.Add(-window), event.TransactionID).
+		Count(&recent).Error; err != nil {
+		return nil, fmt.Errorf("failed to count recent transfers of user %d: %w", event.UserID, err)
+	}
+	if recent < r.MaxCount {
+		return nil, nil
+	}
+
+	return &Hit{
+		Rule:     r.Name(),
+		Decision: r.Decision,
+		Reason:   fmt.Sprintf("%d transfers already started in the last %s", recent, window),
+	}, nil
+}
+
+// NewCardRule fires when a card is used for a large top-up soon after it
+// was added.
+type NewCardRule struct {
+	Enabled       bool                `json:"enabled"`
+	Decision      models.RiskDecision `json:"decision"`
+	MaxAgeSeconds int64               `json:"max_age_seconds"`
+	MinAmount     int64               `json:"min_amount"`
+}
+
+func (r NewCardRule) Name() string { return "new_card_immediate_use" }
+
+func (r NewCardRule) Evaluate(tx *gorm.DB, event *Event) (*Hit, error) {
+	if event.Action != models.RiskActionCardTopUp || event.CardID == nil || !event.Valued || event.Value < r.MinAmount {
+		return nil, nil
+	}
+
+	var card models.Card
+	if err := tx.Unscoped().Select("id", "created_at").First(&card, *event.CardID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load card %d: %w", *event.CardID, err)
+	}
+	age := event.At.Sub(card.CreatedAt)
+	if age >= time.Duration(r.MaxAgeSeconds)*time.Second {
+		return nil, nil
+	}
+
+	return &Hit{
+		Rule:     r.Name(),
+		Decision: r.Decision,
+		Reason: fmt.Sprintf("card %d added %s ago is topping up %s",
+			card.ID, age.Round(time.Second), currency.FormatAmount(event.Amount, event.Currency)),
+	}, nil
+}
+
+// TopUpThenSendRule fires when money topped up from a card is sent straight
+// back out, the usual way stolen cards are cashed out.
+type TopUpThenSendRule struct {
+	Enabled       bool                `json:"enabled"`
+	Decision      models.RiskDecision `json:"decision"`
+	WindowSeconds int64               `json:"window_seconds"`
+	MinPercent    int64               `json:"min_percent"`
+}
+
+func (r TopUpThenSendRule) Name() string { return "top_up_then_send" }
+
+func (r TopUpThenSendRule) Evaluate(tx *gorm.DB, event *Event) (*Hit, error) {
+	if event.Action != models.RiskActionTransfer || !event.Valued {
+		return nil, nil
+	}
+
+	window := time.Duration(r.WindowSeconds) * time.Second
+	var totals []struct {
+		Currency string
+		Total    int64
+	}
+	if err := tx.Model(&models.Transaction{}).
+		Select("currency, COALESCE(SUM(amount), 0) AS total").
+		Where("receiver_id = ? AND type = ? AND payment_method = ? AND status IN ? AND timestamp >= ?",
+			event.UserID, models.TransactionSelf, models.PaymentMethodCard, settledStatuses, event.At.Add(-window)).
+		Group("currency").
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum recent top-ups of user %d: %w", event.UserID, err)
+	}
+
+	var toppedUp int64
+	for _, total := range totals {
+		value, err := valueIn(total.Total, total.Currency, event.ValueCurrency)
+		if err != nil {
+			// A top-up in a currency that can no longer be valued cannot
+			// be compared; the ones that can still count.
+			log.Printf("Risk: leaving %s top-ups of user %d out: %v", total.Currency, event.UserID, err)
+			continue
+		}
+		toppedUp += value
+	}
+	if toppedUp == 0 || event.Value*100 < toppedUp*r.MinPercent {
+		return nil, nil
+	}
+
+	return &Hit{
+		Rule:     r.Name(),
+		Decision: r.Decision,
+		Reason: fmt.Sprintf("sending %s within %s of topping up %s by card",
+			currency.FormatAmount(event.Amount, event.Currency), window,
+			currency.FormatAmount(toppedUp, event.ValueCurrency)),
+	}, nil
+}
+
+func valueIn(amount int64, from, to string) (int64, error) {
+	conversion, err := currency.Convert(currency.DefaultProvider(), amount, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to value %s in %s: %w", from, to, err)
+	}
+	return conversion.Converted, nil
+}
@@ -8,19 +8,34 @@ import (
 	"github.com/go-chi/cors"
 	"gorm.io/gorm"
 
+	"paytm/internal/analytics"
 	"paytm/internal/auth"
+	"paytm/internal/budget"
 	"paytm/internal/card"
+	"paytm/internal/category"
+	"paytm/internal/expense"
+	"paytm/internal/export"
+	"paytm/internal/idempotency"
+	"paytm/internal/ledger"
+	"paytm/internal/limits"
 	customMiddleware "paytm/internal/middleware"
+	"paytm/internal/notification"
+	"paytm/internal/paymentrequest"
+	"paytm/internal/risk"
+	"paytm/internal/scheduler"
+	"paytm/internal/statement"
+	"paytm/internal/stream"
 	"paytm/internal/transaction"
 	"paytm/internal/user"
+	"paytm/internal/webhook"
 )
 
-func RegisterEnhancedRoutes(r chi.Router, db *gorm.DB) error {
+func RegisterEnhancedRoutes(r chi.Router, db *gorm.DB, broker stream.Broker) error {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:5173", "https://dinero.shubbu.dev"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Cookie"},
-		ExposedHeaders:   []string{"Link", "Set-Cookie"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Cookie", idempotency.HeaderKey},
+		ExposedHeaders:   []string{"Link", "Set-Cookie", "Retry-After", idempotency.HeaderReplayed},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -51,6 +66,7 @@ func RegisterEnhancedRoutes(r chi.Router, db *gorm.DB) error {
 		r.Use(customMiddleware.JWTAuthMiddleware(db))
 
 		r.Get("/me", user.GetUserProfileHandler)
+		r.Get("/stream", stream.StreamHandler(db, broker))
 
 		r.Route("/user", func(r chi.Router) {
 			r.Get("/balance", transaction.GetBalanceHandler(db))
@@ -66,17 +82,113 @@ func RegisterEnhancedRoutes(r chi.Router, db *gorm.DB) error {
 			r.Delete("/{friendID}", user.RemoveFriendHandler(db))
 		})
 		r.Route("/transactions", func(r chi.Router) {
-			r.Post("/send", transaction.SendMoneyHandler(db))
+			r.With(idempotency.Middleware(db)).Post("/send", transaction.SendMoneyHandler(db))
 			r.Get("/history", transaction.GetTransactionHistoryHandler(db))
+			r.Get("/export", export.ExportTransactionsHandler(db))
+			r.Get("/{transactionID}", transaction.GetTransactionHandler(db))
+			r.With(idempotency.Middleware(db)).Post("/{transactionID}/refund", transaction.RefundTransactionHandler(db))
+			r.Get("/{transactionID}/annotation", category.GetAnnotationHandler(db))
+			r.Put("/{transactionID}/annotation", category.UpdateAnnotationHandler(db))
+		})
+		r.Route("/groups", func(r chi.Router) {
+			r.Get("/", expense.GetGroupsHandler(db))
+			r.Post("/", expense.CreateGroupHandler(db))
+			r.Get("/{groupID}", expense.GetGroupHandler(db))
+			r.Post("/{groupID}/members", expense.AddMemberHandler(db))
+			r.Post("/{groupID}/expenses", expense.CreateExpenseHandler(db))
+			r.Get("/{groupID}/settlement", expense.GetSettlementPlanHandler(db))
+			r.With(idempotency.Middleware(db)).Post("/{groupID}/settle", expense.SettleUpHandler(db))
+		})
+		r.Route("/requests", func(r chi.Router) {
+			r.Post("/", paymentrequest.CreatePaymentRequestHandler(db))
+			r.Get("/incoming", paymentrequest.GetIncomingRequestsHandler(db))
+			r.Get("/outgoing", paymentrequest.GetOutgoingRequestsHandler(db))
+			r.With(idempotency.Middleware(db)).Post("/{requestID}/accept", paymentrequest.AcceptPaymentRequestHandler(db))
+			r.Post("/{requestID}/decline", paymentrequest.DeclinePaymentRequestHandler(db))
+			r.Post("/{requestID}/cancel", paymentrequest.CancelPaymentRequestHandler(db))
+		})
+		r.Route("/schedules", func(r chi.Router) {
+			r.Get("/", scheduler.GetSchedulesHandler(db))
+			r.Post("/", scheduler.CreateScheduleHandler(db))
+			r.Get("/{scheduleID}", scheduler.GetScheduleHandler(db))
+			r.Put("/{scheduleID}", scheduler.UpdateScheduleHandler(db))
+			r.Post("/{scheduleID}/pause", scheduler.PauseScheduleHandler(db))
+			r.Post("/{scheduleID}/resume", scheduler.ResumeScheduleHandler(db))
+			r.Delete("/{scheduleID}", scheduler.CancelScheduleHandler(db))
 		})
 		r.Route("/wallet", func(r chi.Router) {
 			r.Get("/balance", transaction.GetBalanceHandler(db))
-			r.Post("/balance", transaction.AddBalanceHandler(db))
+			r.With(idempotency.Middleware(db)).Post("/balance", transaction.AddBalanceHandler(db))
+			r.Get("/ledger", ledger.GetLedgerEntriesHandler(db))
+			r.Get("/reconcile", ledger.ReconcileHandler(db))
+			r.Get("/limits", limits.GetLimitsHandler(db))
 		})
 		r.Route("/cards", func(r chi.Router) {
 			r.Get("/", card.GetCardsHandler(db))
 			r.Post("/", card.AddCardHandler(db))
-			r.Post("/add-money", card.AddMoneyWithCardHandler(db))
+			r.With(idempotency.Middleware(db)).Post("/add-money", card.AddMoneyWithCardHandler(db))
+			r.Patch("/{cardID}", card.UpdateCardHandler(db))
+			r.Delete("/{cardID}", card.RemoveCardHandler(db))
+			r.Post("/{cardID}/default", card.SetDefaultCardHandler(db))
+			r.Post("/{cardID}/deactivate", card.DeactivateCardHandler(db))
+			r.Post("/{cardID}/activate", card.ActivateCardHandler(db))
+		})
+		r.Route("/analytics", func(r chi.Router) {
+			r.Get("/summary", analytics.GetSummaryHandler(db))
+			r.Get("/counterparties", analytics.GetCounterpartiesHandler(db))
+			r.Get("/fees", analytics.GetFeesHandler(db))
+			r.Get("/cards", analytics.GetCardsHandler(db))
+			r.Get("/categories", analytics.GetCategoriesHandler(db))
+		})
+		r.Route("/categories", func(r chi.Router) {
+			r.Get("/", category.GetCategoriesHandler(db))
+			r.Post("/", category.CreateCategoryHandler(db))
+			r.Put("/{categoryID}", category.UpdateCategoryHandler(db))
+			r.Delete("/{categoryID}", category.DeleteCategoryHandler(db))
+		})
+		r.Get("/tags", category.GetTagsHandler(db))
+		r.Route("/budgets", func(r chi.Router) {
+			r.Get("/", budget.GetBudgetsHandler(db))
+			r.Post("/", budget.CreateBudgetHandler(db))
+			r.Get("/{budgetID}/progress", budget.GetBudgetProgressHandler(db))
+			r.Put("/{budgetID}", budget.UpdateBudgetHandler(db))
+			r.Delete("/{budgetID}", budget.DeleteBudgetHandler(db))
+		})
+		r.Route("/statements", func(r chi.Router) {
+			r.Get("/", statement.GetStatementsHandler(db))
+			r.Post("/", statement.GenerateStatementHandler(db))
+			r.Get("/{statementID}", statement.DownloadStatementHandler(db))
+		})
+		r.Route("/notifications", func(r chi.Router) {
+			r.Get("/", notification.GetNotificationsHandler(db))
+			r.Get("/unread-count", notification.GetUnreadCountHandler(db))
+			r.Post("/read", notification.BulkMarkReadHandler(db))
+			r.Post("/dismiss", notification.BulkDismissHandler(db))
+			r.Post("/{notificationID}/read", notification.MarkReadHandler(db))
+			r.Delete("/{notificationID}", notification.DismissNotificationHandler(db))
+		})
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Get("/", webhook.GetEndpointsHandler(db))
+			r.Post("/", webhook.CreateEndpointHandler(db))
+			r.Get("/events", webhook.ListEventTypesHandler)
+			r.Get("/{endpointID}", webhook.GetEndpointHandler(db))
+			r.Put("/{endpointID}", webhook.UpdateEndpointHandler(db))
+			r.Delete("/{endpointID}", webhook.DeleteEndpointHandler(db))
+			r.Post("/{endpointID}/rotate-secret", webhook.RotateSecretHandler(db))
+			r.Get("/{endpointID}/deliveries", webhook.GetDeliveriesHandler(db))
+			r.Get("/{endpointID}/deliveries/{deliveryID}", webhook.GetDeliveryHandler(db))
+			r.Post("/{endpointID}/deliveries/{deliveryID}/redeliver", webhook.RedeliverHandler(db))
+		})
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(customMiddleware.RequireAdmin)
+
+			r.Route("/risk", func(r chi.Router) {
+				r.Get("/rules", risk.GetRulesHandler(db))
+				r.Get("/assessments", risk.ListAssessmentsHandler(db))
+				r.Get("/assessments/{assessmentID}", risk.GetAssessmentHandler(db))
+				r.Post("/assessments/{assessmentID}/approve", transaction.ApproveHeldTransactionHandler(db))
+				r.Post("/assessments/{assessmentID}/reject", transaction.RejectHeldTransactionHandler(db))
+			})
 		})
 	})
 
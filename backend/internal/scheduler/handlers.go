@@ -0,0 +1,459 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/transaction"
+)
+
+type CreateScheduleRequest struct {
+	ReceiverID  uint       `json:"receiver_id"`
+	Amount      int64      `json:"amount"`
+	Currency    string     `json:"currency,omitempty"`
+	Description string     `json:"description"`
+	Frequency   string     `json:"frequency"`
+	DayOfMonth  int        `json:"day_of_month,omitempty"`
+	Timezone    string     `json:"timezone,omitempty"`
+	StartAt     *time.Time `json:"start_at,omitempty"`
+	EndAt       *time.Time `json:"end_at,omitempty"`
+}
+
+type UpdateScheduleRequest struct {
+	Amount      *int64     `json:"amount,omitempty"`
+	Description *string    `json:"description,omitempty"`
+	Frequency   *string    `json:"frequency,omitempty"`
+	DayOfMonth  *int       `json:"day_of_month,omitempty"`
+	Timezone    *string    `json:"timezone,omitempty"`
+	StartAt     *time.Time `json:"start_at,omitempty"`
+	EndAt       *time.Time `json:"end_at,omitempty"`
+}
+
+type ScheduleRunResponse struct {
+	ID            uint      `json:"id"`
+	OccurrenceAt  time.Time `json:"occurrence_at"`
+	Attempt       int       `json:"attempt"`
+	Status        string    `json:"status"`
+	TransactionID *uint     `json:"transaction_id,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ScheduleResponse struct {
+	ID          uint                  `json:"id"`
+	ReceiverID  uint                  `json:"receiver_id"`
+	Amount      int64                 `json:"amount"`
+	Currency    string                `json:"currency"`
+	Description string                `json:"description"`
+	Frequency   string                `json:"frequency"`
+	DayOfMonth  int                   `json:"day_of_month,omitempty"`
+	Timezone    string                `json:"timezone"`
+	StartAt     time.Time             `json:"start_at"`
+	EndAt       *time.Time            `json:"end_at,omitempty"`
+	NextRunAt   *time.Time            `json:"next_run_at,omitempty"`
+	Status      string                `json:"status"`
+	RunCount    int                   `json:"run_count"`
+	RetryCount  int                   `json:"retry_count"`
+	LastRunAt   *time.Time            `json:"last_run_at,omitempty"`
+	LastError   string                `json:"last_error,omitempty"`
+	Runs        []ScheduleRunResponse `json:"runs,omitempty"`
+}
+
+func newScheduleResponse(s models.ScheduledTransfer) ScheduleResponse {
+	response := ScheduleResponse{
+		ID:          s.ID,
+		ReceiverID:  s.ReceiverID,
+		Amount:      s.Amount,
+		Currency:    s.Currency,
+		Description: s.Description,
+		Frequency:   string(s.Frequency),
+		DayOfMonth:  s.DayOfMonth,
+		Timezone:    s.Timezone,
+		StartAt:     s.StartAt,
+		EndAt:       s.EndAt,
+		Status:      string(s.Status),
+		RunCount:    s.RunCount,
+		RetryCount:  s.RetryCount,
+		LastRunAt:   s.LastRunAt,
+		LastError:   s.LastError,
+	}
+	if s.Status == models.ScheduleActive || s.Status == models.SchedulePaused {
+		nextRunAt := s.NextRunAt
+		response.NextRunAt = &nextRunAt
+	}
+	for _, run := range s.Runs {
+		response.Runs = append(response.Runs, ScheduleRunResponse{
+			ID:            run.ID,
+			OccurrenceAt:  run.OccurrenceAt,
+			Attempt:       run.Attempt,
+			Status:        string(run.Status),
+			TransactionID: run.TransactionID,
+			Error:         run.Error,
+			CreatedAt:     run.CreatedAt,
+		})
+	}
+	return response
+}
+
+func validateSchedule(s *models.ScheduledTransfer) error {
+	if s.Amount <= 0 {
+		return fmt.Errorf("amount must be greater than 0")
+	}
+
+	switch s.Frequency {
+	case models.ScheduleOnce, models.ScheduleDaily, models.ScheduleWeekly:
+	case models.ScheduleMonthly:
+		if s.DayOfMonth == 0 {
+			s.DayOfMonth = s.StartAt.In(location(s.Timezone)).Day()
+		}
+		if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+			return fmt.Errorf("day_of_month must be between 1 and 31")
+		}
+	default:
+		return fmt.Errorf("frequency must be one of once, daily, weekly or monthly")
+	}
+	if s.Frequency != models.ScheduleMonthly {
+		s.DayOfMonth = 0
+	}
+
+	if s.Timezone == "" {
+		s.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+
+	if s.EndAt != nil && !s.EndAt.After(s.StartAt) {
+		return fmt.Errorf("end_at must be after start_at")
+	}
+	return nil
+}
+
+// reschedule recomputes the next occurrence after the timing of a schedule
+// changed or it was resumed.
+func reschedule(s *models.ScheduledTransfer, now time.Time) {
+	s.RetryCount = 0
+	s.OccurrenceAt = upcomingOccurrence(s, now)
+	s.NextRunAt = s.OccurrenceAt
+	if s.EndAt != nil && s.OccurrenceAt.After(*s.EndAt) {
+		s.Status = models.ScheduleCompleted
+	}
+}
+
+func loadOwnSchedule(db *gorm.DB, r *http.Request, userID uint) (*models.ScheduledTransfer, int, string) {
+	scheduleID, err := strconv.ParseUint(chi.URLParam(r, "scheduleID"), 10, 32)
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid schedule ID"
+	}
+
+	var schedule models.ScheduledTransfer
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ?", uint(scheduleID), userID).First(&schedule).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, http.StatusNotFound, "Schedule not found"
+		}
+		return nil, http.StatusInternalServerError, "Error fetching schedule"
+	}
+	return &schedule, 0, ""
+}
+
+func CreateScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if req.ReceiverID == currentUser.ID {
+			http.Error(w, "Cannot schedule a transfer to yourself", http.StatusBadRequest)
+			return
+		}
+
+		var receiver models.User
+		if err := db.First(&receiver, req.ReceiverID).Error; err != nil {
+			http.Error(w, "Receiver not found", http.StatusNotFound)
+			return
+		}
+
+		code, err := transaction.TransferCurrency(req.Currency, currentUser.Currency)
+		if err != nil {
+			transaction.WriteTransferError(w, err)
+			return
+		}
+
+		now := time.Now()
+		startAt := now
+		if req.StartAt != nil {
+			startAt = *req.StartAt
+		}
+		if startAt.Before(now.Add(-time.Minute)) {
+			http.Error(w, "start_at must not be in the past", http.StatusBadRequest)
+			return
+		}
+
+		schedule := models.ScheduledTransfer{
+			UserID:      currentUser.ID,
+			ReceiverID:  receiver.ID,
+			Amount:      req.Amount,
+			Currency:    code,
+			Description: req.Description,
+			Frequency:   models.ScheduleFrequency(req.Frequency),
+			DayOfMonth:  req.DayOfMonth,
+			Timezone:    req.Timezone,
+			StartAt:     startAt,
+			EndAt:       req.EndAt,
+			Status:      models.ScheduleActive,
+		}
+		if err := validateSchedule(&schedule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reschedule(&schedule, now)
+
+		if err := db.Create(&schedule).Error; err != nil {
+			log.Printf("Error creating schedule for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating schedule", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("✅ Schedule %d created for user %d: %s, next run %s",
+			schedule.ID, currentUser.ID, schedule.Frequency, schedule.NextRunAt.Format(time.RFC3339))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newScheduleResponse(schedule))
+	}
+}
+
+func GetSchedulesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		query := db.Where("user_id = ?", currentUser.ID)
+		if status := r.URL.Query().Get("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var schedules []models.ScheduledTransfer
+		if err := query.Order("created_at DESC").Find(&schedules).Error; err != nil {
+			http.Error(w, "Error fetching schedules", http.StatusInternalServerError)
+			return
+		}
+
+		responses := []ScheduleResponse{}
+		for _, schedule := range schedules {
+			responses = append(responses, newScheduleResponse(schedule))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]ScheduleResponse{"schedules": responses})
+	}
+}
+
+func GetScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		scheduleID, err := strconv.ParseUint(chi.URLParam(r, "scheduleID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid schedule ID", http.StatusBadRequest)
+			return
+		}
+
+		var schedule models.ScheduledTransfer
+		if err := db.Preload("Runs", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC").Limit(50)
+		}).Where("id = ? AND user_id = ?", uint(scheduleID), currentUser.ID).
+			First(&schedule).Error; err != nil {
+			http.Error(w, "Schedule not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newScheduleResponse(schedule))
+	}
+}
+
+func UpdateScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		schedule, status, message := loadOwnSchedule(tx, r, currentUser.ID)
+		if schedule == nil {
+			tx.Rollback()
+			http.Error(w, message, status)
+			return
+		}
+
+		if schedule.Status != models.ScheduleActive && schedule.Status != models.SchedulePaused {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("Schedule is %s and can no longer be edited", schedule.Status), http.StatusConflict)
+			return
+		}
+
+		timingChanged := false
+		if req.Amount != nil {
+			schedule.Amount = *req.Amount
+		}
+		if req.Description != nil {
+			schedule.Description = *req.Description
+		}
+		if req.Frequency != nil {
+			schedule.Frequency = models.ScheduleFrequency(*req.Frequency)
+			timingChanged = true
+		}
+		if req.DayOfMonth != nil {
+			schedule.DayOfMonth = *req.DayOfMonth
+			timingChanged = true
+		}
+		if req.Timezone != nil {
+			schedule.Timezone = *req.Timezone
+			timingChanged = true
+		}
+		if req.StartAt != nil {
+			schedule.StartAt = *req.StartAt
+			timingChanged = true
+		}
+		if req.EndAt != nil {
+			schedule.EndAt = req.EndAt
+			timingChanged = true
+		}
+
+		if err := validateSchedule(schedule); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if timingChanged {
+			reschedule(schedule, time.Now())
+		}
+
+		if err := tx.Omit(clause.Associations).Save(schedule).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error updating schedule", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			http.Error(w, "Error updating schedule", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newScheduleResponse(*schedule))
+	}
+}
+
+// changeScheduleStatus moves a schedule between active, paused and cancelled.
+// Resuming skips occurrences that fell inside the pause.
+func changeScheduleStatus(db *gorm.DB, from []models.ScheduleStatus, to models.ScheduleStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		schedule, status, message := loadOwnSchedule(tx, r, currentUser.ID)
+		if schedule == nil {
+			tx.Rollback()
+			http.Error(w, message, status)
+			return
+		}
+
+		allowed := false
+		for _, s := range from {
+			if schedule.Status == s {
+				allowed = true
+			}
+		}
+		if !allowed {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("Schedule is %s and cannot become %s", schedule.Status, to), http.StatusConflict)
+			return
+		}
+
+		schedule.Status = to
+		if to == models.ScheduleActive {
+			reschedule(schedule, time.Now())
+		}
+
+		if err := tx.Omit(clause.Associations).Save(schedule).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error updating schedule", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			http.Error(w, "Error updating schedule", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("✅ Schedule %d is now %s", schedule.ID, schedule.Status)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newScheduleResponse(*schedule))
+	}
+}
+
+func PauseScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return changeScheduleStatus(db, []models.ScheduleStatus{models.ScheduleActive}, models.SchedulePaused)
+}
+
+func ResumeScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return changeScheduleStatus(db, []models.ScheduleStatus{models.SchedulePaused}, models.ScheduleActive)
+}
+
+func CancelScheduleHandler(db *gorm.DB) http.HandlerFunc {
+	return changeScheduleStatus(db,
+		[]models.ScheduleStatus{models.ScheduleActive, models.SchedulePaused}, models.ScheduleCancelled)
+}
@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/models"
+	"paytm/internal/transaction"
+)
+
+const batchSize = 100
+
+// retryBackoff is the retry policy for failed runs: one retry after each
+// delay, after which the occurrence is skipped (or a one-off schedule is
+// marked failed).
+var retryBackoff = []time.Duration{5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+type Scheduler struct {
+	db *gorm.DB
+}
+
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{db: db}
+}
+
+func location(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func daysIn(year int, month time.Month, loc *time.Location) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+}
+
+func monthlyOn(s *models.ScheduledTransfer, year int, month time.Month) time.Time {
+	loc := location(s.Timezone)
+	start := s.StartAt.In(loc)
+	normalized := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	day := s.DayOfMonth
+	if last := daysIn(normalized.Year(), normalized.Month(), loc); day > last {
+		day = last
+	}
+	return time.Date(normalized.Year(), normalized.Month(), day,
+		start.Hour(), start.Minute(), start.Second(), 0, loc)
+}
+
+func firstOccurrence(s *models.ScheduledTransfer) time.Time {
+	if s.Frequency != models.ScheduleMonthly {
+		return s.StartAt
+	}
+	start := s.StartAt.In(location(s.Timezone))
+	candidate := monthlyOn(s, start.Year(), start.Month())
+	if candidate.Before(s.StartAt) {
+		candidate = monthlyOn(s, start.Year(), start.Month()+1)
+	}
+	return candidate
+}
+
+// nextOccurrence works on wall-clock time in the schedule's time zone so a
+// 09:00 transfer stays at 09:00 across DST changes, and monthly schedules on
+// the 29th-31st fall on the last day of shorter months.
+func nextOccurrence(s *models.ScheduledTransfer, from time.Time) time.Time {
+	t := from.In(location(s.Timezone))
+	switch s.Frequency {
+	case models.ScheduleDaily:
+		return t.AddDate(0, 0, 1)
+	case models.ScheduleWeekly:
+		return t.AddDate(0, 0, 7)
+	case models.ScheduleMonthly:
+		return monthlyOn(s, t.Year(), t.Month()+1)
+	}
+	return time.Time{}
+}
+
+// upcomingOccurrence returns the first occurrence at or after now, skipping
+// any that were missed while the schedule was paused or the worker was down.
+func upcomingOccurrence(s *models.ScheduledTransfer, now time.Time) time.Time {
+	next := firstOccurrence(s)
+	if s.Frequency == models.ScheduleOnce {
+		return next
+	}
+	for next.Before(now) {
+		next = nextOccurrence(s, next)
+	}
+	return next
+}
+
+func advance(s *models.ScheduledTransfer, now time.Time) {
+	s.RetryCount = 0
+	if s.Frequency == models.ScheduleOnce {
+		s.Status = models.ScheduleCompleted
+		return
+	}
+
+	next := nextOccurrence(s, s.OccurrenceAt)
+	for !next.After(now) {
+		next = nextOccurrence(s, next)
+	}
+	if s.EndAt != nil && next.After(*s.EndAt) {
+		s.Status = models.ScheduleCompleted
+		return
+	}
+	s.OccurrenceAt = next
+	s.NextRunAt = next
+}
+
+func isRetryable(err error) bool {
+	switch {
+	case errors.Is(err, transaction.ErrInvalidAmount),
+		errors.Is(err, transaction.ErrSelfTransfer),
+		errors.Is(err, transaction.ErrSenderNotFound),
+		errors.Is(err, transaction.ErrReceiverNotFound),
+		errors.Is(err, transaction.ErrUnknownCurrency),
+		errors.Is(err, transaction.ErrBlockedByRisk):
+		return false
+	}
+	return true
+}
+
+func (s *Scheduler) RunDue(ctx context.Context) error {
+	var ids []uint
+	if err := s.db.WithContext(ctx).Model(&models.ScheduledTransfer{}).
+		Where("status = ? AND next_run_at <= ?", models.ScheduleActive, time.Now()).
+		Order("next_run_at").Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("failed to fetch due schedules: %w", err)
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.process(ctx, id); err != nil {
+			log.Printf("❌ Scheduled transfer %d failed to process: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) process(ctx context.Context, id uint) error {
+	now := time.Now()
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var schedule models.ScheduledTransfer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ? AND next_run_at <= ?", id, models.ScheduleActive, now).
+		First(&schedule).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+
+	run := models.ScheduledTransferRun{
+		ScheduledTransferID: schedule.ID,
+		OccurrenceAt:        schedule.OccurrenceAt,
+		Attempt:             schedule.RetryCount + 1,
+	}
+
+	description := fmt.Sprintf("Scheduled transfer #%d", schedule.ID)
+	if schedule.Description != "" {
+		description += ": " + schedule.Description
+	}
+
+	if err := tx.SavePoint("transfer").Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create savepoint for schedule %d: %w", schedule.ID, err)
+	}
+	result, err := transaction.Transfer(tx, schedule.UserID, schedule.ReceiverID, schedule.Amount, schedule.Currency, description)
+	if err == nil || errors.Is(err, transaction.ErrHeldForReview) {
+		// A held transfer is this occurrence's payment; the review decides
+		// whether it goes through, so the schedule moves on either way.
+		run.Status = models.ScheduleRunSucceeded
+		if err != nil {
+			run.Status = models.ScheduleRunHeld
+		}
+		run.TransactionID = &result.Transaction.ID
+		schedule.RunCount++
+		schedule.LastError = ""
+		advance(&schedule, now)
+		log.Printf("✅ Scheduled transfer %d ran (%s): transaction %d", schedule.ID, run.Status, result.Transaction.ID)
+	} else {
+		if errors.Is(err, transaction.ErrBlockedByRisk) {
+			// The declined transfer and its assessment stay on record.
+			run.TransactionID = &result.Transaction.ID
+		} else if rollbackErr := tx.RollbackTo("transfer").Error; rollbackErr != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to undo transfer of schedule %d: %w", schedule.ID, rollbackErr)
+		}
+		run.Status = models.ScheduleRunFailed
+		run.Error = err.Error()
+		schedule.LastError = err.Error()
+
+		switch {
+		case !isRetryable(err):
+			schedule.Status = models.ScheduleFailed
+		case schedule.RetryCount < len(retryBackoff):
+			run.Status = models.ScheduleRunRetrying
+			schedule.NextRunAt = now.Add(retryBackoff[schedule.RetryCount])
+			schedule.RetryCount++
+		case schedule.Frequency == models.ScheduleOnce:
+			schedule.Status = models.ScheduleFailed
+		default:
+			advance(&schedule, now)
+		}
+		log.Printf("⚠️ Scheduled transfer %d attempt %d failed (%s): %v",
+			schedule.ID, run.Attempt, run.Status, err)
+	}
+	schedule.LastRunAt = &now
+
+	if err := tx.Create(&run).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	if err := tx.Omit(clause.Associations).Save(&schedule).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update schedule: %w", err)
+	}
+	return tx.Commit().Error
+}
@@ -0,0 +1,60 @@
+package statement
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/ledger"
+	"paytm/internal/models"
+)
+
+// BatchResult counts what GenerateAll did.
+type BatchResult struct {
+	Generated int
+	Existing  int
+	Failed    int
+}
+
+// GenerateAll issues the month's statement for every wallet that existed
+// before the month ended. A wallet that fails is logged and skipped so one
+// bad account does not hold up everyone else's statements.
+func GenerateAll(db *gorm.DB, period string, regenerate bool) (*BatchResult, error) {
+	_, end, err := ParsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{}
+	var users []models.User
+	err = db.Order("id").FindInBatches(&users, 100, func(batch *gorm.DB, _ int) error {
+		for i := range users {
+			user := &users[i]
+			wallets, err := ledger.Wallets(db, user.ID)
+			if err != nil {
+				return err
+			}
+			for _, wallet := range wallets {
+				if !wallet.CreatedAt.Before(end) {
+					continue
+				}
+				_, created, err := Generate(db, user, wallet.Currency, period, regenerate)
+				switch {
+				case err != nil:
+					log.Printf("❌ Statement %s %s for user %d failed: %v", period, wallet.Currency, user.ID, err)
+					result.Failed++
+				case created:
+					result.Generated++
+				default:
+					result.Existing++
+				}
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to generate statements for %s: %w", period, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,199 @@
+package statement
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"paytm/internal/currency"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+type GenerateRequest struct {
+	Period   string `json:"period"`
+	Currency string `json:"currency"`
+}
+
+type StatementResponse struct {
+	ID             uint      `json:"id"`
+	Period         string    `json:"period"`
+	Currency       string    `json:"currency"`
+	PeriodStart    time.Time `json:"period_start"`
+	PeriodEnd      time.Time `json:"period_end"`
+	OpeningBalance int64     `json:"opening_balance"`
+	ClosingBalance int64     `json:"closing_balance"`
+	TotalIn        int64     `json:"total_in"`
+	TotalOut       int64     `json:"total_out"`
+	TotalFees      int64     `json:"total_fees"`
+	LineCount      int       `json:"line_count"`
+	Checksum       string    `json:"checksum"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+func newStatementResponse(s models.AccountStatement) StatementResponse {
+	return StatementResponse{
+		ID:             s.ID,
+		Period:         s.Period,
+		Currency:       s.Currency,
+		PeriodStart:    s.PeriodStart,
+		PeriodEnd:      s.PeriodEnd,
+		OpeningBalance: s.OpeningBalance,
+		ClosingBalance: s.ClosingBalance,
+		TotalIn:        s.TotalIn,
+		TotalOut:       s.TotalOut,
+		TotalFees:      s.TotalFees,
+		LineCount:      s.LineCount,
+		Checksum:       s.Checksum,
+		GeneratedAt:    s.GeneratedAt,
+	}
+}
+
+// summaryColumns leaves the rendered documents out of listings.
+var summaryColumns = []string{
+	"id", "created_at", "updated_at", "user_id", "currency", "period", "period_start", "period_end",
+	"opening_balance", "closing_balance", "total_in", "total_out", "total_fees", "line_count",
+	"checksum", "generated_at",
+}
+
+// GetStatementsHandler lists the user's statements, newest month first,
+// optionally for one currency.
+func GetStatementsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := db.Select(summaryColumns).Where("user_id = ?", currentUser.ID)
+		if raw := r.URL.Query().Get("currency"); raw != "" {
+			code, err := currency.Normalize(raw)
+			if err != nil {
+				http.Error(w, "currency must be an ISO 4217 code", http.StatusBadRequest)
+				return
+			}
+			query = query.Where("currency = ?", code)
+		}
+
+		var statements []models.AccountStatement
+		if err := query.Order("period DESC, currency").Find(&statements).Error; err != nil {
+			http.Error(w, "Error fetching statements", http.StatusInternalServerError)
+			return
+		}
+
+		response := []StatementResponse{}
+		for _, s := range statements {
+			response = append(response, newStatementResponse(s))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]StatementResponse{"statements": response})
+	}
+}
+
+// GenerateStatementHandler issues the statement of a finished month for
+// the user, returning the stored one if it was issued already.
+func GenerateStatementHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req GenerateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if _, _, err := ParsePeriod(req.Period); err != nil {
+			http.Error(w, "period must be a YYYY-MM month", http.StatusBadRequest)
+			return
+		}
+		code := currentUser.Currency
+		if req.Currency != "" {
+			normalized, err := currency.Normalize(req.Currency)
+			if err != nil {
+				http.Error(w, "currency must be an ISO 4217 code", http.StatusBadRequest)
+				return
+			}
+			code = normalized
+		}
+
+		stored, created, err := Generate(db, currentUser, code, req.Period, false)
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrPeriodOpen):
+				http.Error(w, "Statements are only available for months that have ended", http.StatusUnprocessableEntity)
+			case errors.Is(err, ErrNotReconciled):
+				log.Printf("Statement for user %d not issued: %v", currentUser.ID, err)
+				http.Error(w, "Statement could not be reconciled with the ledger", http.StatusConflict)
+			default:
+				log.Printf("Error generating statement for user %d: %v", currentUser.ID, err)
+				http.Error(w, "Error generating statement", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		}
+		json.NewEncoder(w).Encode(newStatementResponse(*stored))
+	}
+}
+
+// DownloadStatementHandler serves a stored statement as a PDF (the
+// default) or, with format=html, as an HTML page.
+func DownloadStatementHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		statementID, err := strconv.ParseUint(chi.URLParam(r, "statementID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid statement ID", http.StatusBadRequest)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "pdf"
+		}
+		if format != "pdf" && format != "html" {
+			http.Error(w, "format must be pdf or html", http.StatusBadRequest)
+			return
+		}
+
+		var stored models.AccountStatement
+		if err := db.Where("user_id = ?", currentUser.ID).First(&stored, uint(statementID)).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				http.Error(w, "Statement not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching statement", http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("dinero-statement-%s-%s.%s", stored.Currency, stored.Period, format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(stored.HTML))
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Length", strconv.Itoa(len(stored.PDF)))
+		w.Write(stored.PDF)
+	}
+}
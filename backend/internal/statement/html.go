@@ -0,0 +1,88 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+
+	"paytm/internal/currency"
+	"paytm/internal/export"
+)
+
+var htmlTemplate = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"money": func(amount int64, code string) string { return currency.FormatAmount(amount, code) },
+	"date":  func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"kind":  kindLabel,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Dinero statement {{.Period}} ({{.Currency}})</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 40px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+.meta { color: #555; font-size: 13px; margin-bottom: 24px; }
+table { border-collapse: collapse; width: 100%; font-size: 13px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+.num { text-align: right; font-variant-numeric: tabular-nums; }
+.summary { width: auto; margin-bottom: 24px; }
+.summary th { background: none; font-weight: normal; color: #555; }
+</style>
+</head>
+<body>
+<h1>Dinero Account Statement</h1>
+<div class="meta">
+{{.AccountName}} &middot; {{.Currency}} wallet &middot; {{date .From}} to {{date .To}} (exclusive, UTC)<br>
+Generated {{.GeneratedAt.UTC.Format "2006-01-02 15:04 MST"}}
+</div>
+<table class="summary">
+<tr><th>Opening balance</th><td class="num">{{money .OpeningBalance .Currency}}</td></tr>
+<tr><th>Money in</th><td class="num">{{money .TotalIn .Currency}}</td></tr>
+<tr><th>Money out</th><td class="num">{{money .TotalOut .Currency}}</td></tr>
+<tr><th>Fees</th><td class="num">{{money .TotalFees .Currency}}</td></tr>
+<tr><th>Closing balance</th><td class="num"><strong>{{money .ClosingBalance .Currency}}</strong></td></tr>
+</table>
+<table>
+<thead>
+<tr><th>Date</th><th>Transaction</th><th>Type</th><th>Description</th><th>Counterparty</th><th class="num">Amount</th><th class="num">Balance</th></tr>
+</thead>
+<tbody>
+<tr><td>{{date .From}}</td><td></td><td></td><td>Opening balance</td><td></td><td></td><td class="num">{{money .OpeningBalance .Currency}}</td></tr>
+{{- $currency := .Currency}}
+{{- range .Lines}}
+<tr><td>{{date .Date}}</td><td>{{.TransactionID}}</td><td>{{kind .Kind}}</td><td>{{.Description}}</td><td>{{.Counterparty}}</td><td class="num">{{money .Amount $currency}}</td><td class="num">{{money .Balance $currency}}</td></tr>
+{{- end}}
+<tr><td>{{date .To}}</td><td></td><td></td><td><strong>Closing balance</strong></td><td></td><td></td><td class="num"><strong>{{money .ClosingBalance .Currency}}</strong></td></tr>
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+func kindLabel(kind export.LineKind) string {
+	switch kind {
+	case export.LineTransferOut:
+		return "Sent"
+	case export.LineTransferIn:
+		return "Received"
+	case export.LineTopUp:
+		return "Top-up"
+	case export.LineRefundOut:
+		return "Refund sent"
+	case export.LineRefundIn:
+		return "Refund received"
+	case export.LineFee:
+		return "Fee"
+	}
+	return string(kind)
+}
+
+func RenderHTML(doc *Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, doc); err != nil {
+		return nil, fmt.Errorf("failed to render statement: %w", err)
+	}
+	return buf.Bytes(), nil
+}
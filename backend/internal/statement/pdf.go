@@ -0,0 +1,245 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"paytm/internal/currency"
+)
+
+// The PDF is written by hand: a handful of text-only A4 pages using the
+// standard Helvetica fonts, which every reader has built in, so no font
+// files or third-party libraries are needed.
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	marginLeft   = 40
+	marginRight  = pageWidth - 40
+	marginTop    = pageHeight - 50
+	marginBottom = 60
+	rowHeight    = 14
+	bodySize     = 9
+)
+
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// column describes where a table column sits; right-aligned columns are
+// anchored at X instead of starting there.
+type column struct {
+	Title    string
+	X        float64
+	MaxChars int
+	Right    bool
+}
+
+var pdfColumns = []column{
+	{Title: "Date", X: marginLeft, MaxChars: 10},
+	{Title: "Type", X: 100, MaxChars: 15},
+	{Title: "Description", X: 178, MaxChars: 32},
+	{Title: "Counterparty", X: 335, MaxChars: 20},
+	{Title: "Amount", X: 480, Right: true},
+	{Title: "Balance", X: marginRight, Right: true},
+}
+
+type pdfPage struct {
+	content bytes.Buffer
+}
+
+func (p *pdfPage) text(font string, size float64, x, y float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font, num(size), num(x), num(y), pdfEscape(s))
+}
+
+func (p *pdfPage) textRight(font string, size float64, right, y float64, s string) {
+	p.text(font, size, right-textWidth(s, size), y, s)
+}
+
+func (p *pdfPage) rule(y float64, gray float64) {
+	fmt.Fprintf(&p.content, "%s G 0.5 w %d %s m %d %s l S\n", num(gray), marginLeft, num(y), marginRight, num(y))
+}
+
+// RenderPDF lays the statement out as a PDF document.
+func RenderPDF(doc *Document) []byte {
+	money := func(amount int64) string { return currency.FormatAmount(amount, doc.Currency) }
+
+	var pages []*pdfPage
+	var page *pdfPage
+	var y float64
+
+	tableHeader := func() {
+		for _, col := range pdfColumns {
+			if col.Right {
+				page.textRight(fontBold, bodySize, col.X, y, col.Title)
+			} else {
+				page.text(fontBold, bodySize, col.X, y, col.Title)
+			}
+		}
+		page.rule(y-4, 0.4)
+		y -= rowHeight + 2
+	}
+	newPage := func() {
+		page = &pdfPage{}
+		pages = append(pages, page)
+		y = marginTop
+	}
+	row := func(font string, cells []string) {
+		if y < marginBottom {
+			newPage()
+			tableHeader()
+		}
+		for i, col := range pdfColumns {
+			cell := truncate(cells[i], col.MaxChars)
+			if col.Right {
+				page.textRight(font, bodySize, col.X, y, cell)
+			} else {
+				page.text(font, bodySize, col.X, y, cell)
+			}
+		}
+		page.rule(y-4, 0.85)
+		y -= rowHeight
+	}
+
+	newPage()
+	page.text(fontBold, 18, marginLeft, y, "Dinero Account Statement")
+	y -= 22
+	page.text(fontRegular, 10, marginLeft, y, fmt.Sprintf("%s - %s wallet - %s", doc.AccountName, doc.Currency, doc.Period))
+	y -= 14
+	page.text(fontRegular, 10, marginLeft, y, fmt.Sprintf("%s to %s (exclusive, UTC), generated %s",
+		doc.From.UTC().Format("2006-01-02"), doc.To.UTC().Format("2006-01-02"),
+		doc.GeneratedAt.UTC().Format("2006-01-02 15:04 MST")))
+	y -= 28
+
+	summary := []struct {
+		label  string
+		amount int64
+	}{
+		{"Opening balance", doc.OpeningBalance},
+		{"Money in", doc.TotalIn},
+		{"Money out", doc.TotalOut},
+		{"Fees", doc.TotalFees},
+		{"Closing balance", doc.ClosingBalance},
+	}
+	for i, item := range summary {
+		font := fontRegular
+		if i == len(summary)-1 {
+			font = fontBold
+		}
+		page.text(font, 10, marginLeft, y, item.label)
+		page.textRight(font, 10, 260, y, money(item.amount)+" "+doc.Currency)
+		y -= 14
+	}
+	y -= 20
+
+	tableHeader()
+	row(fontRegular, []string{doc.From.UTC().Format("2006-01-02"), "", "Opening balance", "", "", money(doc.OpeningBalance)})
+	for _, line := range doc.Lines {
+		row(fontRegular, []string{
+			line.Date.UTC().Format("2006-01-02"),
+			kindLabel(line.Kind),
+			line.Description,
+			line.Counterparty,
+			money(line.Amount),
+			money(line.Balance),
+		})
+	}
+	row(fontBold, []string{doc.To.UTC().Format("2006-01-02"), "", "Closing balance", "", "", money(doc.ClosingBalance)})
+
+	for i, p := range pages {
+		p.text(fontRegular, 8, marginLeft, 30, fmt.Sprintf("Dinero statement %s %s", doc.Period, doc.Currency))
+		p.textRight(fontRegular, 8, marginRight, 30, fmt.Sprintf("Page %d of %d", i+1, len(pages)))
+	}
+	return writePDF(pages)
+}
+
+// writePDF assembles the objects of the document and its cross-reference
+// table. Objects 1 to 4 are the catalog, page tree and fonts; each page
+// then takes two objects, the page and its content stream.
+func writePDF(pages []*pdfPage) []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfEscape encodes s as the body of a PDF literal string in WinAnsi.
+// Characters outside Latin-1 are shown as '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// textWidth approximates the width of s in Helvetica, which is only needed
+// for right-aligning amounts and so only knows the characters in them.
+func textWidth(s string, size float64) float64 {
+	var units float64
+	for _, r := range s {
+		switch r {
+		case '.', ',', ' ':
+			units += 278
+		case '-':
+			units += 333
+		default:
+			units += 556
+		}
+	}
+	return units * size / 1000
+}
+
+func truncate(s string, max int) string {
+	if max == 0 {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-3]) + "..."
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,158 @@
+package statement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/export"
+	"paytm/internal/ledger"
+	"paytm/internal/models"
+)
+
+const periodLayout = "2006-01"
+
+var (
+	ErrPeriodOpen    = errors.New("statement period has not ended yet")
+	ErrNotReconciled = errors.New("statement does not reconcile with the ledger")
+)
+
+// Document is everything a statement shows: the export statement header,
+// its lines and the month's totals.
+type Document struct {
+	*export.Statement
+	Period    string
+	Lines     []export.Line
+	TotalIn   int64
+	TotalOut  int64
+	TotalFees int64
+}
+
+// ParsePeriod parses a YYYY-MM month and returns its bounds in UTC.
+func ParsePeriod(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(periodLayout, period, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("period must be a YYYY-MM month: %w", err)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// PreviousPeriod is the last month that has fully ended at now.
+func PreviousPeriod(now time.Time) string {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0).Format(periodLayout)
+}
+
+// collector keeps the lines export.Stream produces.
+type collector struct {
+	doc *Document
+}
+
+func (c *collector) ContentType() string             { return "" }
+func (c *collector) Extension() string               { return "" }
+func (c *collector) Begin(s *export.Statement) error { return nil }
+func (c *collector) End(s *export.Statement) error   { return nil }
+
+func (c *collector) Line(l *export.Line) error {
+	c.doc.Lines = append(c.doc.Lines, *l)
+	switch {
+	case l.Kind == export.LineFee:
+		c.doc.TotalFees -= l.Amount
+	case l.Amount >= 0:
+		c.doc.TotalIn += l.Amount
+	default:
+		c.doc.TotalOut -= l.Amount
+	}
+	return nil
+}
+
+// Build assembles the statement of the user's wallet in currencyCode for a
+// month from its posted transactions. The closing balance it arrives at
+// must match the ledger, otherwise ErrNotReconciled is returned.
+func Build(db *gorm.DB, user *models.User, currencyCode, period string) (*Document, error) {
+	start, end, err := ParsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if end.After(time.Now()) {
+		return nil, ErrPeriodOpen
+	}
+
+	doc := &Document{Period: period}
+	s, err := export.Stream(db, user, currencyCode, start, end, &collector{doc: doc}, nil)
+	if err != nil {
+		return nil, err
+	}
+	doc.Statement = s
+
+	ledgerClosing, err := ledger.BalanceAt(db, user.ID, currencyCode, end)
+	if err != nil {
+		return nil, err
+	}
+	if ledgerClosing != s.ClosingBalance {
+		return nil, fmt.Errorf("%w: %s %s for user %d closes at %d from transactions but %d on the ledger",
+			ErrNotReconciled, currencyCode, period, user.ID, s.ClosingBalance, ledgerClosing)
+	}
+	return doc, nil
+}
+
+// Generate builds, renders and stores a statement. An existing statement
+// for the same month is returned as is unless regenerate is set.
+func Generate(db *gorm.DB, user *models.User, currencyCode, period string, regenerate bool) (*models.AccountStatement, bool, error) {
+	if !regenerate {
+		var existing models.AccountStatement
+		err := db.Where("user_id = ? AND currency = ? AND period = ?", user.ID, currencyCode, period).
+			First(&existing).Error
+		if err == nil {
+			return &existing, false, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, fmt.Errorf("failed to look up statement: %w", err)
+		}
+	}
+
+	doc, err := Build(db, user, currencyCode, period)
+	if err != nil {
+		return nil, false, err
+	}
+
+	html, err := RenderHTML(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	pdf := RenderPDF(doc)
+	sum := sha256.Sum256(pdf)
+
+	stored := models.AccountStatement{
+		UserID:         user.ID,
+		Currency:       currencyCode,
+		Period:         period,
+		PeriodStart:    doc.From,
+		PeriodEnd:      doc.To,
+		OpeningBalance: doc.OpeningBalance,
+		ClosingBalance: doc.ClosingBalance,
+		TotalIn:        doc.TotalIn,
+		TotalOut:       doc.TotalOut,
+		TotalFees:      doc.TotalFees,
+		LineCount:      len(doc.Lines),
+		HTML:           string(html),
+		PDF:            pdf,
+		Checksum:       hex.EncodeToString(sum[:]),
+		GeneratedAt:    doc.GeneratedAt,
+	}
+	if err := db.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "currency"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"period_start", "period_end", "opening_balance", "closing_balance", "total_in", "total_out",
+			"total_fees", "line_count", "html", "pdf", "checksum", "generated_at", "updated_at", "deleted_at",
+		}),
+	}).Create(&stored).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to store statement: %w", err)
+	}
+	return &stored, true, nil
+}
@@ -0,0 +1,217 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+
+	"paytm/internal/events"
+	"paytm/internal/models"
+	"paytm/internal/outbox"
+)
+
+// notifyChannel is the Postgres channel the PostgresBroker announces
+// published events on.
+const notifyChannel = "dinero_events"
+
+// Broker carries events published by the outbox relay to the streaming
+// connections of every server instance. The relay only runs on one instance
+// at a time, so the broker is what lets the others see its events.
+type Broker interface {
+	outbox.Publisher
+
+	// Subscribe returns a channel of events for this instance, closed when
+	// the subscriber falls too far behind, and a function to unsubscribe.
+	Subscribe(buffer int) (<-chan *events.Event, func())
+
+	// Run does whatever background work the broker needs until ctx ends.
+	Run(ctx context.Context) error
+
+	// Shutdown tells the streams served from this broker to close. Streams
+	// never finish on their own, so the server calls it when it starts
+	// shutting down instead of waiting them out.
+	Shutdown()
+
+	// Done is closed once Shutdown has been called.
+	Done() <-chan struct{}
+}
+
+// closer implements Shutdown and Done for the brokers.
+type closer struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func newCloser() closer {
+	return closer{done: make(chan struct{})}
+}
+
+func (c *closer) Shutdown() {
+	c.once.Do(func() { close(c.done) })
+}
+
+func (c *closer) Done() <-chan struct{} {
+	return c.done
+}
+
+// MemoryBroker fans events out within a single instance. It is enough when
+// only one server runs.
+type MemoryBroker struct {
+	*outbox.MemoryPublisher
+	closer
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{MemoryPublisher: outbox.NewMemoryPublisher(1), closer: newCloser()}
+}
+
+func (b *MemoryBroker) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// PostgresBroker announces each published event's outbox sequence with
+// NOTIFY. Every instance LISTENs, loads the event from the outbox and fans
+// it out to its own subscribers, so no extra infrastructure is needed.
+type PostgresBroker struct {
+	db       *gorm.DB
+	local    *outbox.MemoryPublisher
+	lastSeen uint
+	closer
+}
+
+func NewPostgresBroker(db *gorm.DB) *PostgresBroker {
+	return &PostgresBroker{db: db, local: outbox.NewMemoryPublisher(1), closer: newCloser()}
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, event *events.Event) error {
+	if event.Sequence == 0 {
+		return fmt.Errorf("event %s has no outbox sequence", event.ID)
+	}
+	return b.db.WithContext(ctx).
+		Exec("SELECT pg_notify(?, ?)", notifyChannel, strconv.FormatUint(uint64(event.Sequence), 10)).Error
+}
+
+func (b *PostgresBroker) Subscribe(buffer int) (<-chan *events.Event, func()) {
+	return b.local.Subscribe(buffer)
+}
+
+// Run listens for notifications until ctx ends, reconnecting with backoff
+// when the connection drops.
+func (b *PostgresBroker) Run(ctx context.Context) error {
+	backoff := time.Second
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("❌ Stream broker lost its Postgres listener, retrying in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (b *PostgresBroker) listen(ctx context.Context) error {
+	sqlDB, err := b.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unsupported driver connection %T", driverConn)
+		}
+		pgConn := stdConn.Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return err
+		}
+		// The connection goes back to the pool afterwards; stop listening
+		// so it does not keep collecting notifications there.
+		defer pgConn.Exec(context.Background(), "UNLISTEN "+notifyChannel)
+		log.Printf("✅ Stream broker listening on %s", notifyChannel)
+
+		// Catch up on anything published while we were not listening.
+		if b.lastSeen > 0 {
+			if err := b.catchUp(ctx); err != nil {
+				return err
+			}
+		}
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			sequence, err := strconv.ParseUint(notification.Payload, 10, 32)
+			if err != nil {
+				log.Printf("⚠️ Stream broker ignoring notification %q", notification.Payload)
+				continue
+			}
+			if err := b.forward(ctx, uint(sequence)); err != nil {
+				log.Printf("❌ Stream broker failed to forward event %d: %v", sequence, err)
+			}
+		}
+	})
+}
+
+func (b *PostgresBroker) catchUp(ctx context.Context) error {
+	var rows []models.OutboxEvent
+	if err := b.db.WithContext(ctx).
+		Where("id > ? AND published_at IS NOT NULL", b.lastSeen).
+		Order("id").Limit(1000).Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to catch up from %d: %w", b.lastSeen, err)
+	}
+	for i := range rows {
+		b.deliver(ctx, &rows[i])
+	}
+	return nil
+}
+
+func (b *PostgresBroker) forward(ctx context.Context, sequence uint) error {
+	var row models.OutboxEvent
+	if err := b.db.WithContext(ctx).First(&row, sequence).Error; err != nil {
+		return err
+	}
+	b.deliver(ctx, &row)
+	return nil
+}
+
+func (b *PostgresBroker) deliver(ctx context.Context, row *models.OutboxEvent) {
+	event, err := outbox.Decode(row)
+	if err != nil {
+		log.Printf("❌ Stream broker failed to decode event %d: %v", row.ID, err)
+		return
+	}
+	if row.ID > b.lastSeen {
+		b.lastSeen = row.ID
+	}
+	b.local.Publish(ctx, event)
+}
+
+// NewBrokerFromEnv picks the broker named by STREAM_BROKER: "postgres" for
+// deployments with several instances, otherwise the in-memory broker.
+func NewBrokerFromEnv(db *gorm.DB) Broker {
+	if os.Getenv("STREAM_BROKER") == "postgres" {
+		return NewPostgresBroker(db)
+	}
+	return NewMemoryBroker()
+}
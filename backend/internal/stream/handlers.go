@@ -0,0 +1,306 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/events"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/outbox"
+	"paytm/internal/transaction"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	retryMillis       = 3000
+	subscriberBuffer  = 64
+
+	// maxReplay is how many missed events a reconnecting client is sent.
+	// A client further behind than that is told to resync instead.
+	maxReplay = 500
+
+	// recentlySent is how many sequences a session remembers to skip events
+	// it has already sent. It covers a full replay plus what arrives live
+	// while the replay runs.
+	recentlySent = 2 * maxReplay
+)
+
+// Frame names sent on the stream in addition to the event types.
+const (
+	frameBalanceUpdated   = "balance.updated"
+	frameTransferReceived = "transfer.received"
+	frameResync           = "resync"
+)
+
+// StreamHandler streams the user's events over Server-Sent Events. Each
+// event carries its outbox sequence as the SSE id, so a client that
+// reconnects with Last-Event-ID (or ?last_event_id=) is sent what it missed.
+//
+// Sequences are handed out when an event is recorded, not when its
+// transaction commits, so events are published roughly but not strictly in
+// sequence order. Sessions therefore remember which sequences they sent
+// instead of keeping a high-water mark, and replay by publication time.
+func StreamHandler(db *gorm.DB, broker Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		lastID, err := lastEventID(r)
+		if err != nil {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		// The server's write timeout is meant for ordinary requests.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.Printf("Stream for user %d cannot clear write deadline: %v", currentUser.ID, err)
+		}
+
+		// Subscribe before replaying so nothing published in between is lost;
+		// anything seen twice is skipped by sequence.
+		live, unsubscribe := broker.Subscribe(subscriberBuffer)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		s := &session{w: w, rc: rc, db: db, userID: currentUser.ID, sent: newSequenceSet(recentlySent)}
+		fmt.Fprintf(w, "retry: %d\n\n", retryMillis)
+
+		if lastID > 0 {
+			if err := s.replay(lastID); err != nil {
+				log.Printf("Stream replay for user %d failed: %v", currentUser.ID, err)
+				return
+			}
+		}
+		if err := s.sendBalance(); err != nil {
+			log.Printf("Stream for user %d closed: %v", currentUser.ID, err)
+			return
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-broker.Done():
+				// The server is shutting down; the client reconnects and
+				// resumes from its last event ID.
+				return
+			case event, ok := <-live:
+				if !ok {
+					// Dropped for falling behind; the client reconnects and
+					// resumes from its last event ID.
+					return
+				}
+				if s.sent.has(event.Sequence) || !event.Concerns(s.userID) {
+					continue
+				}
+				if err := s.sendEvent(event); err != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func lastEventID(r *http.Request) (uint, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint(id), nil
+}
+
+// sequenceSet remembers the last few sequences added to it.
+type sequenceSet struct {
+	seen  map[uint]struct{}
+	order []uint
+	next  int
+}
+
+func newSequenceSet(size int) *sequenceSet {
+	return &sequenceSet{seen: make(map[uint]struct{}, size), order: make([]uint, 0, size)}
+}
+
+func (s *sequenceSet) has(seq uint) bool {
+	_, ok := s.seen[seq]
+	return ok
+}
+
+// add remembers seq, forgetting the oldest sequence once the set is full.
+func (s *sequenceSet) add(seq uint) {
+	if s.has(seq) {
+		return
+	}
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, seq)
+	} else {
+		delete(s.seen, s.order[s.next])
+		s.order[s.next] = seq
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.seen[seq] = struct{}{}
+}
+
+type session struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	db     *gorm.DB
+	userID uint
+	sent   *sequenceSet
+}
+
+// replay sends the user's events published after the one the client last
+// saw, or a resync frame when too many were missed to replay. An event
+// whose transaction committed late has a lower sequence than events
+// published before it, so what the client missed is found by publication
+// time rather than by sequence. Only when the client's last event is not in
+// the outbox does the sequence decide.
+func (s *session) replay(lastID uint) error {
+	query := s.db.
+		Where("published_at IS NOT NULL").
+		Where("(',' || user_ids || ',') LIKE ?", "%,"+strconv.FormatUint(uint64(s.userID), 10)+",%")
+
+	var last models.OutboxEvent
+	err := s.db.Select("id", "published_at").Where("id = ? AND published_at IS NOT NULL", lastID).Take(&last).Error
+	switch {
+	case err == nil:
+		query = query.Where("published_at >= ? AND id <> ?", last.PublishedAt, last.ID)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		query = query.Where("id > ?", lastID)
+	default:
+		return fmt.Errorf("failed to load last seen event: %w", err)
+	}
+
+	var rows []models.OutboxEvent
+	if err := query.Order("published_at, id").Limit(maxReplay + 1).Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to load missed events: %w", err)
+	}
+
+	if len(rows) > maxReplay {
+		// Skip ahead; the client refetches its state and carries on from
+		// the newest event.
+		newest := rows[len(rows)-1].ID
+		s.sent.add(newest)
+		return s.write(strconv.FormatUint(uint64(newest), 10), frameResync, []byte(`{}`))
+	}
+
+	for i := range rows {
+		event, err := outbox.Decode(&rows[i])
+		if err != nil {
+			log.Printf("Stream skipping undecodable event %d: %v", rows[i].ID, err)
+			continue
+		}
+		if err := s.sendEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendEvent writes the event under the frame name the user should see it
+// as, followed by a fresh balance when it moved money.
+func (s *session) sendEvent(event *events.Event) error {
+	payload, err := event.Payload()
+	if err != nil {
+		log.Printf("Stream failed to encode event %s: %v", event.ID, err)
+		return nil
+	}
+
+	name, movedMoney := s.frameName(event)
+	if err := s.write(strconv.FormatUint(uint64(event.Sequence), 10), name, payload); err != nil {
+		return err
+	}
+	s.sent.add(event.Sequence)
+
+	if movedMoney {
+		return s.sendBalance()
+	}
+	return nil
+}
+
+// frameName maps an event to its frame name: top-ups are reported as
+// top_up.<outcome> and completed transfers to the user as
+// transfer.received. It also reports whether the event changed balances.
+func (s *session) frameName(event *events.Event) (string, bool) {
+	if !strings.HasPrefix(string(event.Type), "transaction.") {
+		return string(event.Type), false
+	}
+
+	var data events.TransactionData
+	if raw, ok := event.Data.(json.RawMessage); ok {
+		json.Unmarshal(raw, &data)
+	} else if typed, ok := event.Data.(events.TransactionData); ok {
+		data = typed
+	}
+
+	movedMoney := event.Type == events.TransactionCompleted || event.Type == events.TransactionRefunded
+	if data.SenderID == data.ReceiverID && data.SenderID != 0 {
+		return "top_up." + strings.TrimPrefix(string(event.Type), "transaction."), movedMoney
+	}
+	if event.Type == events.TransactionCompleted && data.ReceiverID == s.userID {
+		return frameTransferReceived, movedMoney
+	}
+	return string(event.Type), movedMoney
+}
+
+// sendBalance writes a balance snapshot. It carries no id so it does not
+// move the client's resume point.
+func (s *session) sendBalance() error {
+	balance, err := transaction.LoadBalance(s.db, s.userID)
+	if err != nil {
+		return fmt.Errorf("failed to load balance: %w", err)
+	}
+	data, err := json.Marshal(balance)
+	if err != nil {
+		return err
+	}
+	return s.write("", frameBalanceUpdated, data)
+}
+
+func (s *session) write(id, name string, data []byte) error {
+	var frame strings.Builder
+	if id != "" {
+		fmt.Fprintf(&frame, "id: %s\n", id)
+	}
+	fmt.Fprintf(&frame, "event: %s\n", name)
+	fmt.Fprintf(&frame, "data: %s\n\n", data)
+
+	if _, err := s.w.Write([]byte(frame.String())); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,138 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/models"
+	"paytm/internal/processor"
+)
+
+// settleTimeout bounds the capture, void and refund of one top-up,
+// retries included.
+const settleTimeout = time.Minute
+
+// settleContext detaches the capture, void and refund of a top-up from the
+// request that started it. They must run to the end even when the client
+// has gone away, or a card could be charged without the wallet being
+// credited or the charge being returned.
+func settleContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), settleTimeout)
+}
+
+// ErrCardCharge is returned, together with the processor's error, when a
+// card top-up could not be charged.
+var ErrCardCharge = errors.New("card could not be charged")
+
+// ErrCaptureUnknown is returned when the processor did not answer a
+// capture in time. The card may or may not have been charged, so the
+// authorization is neither voided nor the top-up failed: it stays pending
+// with its processor reference until it is reconciled. Capturing again is
+// safe, as processors treat a repeated capture of the same amount as one.
+var ErrCaptureUnknown = errors.New("card capture outcome unknown")
+
+// CreditFailedReason is the failure reason of a top-up whose card was
+// charged but whose wallet could not be credited, so the charge was
+// refunded.
+const CreditFailedReason = "wallet could not be credited; the card charge was refunded"
+
+// ChargeFailureReason is the failure reason recorded on a top-up whose card
+// could not be charged.
+func ChargeFailureReason(err error) string {
+	var decline *processor.DeclineError
+	switch {
+	case errors.As(err, &decline):
+		return decline.Error()
+	case errors.Is(err, processor.ErrTimeout):
+		return processor.ErrTimeout.Error()
+	}
+	return "card processor error"
+}
+
+// ChargeAmount is what a card top-up takes from the card: the amount
+// credited plus the fee.
+func ChargeAmount(txn *models.Transaction) int64 {
+	return txn.Amount + txn.Fee
+}
+
+// CaptureTopUp captures the authorization of a pending card top-up and
+// credits the wallet. When the capture fails the authorization is released,
+// the top-up is marked failed and an error wrapping ErrCardCharge is
+// returned; committing then keeps the failed attempt on record. A capture
+// that times out returns ErrCaptureUnknown instead. When the wallet cannot
+// be credited after the capture, the charge is refunded and the caller
+// must roll back and FailTopUp with CreditFailedReason.
+// Cancelling ctx does not stop the processor calls; see settleContext.
+func CaptureTopUp(ctx context.Context, tx *gorm.DB, txn *models.Transaction) error {
+	ctx, cancel := settleContext(ctx)
+	defer cancel()
+
+	p := processor.Default()
+	if err := p.Capture(ctx, txn.ProcessorReference, ChargeAmount(txn)); err != nil {
+		if errors.Is(err, processor.ErrTimeout) {
+			log.Printf("⚠️ Capture of %s for top-up %d timed out; leaving it pending for reconciliation",
+				txn.ProcessorReference, txn.ID)
+			return fmt.Errorf("%w: %w", ErrCaptureUnknown, err)
+		}
+		if voidErr := p.Void(ctx, txn.ProcessorReference); voidErr != nil {
+			log.Printf("Error voiding authorization %s of top-up %d: %v", txn.ProcessorReference, txn.ID, voidErr)
+		}
+		if err := Transition(tx, txn, models.TransactionStatusFailed, ChargeFailureReason(err)); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrCardCharge, err)
+	}
+
+	if err := ExecuteTopUp(tx, txn); err != nil {
+		RefundCapture(ctx, txn)
+		return err
+	}
+	return nil
+}
+
+// FailTopUp marks a card top-up failed in a transaction of its own, for
+// when the transaction that was settling it rolled back. The top-up is
+// reloaded first, since the rolled back attempt may have changed it in
+// memory.
+func FailTopUp(db *gorm.DB, txn *models.Transaction, reason string) {
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(txn, txn.ID).Error; err != nil {
+			return err
+		}
+		return Transition(tx, txn, models.TransactionStatusFailed, reason)
+	}); err != nil {
+		log.Printf("Error recording failed card top-up %d: %v", txn.ID, err)
+	}
+}
+
+// VoidTopUp releases the authorization of a card top-up that will not be
+// credited. Failing to release it is logged rather than returned: an
+// uncaptured authorization lapses on its own.
+func VoidTopUp(ctx context.Context, txn *models.Transaction) {
+	if txn.ProcessorReference == "" {
+		return
+	}
+	ctx, cancel := settleContext(ctx)
+	defer cancel()
+	if err := processor.Default().Void(ctx, txn.ProcessorReference); err != nil {
+		log.Printf("Error voiding authorization %s of top-up %d: %v", txn.ProcessorReference, txn.ID, err)
+	}
+}
+
+// RefundCapture returns a captured charge whose top-up could not be
+// credited. A failure here needs a person to look at it, so it is logged
+// loudly.
+func RefundCapture(ctx context.Context, txn *models.Transaction) {
+	ctx, cancel := settleContext(ctx)
+	defer cancel()
+	if err := processor.Default().Refund(ctx, txn.ProcessorReference, ChargeAmount(txn)); err != nil {
+		log.Printf("❌ Captured card charge %s of top-up %d was not credited and could not be refunded: %v",
+			txn.ProcessorReference, txn.ID, err)
+	}
+}
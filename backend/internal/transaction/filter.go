@@ -0,0 +1,249 @@
+package transaction
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/models"
+)
+
+type HistoryFilter struct {
+	From           *time.Time
+	To             *time.Time
+	Types          []string
+	PaymentMethods []string
+	Statuses       []string
+	CounterpartyID *uint
+	CardID         *uint
+	MinAmount      *int64
+	MaxAmount      *int64
+	Query          string
+	// CategoryID of 0 selects transactions the user has not categorized.
+	CategoryID *uint
+	Tags       []string
+}
+
+type Cursor struct {
+	Timestamp time.Time
+	ID        uint
+}
+
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ParseTime accepts either a full RFC 3339 timestamp or a plain date, which
+// is read as midnight UTC.
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func parseUintParam(q url.Values, name string) (*uint, error) {
+	value := q.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a positive integer", name)
+	}
+	id := uint(n)
+	return &id, nil
+}
+
+func parseAmountParam(q url.Values, name string) (*int64, error) {
+	value := q.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return &n, nil
+}
+
+func ParseHistoryFilter(q url.Values) (*HistoryFilter, error) {
+	filter := &HistoryFilter{
+		Types:          parseList(q.Get("type")),
+		PaymentMethods: parseList(q.Get("payment_method")),
+		Statuses:       parseList(q.Get("status")),
+		Query:          strings.TrimSpace(q.Get("q")),
+	}
+
+	for _, t := range filter.Types {
+		switch models.TransactionType(t) {
+		case models.TransactionSent, models.TransactionReceived, models.TransactionSelf, models.TransactionRefund:
+		default:
+			return nil, fmt.Errorf("unknown transaction type %q", t)
+		}
+	}
+
+	for _, status := range filter.Statuses {
+		if !IsValidStatus(models.TransactionStatus(status)) {
+			return nil, fmt.Errorf("unknown transaction status %q", status)
+		}
+	}
+
+	if from := q.Get("from"); from != "" {
+		t, err := ParseTime(from)
+		if err != nil {
+			return nil, fmt.Errorf("from must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		filter.From = &t
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := ParseTime(to)
+		if err != nil {
+			return nil, fmt.Errorf("to must be an RFC 3339 timestamp or YYYY-MM-DD date")
+		}
+		filter.To = &t
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+
+	var err error
+	if filter.CounterpartyID, err = parseUintParam(q, "counterparty_id"); err != nil {
+		return nil, err
+	}
+	if filter.CardID, err = parseUintParam(q, "card_id"); err != nil {
+		return nil, err
+	}
+	if filter.MinAmount, err = parseAmountParam(q, "min_amount"); err != nil {
+		return nil, err
+	}
+	if filter.MaxAmount, err = parseAmountParam(q, "max_amount"); err != nil {
+		return nil, err
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return nil, fmt.Errorf("min_amount cannot be greater than max_amount")
+	}
+	if q.Get("category_id") == "uncategorized" {
+		none := uint(0)
+		filter.CategoryID = &none
+	} else if filter.CategoryID, err = parseUintParam(q, "category_id"); err != nil {
+		return nil, fmt.Errorf("category_id must be a positive integer or uncategorized")
+	}
+	for _, tag := range parseList(q.Get("tag")) {
+		filter.Tags = append(filter.Tags, strings.ToLower(strings.TrimPrefix(tag, "#")))
+	}
+
+	return filter, nil
+}
+
+// Apply scopes a transaction query to the user and narrows it by the filter.
+// Types are read from the user's point of view: "sent" and "received" are
+// transfers leaving or reaching the user, "self" is a wallet top-up.
+func (f *HistoryFilter) Apply(query *gorm.DB, userID uint) *gorm.DB {
+	query = query.Where("(transactions.sender_id = ? OR transactions.receiver_id = ?)", userID, userID)
+
+	if len(f.Types) > 0 {
+		var clauses []string
+		var args []interface{}
+		for _, t := range f.Types {
+			switch models.TransactionType(t) {
+			case models.TransactionSent:
+				clauses = append(clauses, "(transactions.sender_id = ? AND transactions.receiver_id <> ? AND transactions.type <> ?)")
+				args = append(args, userID, userID, models.TransactionRefund)
+			case models.TransactionReceived:
+				clauses = append(clauses, "(transactions.receiver_id = ? AND transactions.sender_id <> ? AND transactions.type <> ?)")
+				args = append(args, userID, userID, models.TransactionRefund)
+			case models.TransactionSelf:
+				clauses = append(clauses, "(transactions.sender_id = ? AND transactions.receiver_id = ?)")
+				args = append(args, userID, userID)
+			case models.TransactionRefund:
+				clauses = append(clauses, "transactions.type = ?")
+				args = append(args, models.TransactionRefund)
+			}
+		}
+		query = query.Where("("+strings.Join(clauses, " OR ")+")", args...)
+	}
+
+	if f.From != nil {
+		query = query.Where("transactions.timestamp >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("transactions.timestamp < ?", *f.To)
+	}
+	if len(f.PaymentMethods) > 0 {
+		query = query.Where("transactions.payment_method IN ?", f.PaymentMethods)
+	}
+	if len(f.Statuses) > 0 {
+		query = query.Where("transactions.status IN ?", f.Statuses)
+	}
+	if f.CounterpartyID != nil {
+		query = query.Where("((transactions.sender_id = ? AND transactions.receiver_id = ?) OR (transactions.sender_id = ? AND transactions.receiver_id = ?))",
+			userID, *f.CounterpartyID, *f.CounterpartyID, userID)
+	}
+	if f.CardID != nil {
+		query = query.Where("transactions.card_id = ?", *f.CardID)
+	}
+	if f.MinAmount != nil {
+		query = query.Where("transactions.amount >= ?", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		query = query.Where("transactions.amount <= ?", *f.MaxAmount)
+	}
+	if f.Query != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Query)
+		query = query.Where("transactions.description ILIKE ?", "%"+escaped+"%")
+	}
+	if f.CategoryID != nil && *f.CategoryID == 0 {
+		query = query.Where("NOT EXISTS (SELECT 1 FROM transaction_annotations WHERE transaction_annotations.transaction_id = transactions.id AND transaction_annotations.user_id = ? AND transaction_annotations.category_id IS NOT NULL)", userID)
+	} else if f.CategoryID != nil {
+		query = query.Where("EXISTS (SELECT 1 FROM transaction_annotations WHERE transaction_annotations.transaction_id = transactions.id AND transaction_annotations.user_id = ? AND transaction_annotations.category_id = ?)", userID, *f.CategoryID)
+	}
+	// Several tags select transactions carrying all of them.
+	for _, tag := range f.Tags {
+		query = query.Where("EXISTS (SELECT 1 FROM transaction_tags WHERE transaction_tags.transaction_id = transactions.id AND transaction_tags.user_id = ? AND transaction_tags.tag = ?)", userID, tag)
+	}
+	return query
+}
+
+func (c Cursor) Encode() string {
+	raw := c.Timestamp.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &Cursor{Timestamp: ts, ID: uint(id)}, nil
+}
+
+// After restricts a newest-first query to rows strictly older than the
+// cursor. The (timestamp, id) pair is unique, so pages never skip or repeat
+// rows even when new transactions arrive between requests.
+func (c *Cursor) After(query *gorm.DB) *gorm.DB {
+	return query.Where("(transactions.timestamp, transactions.id) < (?, ?)", c.Timestamp, c.ID)
+}
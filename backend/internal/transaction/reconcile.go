@@ -0,0 +1,107 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/models"
+)
+
+const (
+	reconcileBatchSize = 100
+
+	// reconcileAfter is how long a card top-up is left to the request that
+	// authorized it. Every request settles within settleTimeout, so a top-up
+	// still pending well after that was given up on: its capture timed out,
+	// or the server stopped between authorizing and capturing it.
+	reconcileAfter = 2 * settleTimeout
+)
+
+// TopUpReconciler settles card top-ups left pending with an authorization.
+// It captures them again, which processors treat as one capture with any
+// that already went through: the wallet is credited if the card was
+// charged, and the top-up is failed and the authorization released if it
+// cannot be. Top-ups held for risk review are left to the review.
+type TopUpReconciler struct {
+	db *gorm.DB
+}
+
+func NewTopUpReconciler(db *gorm.DB) *TopUpReconciler {
+	return &TopUpReconciler{db: db}
+}
+
+func (r *TopUpReconciler) RunDue(ctx context.Context) error {
+	awaitingReview := r.db.Model(&models.RiskAssessment{}).Select("transaction_id").
+		Where("decision = ? AND review_status = ?", models.RiskDecisionHold, models.RiskReviewPending)
+
+	var ids []uint
+	if err := r.db.WithContext(ctx).Model(&models.Transaction{}).
+		Where("status = ? AND type = ? AND payment_method = ? AND processor_reference <> '' AND status_changed_at <= ?",
+			models.TransactionStatusPending, models.TransactionSelf, models.PaymentMethodCard, time.Now().Add(-reconcileAfter)).
+		Where("id NOT IN (?)", awaitingReview).
+		Order("id").Limit(reconcileBatchSize).Pluck("id", &ids).Error; err != nil {
+		return fmt.Errorf("failed to load unsettled card top-ups: %w", err)
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := r.reconcile(ctx, id); err != nil {
+			log.Printf("❌ Reconciling card top-up %d failed: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func (r *TopUpReconciler) reconcile(ctx context.Context, id uint) error {
+	tx := r.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var txn models.Transaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ?", id, models.TransactionStatusPending).
+		First(&txn).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	err := CaptureTopUp(ctx, tx, &txn)
+	switch {
+	case errors.Is(err, ErrCaptureUnknown):
+		// Still no answer; the next run asks again.
+		tx.Rollback()
+		return nil
+	case err != nil && !errors.Is(err, ErrCardCharge):
+		tx.Rollback()
+		FailTopUp(r.db, &txn, CreditFailedReason)
+		return err
+	}
+
+	if commitErr := tx.Commit().Error; commitErr != nil {
+		if err == nil {
+			RefundCapture(ctx, &txn)
+			FailTopUp(r.db, &txn, CreditFailedReason)
+		}
+		return fmt.Errorf("failed to commit reconciled top-up: %w", commitErr)
+	}
+	if err != nil {
+		log.Printf("⚠️ Reconciled card top-up %d: the card could not be charged: %v", txn.ID, err)
+	} else {
+		log.Printf("✅ Reconciled card top-up %d: wallet credited", txn.ID)
+	}
+	return nil
+}
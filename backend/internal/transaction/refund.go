@@ -0,0 +1,257 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/currency"
+	"paytm/internal/ledger"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+type RefundRequest struct {
+	Amount int64  `json:"amount,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type RefundResponse struct {
+	Refund   TransactionResponse `json:"refund"`
+	Original TransactionResponse `json:"original"`
+}
+
+// RefundTransactionHandler lets the receiver of a completed transfer send
+// all or part of it back. Omitting the amount refunds whatever remains. The
+// amount is in the currency the transfer was sent in; for cross-currency
+// transfers the receiver is debited at the original rate so the sender gets
+// back exactly what they paid.
+func RefundTransactionHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transactionID, err := strconv.ParseUint(chi.URLParam(r, "transactionID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		var req RefundRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if req.Amount < 0 {
+			http.Error(w, "Refund amount must be greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		var original models.Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&original, uint(transactionID)).Error; err != nil {
+			tx.Rollback()
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, "Transaction not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+			return
+		}
+
+		if original.ReceiverID != currentUser.ID || original.SenderID == original.ReceiverID {
+			tx.Rollback()
+			http.Error(w, "Only the receiver of a transfer can refund it", http.StatusForbidden)
+			return
+		}
+
+		if original.Type != models.TransactionSent && original.Type != models.TransactionReceived {
+			tx.Rollback()
+			http.Error(w, "Only transfers can be refunded", http.StatusBadRequest)
+			return
+		}
+
+		if original.Status != models.TransactionStatusCompleted &&
+			original.Status != models.TransactionStatusPartiallyRefunded {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("Transaction in status %q cannot be refunded", original.Status), http.StatusConflict)
+			return
+		}
+
+		remaining := original.Amount - original.RefundedAmount
+		amount := req.Amount
+		if amount == 0 {
+			amount = remaining
+		}
+		if amount > remaining {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("Refund exceeds refundable amount of %d", remaining), http.StatusBadRequest)
+			return
+		}
+
+		debit, err := refundDebit(tx, &original, amount)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error computing refund for transaction %d: %v", original.ID, err)
+			http.Error(w, "Error computing refund amount", http.StatusInternalServerError)
+			return
+		}
+		if debit <= 0 {
+			tx.Rollback()
+			http.Error(w, "Refund amount is too small to convert back", http.StatusBadRequest)
+			return
+		}
+
+		description := fmt.Sprintf("Refund for transaction #%d", original.ID)
+		if req.Reason != "" {
+			description += ": " + req.Reason
+		}
+
+		refund := models.Transaction{
+			SenderID:              currentUser.ID,
+			ReceiverID:            original.SenderID,
+			Amount:                debit,
+			Currency:              original.ReceivedCurrency,
+			ReceivedAmount:        amount,
+			ReceivedCurrency:      original.Currency,
+			Description:           description,
+			Type:                  models.TransactionRefund,
+			OriginalTransactionID: &original.ID,
+			Timestamp:             time.Now(),
+		}
+
+		if original.ExchangeRate != "" {
+			if refund.ExchangeRate, err = currency.InverseRate(original.ExchangeRate); err != nil {
+				tx.Rollback()
+				log.Printf("Error inverting rate of transaction %d: %v", original.ID, err)
+				http.Error(w, "Error computing refund amount", http.StatusInternalServerError)
+				return
+			}
+			refund.RateSource = fmt.Sprintf("transaction:%d", original.ID)
+		}
+
+		if err := CreatePending(tx, &refund); err != nil {
+			tx.Rollback()
+			log.Printf("Error creating refund for transaction %d: %v", original.ID, err)
+			http.Error(w, "Error creating refund", http.StatusInternalServerError)
+			return
+		}
+		if err := Transition(tx, &refund, models.TransactionStatusProcessing, ""); err != nil {
+			tx.Rollback()
+			log.Printf("Error processing refund %d: %v", refund.ID, err)
+			http.Error(w, "Error creating refund", http.StatusInternalServerError)
+			return
+		}
+
+		from := ledger.Leg{UserID: refund.SenderID, Currency: refund.Currency, Amount: debit}
+		to := ledger.Leg{UserID: refund.ReceiverID, Currency: refund.ReceivedCurrency, Amount: amount}
+		if _, err := ledger.Refund(tx, from, to, refund.ID, description); err != nil {
+			tx.Rollback()
+			if errors.Is(err, ledger.ErrInsufficientFunds) {
+				http.Error(w, "Insufficient balance to refund", http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error posting refund %d to ledger: %v", refund.ID, err)
+			http.Error(w, "Error updating balances", http.StatusInternalServerError)
+			return
+		}
+
+		if err := Transition(tx, &refund, models.TransactionStatusCompleted, ""); err != nil {
+			tx.Rollback()
+			log.Printf("Error completing refund %d: %v", refund.ID, err)
+			http.Error(w, "Error completing refund", http.StatusInternalServerError)
+			return
+		}
+
+		original.RefundedAmount += amount
+		next := models.TransactionStatusPartiallyRefunded
+		if original.RefundedAmount == original.Amount {
+			next = models.TransactionStatusReversed
+		}
+
+		if err := tx.Model(&models.Transaction{}).Where("id = ?", original.ID).
+			Update("refunded_amount", original.RefundedAmount).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error updating original transaction", http.StatusInternalServerError)
+			return
+		}
+		if err := Transition(tx, &original, next, refund.Description); err != nil {
+			tx.Rollback()
+			log.Printf("Error updating status of transaction %d: %v", original.ID, err)
+			http.Error(w, "Error updating original transaction", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			http.Error(w, "Error completing refund", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("✅ Refund %d issued for transaction %d: Amount=%d, Status=%s",
+			refund.ID, original.ID, amount, original.Status)
+
+		var loaded []models.Transaction
+		if err := db.Preload("Sender").Preload("Receiver").Preload("Refunds").
+			Where("id IN ?", []uint{original.ID, refund.ID}).Order("id").
+			Find(&loaded).Error; err != nil || len(loaded) != 2 {
+			http.Error(w, "Refund completed but could not be loaded", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(RefundResponse{
+			Original: newTransactionResponse(loaded[0]),
+			Refund:   newTransactionResponse(loaded[1]),
+		})
+	}
+}
+
+// refundDebit returns how much the refunder pays, in the currency they
+// received, to send amount back in the original currency. The last refund
+// takes whatever is left so rounding never leaves a remainder behind.
+func refundDebit(tx *gorm.DB, original *models.Transaction, amount int64) (int64, error) {
+	if original.ExchangeRate == "" {
+		return amount, nil
+	}
+
+	var alreadyRefunded int64
+	if err := tx.Model(&models.Transaction{}).
+		Where("original_transaction_id = ?", original.ID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&alreadyRefunded).Error; err != nil {
+		return 0, fmt.Errorf("failed to sum refunds: %w", err)
+	}
+	left := original.ReceivedAmount - alreadyRefunded
+
+	if original.RefundedAmount+amount == original.Amount {
+		return left, nil
+	}
+
+	debit, err := currency.ConvertAtRate(amount, original.Currency, original.ReceivedCurrency, original.ExchangeRate)
+	if err != nil {
+		return 0, err
+	}
+	if debit > left {
+		debit = left
+	}
+	return debit, nil
+}
@@ -0,0 +1,243 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/risk"
+)
+
+type ReviewRequest struct {
+	Note string `json:"note"`
+}
+
+type ReviewResponse struct {
+	Assessment  risk.AssessmentResponse `json:"assessment"`
+	Transaction TransactionResponse     `json:"transaction"`
+}
+
+// ApproveHeldTransactionHandler releases a transaction held by the risk
+// engine. The transfer or top-up is executed as priced when it was held; a
+// transfer the sender can no longer cover ends up failed. A payment request
+// or group settlement the transfer pays for is completed along with it.
+func ApproveHeldTransactionHandler(db *gorm.DB) http.HandlerFunc {
+	return reviewHeldTransaction(db, models.RiskReviewApproved)
+}
+
+// RejectHeldTransactionHandler cancels a transaction held by the risk
+// engine without moving any money.
+func RejectHeldTransactionHandler(db *gorm.DB) http.HandlerFunc {
+	return reviewHeldTransaction(db, models.RiskReviewRejected)
+}
+
+func reviewHeldTransaction(db *gorm.DB, outcome models.RiskReviewStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		assessmentID, err := strconv.ParseUint(chi.URLParam(r, "assessmentID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid assessment ID", http.StatusBadRequest)
+			return
+		}
+
+		var req ReviewRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+
+		reviewer, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		var assessment models.RiskAssessment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&assessment, uint(assessmentID)).Error; err != nil {
+			tx.Rollback()
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, "Assessment not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching assessment", http.StatusInternalServerError)
+			return
+		}
+		if assessment.Decision != models.RiskDecisionHold || assessment.ReviewStatus != models.RiskReviewPending {
+			tx.Rollback()
+			http.Error(w, "Assessment is not awaiting review", http.StatusConflict)
+			return
+		}
+
+		var txn models.Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&txn, assessment.TransactionID).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error fetching held transaction %d: %v", assessment.TransactionID, err)
+			http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+			return
+		}
+		if txn.Status != models.TransactionStatusPending {
+			tx.Rollback()
+			http.Error(w, "Transaction is no longer pending", http.StatusConflict)
+			return
+		}
+
+		unconfirmed := false
+		reason := "rejected in risk review"
+		if req.Note != "" {
+			reason += ": " + req.Note
+		}
+		switch {
+		case outcome == models.RiskReviewRejected:
+			err = Transition(tx, &txn, models.TransactionStatusCancelled, reason)
+		case txn.Type == models.TransactionSelf && txn.PaymentMethod == models.PaymentMethodCard:
+			// A declined capture leaves the top-up failed, which is
+			// recorded like any other outcome of the review.
+			err = CaptureTopUp(r.Context(), tx, &txn)
+			if errors.Is(err, ErrCardCharge) {
+				err = nil
+			}
+			if errors.Is(err, ErrCaptureUnknown) {
+				// The approval is recorded and the top-up stays pending;
+				// the reconciler captures it once the processor answers.
+				unconfirmed = true
+				err = nil
+			}
+			if err != nil {
+				// The charge was refunded when the wallet could not be
+				// credited.
+				tx.Rollback()
+				FailTopUp(db, &txn, CreditFailedReason)
+				log.Printf("Error reviewing held transaction %d: %v", txn.ID, err)
+				http.Error(w, "Error reviewing transaction", http.StatusInternalServerError)
+				return
+			}
+		case txn.Type == models.TransactionSelf:
+			err = ExecuteTopUp(tx, &txn)
+		default:
+			err = ExecuteTransfer(tx, &txn)
+			if errors.Is(err, ErrInsufficientBalance) {
+				err = nil
+			}
+		}
+		if err == nil && txn.Type != models.TransactionSelf {
+			err = settleHeldTransfer(tx, &txn)
+		}
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error reviewing held transaction %d: %v", txn.ID, err)
+			http.Error(w, "Error reviewing transaction", http.StatusInternalServerError)
+			return
+		}
+
+		// A captured card charge must be returned, and the top-up failed,
+		// if the review does not commit after all.
+		committed := false
+		if txn.ProcessorReference != "" && txn.Status == models.TransactionStatusCompleted {
+			defer func() {
+				if !committed {
+					RefundCapture(r.Context(), &txn)
+					FailTopUp(db, &txn, CreditFailedReason)
+				}
+			}()
+		}
+
+		if err := tx.Model(&assessment).Updates(map[string]interface{}{
+			"review_status":  outcome,
+			"reviewed_by_id": reviewer.ID,
+			"reviewed_at":    time.Now(),
+			"review_note":    req.Note,
+		}).Error; err != nil {
+			tx.Rollback()
+			log.Printf("Error recording review of assessment %d: %v", assessment.ID, err)
+			http.Error(w, "Error reviewing transaction", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Preload("Hits").First(&assessment, assessment.ID).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error fetching assessment", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Preload("Sender").Preload("Receiver").First(&txn, txn.ID).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
+			http.Error(w, "Error reviewing transaction", http.StatusInternalServerError)
+			return
+		}
+		committed = true
+		if txn.Status == models.TransactionStatusCancelled {
+			VoidTopUp(r.Context(), &txn)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if unconfirmed {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		json.NewEncoder(w).Encode(ReviewResponse{
+			Assessment:  risk.NewAssessmentResponse(assessment),
+			Transaction: newTransactionResponse(txn),
+		})
+	}
+}
+
+// settleHeldTransfer brings what a held transfer was paying for in line with
+// how its review ended. The payment request it accepts, or the group debt it
+// settles, only counts once the money has moved; a group settlement whose
+// transfer did not go through is dropped so the debt can be settled again.
+func settleHeldTransfer(tx *gorm.DB, txn *models.Transaction) error {
+	var settlements []models.GroupSettlement
+	if err := tx.Where("transaction_id = ?", txn.ID).Find(&settlements).Error; err != nil {
+		return fmt.Errorf("failed to load settlements paid by transaction %d: %w", txn.ID, err)
+	}
+	if txn.Status != models.TransactionStatusCompleted {
+		if len(settlements) == 0 {
+			return nil
+		}
+		if err := tx.Where("transaction_id = ?", txn.ID).Delete(&models.GroupSettlement{}).Error; err != nil {
+			return fmt.Errorf("failed to drop settlements paid by transaction %d: %w", txn.ID, err)
+		}
+		return nil
+	}
+
+	now := time.Now()
+	if err := tx.Model(&models.PaymentRequest{}).
+		Where("transaction_id = ? AND status = ?", txn.ID, models.PaymentRequestPending).
+		Updates(map[string]interface{}{
+			"status":       models.PaymentRequestAccepted,
+			"responded_at": &now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to accept payment request paid by transaction %d: %w", txn.ID, err)
+	}
+	for _, settlement := range settlements {
+		for userID, delta := range map[uint]int64{settlement.FromUserID: settlement.Amount, settlement.ToUserID: -settlement.Amount} {
+			if err := tx.Model(&models.ExpenseGroupMember{}).
+				Where("group_id = ? AND user_id = ?", settlement.GroupID, userID).
+				UpdateColumn("balance", gorm.Expr("balance + ?", delta)).Error; err != nil {
+				return fmt.Errorf("failed to apply settlement %d: %w", settlement.ID, err)
+			}
+		}
+	}
+	return nil
+}
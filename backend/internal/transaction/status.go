@@ -0,0 +1,201 @@
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
+	"paytm/internal/category"
+	"paytm/internal/events"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+	"paytm/internal/outbox"
+)
+
+var ErrIllegalTransition = errors.New("illegal transaction status transition")
+
+type StatusChangeResponse struct {
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type TransactionDetailResponse struct {
+	TransactionResponse
+	StatusHistory []StatusChangeResponse `json:"status_history"`
+}
+
+// transitions lists the statuses each status may move to. Failed, reversed
+// and cancelled are final.
+var transitions = map[models.TransactionStatus][]models.TransactionStatus{
+	models.TransactionStatusPending: {
+		models.TransactionStatusProcessing,
+		models.TransactionStatusFailed,
+		models.TransactionStatusCancelled,
+	},
+	models.TransactionStatusProcessing: {
+		models.TransactionStatusCompleted,
+		models.TransactionStatusFailed,
+	},
+	models.TransactionStatusCompleted: {
+		models.TransactionStatusPartiallyRefunded,
+		models.TransactionStatusReversed,
+	},
+	models.TransactionStatusPartiallyRefunded: {
+		models.TransactionStatusPartiallyRefunded,
+		models.TransactionStatusReversed,
+	},
+}
+
+func IsValidStatus(status models.TransactionStatus) bool {
+	switch status {
+	case models.TransactionStatusPending, models.TransactionStatusProcessing,
+		models.TransactionStatusCompleted, models.TransactionStatusFailed,
+		models.TransactionStatusPartiallyRefunded, models.TransactionStatusReversed,
+		models.TransactionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func CanTransition(from, to models.TransactionStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePending inserts a new transaction in the pending state and records
+// the first step of its history.
+func CreatePending(tx *gorm.DB, txn *models.Transaction) error {
+	now := time.Now()
+	txn.Status = models.TransactionStatusPending
+	txn.StatusChangedAt = &now
+	if err := tx.Create(txn).Error; err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+	if err := tx.Create(&models.TransactionStatusChange{
+		TransactionID: txn.ID,
+		ToStatus:      models.TransactionStatusPending,
+		ChangedAt:     now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record status of transaction %d: %w", txn.ID, err)
+	}
+	return nil
+}
+
+// Transition moves a transaction to a new status and records when and why.
+// The update is guarded on the status the caller last saw, so two writers
+// can never both move the same transaction out of a state.
+func Transition(tx *gorm.DB, txn *models.Transaction, to models.TransactionStatus, reason string) error {
+	from := txn.Status
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":            to,
+		"status_changed_at": now,
+	}
+	if to == models.TransactionStatusFailed {
+		updates["failure_reason"] = reason
+	}
+
+	result := tx.Model(&models.Transaction{}).
+		Where("id = ? AND status = ?", txn.ID, from).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update status of transaction %d: %w", txn.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: transaction %d is no longer %s", ErrIllegalTransition, txn.ID, from)
+	}
+
+	if err := tx.Create(&models.TransactionStatusChange{
+		TransactionID: txn.ID,
+		FromStatus:    from,
+		ToStatus:      to,
+		Reason:        reason,
+		ChangedAt:     now,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to record status of transaction %d: %w", txn.ID, err)
+	}
+
+	txn.Status = to
+	txn.StatusChangedAt = &now
+	if to == models.TransactionStatusFailed {
+		txn.FailureReason = reason
+	}
+
+	if event := events.ForTransition(txn); event != nil {
+		if err := outbox.Record(tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTransactionHandler returns one transaction the user took part in,
+// together with every status it has passed through.
+func GetTransactionHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		transactionID, err := strconv.ParseUint(chi.URLParam(r, "transactionID"), 10, 32)
+		if err != nil {
+			http.Error(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var txn models.Transaction
+		if err := db.Preload("Sender").Preload("Receiver").Preload("Refunds").
+			Preload("StatusChanges", func(db *gorm.DB) *gorm.DB {
+				return db.Order("changed_at, id")
+			}).
+			Where("id = ? AND (sender_id = ? OR receiver_id = ?)", uint(transactionID), currentUser.ID, currentUser.ID).
+			First(&txn).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, "Transaction not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+			return
+		}
+
+		response := TransactionDetailResponse{
+			TransactionResponse: newTransactionResponse(txn),
+			StatusHistory:       []StatusChangeResponse{},
+		}
+		annotations, err := category.LoadAnnotations(db, currentUser.ID, []uint{txn.ID})
+		if err != nil {
+			http.Error(w, "Error fetching transaction", http.StatusInternalServerError)
+			return
+		}
+		response.annotate(annotations[txn.ID])
+		for _, change := range txn.StatusChanges {
+			response.StatusHistory = append(response.StatusHistory, StatusChangeResponse{
+				FromStatus: string(change.FromStatus),
+				ToStatus:   string(change.ToStatus),
+				Reason:     change.Reason,
+				ChangedAt:  change.ChangedAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
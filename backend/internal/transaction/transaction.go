@@ -2,12 +2,19 @@ package transaction
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"gorm.io/gorm"
 
+	"paytm/internal/category"
+	"paytm/internal/currency"
+	"paytm/internal/ledger"
+	"paytm/internal/limits"
 	"paytm/internal/middleware"
 	"paytm/internal/models"
 )
@@ -15,6 +22,7 @@ import (
 type TransferRequest struct {
 	ReceiverID  uint   `json:"receiver_id"`
 	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency,omitempty"`
 	Description string `json:"description"`
 }
 
@@ -24,15 +32,31 @@ type AddBalanceRequest struct {
 }
 
 type TransactionResponse struct {
-	ID          uint             `json:"id"`
-	SenderID    uint             `json:"sender_id"`
-	ReceiverID  uint             `json:"receiver_id"`
-	Amount      int64            `json:"amount"`
-	Description string           `json:"description"`
-	Type        string           `json:"type"`
-	Timestamp   time.Time        `json:"timestamp"`
-	Sender      *TransactionUser `json:"sender"`
-	Receiver    TransactionUser  `json:"receiver"`
+	ID                    uint             `json:"id"`
+	SenderID              uint             `json:"sender_id"`
+	ReceiverID            uint             `json:"receiver_id"`
+	Amount                int64            `json:"amount"`
+	Currency              string           `json:"currency"`
+	ReceivedAmount        int64            `json:"received_amount"`
+	ReceivedCurrency      string           `json:"received_currency"`
+	ExchangeRate          string           `json:"exchange_rate,omitempty"`
+	Description           string           `json:"description"`
+	Type                  string           `json:"type"`
+	Status                string           `json:"status"`
+	StatusChangedAt       *time.Time       `json:"status_changed_at,omitempty"`
+	FailureReason         string           `json:"failure_reason,omitempty"`
+	Timestamp             time.Time        `json:"timestamp"`
+	Sender                *TransactionUser `json:"sender"`
+	Receiver              TransactionUser  `json:"receiver"`
+	OriginalTransactionID *uint            `json:"original_transaction_id,omitempty"`
+	RefundedAmount        int64            `json:"refunded_amount"`
+	RefundIDs             []uint           `json:"refund_ids,omitempty"`
+	ProcessorReference    string           `json:"processor_reference,omitempty"`
+
+	// Category, Tags and Note are the requesting user's own annotations.
+	Category *category.CategoryResponse `json:"category,omitempty"`
+	Tags     []string                   `json:"tags,omitempty"`
+	Note     string                     `json:"note,omitempty"`
 }
 
 type TransactionUser struct {
@@ -43,13 +67,23 @@ type TransactionUser struct {
 
 type TransactionHistoryResponse struct {
 	Transactions []TransactionResponse `json:"transactions"`
-	Total        int64                 `json:"total"`
-	Page         int                   `json:"page"`
+	Total        *int64                `json:"total,omitempty"`
+	Page         int                   `json:"page,omitempty"`
 	Limit        int                   `json:"limit"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+	HasMore      bool                  `json:"has_more"`
 }
 
 type BalanceResponse struct {
-	Balance int64 `json:"balance"`
+	Balance  int64           `json:"balance"`
+	Currency string          `json:"currency"`
+	Wallets  []WalletBalance `json:"wallets,omitempty"`
+}
+
+type WalletBalance struct {
+	Currency string `json:"currency"`
+	Balance  int64  `json:"balance"`
+	Primary  bool   `json:"primary"`
 }
 
 func SendMoneyHandler(db *gorm.DB) http.HandlerFunc {
@@ -66,16 +100,6 @@ func SendMoneyHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		if req.Amount <= 0 {
-			http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
-			return
-		}
-
-		if req.ReceiverID == currentUser.ID {
-			http.Error(w, "Cannot send money to yourself", http.StatusBadRequest)
-			return
-		}
-
 		tx := db.Begin()
 		defer func() {
 			if r := recover(); r != nil {
@@ -83,60 +107,51 @@ func SendMoneyHandler(db *gorm.DB) http.HandlerFunc {
 			}
 		}()
 
-		var sender models.User
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&sender, currentUser.ID).Error; err != nil {
+		result, err := PrepareTransfer(tx, currentUser.ID, req.ReceiverID, req.Amount, req.Currency, req.Description)
+		if err != nil {
 			tx.Rollback()
-			http.Error(w, "Sender not found", http.StatusNotFound)
+			WriteTransferError(w, err)
 			return
 		}
 
-		if sender.Balance < req.Amount {
-			tx.Rollback()
-			http.Error(w, "Insufficient balance", http.StatusBadRequest)
+		switch err := Screen(tx, &result.Transaction); {
+		case errors.Is(err, ErrBlockedByRisk):
+			if err := tx.Commit().Error; err != nil {
+				log.Printf("Error recording declined transfer: %v", err)
+			}
+			WriteTransferError(w, err)
 			return
-		}
-
-		var receiver models.User
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&receiver, req.ReceiverID).Error; err != nil {
-			tx.Rollback()
-			http.Error(w, "Receiver not found", http.StatusNotFound)
+		case errors.Is(err, ErrHeldForReview):
+			// Held transfers stay pending and move no money until reviewed.
+			if err := tx.Commit().Error; err != nil {
+				http.Error(w, "Error completing transaction", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(NewTransferResponse(result))
 			return
-		}
-
-		sender.Balance -= req.Amount
-		receiver.Balance += req.Amount
-
-		if err := tx.Save(&sender).Error; err != nil {
+		case err != nil:
 			tx.Rollback()
-			http.Error(w, "Error updating sender balance", http.StatusInternalServerError)
+			log.Printf("Error screening transfer %d: %v", result.Transaction.ID, err)
+			http.Error(w, "Error completing transaction", http.StatusInternalServerError)
 			return
 		}
 
-		if err := tx.Save(&receiver).Error; err != nil {
-			tx.Rollback()
-			http.Error(w, "Error updating receiver balance", http.StatusInternalServerError)
+		if err := ExecuteTransfer(tx, &result.Transaction); err != nil {
+			if errors.Is(err, ErrInsufficientBalance) {
+				if err := tx.Commit().Error; err != nil {
+					log.Printf("Error recording failed transfer: %v", err)
+				}
+			} else {
+				tx.Rollback()
+			}
+			WriteTransferError(w, err)
 			return
 		}
-
-		var transactionType models.TransactionType
-		if currentUser.ID == sender.ID {
-			transactionType = models.TransactionSent
-		} else {
-			transactionType = models.TransactionReceived
-		}
-
-		transaction := models.Transaction{
-			SenderID:    sender.ID,
-			ReceiverID:  receiver.ID,
-			Amount:      req.Amount,
-			Description: req.Description,
-			Type:        transactionType,
-			Timestamp:   time.Now(),
-		}
-
-		if err := tx.Create(&transaction).Error; err != nil {
+		if err := result.reload(tx); err != nil {
 			tx.Rollback()
-			http.Error(w, "Error creating transaction", http.StatusInternalServerError)
+			WriteTransferError(w, err)
 			return
 		}
 
@@ -145,30 +160,14 @@ func SendMoneyHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		response := TransactionResponse{
-			ID:          transaction.ID,
-			SenderID:    transaction.SenderID,
-			ReceiverID:  transaction.ReceiverID,
-			Amount:      transaction.Amount,
-			Description: transaction.Description,
-			Timestamp:   transaction.Timestamp,
-			Sender: &TransactionUser{
-				ID:    sender.ID,
-				Name:  sender.Name,
-				Email: sender.Email,
-			},
-			Receiver: TransactionUser{
-				ID:    receiver.ID,
-				Name:  receiver.Name,
-				Email: receiver.Email,
-			},
-		}
-
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		json.NewEncoder(w).Encode(NewTransferResponse(result))
 	}
 }
 
+// GetTransactionHistoryHandler pages through the user's transactions newest
+// first. Clients pass the returned next_cursor to fetch the following page;
+// the legacy page parameter is still honoured and also returns the total.
 func GetTransactionHistoryHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		currentUser, ok := middleware.GetUserFromContext(r)
@@ -177,73 +176,78 @@ func GetTransactionHistoryHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		page := 1
-		if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-				page = p
-			}
+		q := r.URL.Query()
+
+		filter, err := ParseHistoryFilter(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		limit := 10
-		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limitStr := q.Get("limit"); limitStr != "" {
 			if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
 				limit = l
 			}
 		}
 
-		offset := (page - 1) * limit
+		query := filter.Apply(db.Model(&models.Transaction{}), currentUser.ID)
+		response := TransactionHistoryResponse{Limit: limit}
 
-		var transactions []models.Transaction
-		var total int64
+		if cursorStr := q.Get("cursor"); cursorStr != "" {
+			cursor, err := DecodeCursor(cursorStr)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			query = cursor.After(query)
+		} else if pageStr := q.Get("page"); pageStr != "" {
+			page := 1
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				page = p
+			}
 
-		db.Model(&models.Transaction{}).
-			Where("sender_id = ? OR receiver_id = ? OR (sender_id IS NULL AND receiver_id = ?)", currentUser.ID, currentUser.ID, currentUser.ID).
-			Count(&total)
+			var total int64
+			if err := filter.Apply(db.Model(&models.Transaction{}), currentUser.ID).Count(&total).Error; err != nil {
+				http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+				return
+			}
+			response.Page = page
+			response.Total = &total
+			query = query.Offset((page - 1) * limit)
+		}
 
-		if err := db.Preload("Sender").Preload("Receiver").
-			Where("sender_id = ? OR receiver_id = ? OR (sender_id IS NULL AND receiver_id = ?)", currentUser.ID, currentUser.ID, currentUser.ID).
-			Order("timestamp DESC").
-			Limit(limit).
-			Offset(offset).
+		var transactions []models.Transaction
+		if err := query.Preload("Sender").Preload("Receiver").Preload("Refunds").
+			Order("transactions.timestamp DESC, transactions.id DESC").
+			Limit(limit + 1).
 			Find(&transactions).Error; err != nil {
 			http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
 			return
 		}
 
-		var transactionResponses []TransactionResponse
-		for _, transaction := range transactions {
-			var senderInfo *TransactionUser
-			if transaction.Sender != nil && transaction.Sender.ID != 0 {
-				senderInfo = &TransactionUser{
-					ID:    transaction.Sender.ID,
-					Name:  transaction.Sender.Name,
-					Email: transaction.Sender.Email,
-				}
-			}
+		if len(transactions) > limit {
+			transactions = transactions[:limit]
+			response.HasMore = true
+			last := transactions[len(transactions)-1]
+			response.NextCursor = Cursor{Timestamp: last.Timestamp, ID: last.ID}.Encode()
+		}
 
-			response := TransactionResponse{
-				ID:          transaction.ID,
-				SenderID:    transaction.SenderID,
-				ReceiverID:  transaction.ReceiverID,
-				Amount:      transaction.Amount,
-				Description: transaction.Description,
-				Type:        string(transaction.Type),
-				Timestamp:   transaction.Timestamp,
-				Sender:      senderInfo,
-				Receiver: TransactionUser{
-					ID:    transaction.Receiver.ID,
-					Name:  transaction.Receiver.Name,
-					Email: transaction.Receiver.Email,
-				},
-			}
-			transactionResponses = append(transactionResponses, response)
+		ids := make([]uint, 0, len(transactions))
+		for _, transaction := range transactions {
+			ids = append(ids, transaction.ID)
+		}
+		annotations, err := category.LoadAnnotations(db, currentUser.ID, ids)
+		if err != nil {
+			log.Printf("Error fetching annotations for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+			return
 		}
 
-		response := TransactionHistoryResponse{
-			Transactions: transactionResponses,
-			Total:        total,
-			Page:         page,
-			Limit:        limit,
+		for _, transaction := range transactions {
+			item := newTransactionResponse(transaction)
+			item.annotate(annotations[transaction.ID])
+			response.Transactions = append(response.Transactions, item)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -251,6 +255,57 @@ func GetTransactionHistoryHandler(db *gorm.DB) http.HandlerFunc {
 	}
 }
 
+func newTransactionResponse(transaction models.Transaction) TransactionResponse {
+	var senderInfo *TransactionUser
+	if transaction.Sender != nil && transaction.Sender.ID != 0 {
+		senderInfo = &TransactionUser{
+			ID:    transaction.Sender.ID,
+			Name:  transaction.Sender.Name,
+			Email: transaction.Sender.Email,
+		}
+	}
+
+	response := TransactionResponse{
+		ID:                    transaction.ID,
+		SenderID:              transaction.SenderID,
+		ReceiverID:            transaction.ReceiverID,
+		Amount:                transaction.Amount,
+		Currency:              transaction.Currency,
+		ReceivedAmount:        transaction.ReceivedAmount,
+		ReceivedCurrency:      transaction.ReceivedCurrency,
+		ExchangeRate:          transaction.ExchangeRate,
+		Description:           transaction.Description,
+		Type:                  string(transaction.Type),
+		Status:                string(transaction.Status),
+		StatusChangedAt:       transaction.StatusChangedAt,
+		FailureReason:         transaction.FailureReason,
+		Timestamp:             transaction.Timestamp,
+		Sender:                senderInfo,
+		OriginalTransactionID: transaction.OriginalTransactionID,
+		RefundedAmount:        transaction.RefundedAmount,
+		ProcessorReference:    transaction.ProcessorReference,
+		Receiver: TransactionUser{
+			ID:    transaction.Receiver.ID,
+			Name:  transaction.Receiver.Name,
+			Email: transaction.Receiver.Email,
+		},
+	}
+	for _, refund := range transaction.Refunds {
+		response.RefundIDs = append(response.RefundIDs, refund.ID)
+	}
+	return response
+}
+
+// annotate adds the user's category, tags and note, if any.
+func (r *TransactionResponse) annotate(annotation *category.Annotation) {
+	if annotation == nil {
+		return
+	}
+	r.Category = annotation.Category
+	r.Tags = annotation.Tags
+	r.Note = annotation.Note
+}
+
 func GetBalanceHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		currentUser, ok := middleware.GetUserFromContext(r)
@@ -259,21 +314,49 @@ func GetBalanceHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		var user models.User
-		if err := db.First(&user, currentUser.ID).Error; err != nil {
-			http.Error(w, "User not found", http.StatusNotFound)
+		response, err := LoadBalance(db, currentUser.ID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Error fetching balance for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error fetching balance", http.StatusInternalServerError)
 			return
 		}
 
-		response := BalanceResponse{
-			Balance: user.Balance,
-		}
-
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
 }
 
+// LoadBalance returns the user's primary balance together with every
+// wallet they hold.
+func LoadBalance(db *gorm.DB, userID uint) (*BalanceResponse, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	wallets, err := ledger.Wallets(db, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch wallets for user %d: %w", user.ID, err)
+	}
+
+	response := &BalanceResponse{
+		Balance:  user.Balance,
+		Currency: user.Currency,
+	}
+	for _, wallet := range wallets {
+		response.Wallets = append(response.Wallets, WalletBalance{
+			Currency: wallet.Currency,
+			Balance:  wallet.Balance,
+			Primary:  wallet.Currency == user.Currency,
+		})
+	}
+	return response, nil
+}
+
 func AddBalanceHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req AddBalanceRequest
@@ -300,33 +383,51 @@ func AddBalanceHandler(db *gorm.DB) http.HandlerFunc {
 			}
 		}()
 
-		var user models.User
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&user, currentUser.ID).Error; err != nil {
+		if err := limits.CheckTopUp(tx, currentUser.ID, req.Amount, currentUser.Currency); err != nil {
 			tx.Rollback()
-			http.Error(w, "User not found", http.StatusNotFound)
+			var limitErr *limits.Error
+			if errors.As(err, &limitErr) {
+				limits.WriteError(w, limitErr)
+				return
+			}
+			if errors.Is(err, currency.ErrRateUnavailable) {
+				http.Error(w, fmt.Sprintf("No exchange rate available to check limits for %s", currentUser.Currency), http.StatusUnprocessableEntity)
+				return
+			}
+			log.Printf("Error checking top-up limits for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error checking limits", http.StatusInternalServerError)
 			return
 		}
 
-		user.Balance += req.Amount
-
-		if err := tx.Save(&user).Error; err != nil {
+		transaction := models.Transaction{
+			SenderID:         currentUser.ID,
+			ReceiverID:       currentUser.ID,
+			Amount:           req.Amount,
+			Currency:         currentUser.Currency,
+			ReceivedAmount:   req.Amount,
+			ReceivedCurrency: currentUser.Currency,
+			Type:             "self",
+			Description:      "Balance added: " + req.Description,
+			Timestamp:        time.Now(),
+		}
+
+		if err := CreatePending(tx, &transaction); err != nil {
 			tx.Rollback()
-			http.Error(w, "Error updating balance", http.StatusInternalServerError)
+			log.Printf("Error creating top-up for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating transaction record", http.StatusInternalServerError)
 			return
 		}
-
-		transaction := models.Transaction{
-			SenderID:    user.ID,
-			ReceiverID:  user.ID,
-			Amount:      req.Amount,
-			Type:        "self",
-			Description: "Balance added: " + req.Description,
-			Timestamp:   time.Now(),
+		if err := ExecuteTopUp(tx, &transaction); err != nil {
+			tx.Rollback()
+			log.Printf("Error executing top-up %d: %v", transaction.ID, err)
+			http.Error(w, "Error updating balance", http.StatusInternalServerError)
+			return
 		}
 
-		if err := tx.Create(&transaction).Error; err != nil {
+		var user models.User
+		if err := tx.First(&user, currentUser.ID).Error; err != nil {
 			tx.Rollback()
-			http.Error(w, "Error creating transaction record", http.StatusInternalServerError)
+			http.Error(w, "User not found", http.StatusNotFound)
 			return
 		}
 
@@ -336,10 +437,29 @@ func AddBalanceHandler(db *gorm.DB) http.HandlerFunc {
 		}
 
 		response := BalanceResponse{
-			Balance: user.Balance,
+			Balance:  user.Balance,
+			Currency: user.Currency,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// ExecuteTopUp credits a pending top-up to the user's wallet, from the card
+// funding account for card top-ups and the manual top-up account otherwise.
+func ExecuteTopUp(tx *gorm.DB, txn *models.Transaction) error {
+	kind, source := models.JournalEntryTopUp, ledger.AccountManualTopUp
+	if txn.PaymentMethod == models.PaymentMethodCard {
+		kind, source = models.JournalEntryCardTopUp, ledger.AccountCardFunding
+	}
+
+	if err := Transition(tx, txn, models.TransactionStatusProcessing, ""); err != nil {
+		return err
+	}
+	if _, err := ledger.TopUp(tx, kind, txn.ReceiverID, txn.Currency, source,
+		txn.Amount, txn.Fee, txn.ID, txn.Description); err != nil {
+		return fmt.Errorf("failed to post top-up %d to ledger: %w", txn.ID, err)
+	}
+	return Transition(tx, txn, models.TransactionStatusCompleted, "")
+}
@@ -0,0 +1,269 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/budget"
+	"paytm/internal/currency"
+	"paytm/internal/ledger"
+	"paytm/internal/limits"
+	"paytm/internal/models"
+	"paytm/internal/risk"
+)
+
+var (
+	ErrInvalidAmount       = errors.New("amount must be greater than 0")
+	ErrSelfTransfer        = errors.New("cannot send money to yourself")
+	ErrSenderNotFound      = errors.New("sender not found")
+	ErrReceiverNotFound    = errors.New("receiver not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrUnknownCurrency     = errors.New("unknown currency")
+	ErrRateUnavailable     = errors.New("exchange rate unavailable")
+	ErrBlockedByRisk       = errors.New("declined by risk checks")
+	ErrHeldForReview       = errors.New("held for risk review")
+)
+
+type TransferResult struct {
+	Transaction models.Transaction
+	Sender      models.User
+	Receiver    models.User
+}
+
+// Transfer moves money between two wallets inside the caller's database
+// transaction. The caller owns Begin/Commit so the transfer can be combined
+// atomically with other writes, such as settling a payment request.
+//
+// The amount is debited from the sender's wallet in currencyCode, or in the
+// sender's primary currency when it is empty, and credited to the receiver's
+// primary currency wallet, converted at the current rate if they differ.
+//
+// The transfer is screened like one sent directly: a blocked transfer is
+// marked failed and returned with ErrBlockedByRisk, and a held one stays
+// pending and is returned with ErrHeldForReview, moving no money until it is
+// approved. Otherwise the transaction moves from pending through processing
+// to completed. When the sender cannot cover it, it is marked failed and
+// returned together with ErrInsufficientBalance. In all three cases
+// committing keeps the transaction on record.
+func Transfer(tx *gorm.DB, senderID, receiverID uint, amount int64, currencyCode, description string) (*TransferResult, error) {
+	result, err := PrepareTransfer(tx, senderID, receiverID, amount, currencyCode, description)
+	if err != nil {
+		return nil, err
+	}
+	if err := Screen(tx, &result.Transaction); err != nil {
+		if errors.Is(err, ErrBlockedByRisk) || errors.Is(err, ErrHeldForReview) {
+			return result, err
+		}
+		return nil, err
+	}
+	if err := ExecuteTransfer(tx, &result.Transaction); err != nil {
+		if errors.Is(err, ErrInsufficientBalance) {
+			return result, err
+		}
+		return nil, err
+	}
+	if err := result.reload(tx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// PrepareTransfer validates and prices a transfer, checks it against the
+// sender's and receiver's limits and records it as pending. No money moves
+// until ExecuteTransfer, which leaves room to screen the transfer first.
+func PrepareTransfer(tx *gorm.DB, senderID, receiverID uint, amount int64, currencyCode, description string) (*TransferResult, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if senderID == receiverID {
+		return nil, ErrSelfTransfer
+	}
+
+	var result TransferResult
+	if err := tx.First(&result.Sender, senderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSenderNotFound
+		}
+		return nil, fmt.Errorf("failed to load sender %d: %w", senderID, err)
+	}
+	if err := tx.First(&result.Receiver, receiverID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrReceiverNotFound
+		}
+		return nil, fmt.Errorf("failed to load receiver %d: %w", receiverID, err)
+	}
+
+	if currencyCode == "" {
+		currencyCode = result.Sender.Currency
+	}
+	currencyCode, err := currency.Normalize(currencyCode)
+	if err != nil {
+		return nil, ErrUnknownCurrency
+	}
+
+	conversion, err := currency.Convert(currency.DefaultProvider(), amount, currencyCode, result.Receiver.Currency)
+	if err != nil {
+		if errors.Is(err, currency.ErrRateUnavailable) || errors.Is(err, currency.ErrUnknownCurrency) {
+			return nil, fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+		}
+		return nil, fmt.Errorf("failed to convert %s to %s: %w", currencyCode, result.Receiver.Currency, err)
+	}
+	if conversion.Converted <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	if err := limits.CheckTransfer(tx, result.Sender.ID, result.Receiver.ID,
+		amount, conversion.From, conversion.Converted, conversion.To); err != nil {
+		if errors.Is(err, currency.ErrRateUnavailable) {
+			return nil, fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+		}
+		return nil, err
+	}
+
+	result.Transaction = models.Transaction{
+		SenderID:         result.Sender.ID,
+		ReceiverID:       result.Receiver.ID,
+		Amount:           amount,
+		Currency:         conversion.From,
+		ReceivedAmount:   conversion.Converted,
+		ReceivedCurrency: conversion.To,
+		ExchangeRate:     conversion.Rate,
+		RateSource:       conversion.Source,
+		Description:      description,
+		Type:             models.TransactionSent,
+		Timestamp:        time.Now(),
+	}
+	if err := CreatePending(tx, &result.Transaction); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Screen runs a pending transfer past the risk engine. A blocked transfer is
+// marked failed and ErrBlockedByRisk returned; a held one is left pending for
+// review and ErrHeldForReview returned. Nil means it may go ahead.
+func Screen(tx *gorm.DB, txn *models.Transaction) error {
+	assessment, err := risk.DefaultEngine().Assess(tx, risk.EventFor(txn))
+	if err != nil {
+		return fmt.Errorf("failed to screen transfer %d: %w", txn.ID, err)
+	}
+
+	switch assessment.Decision {
+	case models.RiskDecisionBlock:
+		if err := Transition(tx, txn, models.TransactionStatusFailed, ErrBlockedByRisk.Error()); err != nil {
+			return fmt.Errorf("failed to decline transfer %d: %w", txn.ID, err)
+		}
+		return ErrBlockedByRisk
+	case models.RiskDecisionHold:
+		return ErrHeldForReview
+	}
+	return nil
+}
+
+// ExecuteTransfer posts a pending transfer to the ledger at the amounts and
+// rate it was priced at, then checks the sender's budgets. When the sender
+// cannot cover it the transaction is marked failed and
+// ErrInsufficientBalance is returned.
+func ExecuteTransfer(tx *gorm.DB, txn *models.Transaction) error {
+	if err := Transition(tx, txn, models.TransactionStatusProcessing, ""); err != nil {
+		return err
+	}
+
+	// Post behind a savepoint so a rejected transfer can be undone on its
+	// own and recorded as failed instead of vanishing with the rollback.
+	if err := tx.SavePoint("ledger_post").Error; err != nil {
+		return fmt.Errorf("failed to create savepoint for transfer %d: %w", txn.ID, err)
+	}
+	from := ledger.Leg{UserID: txn.SenderID, Currency: txn.Currency, Amount: txn.Amount}
+	to := ledger.Leg{UserID: txn.ReceiverID, Currency: txn.ReceivedCurrency, Amount: txn.ReceivedAmount}
+	if _, err := ledger.Transfer(tx, from, to, txn.ID, txn.Description); err != nil {
+		if !errors.Is(err, ledger.ErrInsufficientFunds) {
+			return fmt.Errorf("failed to post transfer %d to ledger: %w", txn.ID, err)
+		}
+		if err := tx.RollbackTo("ledger_post").Error; err != nil {
+			return fmt.Errorf("failed to undo ledger posting of transfer %d: %w", txn.ID, err)
+		}
+		if err := Transition(tx, txn, models.TransactionStatusFailed, ErrInsufficientBalance.Error()); err != nil {
+			return err
+		}
+		return ErrInsufficientBalance
+	}
+
+	if err := Transition(tx, txn, models.TransactionStatusCompleted, ""); err != nil {
+		return err
+	}
+	return budget.Evaluate(tx, txn)
+}
+
+// reload refreshes both parties so their balances reflect the transfer.
+// TransferCurrency resolves the currency of a transfer that is agreed now and
+// paid later, such as a payment request or a schedule: code, or fallback when
+// code is empty. It must be one the rate provider quotes, or the transfer
+// could not be priced when it runs. The result is stored with the record so
+// the amount keeps its meaning if the payer switches wallets in between.
+func TransferCurrency(code, fallback string) (string, error) {
+	if code == "" {
+		code = fallback
+	}
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return "", ErrUnknownCurrency
+	}
+	if _, err := currency.DefaultProvider().Rate(code, currency.Default); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRateUnavailable, err)
+	}
+	return code, nil
+}
+
+func (r *TransferResult) reload(tx *gorm.DB) error {
+	if err := tx.First(&r.Sender, r.Sender.ID).Error; err != nil {
+		return fmt.Errorf("failed to reload sender %d: %w", r.Sender.ID, err)
+	}
+	if err := tx.First(&r.Receiver, r.Receiver.ID).Error; err != nil {
+		return fmt.Errorf("failed to reload receiver %d: %w", r.Receiver.ID, err)
+	}
+	return nil
+}
+
+func WriteTransferError(w http.ResponseWriter, err error) {
+	var limitErr *limits.Error
+	if errors.As(err, &limitErr) {
+		limits.WriteError(w, limitErr)
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrInvalidAmount):
+		http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
+	case errors.Is(err, ErrSelfTransfer):
+		http.Error(w, "Cannot send money to yourself", http.StatusBadRequest)
+	case errors.Is(err, ErrInsufficientBalance):
+		http.Error(w, "Insufficient balance", http.StatusBadRequest)
+	case errors.Is(err, ErrUnknownCurrency):
+		http.Error(w, "Currency must be an ISO 4217 code", http.StatusBadRequest)
+	case errors.Is(err, ErrRateUnavailable):
+		http.Error(w, "No exchange rate available for this currency pair", http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrBlockedByRisk):
+		http.Error(w, "Transfer declined by risk checks", http.StatusForbidden)
+	case errors.Is(err, ErrSenderNotFound):
+		http.Error(w, "Sender not found", http.StatusNotFound)
+	case errors.Is(err, ErrReceiverNotFound):
+		http.Error(w, "Receiver not found", http.StatusNotFound)
+	default:
+		log.Printf("Error processing transfer: %v", err)
+		http.Error(w, "Error completing transaction", http.StatusInternalServerError)
+	}
+}
+
+func NewTransferResponse(result *TransferResult) TransactionResponse {
+	transaction := result.Transaction
+	transaction.Sender = &result.Sender
+	transaction.Receiver = result.Receiver
+	return newTransactionResponse(transaction)
+}
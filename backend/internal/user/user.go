@@ -2,15 +2,22 @@ package user
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"paytm/internal/currency"
+	"paytm/internal/events"
+	"paytm/internal/ledger"
 	"paytm/internal/middleware"
 	"paytm/internal/models"
+	"paytm/internal/outbox"
 )
 
 type AddFriendRequest struct {
@@ -34,6 +41,7 @@ type UpdateUserCurrencyRequest struct {
 type UpdateUserCurrencyResponse struct {
 	Message  string `json:"message"`
 	Currency string `json:"currency"`
+	Balance  int64  `json:"balance"`
 }
 
 func GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
@@ -49,6 +57,7 @@ func GetUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 		"email":         usr.Email,
 		"balance":       usr.Balance,
 		"currency":      usr.Currency,
+		"tier":          usr.Tier,
 		"auth_provider": usr.AuthProvider,
 		"avatar":        usr.Avatar,
 		"created_at":    usr.CreatedAt,
@@ -130,12 +139,16 @@ func AddFriendHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		if err := db.Model(currentUser).Association("Friends").Append(&friend); err != nil {
-			http.Error(w, "Error adding friend", http.StatusInternalServerError)
-			return
-		}
-
-		if err := db.Model(&friend).Association("Friends").Append(currentUser); err != nil {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(currentUser).Association("Friends").Append(&friend); err != nil {
+				return err
+			}
+			if err := tx.Model(&friend).Association("Friends").Append(currentUser); err != nil {
+				return err
+			}
+			return outbox.Record(tx, events.ForFriendship(events.FriendAdded, currentUser.ID, friend.ID))
+		}); err != nil {
+			log.Printf("Error adding friend %d for user %d: %v", friend.ID, currentUser.ID, err)
 			http.Error(w, "Error adding friend", http.StatusInternalServerError)
 			return
 		}
@@ -194,12 +207,16 @@ func RemoveFriendHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
-		if err := db.Model(currentUser).Association("Friends").Delete(&friend); err != nil {
-			http.Error(w, "Error removing friend", http.StatusInternalServerError)
-			return
-		}
-
-		if err := db.Model(&friend).Association("Friends").Delete(currentUser); err != nil {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(currentUser).Association("Friends").Delete(&friend); err != nil {
+				return err
+			}
+			if err := tx.Model(&friend).Association("Friends").Delete(currentUser); err != nil {
+				return err
+			}
+			return outbox.Record(tx, events.ForFriendship(events.FriendRemoved, currentUser.ID, friend.ID))
+		}); err != nil {
+			log.Printf("Error removing friend %d for user %d: %v", friend.ID, currentUser.ID, err)
 			http.Error(w, "Error removing friend", http.StatusInternalServerError)
 			return
 		}
@@ -235,6 +252,9 @@ func GetUserByIDHandler(db *gorm.DB) http.HandlerFunc {
 	}
 }
 
+// UpdateUserCurrencyHandler switches the user's primary wallet. Balances are
+// kept per currency, so switching shows the balance already held in the new
+// currency rather than relabelling the old one.
 func UpdateUserCurrencyHandler(db *gorm.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req UpdateUserCurrencyRequest
@@ -243,21 +263,73 @@ func UpdateUserCurrencyHandler(db *gorm.DB) http.HandlerFunc {
 			return
 		}
 
+		code, err := currency.Normalize(req.Currency)
+		if err != nil {
+			http.Error(w, "Currency must be an ISO 4217 code", http.StatusBadRequest)
+			return
+		}
+		// Transfers, limits and risk checks all value amounts through the
+		// rate provider, so a wallet it cannot quote would be unusable.
+		if _, err := currency.DefaultProvider().Rate(code, currency.Default); err != nil {
+			http.Error(w, fmt.Sprintf("%s is not supported: no exchange rate is available", code), http.StatusBadRequest)
+			return
+		}
+
 		currentUser, ok := middleware.GetUserFromContext(r)
 		if !ok {
 			http.Error(w, "User not found in context", http.StatusInternalServerError)
 			return
 		}
 
-		if err := db.Model(currentUser).Update("currency", req.Currency).Error; err != nil {
+		tx := db.Begin()
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
+
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, currentUser.ID).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		// Open the current wallet first so a balance from before the ledger
+		// is carried over into the currency it was held in.
+		if _, err := ledger.UserAccount(tx, user.ID, user.Currency); err != nil {
+			tx.Rollback()
+			log.Printf("Error opening %s wallet for user %d: %v", user.Currency, user.ID, err)
+			http.Error(w, "Failed to update currency", http.StatusInternalServerError)
+			return
+		}
+		wallet, err := ledger.UserAccount(tx, user.ID, code)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error opening %s wallet for user %d: %v", code, user.ID, err)
+			http.Error(w, "Failed to update currency", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"currency": code,
+			"balance":  wallet.Balance,
+		}).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, "Failed to update currency", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit().Error; err != nil {
 			http.Error(w, "Failed to update currency", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message":  "Currency updated successfully",
-			"currency": req.Currency,
+		json.NewEncoder(w).Encode(UpdateUserCurrencyResponse{
+			Message:  "Currency updated successfully",
+			Currency: code,
+			Balance:  wallet.Balance,
 		})
 	}
 }
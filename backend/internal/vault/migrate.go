@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/models"
+)
+
+const migrateBatchSize = 100
+
+// errTokenChanged rolls back a re-tokenization whose card was changed
+// concurrently.
+var errTokenChanged = errors.New("card token changed")
+
+// legacyCard is the part of the JSON that cards stored, encrypted, in
+// card_token before the vault that is still needed: the number. The CVV
+// and the rest of it are dropped.
+type legacyCard struct {
+	CardNumber string `json:"card_number"`
+}
+
+// MigrateCardTokens moves the card numbers of cards stored before the vault
+// into it and replaces their card_token, which also held the CVV, with a
+// vault token. Removed cards can never be charged again, so their card data
+// is discarded instead: they get a token the vault holds nothing for, as
+// removing a card leaves it. Only cards without a vault token are touched,
+// so it is safe to run on each start; a card that cannot be decrypted is
+// logged and left for the next run.
+func MigrateCardTokens(db *gorm.DB) error {
+	var legacy int64
+	if err := db.Unscoped().Model(&models.Card{}).
+		Where("LEFT(card_token, ?) <> ?", len(TokenPrefix), TokenPrefix).
+		Count(&legacy).Error; err != nil {
+		return fmt.Errorf("failed to count legacy card tokens: %w", err)
+	}
+	if legacy == 0 {
+		return nil
+	}
+
+	v, err := New()
+	if err != nil {
+		return err
+	}
+
+	var lastID uint
+	migrated, discarded, failed := 0, 0, 0
+	for {
+		var cards []models.Card
+		if err := db.Unscoped().Where("LEFT(card_token, ?) <> ? AND id > ?", len(TokenPrefix), TokenPrefix, lastID).
+			Order("id").Limit(migrateBatchSize).Find(&cards).Error; err != nil {
+			return fmt.Errorf("failed to load legacy card tokens: %w", err)
+		}
+
+		for i := range cards {
+			if cards[i].DeletedAt.Valid {
+				if err := discard(db, &cards[i]); err != nil {
+					if !errors.Is(err, errTokenChanged) {
+						log.Printf("❌ Could not discard the card data of removed card %d: %v", cards[i].ID, err)
+						failed++
+					}
+					continue
+				}
+				discarded++
+				continue
+			}
+			if err := v.retokenize(db, &cards[i]); err != nil {
+				if !errors.Is(err, errTokenChanged) {
+					log.Printf("❌ Could not move card %d into the card vault: %v", cards[i].ID, err)
+					failed++
+				}
+				continue
+			}
+			migrated++
+		}
+
+		if len(cards) < migrateBatchSize {
+			break
+		}
+		lastID = cards[len(cards)-1].ID
+	}
+
+	log.Printf("Moved %d card numbers into the card vault and discarded the card data of %d removed cards", migrated, discarded)
+	if failed > 0 {
+		log.Printf("Warning: %d cards still hold legacy card data and cannot be charged", failed)
+	}
+	return nil
+}
+
+func (v *Vault) retokenize(db *gorm.DB, card *models.Card) error {
+	plaintext, err := v.encryption.Decrypt(card.CardToken)
+	if err != nil {
+		return err
+	}
+	var stored legacyCard
+	if err := json.Unmarshal([]byte(plaintext), &stored); err != nil {
+		return fmt.Errorf("failed to decode card data: %w", err)
+	}
+	if stored.CardNumber == "" {
+		return fmt.Errorf("card data has no card number")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		token, err := v.Tokenize(tx, stored.CardNumber)
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Model(&models.Card{}).
+			Where("id = ? AND card_token = ?", card.ID, card.CardToken).
+			Update("card_token", token)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update card: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return errTokenChanged
+		}
+		return nil
+	})
+}
+
+// discard replaces the legacy card data of a removed card without reading
+// it.
+func discard(db *gorm.DB, card *models.Card) error {
+	result := db.Unscoped().Model(&models.Card{}).
+		Where("id = ? AND card_token = ?", card.ID, card.CardToken).
+		Update("card_token", newToken())
+	if result.Error != nil {
+		return fmt.Errorf("failed to update card: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errTokenChanged
+	}
+	return nil
+}
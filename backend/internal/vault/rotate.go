@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"paytm/internal/models"
+)
+
+const rotateBatchSize = 100
+
+// Rotator moves the card numbers in the vault, which every card's
+// card_token points to, onto the current master key. Entries from before
+// key rotation are encrypted afresh; the others only have their data key
+// rewrapped. Once no entry uses an old master key, that key can be retired.
+type Rotator struct {
+	db *gorm.DB
+}
+
+func NewRotator(db *gorm.DB) *Rotator {
+	return &Rotator{db: db}
+}
+
+func (r *Rotator) RunDue(ctx context.Context) error {
+	v, err := New()
+	if err != nil {
+		return err
+	}
+	current := v.encryption.CurrentKeyID()
+
+	var lastID uint
+	rotated := 0
+	for {
+		var entries []models.VaultEntry
+		if err := due(r.db.WithContext(ctx), current, lastID).Find(&entries).Error; err != nil {
+			return fmt.Errorf("failed to load card vault entries: %w", err)
+		}
+
+		for _, entry := range entries {
+			updates, err := v.reencrypt(entry)
+			if err != nil {
+				log.Printf("❌ Could not re-encrypt card vault entry %d: %v", entry.ID, err)
+				continue
+			}
+			// Matching on the old ciphertext keeps a concurrent rotation
+			// from being overwritten.
+			result := r.db.WithContext(ctx).Model(&models.VaultEntry{}).
+				Where("id = ? AND encrypted_pan = ?", entry.ID, entry.EncryptedPAN).
+				Updates(updates)
+			if result.Error != nil {
+				return fmt.Errorf("failed to update card vault entry %d: %w", entry.ID, result.Error)
+			}
+			rotated += int(result.RowsAffected)
+		}
+
+		if len(entries) < rotateBatchSize {
+			break
+		}
+		lastID = entries[len(entries)-1].ID
+	}
+
+	if rotated > 0 {
+		log.Printf("Re-encrypted %d card vault entries under master key %s", rotated, current)
+	}
+	return nil
+}
+
+// due selects the next batch of entries after lastID that are not under the
+// current master key.
+func due(db *gorm.DB, current string, lastID uint) *gorm.DB {
+	return db.Where("key_id <> ? AND id > ?", current, lastID).Order("id").Limit(rotateBatchSize)
+}
+
+// reencrypt returns the columns that move an entry onto the current master
+// key.
+func (v *Vault) reencrypt(entry models.VaultEntry) (map[string]interface{}, error) {
+	encrypted, err := v.encryption.Reencrypt(entry.EncryptedPAN)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"encrypted_pan": encrypted, "key_id": v.encryption.KeyID(encrypted)}, nil
+}
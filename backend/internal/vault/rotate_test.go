@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"paytm/internal/encryption"
+	"paytm/internal/models"
+)
+
+const testPAN = "4111111111111111"
+
+func testKey(b byte) []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = b + byte(i)
+	}
+	return key
+}
+
+// testVault opens a vault whose current master key is current, out of the
+// master keys "old" and "new".
+func testVault(t *testing.T, current string) *Vault {
+	t.Helper()
+	ring, err := encryption.NewKeyring("test", current, map[string][]byte{"old": testKey(1), "new": testKey(2)})
+	if err != nil {
+		t.Fatalf("NewKeyring() = %v", err)
+	}
+	encryption.SetDefaultProvider(ring)
+	v, err := New()
+	if err != nil {
+		t.Fatalf("New() = %v", err)
+	}
+	return v
+}
+
+// legacyEntry is a vault entry written before key rotation: the number
+// sealed with CARD_ENCRYPTION_KEY and no key ID.
+func legacyEntry(t *testing.T, id uint, key []byte) models.VaultEntry {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(testPAN), nil)
+	return models.VaultEntry{ID: id, EncryptedPAN: base64.StdEncoding.EncodeToString(sealed)}
+}
+
+func TestRotatorSelectsEntriesNotUnderCurrentKey(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("gorm.Open() = %v", err)
+	}
+
+	stmt := due(db, "new", 42).Find(&[]models.VaultEntry{}).Statement
+	want := `SELECT * FROM "card_vault_entries" WHERE key_id <> $1 AND id > $2 ORDER BY id LIMIT $3`
+	if got := stmt.SQL.String(); got != want {
+		t.Errorf("due() SQL = %s, want %s", got, want)
+	}
+	if want := []interface{}{"new", uint(42), rotateBatchSize}; !reflect.DeepEqual(stmt.Vars, want) {
+		t.Errorf("due() vars = %v, want %v", stmt.Vars, want)
+	}
+}
+
+func TestRotatorReencryptsEntries(t *testing.T) {
+	legacyKey := testKey(9)
+	t.Setenv("CARD_ENCRYPTION_KEY", hex.EncodeToString(legacyKey))
+
+	old := testVault(t, "old")
+	underOld, err := old.encryption.Encrypt(testPAN)
+	if err != nil {
+		t.Fatalf("Encrypt() = %v", err)
+	}
+
+	v := testVault(t, "new")
+	underNew, err := v.encryption.Encrypt(testPAN)
+	if err != nil {
+		t.Fatalf("Encrypt() = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		entry models.VaultEntry
+		// rewrapped is whether the sealed number is kept and only its data
+		// key wrapped again.
+		rewrapped bool
+	}{
+		{"under an older master key", models.VaultEntry{ID: 1, EncryptedPAN: underOld, KeyID: "old"}, true},
+		{"from before key rotation", legacyEntry(t, 2, legacyKey), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, err := v.reencrypt(tt.entry)
+			if err != nil {
+				t.Fatalf("reencrypt() = %v", err)
+			}
+			encrypted, _ := updates["encrypted_pan"].(string)
+			if updates["key_id"] != "new" || v.encryption.KeyID(encrypted) != "new" {
+				t.Errorf("reencrypt() = %v, want an entry under master key new", updates)
+			}
+			if encrypted == tt.entry.EncryptedPAN {
+				t.Error("reencrypt() left the ciphertext unchanged")
+			}
+			sealed := func(ciphertext string) string { return ciphertext[strings.LastIndex(ciphertext, ":")+1:] }
+			if tt.rewrapped && sealed(encrypted) != sealed(tt.entry.EncryptedPAN) {
+				t.Error("reencrypt() sealed the number again instead of rewrapping its data key")
+			}
+
+			pan, err := v.encryption.Decrypt(encrypted)
+			if err != nil || pan != testPAN {
+				t.Errorf("Decrypt(reencrypt()) = %q, %v, want %s", pan, err, testPAN)
+			}
+		})
+	}
+
+	updates, err := v.reencrypt(models.VaultEntry{ID: 3, EncryptedPAN: underNew, KeyID: "new"})
+	if err != nil || updates["encrypted_pan"] != underNew {
+		t.Errorf("reencrypt() of an entry under the current key = %v, %v, want it unchanged", updates, err)
+	}
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/models"
+)
+
+const (
+	batchSize = 100
+
+	// maxResponseBody is how much of a receiver's response is kept in the
+	// delivery log.
+	maxResponseBody = 1024
+
+	// maxConcurrentEndpoints is how many endpoints are sent to at once.
+	maxConcurrentEndpoints = 8
+
+	// claimLease is how long a claimed delivery is kept from other
+	// workers. It must outlast a send.
+	claimLease = 2 * time.Minute
+)
+
+// Deliverer sends queued deliveries whose next attempt is due.
+type Deliverer struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+// NewDeliverer uses client to send requests, or, when it is nil, a client
+// with a 10 second timeout that refuses to connect to internal addresses.
+func NewDeliverer(db *gorm.DB, client *http.Client) *Deliverer {
+	if client == nil {
+		client = newClient(10 * time.Second)
+	}
+	return &Deliverer{db: db, client: client}
+}
+
+func (d *Deliverer) RunDue(ctx context.Context) error {
+	var due []struct {
+		ID         uint
+		EndpointID uint
+	}
+	if err := d.db.WithContext(ctx).Model(&models.WebhookDelivery{}).Select("id, endpoint_id").
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+		Order("next_attempt_at, id").Limit(batchSize).Scan(&due).Error; err != nil {
+		return fmt.Errorf("failed to fetch due webhook deliveries: %w", err)
+	}
+
+	// Each endpoint gets its deliveries in order, one at a time, while
+	// different endpoints are sent to in parallel so a slow receiver only
+	// holds up its own deliveries.
+	var endpoints []uint
+	byEndpoint := map[uint][]uint{}
+	for _, row := range due {
+		if _, ok := byEndpoint[row.EndpointID]; !ok {
+			endpoints = append(endpoints, row.EndpointID)
+		}
+		byEndpoint[row.EndpointID] = append(byEndpoint[row.EndpointID], row.ID)
+	}
+
+	slots := make(chan struct{}, maxConcurrentEndpoints)
+	var wg sync.WaitGroup
+	for _, endpointID := range endpoints {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(ids []uint) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			for _, id := range ids {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := d.deliver(ctx, id); err != nil {
+					log.Printf("❌ Webhook delivery %d failed to process: %v", id, err)
+				}
+			}
+		}(byEndpoint[endpointID])
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// deliver claims a delivery, sends it and records the outcome. No database
+// transaction is open while the receiver is being called.
+func (d *Deliverer) deliver(ctx context.Context, id uint) error {
+	delivery, endpoint, err := d.claim(ctx, id)
+	if err != nil || delivery == nil {
+		return err
+	}
+	attempt := d.attempt(ctx, endpoint, delivery, time.Now())
+	// The attempt was made, so it is recorded even when the worker is
+	// being stopped.
+	return d.record(context.WithoutCancel(ctx), delivery, &attempt)
+}
+
+// claim locks a due delivery just long enough to push its next attempt
+// past the send, which keeps other workers away from it. If this process
+// dies while sending, the delivery is picked up again once claimLease has
+// passed. It returns a nil delivery when the delivery is no longer due.
+func (d *Deliverer) claim(ctx context.Context, id uint) (*models.WebhookDelivery, *models.WebhookEndpoint, error) {
+	var delivery models.WebhookDelivery
+	var endpoint models.WebhookEndpoint
+	err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND status = ? AND next_attempt_at <= ?", id, models.WebhookDeliveryPending, time.Now()).
+			First(&delivery).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().First(&endpoint, delivery.EndpointID).Error; err != nil {
+			return fmt.Errorf("failed to load endpoint %d: %w", delivery.EndpointID, err)
+		}
+		return tx.Model(&delivery).Update("next_attempt_at", time.Now().Add(claimLease)).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &delivery, &endpoint, nil
+}
+
+// attempt sends a claimed delivery and updates it for the outcome: done,
+// retried after backoff, or failed once MaxAttempts is reached or the
+// endpoint is gone.
+func (d *Deliverer) attempt(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery, now time.Time) models.WebhookAttempt {
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	attempt := models.WebhookAttempt{
+		DeliveryID:  delivery.ID,
+		Attempt:     delivery.Attempts,
+		AttemptedAt: now,
+	}
+
+	if !endpoint.IsActive || endpoint.DeletedAt.Valid {
+		attempt.Error = "endpoint is disabled"
+	} else {
+		attempt.StatusCode, attempt.ResponseBody, attempt.Error = d.send(ctx, endpoint, delivery)
+		attempt.DurationMs = time.Since(now).Milliseconds()
+	}
+
+	delivery.ResponseStatus = attempt.StatusCode
+	delivery.LastError = attempt.Error
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= MaxAttempts || !endpoint.IsActive || endpoint.DeletedAt.Valid:
+		delivery.Status = models.WebhookDeliveryFailed
+		log.Printf("⚠️ Webhook delivery %d to endpoint %d gave up after %d attempts: %s",
+			delivery.ID, endpoint.ID, delivery.Attempts, attempt.Error)
+	default:
+		delivery.NextAttemptAt = now.Add(retryDelay(delivery.Attempts))
+	}
+	return attempt
+}
+
+func (d *Deliverer) record(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) error {
+	return d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return fmt.Errorf("failed to record attempt: %w", err)
+		}
+		if err := tx.Omit(clause.Associations).Save(delivery).Error; err != nil {
+			return fmt.Errorf("failed to update delivery: %w", err)
+		}
+		return nil
+	})
+}
+
+// send posts the payload and reports the receiver's status and response,
+// and an error message unless it answered with a 2xx status.
+func (d *Deliverer) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) (int, string, string) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Dinero-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderEventID, delivery.EventID)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	snippet := strings.ReplaceAll(strings.ToValidUTF8(string(raw), ""), "\x00", "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, snippet, fmt.Sprintf("receiver answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, snippet, ""
+}
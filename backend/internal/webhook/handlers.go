@@ -0,0 +1,516 @@
+package webhook
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/events"
+	"paytm/internal/middleware"
+	"paytm/internal/models"
+)
+
+type EndpointRequest struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Global      *bool    `json:"global"`
+	IsActive    *bool    `json:"is_active"`
+}
+
+type EndpointResponse struct {
+	ID          uint      `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Global      bool      `json:"global"`
+	IsActive    bool      `json:"is_active"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type AttemptResponse struct {
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+	AttemptedAt  time.Time `json:"attempted_at"`
+}
+
+type DeliveryResponse struct {
+	ID             uint              `json:"id"`
+	EndpointID     uint              `json:"endpoint_id"`
+	EventID        string            `json:"event_id"`
+	EventType      string            `json:"event_type"`
+	Status         string            `json:"status"`
+	Attempts       int               `json:"attempts"`
+	NextAttemptAt  *time.Time        `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time        `json:"last_attempt_at,omitempty"`
+	ResponseStatus int               `json:"response_status,omitempty"`
+	LastError      string            `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time        `json:"delivered_at,omitempty"`
+	RedeliveryOf   *uint             `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Payload        json.RawMessage   `json:"payload,omitempty"`
+	AttemptLog     []AttemptResponse `json:"attempt_log,omitempty"`
+}
+
+type DeliveryListResponse struct {
+	Deliveries []DeliveryResponse `json:"deliveries"`
+	NextBefore uint               `json:"next_before,omitempty"`
+	HasMore    bool               `json:"has_more"`
+}
+
+func newEndpointResponse(endpoint models.WebhookEndpoint) EndpointResponse {
+	return EndpointResponse{
+		ID:          endpoint.ID,
+		URL:         endpoint.URL,
+		Events:      strings.Split(endpoint.Events, ","),
+		Description: endpoint.Description,
+		Global:      endpoint.Global,
+		IsActive:    endpoint.IsActive,
+		CreatedAt:   endpoint.CreatedAt,
+		UpdatedAt:   endpoint.UpdatedAt,
+	}
+}
+
+func newDeliveryResponse(delivery models.WebhookDelivery) DeliveryResponse {
+	response := DeliveryResponse{
+		ID:             delivery.ID,
+		EndpointID:     delivery.EndpointID,
+		EventID:        delivery.EventID,
+		EventType:      delivery.EventType,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		LastAttemptAt:  delivery.LastAttemptAt,
+		ResponseStatus: delivery.ResponseStatus,
+		LastError:      delivery.LastError,
+		DeliveredAt:    delivery.DeliveredAt,
+		RedeliveryOf:   delivery.RedeliveryOf,
+		CreatedAt:      delivery.CreatedAt,
+	}
+	if delivery.Status == models.WebhookDeliveryPending {
+		next := delivery.NextAttemptAt
+		response.NextAttemptAt = &next
+	}
+	return response
+}
+
+// normalizeEvents validates the subscribed event types and joins them for
+// storage. An empty list subscribes to everything.
+func normalizeEvents(names []string) (string, bool) {
+	if len(names) == 0 {
+		return AllEvents, true
+	}
+	seen := map[string]bool{}
+	var valid []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == AllEvents {
+			return AllEvents, true
+		}
+		if !events.IsValidType(name) {
+			return "", false
+		}
+		if !seen[name] {
+			seen[name] = true
+			valid = append(valid, name)
+		}
+	}
+	return strings.Join(valid, ","), true
+}
+
+// findEndpoint loads an endpoint the current user may manage: their own, or
+// any endpoint for admins.
+func findEndpoint(db *gorm.DB, w http.ResponseWriter, r *http.Request) (*models.WebhookEndpoint, bool) {
+	endpointID, err := strconv.ParseUint(chi.URLParam(r, "endpointID"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid endpoint ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	currentUser, ok := middleware.GetUserFromContext(r)
+	if !ok {
+		http.Error(w, "User not found in context", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	query := db.Where("id = ?", uint(endpointID))
+	if !currentUser.IsAdmin {
+		query = query.Where("user_id = ?", currentUser.ID)
+	}
+	var endpoint models.WebhookEndpoint
+	if err := query.First(&endpoint).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Webhook endpoint not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error fetching webhook endpoint", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &endpoint, true
+}
+
+func findDelivery(db *gorm.DB, w http.ResponseWriter, r *http.Request, endpoint *models.WebhookEndpoint) (*models.WebhookDelivery, bool) {
+	deliveryID, err := strconv.ParseUint(chi.URLParam(r, "deliveryID"), 10, 32)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var delivery models.WebhookDelivery
+	if err := db.Preload("AttemptLogs", func(db *gorm.DB) *gorm.DB {
+		return db.Order("attempt")
+	}).Where("id = ? AND endpoint_id = ?", uint(deliveryID), endpoint.ID).First(&delivery).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, "Error fetching delivery", http.StatusInternalServerError)
+		return nil, false
+	}
+	return &delivery, true
+}
+
+func ListEventTypesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]events.Type{"events": events.Types})
+}
+
+// CreateEndpointHandler registers an endpoint. The signing secret is only
+// returned here and when it is rotated.
+func CreateEndpointHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req EndpointRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		if req.URL == nil {
+			http.Error(w, "URL is required", http.StatusBadRequest)
+			return
+		}
+		if err := checkURL(r.Context(), *req.URL, currentUser.IsAdmin); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		subscribed, ok := normalizeEvents(req.Events)
+		if !ok {
+			http.Error(w, "Unknown event type", http.StatusBadRequest)
+			return
+		}
+		if req.Global != nil && *req.Global && !currentUser.IsAdmin {
+			http.Error(w, "Only admins can register global endpoints", http.StatusForbidden)
+			return
+		}
+
+		endpoint := models.WebhookEndpoint{
+			UserID:   currentUser.ID,
+			Global:   req.Global != nil && *req.Global,
+			URL:      *req.URL,
+			Secret:   NewSecret(),
+			Events:   subscribed,
+			IsActive: true,
+		}
+		if req.Description != nil {
+			endpoint.Description = *req.Description
+		}
+		if err := db.Omit(clause.Associations).Create(&endpoint).Error; err != nil {
+			log.Printf("Error creating webhook endpoint for user %d: %v", currentUser.ID, err)
+			http.Error(w, "Error creating webhook endpoint", http.StatusInternalServerError)
+			return
+		}
+
+		response := newEndpointResponse(endpoint)
+		response.Secret = endpoint.Secret
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func GetEndpointsHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		currentUser, ok := middleware.GetUserFromContext(r)
+		if !ok {
+			http.Error(w, "User not found in context", http.StatusUnauthorized)
+			return
+		}
+
+		var endpoints []models.WebhookEndpoint
+		if err := db.Where("user_id = ?", currentUser.ID).Order("id").Find(&endpoints).Error; err != nil {
+			http.Error(w, "Error fetching webhook endpoints", http.StatusInternalServerError)
+			return
+		}
+
+		response := []EndpointResponse{}
+		for _, endpoint := range endpoints {
+			response = append(response, newEndpointResponse(endpoint))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]EndpointResponse{"endpoints": response})
+	}
+}
+
+func GetEndpointHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newEndpointResponse(*endpoint))
+	}
+}
+
+func UpdateEndpointHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req EndpointRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+		currentUser, _ := middleware.GetUserFromContext(r)
+
+		updates := map[string]interface{}{}
+		if req.URL != nil {
+			if err := checkURL(r.Context(), *req.URL, currentUser.IsAdmin); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			updates["url"] = *req.URL
+		}
+		if req.Events != nil {
+			subscribed, ok := normalizeEvents(req.Events)
+			if !ok {
+				http.Error(w, "Unknown event type", http.StatusBadRequest)
+				return
+			}
+			updates["events"] = subscribed
+		}
+		if req.Description != nil {
+			updates["description"] = *req.Description
+		}
+		if req.Global != nil {
+			if !currentUser.IsAdmin {
+				http.Error(w, "Only admins can register global endpoints", http.StatusForbidden)
+				return
+			}
+			updates["global"] = *req.Global
+		}
+		if req.IsActive != nil {
+			updates["is_active"] = *req.IsActive
+		}
+
+		if len(updates) > 0 {
+			if err := db.Model(endpoint).Updates(updates).Error; err != nil {
+				http.Error(w, "Error updating webhook endpoint", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := db.First(endpoint, endpoint.ID).Error; err != nil {
+			http.Error(w, "Error fetching webhook endpoint", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newEndpointResponse(*endpoint))
+	}
+}
+
+// DeleteEndpointHandler removes an endpoint. Deliveries still queued for it
+// are marked failed on their next attempt.
+func DeleteEndpointHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+
+		if err := db.Delete(endpoint).Error; err != nil {
+			http.Error(w, "Error deleting webhook endpoint", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Webhook endpoint deleted"})
+	}
+}
+
+// RotateSecretHandler replaces the signing secret. Deliveries sent from now
+// on, including retries of older ones, are signed with the new secret.
+func RotateSecretHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+
+		endpoint.Secret = NewSecret()
+		if err := db.Model(endpoint).Update("secret", endpoint.Secret).Error; err != nil {
+			http.Error(w, "Error rotating secret", http.StatusInternalServerError)
+			return
+		}
+
+		response := newEndpointResponse(*endpoint)
+		response.Secret = endpoint.Secret
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetDeliveriesHandler pages through an endpoint's delivery log newest
+// first, optionally filtered by status and event type.
+func GetDeliveriesHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+
+		limit := 50
+		if raw := query.Get("limit"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 200 {
+				http.Error(w, "Limit must be between 1 and 200", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		dbQuery := db.Where("endpoint_id = ?", endpoint.ID)
+		if status := query.Get("status"); status != "" {
+			dbQuery = dbQuery.Where("status = ?", status)
+		}
+		if eventType := query.Get("event"); eventType != "" {
+			dbQuery = dbQuery.Where("event_type = ?", eventType)
+		}
+		if raw := query.Get("before"); raw != "" {
+			before, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil {
+				http.Error(w, "Invalid before", http.StatusBadRequest)
+				return
+			}
+			dbQuery = dbQuery.Where("id < ?", uint(before))
+		}
+
+		var deliveries []models.WebhookDelivery
+		if err := dbQuery.Order("id DESC").Limit(limit + 1).Find(&deliveries).Error; err != nil {
+			http.Error(w, "Error fetching deliveries", http.StatusInternalServerError)
+			return
+		}
+
+		response := DeliveryListResponse{Deliveries: []DeliveryResponse{}}
+		if len(deliveries) > limit {
+			deliveries = deliveries[:limit]
+			response.HasMore = true
+			response.NextBefore = deliveries[limit-1].ID
+		}
+		for _, delivery := range deliveries {
+			response.Deliveries = append(response.Deliveries, newDeliveryResponse(delivery))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// GetDeliveryHandler returns one delivery with its payload and every
+// attempt made to send it. What the receiver answered is only shown to
+// admins, so the log cannot be used to read responses the server fetched.
+func GetDeliveryHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+		delivery, ok := findDelivery(db, w, r, endpoint)
+		if !ok {
+			return
+		}
+
+		currentUser, _ := middleware.GetUserFromContext(r)
+
+		response := newDeliveryResponse(*delivery)
+		response.Payload = json.RawMessage(delivery.Payload)
+		for _, attempt := range delivery.AttemptLogs {
+			entry := AttemptResponse{
+				Attempt:     attempt.Attempt,
+				StatusCode:  attempt.StatusCode,
+				Error:       attempt.Error,
+				DurationMs:  attempt.DurationMs,
+				AttemptedAt: attempt.AttemptedAt,
+			}
+			if currentUser != nil && currentUser.IsAdmin {
+				entry.ResponseBody = attempt.ResponseBody
+			}
+			response.AttemptLog = append(response.AttemptLog, entry)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// RedeliverHandler queues a fresh delivery of the same event, keeping the
+// original and its attempts in the log. The receiver sees the same event ID
+// and can use it to deduplicate.
+func RedeliverHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpoint, ok := findEndpoint(db, w, r)
+		if !ok {
+			return
+		}
+		if !endpoint.IsActive {
+			http.Error(w, "Webhook endpoint is disabled", http.StatusConflict)
+			return
+		}
+		original, ok := findDelivery(db, w, r, endpoint)
+		if !ok {
+			return
+		}
+
+		delivery := models.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			EventID:       original.EventID,
+			EventType:     original.EventType,
+			Payload:       original.Payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: time.Now(),
+			RedeliveryOf:  &original.ID,
+		}
+		if err := db.Omit(clause.Associations).Create(&delivery).Error; err != nil {
+			log.Printf("Error queueing redelivery of %d: %v", original.ID, err)
+			http.Error(w, "Error queueing redelivery", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(newDeliveryResponse(delivery))
+	}
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned for webhook URLs that point into the
+// server's own network. Delivering to them would let users make the server
+// call internal services and read the answers from the delivery log.
+var ErrForbiddenTarget = errors.New("webhook URL must not point to a loopback, link-local, private or unspecified address")
+
+// forbiddenIP reports whether ip is somewhere webhooks must not be sent.
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// checkURL validates an endpoint URL and every address its host resolves
+// to. Only admins may register plain http endpoints.
+func checkURL(ctx context.Context, raw string, allowHTTP bool) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || parsed.Hostname() == "" {
+		return fmt.Errorf("URL must be an absolute https URL")
+	}
+	switch {
+	case parsed.Scheme == "https":
+	case parsed.Scheme == "http" && allowHTTP:
+	case parsed.Scheme == "http":
+		return fmt.Errorf("URL must use https")
+	default:
+		return fmt.Errorf("URL must be an absolute https URL")
+	}
+
+	host := parsed.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("URL host %s could not be resolved", host)
+	}
+	for _, addr := range addrs {
+		if forbiddenIP(addr.IP) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// guardDial refuses connections to forbidden addresses. It runs after DNS
+// resolution, on the address actually dialed, so a host that resolved to a
+// public address when the endpoint was registered cannot be rebound to an
+// internal one later.
+func guardDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || forbiddenIP(ip) {
+		return ErrForbiddenTarget
+	}
+	return nil
+}
+
+// newClient is the HTTP client deliveries are sent with: a timeout per
+// request, no proxy and no connections to internal addresses.
+func newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: guardDial}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
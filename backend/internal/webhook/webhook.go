@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"paytm/internal/events"
+	"paytm/internal/models"
+)
+
+const (
+	HeaderSignature = "X-Dinero-Signature"
+	HeaderEvent     = "X-Dinero-Event"
+	HeaderEventID   = "X-Dinero-Event-Id"
+	HeaderDelivery  = "X-Dinero-Delivery"
+
+	AllEvents = "*"
+
+	// MaxAttempts is how many times a delivery is tried before it is
+	// marked failed.
+	MaxAttempts = 10
+
+	// DefaultTolerance is how old a signature Verify accepts by default.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature timestamp outside tolerance")
+)
+
+// retryDelay is the wait before the given attempt is retried: 30 seconds
+// doubling each time, capped at six hours.
+func retryDelay(attempt int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempt && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
+
+func NewSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("webhook: failed to read random bytes: " + err.Error())
+	}
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+func computeSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the signature header for a body sent at timestamp, in the
+// form "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := timestamp.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", ts, computeSignature(secret, ts, body))
+}
+
+// Verify checks a signature header against the body, rejecting signatures
+// older than tolerance so captured requests cannot be replayed later.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			timestamp = ts
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := computeSignature(secret, timestamp, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func subscribes(endpoint *models.WebhookEndpoint, t events.Type) bool {
+	for _, name := range strings.Split(endpoint.Events, ",") {
+		name = strings.TrimSpace(name)
+		if name == AllEvents || name == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch queues an event for every active endpoint subscribed to it.
+// Endpoints that already have a delivery of the event are skipped, so an
+// event published twice is still only delivered once.
+func Dispatch(tx *gorm.DB, event *events.Event) error {
+	var endpoints []models.WebhookEndpoint
+	query := tx.Where("is_active = ?", true)
+	if len(event.UserIDs) > 0 {
+		query = query.Where("global = ? OR user_id IN ?", true, event.UserIDs)
+	} else {
+		query = query.Where("global = ?", true)
+	}
+	if err := query.Find(&endpoints).Error; err != nil {
+		return fmt.Errorf("failed to find webhook endpoints for %s: %w", event.Type, err)
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	var queued []uint
+	if err := tx.Model(&models.WebhookDelivery{}).
+		Where("event_id = ? AND redelivery_of IS NULL", event.ID).
+		Pluck("endpoint_id", &queued).Error; err != nil {
+		return fmt.Errorf("failed to check deliveries of %s: %w", event.ID, err)
+	}
+	skip := map[uint]bool{}
+	for _, id := range queued {
+		skip[id] = true
+	}
+
+	var deliveries []models.WebhookDelivery
+	var payload []byte
+	for i := range endpoints {
+		if skip[endpoints[i].ID] || !subscribes(&endpoints[i], event.Type) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = event.Payload(); err != nil {
+				return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    endpoints[i].ID,
+			EventID:       event.ID,
+			EventType:     string(event.Type),
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := tx.Omit(clause.Associations).Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to queue %s deliveries: %w", event.Type, err)
+	}
+	return nil
+}
+
+// Publisher queues webhook deliveries for events published by the outbox
+// relay.
+type Publisher struct {
+	db *gorm.DB
+}
+
+func NewPublisher(db *gorm.DB) *Publisher {
+	return &Publisher{db: db}
+}
+
+func (p *Publisher) Publish(ctx context.Context, event *events.Event) error {
+	return Dispatch(p.db.WithContext(ctx), event)
+}
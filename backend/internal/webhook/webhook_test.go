@@ -0,0 +1,239 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"paytm/internal/models"
+)
+
+const testSecret = "whsec_test"
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	body := []byte(`{"type":"transaction.completed"}`)
+	header := Sign(testSecret, time.Now(), body)
+	if err := Verify(testSecret, header, body, DefaultTolerance); err != nil {
+		t.Fatalf("Verify(Sign()) = %v, want nil", err)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	body := []byte(`{"amount":100}`)
+	now := time.Now()
+	valid := computeSignature(testSecret, now.Unix(), body)
+
+	tests := []struct {
+		name   string
+		header string
+		body   []byte
+		want   error
+	}{
+		{"tampered body", Sign(testSecret, now, body), []byte(`{"amount":999}`), ErrInvalidSignature},
+		{"wrong secret", Sign("whsec_other", now, body), body, ErrInvalidSignature},
+		{"expired timestamp", Sign(testSecret, now.Add(-DefaultTolerance-time.Minute), body), body, ErrSignatureExpired},
+		{"future timestamp", Sign(testSecret, now.Add(DefaultTolerance+time.Minute), body), body, ErrSignatureExpired},
+		{"missing timestamp", "v1=" + valid, body, ErrInvalidSignature},
+		{"missing signature", fmt.Sprintf("t=%d", now.Unix()), body, ErrInvalidSignature},
+		{"malformed timestamp", "t=abc,v1=" + valid, body, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(testSecret, tt.header, tt.body, DefaultTolerance); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAcceptsAnyOfSeveralSignatures(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now()
+	valid := computeSignature(testSecret, now.Unix(), body)
+	stale := computeSignature("whsec_rotated_out", now.Unix(), body)
+
+	for _, header := range []string{
+		fmt.Sprintf("t=%d,v1=%s,v1=%s", now.Unix(), stale, valid),
+		fmt.Sprintf("t=%d, v1=%s, v1=%s", now.Unix(), valid, stale),
+	} {
+		if err := Verify(testSecret, header, body, DefaultTolerance); err != nil {
+			t.Errorf("Verify(%q) = %v, want nil", header, err)
+		}
+	}
+
+	header := fmt.Sprintf("t=%d,v1=%s,v1=%s", now.Unix(), stale, strings.Repeat("0", len(valid)))
+	if err := Verify(testSecret, header, body, DefaultTolerance); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Verify() with no matching signature = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{9, 128 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// receiver is a local webhook receiver that answers with status and
+// remembers whether the signatures it got were valid.
+type receiver struct {
+	status    atomic.Int32
+	requests  atomic.Int32
+	badSigned atomic.Int32
+}
+
+func newReceiver(t *testing.T, status int) (*receiver, *httptest.Server) {
+	rcv := &receiver{}
+	rcv.status.Store(int32(status))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rcv.requests.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(testSecret, r.Header.Get(HeaderSignature), body, DefaultTolerance); err != nil {
+			rcv.badSigned.Add(1)
+		}
+		if r.Header.Get(HeaderEvent) != "transaction.completed" || r.Header.Get(HeaderEventID) != "evt_1" {
+			rcv.badSigned.Add(1)
+		}
+		w.WriteHeader(int(rcv.status.Load()))
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+	return rcv, srv
+}
+
+func newTestDelivery(srv *httptest.Server) (*models.WebhookEndpoint, *models.WebhookDelivery) {
+	endpoint := &models.WebhookEndpoint{URL: srv.URL, Secret: testSecret, IsActive: true}
+	endpoint.ID = 7
+	delivery := &models.WebhookDelivery{
+		EndpointID: endpoint.ID,
+		EventID:    "evt_1",
+		EventType:  "transaction.completed",
+		Payload:    `{"id":"evt_1"}`,
+		Status:     models.WebhookDeliveryPending,
+	}
+	delivery.ID = 42
+	return endpoint, delivery
+}
+
+func TestDelivererSendsSignedRequest(t *testing.T) {
+	rcv, srv := newReceiver(t, http.StatusOK)
+	d := NewDeliverer(nil, srv.Client())
+	endpoint, delivery := newTestDelivery(srv)
+
+	now := time.Now()
+	attempt := d.attempt(context.Background(), endpoint, delivery, now)
+
+	if rcv.requests.Load() != 1 || rcv.badSigned.Load() != 0 {
+		t.Fatalf("receiver got %d requests, %d badly signed", rcv.requests.Load(), rcv.badSigned.Load())
+	}
+	if attempt.Error != "" || attempt.StatusCode != http.StatusOK || attempt.ResponseBody != "ok" {
+		t.Errorf("attempt = %+v, want a 200 without error", attempt)
+	}
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.DeliveredAt == nil || delivery.Attempts != 1 {
+		t.Errorf("delivery = %s after %d attempts, want succeeded after 1", delivery.Status, delivery.Attempts)
+	}
+}
+
+func TestDelivererRetriesServerErrors(t *testing.T) {
+	_, srv := newReceiver(t, http.StatusInternalServerError)
+	d := NewDeliverer(nil, srv.Client())
+	endpoint, delivery := newTestDelivery(srv)
+
+	now := time.Now()
+	attempt := d.attempt(context.Background(), endpoint, delivery, now)
+	if attempt.StatusCode != http.StatusInternalServerError || attempt.Error == "" {
+		t.Errorf("attempt = %+v, want a failed 500", attempt)
+	}
+	if delivery.Status != models.WebhookDeliveryPending {
+		t.Fatalf("delivery status = %s, want pending", delivery.Status)
+	}
+	if want := now.Add(30 * time.Second); !delivery.NextAttemptAt.Equal(want) {
+		t.Errorf("next attempt at %s, want %s", delivery.NextAttemptAt, want)
+	}
+
+	now = now.Add(time.Minute)
+	d.attempt(context.Background(), endpoint, delivery, now)
+	if want := now.Add(time.Minute); delivery.Status != models.WebhookDeliveryPending || !delivery.NextAttemptAt.Equal(want) {
+		t.Errorf("after attempt 2: status %s, next attempt at %s, want pending at %s", delivery.Status, delivery.NextAttemptAt, want)
+	}
+}
+
+func TestDelivererGivesUpAfterMaxAttempts(t *testing.T) {
+	rcv, srv := newReceiver(t, http.StatusInternalServerError)
+	d := NewDeliverer(nil, srv.Client())
+	endpoint, delivery := newTestDelivery(srv)
+
+	now := time.Now()
+	for i := 1; i < MaxAttempts; i++ {
+		d.attempt(context.Background(), endpoint, delivery, now)
+		if delivery.Status != models.WebhookDeliveryPending {
+			t.Fatalf("attempt %d: status %s, want pending", i, delivery.Status)
+		}
+	}
+	d.attempt(context.Background(), endpoint, delivery, now)
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != MaxAttempts {
+		t.Errorf("after %d attempts: status %s, want failed", delivery.Attempts, delivery.Status)
+	}
+	if int(rcv.requests.Load()) != MaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", rcv.requests.Load(), MaxAttempts)
+	}
+}
+
+func TestDelivererRefusesInternalAddresses(t *testing.T) {
+	rcv, srv := newReceiver(t, http.StatusOK)
+	d := NewDeliverer(nil, nil)
+	endpoint, delivery := newTestDelivery(srv)
+
+	attempt := d.attempt(context.Background(), endpoint, delivery, time.Now())
+	if rcv.requests.Load() != 0 || !strings.Contains(attempt.Error, ErrForbiddenTarget.Error()) {
+		t.Errorf("attempt = %+v with %d requests, want the loopback receiver refused", attempt, rcv.requests.Load())
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		allowHTTP bool
+		ok        bool
+	}{
+		{"https://203.0.113.10/hook", false, true},
+		{"http://203.0.113.10/hook", false, false},
+		{"http://203.0.113.10/hook", true, true},
+		{"https://127.0.0.1/hook", true, false},
+		{"https://10.1.2.3/hook", true, false},
+		{"https://192.168.0.1/hook", true, false},
+		{"https://169.254.169.254/latest/meta-data", true, false},
+		{"https://0.0.0.0/", true, false},
+		{"https://[::1]/hook", true, false},
+		{"https://[fd00::1]/hook", true, false},
+		{"ftp://203.0.113.10/hook", true, false},
+		{"/relative", true, false},
+	}
+	for _, tt := range tests {
+		err := checkURL(context.Background(), tt.url, tt.allowHTTP)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkURL(%q, %v) = %v, want ok=%v", tt.url, tt.allowHTTP, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type Job func(ctx context.Context) error
+
+// Worker runs a job on a fixed interval in its own goroutine until it is
+// stopped. A run that is in progress when Stop is called is allowed to
+// finish; its context is cancelled so long operations can bail out early.
+type Worker struct {
+	name     string
+	interval time.Duration
+	job      Job
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewWorker(name string, interval time.Duration, job Job) *Worker {
+	return &Worker{name: name, interval: interval, job: job}
+}
+
+func (w *Worker) Start(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cancel != nil {
+		return
+	}
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		log.Printf("✅ %s worker started (interval %v)", w.name, w.interval)
+		for {
+			w.runOnce(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (w *Worker) runOnce(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("❌ %s worker panicked: %v", w.name, r)
+		}
+	}()
+
+	if err := w.job(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("❌ %s worker run failed: %v", w.name, err)
+	}
+}
+
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.cancel = nil
+	w.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+	log.Printf("%s worker stopped", w.name)
+}